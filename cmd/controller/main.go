@@ -23,6 +23,7 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator"
+	"github.com/Azure/karpenter-provider-azure/pkg/webhooks"
 
 	controllers "github.com/Azure/karpenter-provider-azure/pkg/controllers"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider/metrics"
@@ -54,11 +55,18 @@ func main() {
 			cloudProvider,
 		)...).
 		WithWebhooks(ctx, corewebhooks.NewWebhooks()...).
+		WithWebhooks(ctx, webhooks.NewWebhooks()...).
 		WithControllers(ctx, controllers.NewControllers(
 			ctx,
 			op.GetClient(),
+			op.GetAPIReader(),
 			aksCloudProvider,
 			op.InstanceProvider,
+			op.InstanceTypesProvider,
+			op.PricingProvider,
+			op.ImageProvider,
+			op.AZClient.SubnetsClient,
+			op.EventRecorder,
 		)...).
 		Start(ctx)
 }
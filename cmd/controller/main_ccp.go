@@ -28,6 +28,9 @@ import (
 	controllers "github.com/Azure/karpenter-provider-azure/pkg/controllers"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider/metrics"
 	corecontrollers "sigs.k8s.io/karpenter/pkg/controllers"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/webhooks/ccp"
 
 	// Note the absence of corewebhooks: these pull in knative webhook-related packages and informers in init()
 	// We don't give cluster-level roles when running in AKS managed mode, so their informers will produce errors and halt all other operations
@@ -48,6 +51,9 @@ func main() {
 	)
 
 	lo.Must0(op.AddHealthzCheck("cloud-provider", aksCloudProvider.LivenessProbe))
+	if !coreoptions.FromContext(ctx).DisableWebhook {
+		op.GetWebhookServer().Register(ccp.ValidationPath, ccp.NewValidationWebhook())
+	}
 	cloudProvider := metrics.Decorate(aksCloudProvider)
 
 	op.
@@ -62,8 +68,14 @@ func main() {
 		WithControllers(ctx, controllers.NewControllers(
 			ctx,
 			op.GetClient(),
+			op.GetAPIReader(),
 			aksCloudProvider,
 			op.InstanceProvider,
+			op.InstanceTypesProvider,
+			op.PricingProvider,
+			op.ImageProvider,
+			op.AZClient.SubnetsClient,
+			op.EventRecorder,
 		)...).
 		// WithWebhooks(ctx, corewebhooks.NewWebhooks()...).
 		Start(ctx)
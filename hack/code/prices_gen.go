@@ -119,7 +119,7 @@ func generatePricing(filePath string) {
 		resultsChan := make(chan *pricing.Provider)
 		log.Println("fetching pricing data in region", region)
 		go func(region string, resultsChan chan *pricing.Provider) {
-			pricingProvider := pricing.NewProvider(ctx, pricing.NewAPI(), region, make(chan struct{}))
+			pricingProvider := pricing.NewProvider(ctx, pricing.NewAPI("", "", ""), nil, region, make(chan struct{}))
 			attempts := 0
 			for {
 				if pricingProvider.OnDemandLastUpdated().After(updateStarted) {
@@ -0,0 +1,23 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+# The AKSNodeClass CRD shipped by the karpenter-crd chart points its conversion at the Karpenter webhook.
+# controller-gen does not generate the conversion stanza, and pkg/apis/crds keeps the CRD without it
+# (strategy None), as envtest and AKS managed mode run without webhooks.
+CRD=karpenter.azure.com_aksnodeclasses.yaml
+rm -f "charts/karpenter-crd/templates/${CRD}"
+cp "pkg/apis/crds/${CRD}" "charts/karpenter-crd/templates/${CRD}"
+cat <<'EOT' >> "charts/karpenter-crd/templates/${CRD}"
+{{- if .Values.webhook.enabled }}
+  conversion:
+    strategy: Webhook
+    webhook:
+      conversionReviewVersions:
+        - v1
+      clientConfig:
+        service:
+          name: {{ .Values.webhook.serviceName }}
+          namespace: {{ .Values.webhook.serviceNamespace | default .Release.Namespace }}
+          port: {{ .Values.webhook.port }}
+{{- end }}
+EOT
@@ -10,15 +10,21 @@ rule=$'self.all(x, x in
         "karpenter.azure.com/sku-family",
         "karpenter.azure.com/sku-version",
         "karpenter.azure.com/sku-cpu",
+        "karpenter.azure.com/sku-cpu-manufacturer",
+        "karpenter.azure.com/sku-acu",
         "karpenter.azure.com/sku-memory",
         "karpenter.azure.com/sku-accelerator",
         "karpenter.azure.com/sku-networking-accelerated",
+        "karpenter.azure.com/sku-networking-maxnics",
         "karpenter.azure.com/sku-storage-premium-capable",
         "karpenter.azure.com/sku-storage-ephemeralos-maxsize",
+        "karpenter.azure.com/sku-storage-maxdatadisks",
+        "karpenter.azure.com/sku-storage-tempdisk-size",
         "karpenter.azure.com/sku-encryptionathost-capable",
         "karpenter.azure.com/sku-gpu-name",
         "karpenter.azure.com/sku-gpu-manufacturer",
-        "karpenter.azure.com/sku-gpu-count"
+        "karpenter.azure.com/sku-gpu-count",
+        "karpenter.azure.com/sku-spot-eviction-rate"
     ]
     || !x.find("^([^/]+)").endsWith("karpenter.azure.com")
 )
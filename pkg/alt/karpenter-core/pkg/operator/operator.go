@@ -58,6 +58,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 // Unmodified; for exposing private entity only
@@ -69,11 +70,11 @@ const (
 // Source: NewOperator()
 // Modified behavior:
 // - Allow Karpenter and most components to exist on control plane, but can reach the CRs on overlay
-// - Webhooks not supported
+// - Knative webhooks not supported; the webhook server of the manager serves the webhooks registered by the caller
 // - Karpenter will not crash if CRDs are not found, but goes into a retry loop for a while
 // Modified implementations:
 // - Split the context into two: control plane and overlay
-// - Remove webhooks-related code
+// - Remove knative webhooks-related code
 // - Retry loop for getting CRDs
 // - Introduce and retrieve overlay namespace from env
 // - No profiling
@@ -102,7 +103,7 @@ func NewOperator() (context.Context, *coreoperator.Operator) {
 	}
 
 	// Webhook
-	// Unsupported -- skipping
+	// Knative webhooks unsupported -- skipping
 
 	// Client Config
 	ccPlaneConfig := lo.Must(rest.InClusterConfig())
@@ -135,6 +136,10 @@ func NewOperator() (context.Context, *coreoperator.Operator) {
 			BindAddress: fmt.Sprintf(":%d", options.FromContext(overlayCtx).MetricsPort),
 		},
 		HealthProbeBindAddress: fmt.Sprintf(":%d", options.FromContext(overlayCtx).HealthProbePort),
+		// Only started once a webhook is registered with it
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port: options.FromContext(overlayCtx).WebhookPort,
+		}),
 		BaseContext: func() context.Context {
 			ctx := context.Background()
 			ctx = knativelogging.WithLogger(ctx, logger)
@@ -0,0 +1,35 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"context"
+	"fmt"
+
+	"knative.dev/pkg/apis"
+)
+
+// v1beta1 is the hub of the AKSNodeClass conversion, the conversions to and from v1alpha2 are implemented
+// on the v1beta1 AKSNodeClass. These are never called, they only make the AKSNodeClass convertible.
+
+func (in *AKSNodeClass) ConvertTo(_ context.Context, to apis.Convertible) error {
+	return fmt.Errorf("v1alpha2 is not the hub version of the AKSNodeClass, got: %T", to)
+}
+
+func (in *AKSNodeClass) ConvertFrom(_ context.Context, from apis.Convertible) error {
+	return fmt.Errorf("v1alpha2 is not the hub version of the AKSNodeClass, got: %T", from)
+}
@@ -16,7 +16,10 @@ limitations under the License.
 
 package v1alpha2
 
-import v1 "k8s.io/api/core/v1"
+import (
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/apis"
+)
 
 // Image contains resolved image selector values utilized for node launch
 type Image struct {
@@ -30,4 +33,45 @@ type Image struct {
 
 // AKSNodeClassStatus contains the resolved state of the AKSNodeClass
 type AKSNodeClassStatus struct {
+	// Images contains the current set of images available to use
+	// for the AKSNodeClass, one per image definition of the image family
+	// +optional
+	Images []Image `json:"images,omitempty"`
+	// KubernetesVersion contains the current kubernetes version which should be
+	// used for nodes provisioned for the AKSNodeClass
+	// +optional
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// Conditions contains signals for health and readiness
+	// +optional
+	Conditions apis.Conditions `json:"conditions,omitempty"`
+}
+
+const (
+	// ConditionTypeImagesReady is set when the images of the AKSNodeClass have been resolved
+	ConditionTypeImagesReady apis.ConditionType = "ImagesReady"
+	// ConditionTypeKubernetesVersionReady is set when the kubernetes version of the cluster has been resolved
+	ConditionTypeKubernetesVersionReady apis.ConditionType = "KubernetesVersionReady"
+	// ConditionTypeSubnetReady is set when the subnet nodes are launched into has been validated
+	ConditionTypeSubnetReady apis.ConditionType = "SubnetReady"
+	// ConditionTypeIdentitiesReady is set when the identities assigned to nodes have been validated
+	ConditionTypeIdentitiesReady apis.ConditionType = "IdentitiesReady"
+)
+
+// StatusConditions returns the condition manager of the AKSNodeClass.
+// The AKSNodeClass is Ready once all of its dependent conditions are.
+func (in *AKSNodeClass) StatusConditions() apis.ConditionManager {
+	return apis.NewLivingConditionSet(
+		ConditionTypeImagesReady,
+		ConditionTypeKubernetesVersionReady,
+		ConditionTypeSubnetReady,
+		ConditionTypeIdentitiesReady,
+	).Manage(in)
+}
+
+func (in *AKSNodeClass) GetConditions() apis.Conditions {
+	return in.Status.Conditions
+}
+
+func (in *AKSNodeClass) SetConditions(conditions apis.Conditions) {
+	in.Status.Conditions = conditions
 }
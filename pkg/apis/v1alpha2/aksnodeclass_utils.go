@@ -16,9 +16,23 @@ limitations under the License.
 
 package v1alpha2
 
+import "github.com/samber/lo"
+
 func (in *AKSNodeClassSpec) GetImageVersion() string {
 	if in.ImageVersion == nil {
 		return ""
 	}
 	return *in.ImageVersion
 }
+
+func (in *AKSNodeClassSpec) IsFIPSEnabled() bool {
+	return lo.FromPtr(in.FIPSMode) == FIPSModeEnabled
+}
+
+func (in *AKSNodeClassSpec) IsKubeletOnTemporaryDisk() bool {
+	return lo.FromPtr(in.KubeletDiskType) == KubeletDiskTypeTemporary
+}
+
+func (in *AKSNodeClassSpec) IsSpotPriceCapacityOptimized() bool {
+	return lo.FromPtr(in.SpotAllocationStrategy) == SpotAllocationStrategyPriceCapacityOptimized
+}
@@ -0,0 +1,124 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/apis"
+)
+
+const (
+	// Azure limits, see https://learn.microsoft.com/en-us/azure/azure-resource-manager/management/tag-resources#limitations
+	maxTagKeyLength   = 512
+	maxTagValueLength = 256
+	// Azure allows 50 tags per resource, two of which are set by Karpenter
+	maxTags = 48
+	// invalidTagKeyCharacters are rejected by Azure in tag keys. '/' is rejected as well, but Karpenter replaces it with '_'.
+	invalidTagKeyCharacters = `<>%&?\`
+)
+
+var (
+	// RestrictedTagKeys are the tag keys Karpenter sets on the resources of every instance. Tag keys are compared
+	// after replacing '/' with '_' and case insensitively, the way Azure compares them.
+	RestrictedTagKeys = sets.New(
+		"karpenter.azure.com_cluster",
+		"karpenter.sh_nodepool",
+	)
+
+	// imageVersionRegex matches gallery image versions, MajorVersion.MinorVersion.Patch, e.g. 202405.20.0
+	imageVersionRegex = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+)
+
+func (in *AKSNodeClass) SupportedVerbs() []admissionregistrationv1.OperationType {
+	return []admissionregistrationv1.OperationType{
+		admissionregistrationv1.Create,
+		admissionregistrationv1.Update,
+	}
+}
+
+// Validate mirrors the CEL rules of the AKSNodeClass CRD, for clusters where CEL validation is not available
+func (in *AKSNodeClass) Validate(_ context.Context) (errs *apis.FieldError) {
+	return errs.Also(
+		apis.ValidateObjectMetadata(in).ViaField("metadata"),
+		in.Spec.validate().ViaField("spec"),
+	)
+}
+
+func (in *AKSNodeClassSpec) validate() (errs *apis.FieldError) {
+	return errs.Also(
+		in.validateTags().ViaField("tags"),
+		in.validateImageVersion(),
+		in.validateImageFamily(),
+	)
+}
+
+func (in *AKSNodeClassSpec) validateTags() (errs *apis.FieldError) {
+	if len(in.Tags) > maxTags {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(len(in.Tags), 0, maxTags, "length"))
+	}
+	for key, value := range in.Tags {
+		if len(key) == 0 || len(key) > maxTagKeyLength {
+			errs = errs.Also(apis.ErrInvalidKeyName(key, apis.CurrentField, fmt.Sprintf("must be between 1 and %d characters", maxTagKeyLength)))
+		}
+		if strings.ContainsAny(key, invalidTagKeyCharacters) {
+			errs = errs.Also(apis.ErrInvalidKeyName(key, apis.CurrentField, fmt.Sprintf("must not contain any of %s", invalidTagKeyCharacters)))
+		}
+		if RestrictedTagKeys.Has(strings.ToLower(strings.ReplaceAll(key, "/", "_"))) {
+			errs = errs.Also(apis.ErrInvalidKeyName(key, apis.CurrentField, "restricted"))
+		}
+		if len(value) > maxTagValueLength {
+			errs = errs.Also(apis.ErrInvalidValue(value, key, fmt.Sprintf("must be at most %d characters", maxTagValueLength)))
+		}
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateImageVersion() (errs *apis.FieldError) {
+	if in.ImageVersion != nil && !imageVersionRegex.MatchString(*in.ImageVersion) {
+		errs = errs.Also(apis.ErrInvalidValue(*in.ImageVersion, "imageVersion", "must be in the format MajorVersion.MinorVersion.Patch"))
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateImageFamily() (errs *apis.FieldError) {
+	if lo.FromPtr(in.ImageFamily) == CustomImageFamily {
+		if in.ImageID == nil {
+			errs = errs.Also(apis.ErrMissingField("imageID"))
+		}
+		if in.UserData == nil {
+			errs = errs.Also(apis.ErrMissingField("userData"))
+		}
+		if in.ImageVersion != nil {
+			errs = errs.Also(apis.ErrDisallowedFields("imageVersion"))
+		}
+		return errs
+	}
+	if in.ImageID != nil {
+		errs = errs.Also(apis.ErrDisallowedFields("imageID"))
+	}
+	if in.UserData != nil {
+		errs = errs.Also(apis.ErrDisallowedFields("userData"))
+	}
+	return errs
+}
@@ -0,0 +1,191 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2_test
+
+import (
+	"strings"
+
+	"github.com/Pallinder/go-randomdata"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+var _ = Describe("AKSNodeClass CEL/Validation", func() {
+	var nodeClass *v1alpha2.AKSNodeClass
+
+	BeforeEach(func() {
+		if env.Version.Minor() < 25 {
+			Skip("CEL Validation is for 1.25>")
+		}
+		nodeClass = &v1alpha2.AKSNodeClass{
+			ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+			Spec:       v1alpha2.AKSNodeClassSpec{},
+		}
+	})
+	It("should succeed with the defaults", func() {
+		Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+	})
+	Context("Tags", func() {
+		It("should succeed with valid tags", func() {
+			nodeClass.Spec.Tags = map[string]string{
+				"team":                   "a",
+				"example.com/owner":      "b",
+				"empty-value":            "",
+				strings.Repeat("k", 512): strings.Repeat("v", 256),
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		It("should fail on an empty tag key", func() {
+			nodeClass.Spec.Tags = map[string]string{"": "a"}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on a tag key longer than 512 characters", func() {
+			nodeClass.Spec.Tags = map[string]string{strings.Repeat("k", 513): "a"}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on a tag value longer than 256 characters", func() {
+			nodeClass.Spec.Tags = map[string]string{"team": strings.Repeat("v", 257)}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on more than 48 tags", func() {
+			nodeClass.Spec.Tags = map[string]string{}
+			for i := 0; i < 49; i++ {
+				nodeClass.Spec.Tags[randomdata.Alphanumeric(10)] = "a"
+			}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		DescribeTable("should fail on tag keys with characters Azure rejects",
+			func(key string) {
+				nodeClass.Spec.Tags = map[string]string{key: "a"}
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			},
+			Entry("<", "team<"),
+			Entry(">", "team>"),
+			Entry("%", "team%"),
+			Entry("&", "team&"),
+			Entry("?", "team?"),
+			Entry("\\", "team\\"),
+		)
+		DescribeTable("should fail on tag keys Karpenter sets",
+			func(key string) {
+				nodeClass.Spec.Tags = map[string]string{key: "a"}
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			},
+			Entry("cluster tag", "karpenter.azure.com/cluster"),
+			Entry("cluster tag as ARM tag", "karpenter.azure.com_cluster"),
+			Entry("cluster tag with different casing", "Karpenter.Azure.com/Cluster"),
+			Entry("nodepool tag", "karpenter.sh/nodepool"),
+			Entry("nodepool tag as ARM tag", "karpenter.sh_nodepool"),
+		)
+	})
+	Context("Security groups", func() {
+		It("should succeed with valid security group IDs", func() {
+			nodeClass.Spec.NetworkSecurityGroupID = lo.ToPtr("/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg")
+			nodeClass.Spec.ApplicationSecurityGroupIDs = []string{"/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg"}
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		It("should fail on a network security group ID of another resource type", func() {
+			nodeClass.Spec.NetworkSecurityGroupID = lo.ToPtr("/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg")
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on an application security group ID of another resource type", func() {
+			nodeClass.Spec.ApplicationSecurityGroupIDs = []string{"/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+	})
+	Context("Extensions", func() {
+		var extension v1alpha2.Extension
+
+		BeforeEach(func() {
+			extension = v1alpha2.Extension{
+				Name:               "AzureMonitorLinuxAgent",
+				Publisher:          "Microsoft.Azure.Monitor",
+				Type:               "AzureMonitorLinuxAgent",
+				TypeHandlerVersion: "1.0",
+				Settings:           &runtime.RawExtension{Raw: []byte(`{"enableAMA":"true"}`)},
+			}
+		})
+		It("should succeed with a valid extension", func() {
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{extension}
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		It("should fail on extensions with the same name", func() {
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{extension, extension}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on the name of the AKS billing extension", func() {
+			extension.Name = "ComputeAKSLinuxBilling"
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{extension}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on an extension without a publisher", func() {
+			extension.Publisher = ""
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{extension}
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+	})
+	Context("ImageVersion", func() {
+		It("should succeed on a valid image version", func() {
+			nodeClass.Spec.ImageVersion = lo.ToPtr("202405.20.0")
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		DescribeTable("should fail on an invalid image version",
+			func(imageVersion string) {
+				nodeClass.Spec.ImageVersion = lo.ToPtr(imageVersion)
+				Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+			},
+			Entry("empty", ""),
+			Entry("missing patch", "202405.20"),
+			Entry("prefixed", "v202405.20.0"),
+			Entry("not numeric", "latest"),
+		)
+	})
+	Context("ImageFamily", func() {
+		It("should succeed on a Custom image family with imageID and userData", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.CustomImageFamily)
+			nodeClass.Spec.ImageID = lo.ToPtr("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/images/custom")
+			nodeClass.Spec.UserData = lo.ToPtr("#!/bin/bash")
+			Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		})
+		It("should fail on a Custom image family without userData", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.CustomImageFamily)
+			nodeClass.Spec.ImageID = lo.ToPtr("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/images/custom")
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on a Custom image family with an imageVersion", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.CustomImageFamily)
+			nodeClass.Spec.ImageID = lo.ToPtr("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/images/custom")
+			nodeClass.Spec.UserData = lo.ToPtr("#!/bin/bash")
+			nodeClass.Spec.ImageVersion = lo.ToPtr("202405.20.0")
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on imageID with another image family", func() {
+			nodeClass.Spec.ImageID = lo.ToPtr("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/images/custom")
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+		It("should fail on userData with another image family", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+			nodeClass.Spec.UserData = lo.ToPtr("#!/bin/bash")
+			Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+		})
+	})
+})
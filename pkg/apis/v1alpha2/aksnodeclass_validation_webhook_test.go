@@ -0,0 +1,140 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2_test
+
+import (
+	"strings"
+
+	"github.com/Pallinder/go-randomdata"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+var _ = Describe("AKSNodeClass Webhook/Validation", func() {
+	var nodeClass *v1alpha2.AKSNodeClass
+
+	BeforeEach(func() {
+		nodeClass = &v1alpha2.AKSNodeClass{
+			ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+			Spec: v1alpha2.AKSNodeClassSpec{
+				ImageFamily: lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily),
+			},
+		}
+	})
+	It("should succeed with the defaults", func() {
+		Expect(nodeClass.Validate(ctx)).To(Succeed())
+	})
+	Context("Tags", func() {
+		It("should succeed with valid tags", func() {
+			nodeClass.Spec.Tags = map[string]string{
+				"team":                   "a",
+				"example.com/owner":      "b",
+				"empty-value":            "",
+				strings.Repeat("k", 512): strings.Repeat("v", 256),
+			}
+			Expect(nodeClass.Validate(ctx)).To(Succeed())
+		})
+		It("should fail on an empty tag key", func() {
+			nodeClass.Spec.Tags = map[string]string{"": "a"}
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+		It("should fail on a tag key longer than 512 characters", func() {
+			nodeClass.Spec.Tags = map[string]string{strings.Repeat("k", 513): "a"}
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+		It("should fail on a tag value longer than 256 characters", func() {
+			nodeClass.Spec.Tags = map[string]string{"team": strings.Repeat("v", 257)}
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+		It("should fail on more than 48 tags", func() {
+			nodeClass.Spec.Tags = map[string]string{}
+			for i := 0; i < 49; i++ {
+				nodeClass.Spec.Tags[randomdata.Alphanumeric(10)] = "a"
+			}
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+		DescribeTable("should fail on tag keys with characters Azure rejects",
+			func(key string) {
+				nodeClass.Spec.Tags = map[string]string{key: "a"}
+				Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+			},
+			Entry("<", "team<"),
+			Entry(">", "team>"),
+			Entry("%", "team%"),
+			Entry("&", "team&"),
+			Entry("?", "team?"),
+			Entry("\\", "team\\"),
+		)
+		DescribeTable("should fail on tag keys Karpenter sets",
+			func(key string) {
+				nodeClass.Spec.Tags = map[string]string{key: "a"}
+				Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+			},
+			Entry("cluster tag", "karpenter.azure.com/cluster"),
+			Entry("cluster tag as ARM tag", "karpenter.azure.com_cluster"),
+			Entry("cluster tag with different casing", "Karpenter.Azure.com/Cluster"),
+			Entry("nodepool tag", "karpenter.sh/nodepool"),
+			Entry("nodepool tag as ARM tag", "karpenter.sh_nodepool"),
+		)
+	})
+	Context("ImageVersion", func() {
+		It("should succeed on a valid image version", func() {
+			nodeClass.Spec.ImageVersion = lo.ToPtr("202405.20.0")
+			Expect(nodeClass.Validate(ctx)).To(Succeed())
+		})
+		DescribeTable("should fail on an invalid image version",
+			func(imageVersion string) {
+				nodeClass.Spec.ImageVersion = lo.ToPtr(imageVersion)
+				Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+			},
+			Entry("empty", ""),
+			Entry("missing patch", "202405.20"),
+			Entry("prefixed", "v202405.20.0"),
+			Entry("not numeric", "latest"),
+		)
+	})
+	Context("ImageFamily", func() {
+		BeforeEach(func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.CustomImageFamily)
+			nodeClass.Spec.ImageID = lo.ToPtr("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/images/custom")
+			nodeClass.Spec.UserData = lo.ToPtr("#!/bin/bash")
+		})
+		It("should succeed on a Custom image family with imageID and userData", func() {
+			Expect(nodeClass.Validate(ctx)).To(Succeed())
+		})
+		It("should fail on a Custom image family without imageID", func() {
+			nodeClass.Spec.ImageID = nil
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+		It("should fail on a Custom image family without userData", func() {
+			nodeClass.Spec.UserData = nil
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+		It("should fail on a Custom image family with an imageVersion", func() {
+			nodeClass.Spec.ImageVersion = lo.ToPtr("202405.20.0")
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+		It("should fail on imageID and userData with another image family", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+			Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+		})
+	})
+})
@@ -16,7 +16,51 @@ limitations under the License.
 
 package v1alpha2
 
+import "strings"
+
 // Annotations
 var (
 	AnnotationInPlaceUpdateHash = Group + "/in-place-update-hash"
+	// AnnotationInPlaceUpdateTagKeys are the keys of the tags Karpenter applied to the VM, NIC and OS disk of a NodeClaim,
+	// as a JSON array, so that the tags removed from the AKSNodeClass are removed without touching the tags added outside Karpenter.
+	AnnotationInPlaceUpdateTagKeys = Group + "/in-place-update-tag-keys"
+	// AnnotationInPlaceUpdateSecurityGroupIDs are the IDs of the network and application security groups Karpenter
+	// associated with the NIC of a NodeClaim, as a JSON array, so that only those are dissociated once removed from the AKSNodeClass.
+	AnnotationInPlaceUpdateSecurityGroupIDs = Group + "/in-place-update-security-group-ids"
+	// AnnotationInPlaceUpdateExtensionNames are the names of the extensions of the AKSNodeClass Karpenter installed on the
+	// VM of a NodeClaim, as a JSON array, so that only those are uninstalled once removed from the AKSNodeClass.
+	AnnotationInPlaceUpdateExtensionNames = Group + "/in-place-update-extension-names"
+
+	AnnotationAKSNodeClassHash        = Group + "/aksnodeclass-hash"
+	AnnotationAKSNodeClassHashVersion = Group + "/aksnodeclass-hash-version"
+
+	// AnnotationSpotToOnDemandFallback is the policy for launching on-demand when launching spot fails for lack of capacity
+	// or quota, for node claims which allow both. It is set in the template annotations of NodePools, defaulting to Allowed.
+	// Policies are matched case-insensitively, invalid ones allow the fallback and are reported with a warning event.
+	AnnotationSpotToOnDemandFallback = Group + "/spot-to-on-demand-fallback"
+
+	// AnnotationVMCreationAccepted is the time, in RFC 3339, ARM accepted the creation of the VM of a node claim which is
+	// created asynchronously. It is removed once the VM is provisioned.
+	AnnotationVMCreationAccepted = Group + "/vm-creation-accepted"
 )
+
+// Spot to on-demand fallback policies
+const (
+	SpotToOnDemandFallbackAllowed = "Allowed"
+	SpotToOnDemandFallbackNever   = "Never"
+)
+
+// SpotToOnDemandFallbackPolicy returns the spot to on-demand fallback policy of the annotations, matched
+// case-insensitively, and whether the annotation holds a known policy. Unset and unknown policies are Allowed.
+func SpotToOnDemandFallbackPolicy(annotations map[string]string) (string, bool) {
+	value, ok := annotations[AnnotationSpotToOnDemandFallback]
+	switch {
+	case !ok:
+		return SpotToOnDemandFallbackAllowed, true
+	case strings.EqualFold(value, SpotToOnDemandFallbackNever):
+		return SpotToOnDemandFallbackNever, true
+	case strings.EqualFold(value, SpotToOnDemandFallbackAllowed):
+		return SpotToOnDemandFallbackAllowed, true
+	}
+	return SpotToOnDemandFallbackAllowed, false
+}
@@ -30,13 +30,18 @@ func init() {
 		LabelSKUVersion,
 
 		LabelSKUCPU,
+		LabelSKUCPUManufacturer,
+		LabelSKUACU,
 		LabelSKUMemory,
 		LabelSKUAccelerator,
 
 		LabelSKUAcceleratedNetworking,
+		LabelSKUNetworkingMaxNICs,
 
 		LabelSKUStoragePremiumCapable,
 		LabelSKUStorageEphemeralOSMaxSize,
+		LabelSKUStorageMaxDataDisks,
+		LabelSKUStorageTempDiskSize,
 
 		LabelSKUEncryptionAtHostSupported,
 
@@ -44,6 +49,8 @@ func init() {
 		LabelSKUGPUManufacturer,
 		LabelSKUGPUCount,
 
+		LabelSKUSpotEvictionRate,
+
 		AKSLabelCluster,
 	)
 }
@@ -74,19 +81,29 @@ var (
 	HyperVGenerationV2 = "2"
 	ManufacturerNvidia = "nvidia"
 
+	ManufacturerIntel     = "intel"
+	ManufacturerAMD       = "amd"
+	ManufacturerAmpere    = "ampere"
+	ManufacturerMicrosoft = "microsoft"
+
 	LabelSKUName    = Group + "/sku-name"    // Standard_A1_v2
 	LabelSKUFamily  = Group + "/sku-family"  // A
 	LabelSKUVersion = Group + "/sku-version" // numerical (without v), with 1 backfilled
 
-	LabelSKUCPU         = Group + "/sku-cpu"    // sku.vCPUs
-	LabelSKUMemory      = Group + "/sku-memory" // sku.MemoryGB
-	LabelSKUAccelerator = Group + "/sku-accelerator"
+	LabelSKUCPU             = Group + "/sku-cpu"              // sku.vCPUs
+	LabelSKUCPUManufacturer = Group + "/sku-cpu-manufacturer" // ie intel, amd, ampere, microsoft; from architecture and VM size name, unset when unknown
+	LabelSKUACU             = Group + "/sku-acu"              // sku.ACUs (Azure Compute Units)
+	LabelSKUMemory          = Group + "/sku-memory"           // sku.MemoryGB
+	LabelSKUAccelerator     = Group + "/sku-accelerator"
 
 	// selected capabilities (from additive features in VM size name, or from SKU capabilities)
 	LabelSKUAcceleratedNetworking = Group + "/sku-networking-accelerated" // sku.AcceleratedNetworkingEnabled
+	LabelSKUNetworkingMaxNICs     = Group + "/sku-networking-maxnics"     // sku.MaxNetworkInterfaces
 
 	LabelSKUStoragePremiumCapable     = Group + "/sku-storage-premium-capable"     // sku.IsPremiumIO
 	LabelSKUStorageEphemeralOSMaxSize = Group + "/sku-storage-ephemeralos-maxsize" // calculated as max(sku.CachedDiskBytes, sku.MaxResourceVolumeMB)
+	LabelSKUStorageMaxDataDisks       = Group + "/sku-storage-maxdatadisks"        // sku.MaxDataDiskCount
+	LabelSKUStorageTempDiskSize       = Group + "/sku-storage-tempdisk-size"       // sku.MaxResourceVolumeMB, in GiB
 
 	LabelSKUEncryptionAtHostSupported = Group + "/sku-encryptionathost-capable" // sku.EncryptionAtHostSupported
 
@@ -95,16 +112,22 @@ var (
 	LabelSKUGPUManufacturer = Group + "/sku-gpu-manufacturer" // ie NVIDIA, AMD, etc
 	LabelSKUGPUCount        = Group + "/sku-gpu-count"        // ie 16, 32, etc
 
+	// Spot labels, only set on spot nodes. They are informational on nodes: they hold the value when the node was
+	// launched, and are not updated as the published eviction rate changes.
+	LabelSKUSpotEvictionRate = Group + "/sku-spot-eviction-rate" // lower bound of the spot eviction rate bucket in the region, in percent, ie 0, 5, 10, 15, 20
+
 	// Internal/restricted labels
 	LabelSKUHyperVGeneration = Group + "/sku-hyperv-generation" // sku.HyperVGenerations
 
 	// AKS labels
 	AKSLabelDomain = "kubernetes.azure.com"
 
-	AKSLabelCluster = AKSLabelDomain + "/cluster"
+	AKSLabelCluster     = AKSLabelDomain + "/cluster"
+	AKSLabelFIPSEnabled = AKSLabelDomain + "/fips_enabled"
 )
 
 const (
 	Ubuntu2204ImageFamily = "Ubuntu2204"
 	AzureLinuxImageFamily = "AzureLinux"
+	CustomImageFamily     = "Custom"
 )
@@ -0,0 +1,201 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AKSNodeClassSpec is the top level specification for the AKS Karpenter Provider.
+// This will contain configuration necessary to launch instances in AKS.
+// +kubebuilder:validation:XValidation:message="imageID and userData are required when imageFamily is Custom",rule="!has(self.imageFamily) || self.imageFamily != 'Custom' || (has(self.imageID) && has(self.userData))"
+// +kubebuilder:validation:XValidation:message="imageID and userData are only supported when imageFamily is Custom",rule="(has(self.imageFamily) && self.imageFamily == 'Custom') || (!has(self.imageID) && !has(self.userData))"
+// +kubebuilder:validation:XValidation:message="imageVersion is not supported when imageFamily is Custom",rule="!has(self.imageFamily) || self.imageFamily != 'Custom' || !has(self.imageVersion)"
+type AKSNodeClassSpec struct {
+	// +kubebuilder:default=128
+	// +kubebuilder:validation:Minimum=100
+	// osDiskSizeGB is the size of the OS disk in GB.
+	OSDiskSizeGB *int32 `json:"osDiskSizeGB,omitempty"`
+	// ImageID is the ID of the image that instances use.
+	// Only used by the Custom image family. Either a community gallery image version ID
+	// (/CommunityGalleries/...) or the ARM resource ID of a gallery image version or managed image.
+	// The image architecture and Hyper-V generation are not discovered, so the NodePool
+	// should constrain instance types to ones compatible with the image.
+	// +optional
+	ImageID *string `json:"imageID,omitempty"`
+	// ImageFamily is the image family that instances use.
+	// +kubebuilder:default=Ubuntu2204
+	// +kubebuilder:validation:Enum:={Ubuntu2204,AzureLinux,Custom}
+	ImageFamily *string `json:"imageFamily,omitempty"`
+	// ImageVersion is the image version that instances use.
+	// It is a gallery image version, in the format MajorVersion.MinorVersion.Patch, e.g. 202405.20.0
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+\.[0-9]+$`
+	// +optional
+	ImageVersion *string `json:"imageVersion,omitempty"`
+	// FIPSMode controls FIPS compliance for the provisioned nodes.
+	// When set to Enabled, the FIPS variant of the image family is used.
+	// +kubebuilder:validation:Enum:={Disabled,Enabled}
+	// +optional
+	FIPSMode *FIPSMode `json:"fipsMode,omitempty"`
+	// KubeletDiskType is the disk the kubelet root directory, and so emptyDir volumes, container logs
+	// and writable container layers, is placed on. OS places it on the OS disk, Temporary on the temporary
+	// (resource) disk of the instance. Instance types without a temporary disk always use the OS disk.
+	// The ephemeral-storage capacity of the nodes is that of the chosen disk.
+	// +kubebuilder:validation:Enum:={OS,Temporary}
+	// +optional
+	KubeletDiskType *KubeletDiskType `json:"kubeletDiskType,omitempty"`
+	// MaxPods is the maximum number of pods on the nodes, for both the kubelet and the pods capacity.
+	// Defaults to the AKS default of the network plugin and mode of the cluster: 30 for Azure CNI with pod IPs
+	// from the node subnet, 250 for Azure CNI Overlay and Azure CNI with a pod subnet, 100 for kubenet.
+	// The kubelet maxPods of the NodePool takes precedence when set.
+	// +kubebuilder:validation:Minimum=10
+	// +kubebuilder:validation:Maximum=250
+	// +optional
+	MaxPods *int32 `json:"maxPods,omitempty"`
+	// SpotAllocationStrategy is how the instance type of spot instances is chosen among the compatible ones.
+	// LowestPrice chooses the cheapest. PriceCapacityOptimized weighs the spot price of each instance type
+	// with its spot eviction rate in the region, trading a slightly higher price for a lower risk of eviction.
+	// Only applies to new instances, so changing it does not drift existing ones.
+	// +kubebuilder:validation:Enum:={LowestPrice,PriceCapacityOptimized}
+	// +optional
+	SpotAllocationStrategy *SpotAllocationStrategy `json:"spotAllocationStrategy,omitempty" hash:"ignore"`
+	// UserData is a Go template rendered into the custom data of instances.
+	// Only used by the Custom image family, which leaves joining the cluster entirely to this template.
+	// The template has access to the cluster endpoint, CA bundle, labels, taints, kubelet configuration
+	// and TLS bootstrap token of the node being launched.
+	// +optional
+	UserData *string `json:"userData,omitempty"`
+	// Tags to be applied on Azure resources like instances.
+	// Tags are updated in place on existing instances.
+	// +kubebuilder:validation:MaxProperties=48
+	// +kubebuilder:validation:XValidation:message="tag keys must be between 1 and 512 characters",rule="self.all(k, size(k) > 0 && size(k) <= 512)"
+	// +kubebuilder:validation:XValidation:message="tag keys must not contain any of <>%&?\\ characters",rule=`self.all(k, !k.matches(r'[<>%&?\\]'))`
+	// +kubebuilder:validation:XValidation:message="tag values must be at most 256 characters",rule="self.all(k, size(self[k]) <= 256)"
+	// +kubebuilder:validation:XValidation:message="tag keys karpenter.azure.com/cluster and karpenter.sh/nodepool are restricted",rule="self.all(k, !(k.lowerAscii().replace('/', '_') in ['karpenter.azure.com_cluster', 'karpenter.sh_nodepool']))"
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// NetworkSecurityGroupID is the ID of a network security group the network interfaces of instances are associated
+	// with. It is updated in place on existing instances. Removing it dissociates the network interfaces Karpenter
+	// associated, leaving associations made outside Karpenter in place.
+	// +kubebuilder:validation:Pattern=`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Network/networkSecurityGroups/[^/]+$`
+	// +optional
+	NetworkSecurityGroupID *string `json:"networkSecurityGroupID,omitempty"`
+	// ApplicationSecurityGroupIDs are the IDs of application security groups the IP configurations of the network
+	// interfaces of instances are members of. They are updated in place on existing instances, the application
+	// security groups removed from the AKSNodeClass are removed, those added outside Karpenter are kept.
+	// +kubebuilder:validation:MaxItems=20
+	// +kubebuilder:validation:XValidation:message="application security group IDs must be IDs of Microsoft.Network/applicationSecurityGroups",rule=`self.all(id, id.matches(r'(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Network/applicationSecurityGroups/[^/]+$'))`
+	// +optional
+	ApplicationSecurityGroupIDs []string `json:"applicationSecurityGroupIDs,omitempty"`
+	// Extensions are VM extensions installed on instances, in addition to the AKS billing extension. They are
+	// installed and updated in place on existing instances, and uninstalled from them once removed from the AKSNodeClass.
+	// +kubebuilder:validation:MaxItems=10
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Extensions []Extension `json:"extensions,omitempty"`
+}
+
+// Extension is a VM extension installed on the instances of an AKSNodeClass.
+type Extension struct {
+	// Name is the name of the extension on the instances.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:XValidation:message="the name computeAksLinuxBilling is reserved for the AKS billing extension",rule="self.lowerAscii() != 'computeakslinuxbilling'"
+	// +required
+	Name string `json:"name"`
+	// Publisher is the publisher of the extension, e.g. Microsoft.Azure.Monitor.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Publisher string `json:"publisher"`
+	// Type is the type of the extension, e.g. AzureMonitorLinuxAgent.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Type string `json:"type"`
+	// TypeHandlerVersion is the version of the extension, e.g. 1.0.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	TypeHandlerVersion string `json:"typeHandlerVersion"`
+	// AutoUpgradeMinorVersion is whether the extension moves to newer minor versions as they are released.
+	// +optional
+	AutoUpgradeMinorVersion *bool `json:"autoUpgradeMinorVersion,omitempty"`
+	// Settings are the public settings of the extension. Protected settings are not supported,
+	// as the AKSNodeClass would hold them in the clear.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// +optional
+	Settings *runtime.RawExtension `json:"settings,omitempty"`
+}
+
+// FIPSMode is the FIPS compliance mode of the provisioned nodes.
+type FIPSMode string
+
+const (
+	FIPSModeDisabled FIPSMode = "Disabled"
+	FIPSModeEnabled  FIPSMode = "Enabled"
+)
+
+// KubeletDiskType is the disk the kubelet root directory is placed on.
+type KubeletDiskType string
+
+const (
+	KubeletDiskTypeOS        KubeletDiskType = "OS"
+	KubeletDiskTypeTemporary KubeletDiskType = "Temporary"
+)
+
+// SpotAllocationStrategy is how the instance type of spot instances is chosen.
+type SpotAllocationStrategy string
+
+const (
+	SpotAllocationStrategyLowestPrice            SpotAllocationStrategy = "LowestPrice"
+	SpotAllocationStrategyPriceCapacityOptimized SpotAllocationStrategy = "PriceCapacityOptimized"
+)
+
+const (
+	Ubuntu2204ImageFamily = "Ubuntu2204"
+	AzureLinuxImageFamily = "AzureLinux"
+	CustomImageFamily     = "Custom"
+)
+
+// v1beta1 has the same fields as v1alpha2 and converts to it field for field, without loss. What it stabilises is the
+// schema, reviewed from the first v1alpha2 one: imageID, which was hidden, is exposed for the Custom image family,
+// imageVersion and tags are validated the way Azure requires, and the fields added since (e.g. fipsMode,
+// kubeletDiskType, extensions) are part of it. None of them will be removed or change meaning within v1beta1.
+// v1alpha2 remains the storage version, as the providers and controllers still work on it.
+
+// AKSNodeClass is the Schema for the AKSNodeClass API
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=aksnodeclasses,scope=Cluster,categories=karpenter,shortName={aksnc,aksncs}
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+// +kubebuilder:subresource:status
+type AKSNodeClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AKSNodeClassSpec   `json:"spec,omitempty"`
+	Status AKSNodeClassStatus `json:"status,omitempty"`
+}
+
+// AKSNodeClassList contains a list of AKSNodeClass
+// +kubebuilder:object:root=true
+type AKSNodeClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AKSNodeClass `json:"items"`
+}
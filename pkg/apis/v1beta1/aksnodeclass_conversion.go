@@ -0,0 +1,108 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+	"knative.dev/pkg/apis"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+// v1beta1 is the hub of the AKSNodeClass conversion: every other served version
+// is converted to and from v1beta1, so all the conversions are implemented here.
+
+// ConvertTo converts the AKSNodeClass to the version of the sink
+func (in *AKSNodeClass) ConvertTo(_ context.Context, to apis.Convertible) error {
+	switch sink := to.(type) {
+	case *v1alpha2.AKSNodeClass:
+		sink.ObjectMeta = in.ObjectMeta
+		in.Spec.convertToV1Alpha2(&sink.Spec)
+		in.Status.convertToV1Alpha2(&sink.Status)
+		return nil
+	default:
+		return fmt.Errorf("unknown version, got: %T", sink)
+	}
+}
+
+// ConvertFrom converts the AKSNodeClass from the version of the source
+func (in *AKSNodeClass) ConvertFrom(_ context.Context, from apis.Convertible) error {
+	switch source := from.(type) {
+	case *v1alpha2.AKSNodeClass:
+		in.ObjectMeta = source.ObjectMeta
+		in.Spec.convertFromV1Alpha2(&source.Spec)
+		in.Status.convertFromV1Alpha2(&source.Status)
+		return nil
+	default:
+		return fmt.Errorf("unknown version, got: %T", source)
+	}
+}
+
+func (in *AKSNodeClassSpec) convertToV1Alpha2(sink *v1alpha2.AKSNodeClassSpec) {
+	sink.OSDiskSizeGB = in.OSDiskSizeGB
+	sink.ImageID = in.ImageID
+	sink.ImageFamily = in.ImageFamily
+	sink.ImageVersion = in.ImageVersion
+	sink.FIPSMode = (*v1alpha2.FIPSMode)(in.FIPSMode)
+	sink.KubeletDiskType = (*v1alpha2.KubeletDiskType)(in.KubeletDiskType)
+	sink.MaxPods = in.MaxPods
+	sink.SpotAllocationStrategy = (*v1alpha2.SpotAllocationStrategy)(in.SpotAllocationStrategy)
+	sink.UserData = in.UserData
+	sink.Tags = in.Tags
+	sink.NetworkSecurityGroupID = in.NetworkSecurityGroupID
+	sink.ApplicationSecurityGroupIDs = in.ApplicationSecurityGroupIDs
+	sink.Extensions = lo.Map(in.Extensions, func(extension Extension, _ int) v1alpha2.Extension {
+		return v1alpha2.Extension(extension)
+	})
+}
+
+func (in *AKSNodeClassSpec) convertFromV1Alpha2(source *v1alpha2.AKSNodeClassSpec) {
+	in.OSDiskSizeGB = source.OSDiskSizeGB
+	in.ImageID = source.ImageID
+	in.ImageFamily = source.ImageFamily
+	in.ImageVersion = source.ImageVersion
+	in.FIPSMode = (*FIPSMode)(source.FIPSMode)
+	in.KubeletDiskType = (*KubeletDiskType)(source.KubeletDiskType)
+	in.MaxPods = source.MaxPods
+	in.SpotAllocationStrategy = (*SpotAllocationStrategy)(source.SpotAllocationStrategy)
+	in.UserData = source.UserData
+	in.Tags = source.Tags
+	in.NetworkSecurityGroupID = source.NetworkSecurityGroupID
+	in.ApplicationSecurityGroupIDs = source.ApplicationSecurityGroupIDs
+	in.Extensions = lo.Map(source.Extensions, func(extension v1alpha2.Extension, _ int) Extension {
+		return Extension(extension)
+	})
+}
+
+func (in *AKSNodeClassStatus) convertToV1Alpha2(sink *v1alpha2.AKSNodeClassStatus) {
+	sink.Images = lo.Map(in.Images, func(image Image, _ int) v1alpha2.Image {
+		return v1alpha2.Image{ID: image.ID, Requirements: image.Requirements}
+	})
+	sink.KubernetesVersion = in.KubernetesVersion
+	sink.Conditions = in.Conditions
+}
+
+func (in *AKSNodeClassStatus) convertFromV1Alpha2(source *v1alpha2.AKSNodeClassStatus) {
+	in.Images = lo.Map(source.Images, func(image v1alpha2.Image, _ int) Image {
+		return Image{ID: image.ID, Requirements: image.Requirements}
+	})
+	in.KubernetesVersion = source.KubernetesVersion
+	in.Conditions = source.Conditions
+}
@@ -0,0 +1,81 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1_test
+
+import (
+	"fmt"
+
+	fuzz "github.com/google/gofuzz"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/pkg/apis"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+var _ = Describe("Conversion", func() {
+	var fuzzer *fuzz.Fuzzer
+
+	BeforeEach(func() {
+		fuzzer = fuzz.New().NilChance(0.2).NumElements(0, 3).Funcs(
+			// metav1.Time and apis.VolatileTime wrap a time.Time, which the fuzzer cannot fill
+			func(t *metav1.Time, c fuzz.Continue) { *t = metav1.Unix(c.Int63n(1<<32), 0) },
+			func(t *apis.VolatileTime, c fuzz.Continue) { t.Inner = metav1.Unix(c.Int63n(1<<32), 0) },
+			// runtime.RawExtension holds a runtime.Object, which the fuzzer cannot fill either
+			func(e *runtime.RawExtension, c fuzz.Continue) {
+				e.Raw = []byte(fmt.Sprintf(`{"key":%q}`, c.RandString()))
+			},
+		)
+	})
+
+	It("should round trip v1alpha2 through v1beta1", func() {
+		for i := 0; i < 1000; i++ {
+			in := &v1alpha2.AKSNodeClass{}
+			fuzzer.Fuzz(in)
+
+			hub := &v1beta1.AKSNodeClass{}
+			Expect(hub.ConvertFrom(ctx, in)).To(Succeed())
+			out := &v1alpha2.AKSNodeClass{}
+			Expect(hub.ConvertTo(ctx, out)).To(Succeed())
+
+			out.TypeMeta = in.TypeMeta
+			Expect(equality.Semantic.DeepEqual(in, out)).To(BeTrue(), "round trip of %+v resulted in %+v", in, out)
+		}
+	})
+	It("should round trip v1beta1 through v1alpha2", func() {
+		for i := 0; i < 1000; i++ {
+			in := &v1beta1.AKSNodeClass{}
+			fuzzer.Fuzz(in)
+
+			spoke := &v1alpha2.AKSNodeClass{}
+			Expect(in.ConvertTo(ctx, spoke)).To(Succeed())
+			out := &v1beta1.AKSNodeClass{}
+			Expect(out.ConvertFrom(ctx, spoke)).To(Succeed())
+
+			out.TypeMeta = in.TypeMeta
+			Expect(equality.Semantic.DeepEqual(in, out)).To(BeTrue(), "round trip of %+v resulted in %+v", in, out)
+		}
+	})
+	It("should fail to convert to an unknown version", func() {
+		Expect((&v1beta1.AKSNodeClass{}).ConvertTo(ctx, &v1beta1.AKSNodeClass{})).ToNot(Succeed())
+		Expect((&v1beta1.AKSNodeClass{}).ConvertFrom(ctx, &v1beta1.AKSNodeClass{})).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,77 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/apis"
+)
+
+// Image contains resolved image selector values utilized for node launch
+type Image struct {
+	// ID of the image
+	// +required
+	ID string `json:"id"`
+	// Requirements of the image to be utilized on an instance type
+	// +required
+	Requirements []v1.NodeSelectorRequirement `json:"requirements"`
+}
+
+// AKSNodeClassStatus contains the resolved state of the AKSNodeClass
+type AKSNodeClassStatus struct {
+	// Images contains the current set of images available to use
+	// for the AKSNodeClass, one per image definition of the image family
+	// +optional
+	Images []Image `json:"images,omitempty"`
+	// KubernetesVersion contains the current kubernetes version which should be
+	// used for nodes provisioned for the AKSNodeClass
+	// +optional
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// Conditions contains signals for health and readiness
+	// +optional
+	Conditions apis.Conditions `json:"conditions,omitempty"`
+}
+
+const (
+	// ConditionTypeImagesReady is set when the images of the AKSNodeClass have been resolved
+	ConditionTypeImagesReady apis.ConditionType = "ImagesReady"
+	// ConditionTypeKubernetesVersionReady is set when the kubernetes version of the cluster has been resolved
+	ConditionTypeKubernetesVersionReady apis.ConditionType = "KubernetesVersionReady"
+	// ConditionTypeSubnetReady is set when the subnet nodes are launched into has been validated
+	ConditionTypeSubnetReady apis.ConditionType = "SubnetReady"
+	// ConditionTypeIdentitiesReady is set when the identities assigned to nodes have been validated
+	ConditionTypeIdentitiesReady apis.ConditionType = "IdentitiesReady"
+)
+
+// StatusConditions returns the condition manager of the AKSNodeClass.
+// The AKSNodeClass is Ready once all of its dependent conditions are.
+func (in *AKSNodeClass) StatusConditions() apis.ConditionManager {
+	return apis.NewLivingConditionSet(
+		ConditionTypeImagesReady,
+		ConditionTypeKubernetesVersionReady,
+		ConditionTypeSubnetReady,
+		ConditionTypeIdentitiesReady,
+	).Manage(in)
+}
+
+func (in *AKSNodeClass) GetConditions() apis.Conditions {
+	return in.Status.Conditions
+}
+
+func (in *AKSNodeClass) SetConditions(conditions apis.Conditions) {
+	in.Status.Conditions = conditions
+}
@@ -0,0 +1,43 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"knative.dev/pkg/apis"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+func (in *AKSNodeClass) SupportedVerbs() []admissionregistrationv1.OperationType {
+	return []admissionregistrationv1.OperationType{
+		admissionregistrationv1.Create,
+		admissionregistrationv1.Update,
+	}
+}
+
+// Validate converts the AKSNodeClass to v1alpha2 and validates it there, so that both versions share one
+// implementation of the rules. The versions have the same schema, so the conversion is lossless.
+func (in *AKSNodeClass) Validate(ctx context.Context) *apis.FieldError {
+	nodeClass := &v1alpha2.AKSNodeClass{}
+	if err := in.ConvertTo(ctx, nodeClass); err != nil {
+		return apis.ErrGeneric(err.Error())
+	}
+	return nodeClass.Validate(ctx)
+}
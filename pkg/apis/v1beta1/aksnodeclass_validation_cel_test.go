@@ -0,0 +1,75 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1_test
+
+import (
+	"strings"
+
+	"github.com/Pallinder/go-randomdata"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+var _ = Describe("AKSNodeClass CEL/Validation", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+
+	BeforeEach(func() {
+		if env.Version.Minor() < 25 {
+			Skip("CEL Validation is for 1.25>")
+		}
+		nodeClass = &v1beta1.AKSNodeClass{
+			ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+			Spec:       v1beta1.AKSNodeClassSpec{},
+		}
+	})
+	It("should succeed with the defaults", func() {
+		Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+		Expect(env.Client.Get(ctx, client.ObjectKeyFromObject(nodeClass), nodeClass)).To(Succeed())
+		Expect(nodeClass.Spec.ImageFamily).To(Equal(lo.ToPtr(v1beta1.Ubuntu2204ImageFamily)))
+		Expect(nodeClass.Spec.OSDiskSizeGB).To(Equal(lo.ToPtr[int32](128)))
+	})
+	It("should serve a v1beta1 AKSNodeClass as v1alpha2", func() {
+		nodeClass.Spec.ImageVersion = lo.ToPtr("202405.20.0")
+		nodeClass.Spec.FIPSMode = lo.ToPtr(v1beta1.FIPSModeEnabled)
+		nodeClass.Spec.Tags = map[string]string{"team": "a"}
+		Expect(env.Client.Create(ctx, nodeClass)).To(Succeed())
+
+		v1alpha2NodeClass := &v1alpha2.AKSNodeClass{}
+		Expect(env.Client.Get(ctx, client.ObjectKeyFromObject(nodeClass), v1alpha2NodeClass)).To(Succeed())
+		Expect(v1alpha2NodeClass.Spec.ImageVersion).To(Equal(lo.ToPtr("202405.20.0")))
+		Expect(v1alpha2NodeClass.Spec.FIPSMode).To(Equal(lo.ToPtr(v1alpha2.FIPSModeEnabled)))
+		Expect(v1alpha2NodeClass.Spec.Tags).To(Equal(map[string]string{"team": "a"}))
+	})
+	It("should fail on restricted tag keys", func() {
+		nodeClass.Spec.Tags = map[string]string{"karpenter.sh/nodepool": "a"}
+		Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+	})
+	It("should fail on an invalid image version", func() {
+		nodeClass.Spec.ImageVersion = lo.ToPtr("latest")
+		Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+	})
+	It("should fail on a Custom image family without imageID and userData", func() {
+		nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.CustomImageFamily)
+		Expect(env.Client.Create(ctx, nodeClass)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,58 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1_test
+
+import (
+	"strings"
+
+	"github.com/Pallinder/go-randomdata"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// The rules are implemented and covered by v1alpha2, these only check that v1beta1 is validated by them
+var _ = Describe("AKSNodeClass Webhook/Validation", func() {
+	var nodeClass *v1beta1.AKSNodeClass
+
+	BeforeEach(func() {
+		nodeClass = &v1beta1.AKSNodeClass{
+			ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(randomdata.SillyName())},
+			Spec: v1beta1.AKSNodeClassSpec{
+				ImageFamily: lo.ToPtr(v1beta1.Ubuntu2204ImageFamily),
+			},
+		}
+	})
+	It("should succeed with the defaults", func() {
+		Expect(nodeClass.Validate(ctx)).To(Succeed())
+	})
+	It("should fail on a restricted tag key", func() {
+		nodeClass.Spec.Tags = map[string]string{"karpenter.sh/nodepool": "a"}
+		Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+	})
+	It("should fail on an invalid image version", func() {
+		nodeClass.Spec.ImageVersion = lo.ToPtr("latest")
+		Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+	})
+	It("should fail when imageFamily is Custom without imageID and userData", func() {
+		nodeClass.Spec.ImageFamily = lo.ToPtr(v1beta1.CustomImageFamily)
+		Expect(nodeClass.Validate(ctx)).ToNot(Succeed())
+	})
+})
@@ -19,6 +19,7 @@ package cache
 import (
 	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -35,17 +36,33 @@ var (
 // attempting to launch the capacity. These offerings are ignored as long as they are in the cache on
 // GetInstanceTypes responses
 type UnavailableOfferings struct {
-	// key: <capacityType>:<instanceType>:<zone>, value: struct{}{}
+	// key: <capacityType>:<instanceType>:<zone>, value: the reason the offering is unavailable
 	cache  *cache.Cache
 	SeqNum uint64
+
+	mu sync.Mutex
+	// offerings are the offerings in the cache, by key, and zoneCounts their count by instance type by reason by zone,
+	// kept as offerings are marked and evicted so that counting them does not copy the cache
+	offerings  map[string]unavailableOffering
+	zoneCounts map[string]map[string]map[string]int
+}
+
+type unavailableOffering struct {
+	instanceType string
+	zone         string
+	reason       string
+	expires      time.Time
 }
 
 func NewUnavailableOfferingsWithCache(c *cache.Cache) *UnavailableOfferings {
 	uo := &UnavailableOfferings{
-		cache:  c,
-		SeqNum: 0,
+		cache:      c,
+		SeqNum:     0,
+		offerings:  map[string]unavailableOffering{},
+		zoneCounts: map[string]map[string]map[string]int{},
 	}
-	uo.cache.OnEvicted(func(_ string, _ interface{}) {
+	uo.cache.OnEvicted(func(k string, _ interface{}) {
+		uo.evicted(k)
 		atomic.AddUint64(&uo.SeqNum, 1)
 	})
 	return uo
@@ -81,7 +98,19 @@ func (u *UnavailableOfferings) MarkUnavailableWithTTL(ctx context.Context, unava
 		"zone", zone,
 		"capacity-type", capacityType,
 		"ttl", ttl).Debugf("removing offering from offerings")
-	u.cache.Set(key(instanceType, zone, capacityType), struct{}{}, ttl)
+	k := key(instanceType, zone, capacityType)
+	u.mu.Lock()
+	u.cache.Set(k, unavailableReason, ttl)
+	u.uncount(k)
+	u.offerings[k] = unavailableOffering{instanceType: instanceType, zone: zone, reason: unavailableReason, expires: time.Now().Add(ttl)}
+	if u.zoneCounts[zone] == nil {
+		u.zoneCounts[zone] = map[string]map[string]int{}
+	}
+	if u.zoneCounts[zone][unavailableReason] == nil {
+		u.zoneCounts[zone][unavailableReason] = map[string]int{}
+	}
+	u.zoneCounts[zone][unavailableReason][instanceType]++
+	u.mu.Unlock()
 	atomic.AddUint64(&u.SeqNum, 1)
 }
 
@@ -90,11 +119,49 @@ func (u *UnavailableOfferings) MarkUnavailable(ctx context.Context, unavailableR
 	u.MarkUnavailableWithTTL(ctx, unavailableReason, instanceType, zone, capacityType, UnavailableOfferingsTTL)
 }
 
+// UnavailableInZone returns how many instance types have offerings in the zone unavailable for the reason,
+// counting an instance type once whatever the capacity types of its unavailable offerings
+func (u *UnavailableOfferings) UnavailableInZone(zone, unavailableReason string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.zoneCounts[zone][unavailableReason])
+}
+
 func (u *UnavailableOfferings) Flush() {
+	u.mu.Lock()
+	// flushing does not evict the offerings one by one
 	u.cache.Flush()
+	u.offerings = map[string]unavailableOffering{}
+	u.zoneCounts = map[string]map[string]map[string]int{}
+	u.mu.Unlock()
 	atomic.AddUint64(&u.SeqNum, 1)
 }
 
+// evicted stops counting an offering evicted from the cache, unless it was marked unavailable again since it expired
+func (u *UnavailableOfferings) evicted(k string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if offering, ok := u.offerings[k]; ok && !offering.expires.After(time.Now()) {
+		u.uncount(k)
+	}
+}
+
+func (u *UnavailableOfferings) uncount(k string) {
+	offering, ok := u.offerings[k]
+	if !ok {
+		return
+	}
+	delete(u.offerings, k)
+	instanceTypes := u.zoneCounts[offering.zone][offering.reason]
+	instanceTypes[offering.instanceType]--
+	if instanceTypes[offering.instanceType] == 0 {
+		delete(instanceTypes, offering.instanceType)
+	}
+	if len(instanceTypes) == 0 {
+		delete(u.zoneCounts[offering.zone], offering.reason)
+	}
+}
+
 // key returns the cache key for all offerings in the cache
 func key(instanceType string, zone string, capacityType string) string {
 	return fmt.Sprintf("%s:%s:%s", capacityType, instanceType, zone)
@@ -58,3 +58,41 @@ func TestUnavailableOfferings_KeyGeneration(t *testing.T) {
 		t.Errorf("Expected key to be %s, but got %s", expectedKey, key)
 	}
 }
+
+func TestUnavailableOfferings_UnavailableInZone(t *testing.T) {
+	u := NewUnavailableOfferings()
+	u.MarkUnavailable(context.TODO(), "ZonalAllocationFailure", "NV16as_v4", "westus-1", "spot")
+	u.MarkUnavailable(context.TODO(), "ZonalAllocationFailure", "NV16as_v4", "westus-1", "on-demand")
+	u.MarkUnavailable(context.TODO(), "ZonalAllocationFailure", "D2s_v3", "westus-2", "on-demand")
+	u.MarkUnavailable(context.TODO(), "SKUNotAvailable", "D2s_v3", "westus-1", "spot")
+
+	// the spot and on-demand offerings of an instance type count once
+	if count := u.UnavailableInZone("westus-1", "ZonalAllocationFailure"); count != 1 {
+		t.Errorf("Expected 1 instance type unavailable in westus-1, but got %d", count)
+	}
+	if count := u.UnavailableInZone("westus-3", "ZonalAllocationFailure"); count != 0 {
+		t.Errorf("Expected no instance types unavailable in westus-3, but got %d", count)
+	}
+}
+
+func TestUnavailableOfferings_UnavailableInZoneAfterEviction(t *testing.T) {
+	u := NewUnavailableOfferings()
+	u.MarkUnavailableWithTTL(context.TODO(), "ZonalAllocationFailure", "NV16as_v4", "westus-1", "spot", time.Millisecond)
+	u.MarkUnavailable(context.TODO(), "ZonalAllocationFailure", "D2s_v3", "westus-1", "spot")
+	// marking an offering unavailable again for another reason counts it once, for the latest reason
+	u.MarkUnavailable(context.TODO(), "ZonalAllocationFailure", "D2s_v3", "westus-1", "on-demand")
+	u.MarkUnavailable(context.TODO(), "SKUNotAvailable", "D2s_v3", "westus-1", "on-demand")
+	time.Sleep(2 * time.Millisecond)
+	u.cache.DeleteExpired()
+
+	if count := u.UnavailableInZone("westus-1", "ZonalAllocationFailure"); count != 1 {
+		t.Errorf("Expected 1 instance type unavailable in westus-1, but got %d", count)
+	}
+	if count := u.UnavailableInZone("westus-1", "SKUNotAvailable"); count != 1 {
+		t.Errorf("Expected 1 instance type not available in westus-1, but got %d", count)
+	}
+	u.Flush()
+	if count := u.UnavailableInZone("westus-1", "ZonalAllocationFailure"); count != 0 {
+		t.Errorf("Expected no instance types unavailable in westus-1 after flushing, but got %d", count)
+	}
+}
@@ -18,9 +18,11 @@ package cloudprovider
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -80,10 +82,14 @@ func New(instanceTypeProvider *instancetype.Provider, instanceProvider *instance
 func (c *CloudProvider) Create(ctx context.Context, nodeClaim *corev1beta1.NodeClaim) (*corev1beta1.NodeClaim, error) {
 	nodeClass, err := c.resolveNodeClassFromNodeClaim(ctx, nodeClaim)
 	if err != nil {
-		if errors.IsNotFound(err) {
+		switch {
+		case isNodeClassTerminatingError(err):
+			c.recorder.Publish(cloudproviderevents.NodeClaimFailedToLaunchOnTerminatingNodeClass(nodeClaim, nodeClaim.Spec.NodeClassRef.Name))
+		case errors.IsNotFound(err):
 			c.recorder.Publish(cloudproviderevents.NodeClaimFailedToResolveNodeClass(nodeClaim))
 		}
-		// We treat a failure to resolve the NodeClass as an ICE since this means there is no capacity possibilities for this NodeClaim
+		// We treat a failure to resolve the NodeClass as an ICE since this means there is no capacity possibilities for this NodeClaim.
+		// This also deletes NodeClaims of a terminating NodeClass, which waits on them before it is removed.
 		return nil, cloudprovider.NewInsufficientCapacityError(fmt.Errorf("resolving node class, %w", err))
 	}
 
@@ -94,15 +100,36 @@ func (c *CloudProvider) Create(ctx context.Context, nodeClaim *corev1beta1.NodeC
 	if len(instanceTypes) == 0 {
 		return nil, cloudprovider.NewInsufficientCapacityError(fmt.Errorf("all requested instance types were unavailable during launch"))
 	}
-	instance, err := c.instanceProvider.Create(ctx, nodeClass, nodeClaim, instanceTypes)
+	if _, ok := v1alpha2.SpotToOnDemandFallbackPolicy(nodeClaim.Annotations); !ok {
+		c.recorder.Publish(cloudproviderevents.NodeClaimInvalidSpotToOnDemandFallback(nodeClaim))
+	}
+	vm, fallback, err := c.instanceProvider.Create(ctx, nodeClass, nodeClaim, instanceTypes)
 	if err != nil {
 		return nil, fmt.Errorf("creating instance, %w", err)
 	}
+	if fallback != nil {
+		c.recorder.Publish(cloudproviderevents.NodeClaimFellBackToOnDemand(nodeClaim, fallback.InstanceType, fallback.Err))
+	}
 	instanceType, _ := lo.Find(instanceTypes, func(i *cloudprovider.InstanceType) bool {
-		return i.Name == string(lo.FromPtr(instance.Properties.HardwareProfile.VMSize))
+		return i.Name == string(lo.FromPtr(vm.Properties.HardwareProfile.VMSize))
 	})
 
-	return c.instanceToNodeClaim(ctx, instance, instanceType)
+	nc, err := c.instanceToNodeClaim(ctx, vm, instanceType)
+	if err != nil {
+		return nil, err
+	}
+	nc.Annotations = lo.Assign(nc.Annotations, map[string]string{
+		v1alpha2.AnnotationAKSNodeClassHash:              nodeClass.Hash(),
+		v1alpha2.AnnotationAKSNodeClassHashVersion:       v1alpha2.AKSNodeClassHashVersion,
+		v1alpha2.AnnotationInPlaceUpdateTagKeys:          inplaceupdate.TagKeysAnnotation(vm.Tags),
+		v1alpha2.AnnotationInPlaceUpdateSecurityGroupIDs: inplaceupdate.SecurityGroupIDsAnnotation(nodeClass),
+		v1alpha2.AnnotationInPlaceUpdateExtensionNames:   inplaceupdate.ExtensionNamesAnnotation(nodeClass),
+	})
+	// VMs created asynchronously are still being provisioned, which the creation controller tracks
+	if lo.FromPtr(vm.Properties.ProvisioningState) == instance.ProvisioningStateCreating {
+		nc.Annotations[v1alpha2.AnnotationVMCreationAccepted] = vm.Properties.TimeCreated.Format(time.RFC3339)
+	}
+	return nc, nil
 }
 
 func (c *CloudProvider) List(ctx context.Context) ([]*corev1beta1.NodeClaim, error) {
@@ -206,6 +233,9 @@ func (c *CloudProvider) IsDrifted(ctx context.Context, nodeClaim *corev1beta1.No
 	if imageVersionDrifted != "" {
 		return imageVersionDrifted, nil
 	}
+	if nodeClassDrifted := c.isNodeClassDrifted(ctx, nodeClaim, nodeClass); nodeClassDrifted != "" {
+		return nodeClassDrifted, nil
+	}
 	return "", nil
 }
 
@@ -224,6 +254,22 @@ func (c *CloudProvider) GetSupportedNodeClasses() []schema.GroupVersionKind {
 	}
 }
 
+// nodeClassTerminatingError is returned when resolving a deleting AKSNodeClass. It is a NotFound error, so callers
+// tolerating a missing AKSNodeClass tolerate a deleting one as well.
+type nodeClassTerminatingError struct {
+	*errors.StatusError
+}
+
+func newNodeClassTerminatingError(name string) *nodeClassTerminatingError {
+	err := errors.NewNotFound(v1alpha2.SchemeGroupVersion.WithResource("aksnodeclasses").GroupResource(), name)
+	err.ErrStatus.Message = fmt.Sprintf("AKSNodeClass %q is terminating, treating as not found", name)
+	return &nodeClassTerminatingError{StatusError: err}
+}
+
+func isNodeClassTerminatingError(err error) bool {
+	return stderrors.As(err, lo.ToPtr(&nodeClassTerminatingError{}))
+}
+
 func (c *CloudProvider) resolveNodeClassFromNodeClaim(ctx context.Context, nodeClaim *corev1beta1.NodeClaim) (*v1alpha2.AKSNodeClass, error) {
 	nodeClass := &v1alpha2.AKSNodeClass{}
 	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: nodeClaim.Spec.NodeClassRef.Name}, nodeClass); err != nil {
@@ -231,7 +277,7 @@ func (c *CloudProvider) resolveNodeClassFromNodeClaim(ctx context.Context, nodeC
 	}
 	// For the purposes of NodeClass CloudProvider resolution, we treat deleting NodeClasses as NotFound
 	if !nodeClass.DeletionTimestamp.IsZero() {
-		return nil, errors.NewNotFound(v1alpha2.SchemeGroupVersion.WithResource("aksnodeclasses").GroupResource(), nodeClass.Name)
+		return nil, newNodeClassTerminatingError(nodeClass.Name)
 	}
 	return nodeClass, nil
 }
@@ -243,7 +289,7 @@ func (c *CloudProvider) resolveNodeClassFromNodePool(ctx context.Context, nodePo
 	}
 	// For the purposes of NodeClass CloudProvider resolution, we treat deleting NodeClasses as NotFound
 	if !nodeClass.DeletionTimestamp.IsZero() {
-		return nil, errors.NewNotFound(v1alpha2.SchemeGroupVersion.WithResource("aksnodeclasses").GroupResource(), nodeClass.Name)
+		return nil, newNodeClassTerminatingError(nodeClass.Name)
 	}
 	return nodeClass, nil
 }
@@ -317,6 +363,10 @@ func (c *CloudProvider) instanceToNodeClaim(ctx context.Context, vm *armcompute.
 	}
 
 	labels[corev1beta1.CapacityTypeLabelKey] = instance.GetCapacityType(vm)
+	if labels[corev1beta1.CapacityTypeLabelKey] != corev1beta1.CapacityTypeSpot {
+		// the instance type may have spot offerings, the eviction rate is only meaningful for spot VMs
+		delete(labels, v1alpha2.LabelSKUSpotEvictionRate)
+	}
 
 	// TODO: v1beta1 new kes/labels
 	if tag, ok := vm.Tags[instance.NodePoolTagKey]; ok {
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/samber/lo"
 	"knative.dev/pkg/logging"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
@@ -38,6 +40,7 @@ import (
 const (
 	K8sVersionDrift   cloudprovider.DriftReason = "K8sVersionDrift"
 	ImageVersionDrift cloudprovider.DriftReason = "ImageVersionDrift"
+	NodeClassDrift    cloudprovider.DriftReason = "NodeClassDrift"
 )
 
 func (c *CloudProvider) isK8sVersionDrifted(ctx context.Context, nodeClaim *corev1beta1.NodeClaim) (cloudprovider.DriftReason, error) {
@@ -92,6 +95,10 @@ func (c *CloudProvider) isImageVersionDrifted(
 		return "", fmt.Errorf("vm with id %s missing", id)
 	}
 
+	if lo.FromPtr(nodeClass.Spec.ImageFamily) == v1alpha2.CustomImageFamily {
+		return isCustomImageDrifted(ctx, vm, nodeClass), nil
+	}
+
 	if vm.Properties == nil ||
 		vm.Properties.StorageProfile == nil ||
 		vm.Properties.StorageProfile.ImageReference == nil ||
@@ -108,6 +115,12 @@ func (c *CloudProvider) isImageVersionDrifted(
 		return "", err
 	}
 
+	// never mix FIPS and non-FIPS images: switching fipsMode replaces existing nodes
+	if imagefamily.IsFIPSCommunityImage(communityImageName) != nodeClass.Spec.IsFIPSEnabled() {
+		logger.Debugf("drift triggered for %s, with expected FIPS enabled %t, and actual image %s", ImageVersionDrift, nodeClass.Spec.IsFIPSEnabled(), communityImageName)
+		return ImageVersionDrift, nil
+	}
+
 	expectedImageID, err := c.imageProvider.GetImageID(ctx, communityImageName, publicGalleryURL, nodeClass.Spec.GetImageVersion())
 	if err != nil {
 		return "", err
@@ -119,3 +132,41 @@ func (c *CloudProvider) isImageVersionDrifted(
 	}
 	return "", nil
 }
+
+// isCustomImageDrifted compares the image of the vm against the imageID of a Custom image family AKSNodeClass
+func isCustomImageDrifted(ctx context.Context, vm *armcompute.VirtualMachine, nodeClass *v1alpha2.AKSNodeClass) cloudprovider.DriftReason {
+	if vm.Properties == nil || vm.Properties.StorageProfile == nil || vm.Properties.StorageProfile.ImageReference == nil {
+		return ""
+	}
+	imageReference := vm.Properties.StorageProfile.ImageReference
+	vmImageID := lo.Ternary(imageReference.CommunityGalleryImageID != nil, lo.FromPtr(imageReference.CommunityGalleryImageID), lo.FromPtr(imageReference.ID))
+	expectedImageID := lo.FromPtr(nodeClass.Spec.ImageID)
+	// ARM resource IDs are case insensitive
+	if !strings.EqualFold(vmImageID, expectedImageID) {
+		logging.FromContext(ctx).Debugf("drift triggered for %s, with expected image id %s, and actual image id %s", ImageVersionDrift, expectedImageID, vmImageID)
+		return ImageVersionDrift
+	}
+	return ""
+}
+
+// isNodeClassDrifted compares the AKSNodeClass hash stamped on the NodeClaim at launch with the one stamped on the
+// AKSNodeClass by the nodeclass hash controller. Hashes of different hash versions are not comparable, so
+// such NodeClaims are not considered drifted until the hash controller has migrated them.
+func (c *CloudProvider) isNodeClassDrifted(ctx context.Context, nodeClaim *corev1beta1.NodeClaim, nodeClass *v1alpha2.AKSNodeClass) cloudprovider.DriftReason {
+	nodeClassHash, foundNodeClassHash := nodeClass.Annotations[v1alpha2.AnnotationAKSNodeClassHash]
+	nodeClassHashVersion, foundNodeClassHashVersion := nodeClass.Annotations[v1alpha2.AnnotationAKSNodeClassHashVersion]
+	nodeClaimHash, foundNodeClaimHash := nodeClaim.Annotations[v1alpha2.AnnotationAKSNodeClassHash]
+	nodeClaimHashVersion, foundNodeClaimHashVersion := nodeClaim.Annotations[v1alpha2.AnnotationAKSNodeClassHashVersion]
+
+	if !foundNodeClassHash || !foundNodeClaimHash || !foundNodeClassHashVersion || !foundNodeClaimHashVersion {
+		return ""
+	}
+	if nodeClassHashVersion != nodeClaimHashVersion {
+		return ""
+	}
+	if nodeClassHash != nodeClaimHash {
+		logging.FromContext(ctx).Debugf("drift triggered for %s, with expected hash %s, and actual hash %s", NodeClassDrift, nodeClassHash, nodeClaimHash)
+		return NodeClassDrift
+	}
+	return ""
+}
@@ -17,10 +17,15 @@ limitations under the License.
 package events
 
 import (
+	"fmt"
+
 	v1 "k8s.io/api/core/v1"
 
 	"sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/events"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 )
 
 func NodePoolFailedToResolveNodeClass(nodePool *v1beta1.NodePool) events.Event {
@@ -40,3 +45,65 @@ func NodeClaimFailedToResolveNodeClass(nodeClaim *v1beta1.NodeClaim) events.Even
 		DedupeValues:   []string{string(nodeClaim.UID)},
 	}
 }
+
+func NodeClaimFailedToLaunchOnTerminatingNodeClass(nodeClaim *v1beta1.NodeClaim, nodeClassName string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           v1.EventTypeWarning,
+		Reason:         "NodeClassTerminating",
+		Message:        fmt.Sprintf("Cannot launch, AKSNodeClass %s is terminating", nodeClassName),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClaimFailedToUpdateInPlace(nodeClaim *v1beta1.NodeClaim, err error) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           v1.EventTypeWarning,
+		Reason:         "FailedInPlaceUpdate",
+		Message:        fmt.Sprintf("Failed updating instance in place, %s", err),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClaimFellBackToOnDemand(nodeClaim *v1beta1.NodeClaim, instanceType string, err error) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           v1.EventTypeNormal,
+		Reason:         "SpotToOnDemandFallback",
+		Message:        fmt.Sprintf("Launched on-demand after failing to launch spot instance type %s, %s", instanceType, err),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClaimInvalidSpotToOnDemandFallback(nodeClaim *v1beta1.NodeClaim) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           v1.EventTypeWarning,
+		Reason:         "InvalidSpotToOnDemandFallback",
+		Message: fmt.Sprintf("Ignoring the invalid %s annotation %q of the NodePool template, allowing the fallback, valid values are %s and %s",
+			v1alpha2.AnnotationSpotToOnDemandFallback, nodeClaim.Annotations[v1alpha2.AnnotationSpotToOnDemandFallback],
+			v1alpha2.SpotToOnDemandFallbackAllowed, v1alpha2.SpotToOnDemandFallbackNever),
+		DedupeValues: []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClaimFailedToCreateVM(nodeClaim *v1beta1.NodeClaim, err error) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           v1.EventTypeWarning,
+		Reason:         "FailedVMCreation",
+		Message:        fmt.Sprintf("Failed creating VM, deleting NodeClaim, %s", err),
+		DedupeValues:   []string{string(nodeClaim.UID)},
+	}
+}
+
+func NodeClassWaitingOnNodeClaimTermination(nodeClass *v1alpha2.AKSNodeClass, names []string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClass,
+		Type:           v1.EventTypeNormal,
+		Reason:         "WaitingOnNodeClaimTermination",
+		Message:        fmt.Sprintf("Waiting on NodeClaim termination for %s", pretty.Slice(names, 5)),
+		DedupeValues:   []string{string(nodeClass.UID)},
+	}
+}
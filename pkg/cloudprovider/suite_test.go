@@ -19,6 +19,7 @@ package cloudprovider
 // TODO v1beta1 extra refactor into suite_test.go / cloudprovider_test.go
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -63,6 +64,7 @@ var nodeClass *v1alpha2.AKSNodeClass
 var nodeClaim *corev1beta1.NodeClaim
 var cluster *state.Cluster
 var cloudProvider *CloudProvider
+var recorder *coretest.EventRecorder
 
 func TestCloudProvider(t *testing.T) {
 	ctx = TestContextWithLogger(t)
@@ -78,7 +80,8 @@ var _ = BeforeSuite(func() {
 	azureEnv = test.NewEnvironment(ctx, env)
 
 	fakeClock = &clock.FakeClock{}
-	cloudProvider = New(azureEnv.InstanceTypesProvider, azureEnv.InstanceProvider, events.NewRecorder(&record.FakeRecorder{}), env.Client, azureEnv.ImageProvider)
+	recorder = coretest.NewEventRecorder()
+	cloudProvider = New(azureEnv.InstanceTypesProvider, azureEnv.InstanceProvider, recorder, env.Client, azureEnv.ImageProvider)
 	cluster = state.NewCluster(fakeClock, env.Client, cloudProvider)
 	coreProvisioner = provisioning.NewProvisioner(env.Client, events.NewRecorder(&record.FakeRecorder{}), cloudProvider, cluster)
 })
@@ -118,6 +121,7 @@ var _ = BeforeEach(func() {
 
 	cluster.Reset()
 	azureEnv.Reset()
+	recorder.Reset()
 })
 
 var _ = AfterEach(func() {
@@ -131,6 +135,9 @@ var _ = Describe("CloudProvider", func() {
 		ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
 		ExpectScheduled(ctx, env.Client, pod)
 		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+		// the launch lists the instances of the NodePool to balance zones, an Azure Resource Graph query of its own
+		Expect(azureEnv.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Len()).To(Equal(1))
+		azureEnv.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Reset()
 
 		nodeClaims, _ := cloudProvider.List(ctx)
 		Expect(azureEnv.AzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Len()).To(Equal(1))
@@ -141,6 +148,13 @@ var _ = Describe("CloudProvider", func() {
 		resp, _ := azureEnv.VirtualMachinesAPI.Get(ctx, azureEnv.AzureResourceGraphAPI.ResourceGroup, nodeClaims[0].Name, nil)
 		Expect(resp.VirtualMachine).ToNot(BeNil())
 	})
+	It("should stamp the AKSNodeClass hash on created NodeClaims", func() {
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+		cloudProviderNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cloudProviderNodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationAKSNodeClassHash, nodeClass.Hash()))
+		Expect(cloudProviderNodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationAKSNodeClassHashVersion, v1alpha2.AKSNodeClassHashVersion))
+	})
 	It("should return an ICE error when there are no instance types to launch", func() {
 		// Specify no instance types and expect to receive a capacity error
 		nodeClaim.Spec.Requirements = []corev1beta1.NodeSelectorRequirementWithMinValues{
@@ -158,6 +172,16 @@ var _ = Describe("CloudProvider", func() {
 		Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
 		Expect(cloudProviderMachine).To(BeNil())
 	})
+	It("should return an ICE error naming the AKSNodeClass when it is terminating", func() {
+		ExpectApplied(ctx, env.Client, nodePool, nodeClass, nodeClaim)
+		ExpectDeletionTimestampSet(ctx, env.Client, nodeClass)
+		cloudProviderNodeClaim, err := cloudProvider.Create(ctx, nodeClaim)
+		Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("AKSNodeClass %q is terminating", nodeClass.Name)))
+		Expect(cloudProviderNodeClaim).To(BeNil())
+		Expect(recorder.Calls("NodeClassTerminating")).To(Equal(1))
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
 	Context("Drift", func() {
 		var nodeClaim *corev1beta1.NodeClaim
 		var pod *v1.Pod
@@ -210,6 +234,74 @@ var _ = Describe("CloudProvider", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(drifted).To(BeEmpty())
 		})
+		It("should return drifted if the NodeClass FIPS mode no longer matches the image", func() {
+			nodeClass.Spec.FIPSMode = lo.ToPtr(v1alpha2.FIPSModeEnabled)
+			ExpectApplied(ctx, env.Client, nodeClass)
+			drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drifted).To(Equal(ImageVersionDrift))
+		})
+		It("should return drifted if the Custom image family imageID no longer matches the image", func() {
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.CustomImageFamily)
+			nodeClass.Spec.ImageID = lo.ToPtr("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/custom/versions/1.0.0")
+			nodeClass.Spec.UserData = lo.ToPtr("#!/bin/bash")
+			ExpectApplied(ctx, env.Client, nodeClass)
+			drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drifted).To(Equal(ImageVersionDrift))
+		})
+		Context("Static Drift", func() {
+			BeforeEach(func() {
+				nodeClass.Annotations = lo.Assign(nodeClass.Annotations, map[string]string{
+					v1alpha2.AnnotationAKSNodeClassHash:        nodeClass.Hash(),
+					v1alpha2.AnnotationAKSNodeClassHashVersion: v1alpha2.AKSNodeClassHashVersion,
+				})
+				nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, map[string]string{
+					v1alpha2.AnnotationAKSNodeClassHash:        nodeClass.Hash(),
+					v1alpha2.AnnotationAKSNodeClassHashVersion: v1alpha2.AKSNodeClassHashVersion,
+				})
+				ExpectApplied(ctx, env.Client, nodeClass)
+			})
+			It("should not return drifted if the hashes match", func() {
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(BeEmpty())
+			})
+			It("should return drifted if the AKSNodeClass hash changed", func() {
+				nodeClass.Spec.OSDiskSizeGB = lo.ToPtr[int32](256)
+				nodeClass.Annotations[v1alpha2.AnnotationAKSNodeClassHash] = nodeClass.Hash()
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(Equal(NodeClassDrift))
+			})
+			It("should not return drifted if only the tags changed", func() {
+				nodeClass.Spec.Tags = map[string]string{"team": "a"}
+				nodeClass.Annotations[v1alpha2.AnnotationAKSNodeClassHash] = nodeClass.Hash()
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(BeEmpty())
+			})
+			It("should not return drifted if the hash versions differ", func() {
+				nodeClass.Spec.OSDiskSizeGB = lo.ToPtr[int32](256)
+				nodeClass.Annotations[v1alpha2.AnnotationAKSNodeClassHash] = nodeClass.Hash()
+				nodeClaim.Annotations[v1alpha2.AnnotationAKSNodeClassHashVersion] = "test"
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(BeEmpty())
+			})
+			It("should not return drifted if the NodeClaim has no hash", func() {
+				nodeClass.Spec.OSDiskSizeGB = lo.ToPtr[int32](256)
+				nodeClass.Annotations[v1alpha2.AnnotationAKSNodeClassHash] = nodeClass.Hash()
+				delete(nodeClaim.Annotations, v1alpha2.AnnotationAKSNodeClassHash)
+				ExpectApplied(ctx, env.Client, nodeClass)
+				drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drifted).To(BeEmpty())
+			})
+		})
 		It("should error drift if NodeClaim doesn't have provider id", func() {
 			nodeClaim.Status = corev1beta1.NodeClaimStatus{}
 			drifted, err := cloudProvider.IsDrifted(ctx, nodeClaim)
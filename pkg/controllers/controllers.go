@@ -21,20 +21,37 @@ import (
 
 	"knative.dev/pkg/logging"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/karpenter/pkg/events"
 	"sigs.k8s.io/karpenter/pkg/operator/controller"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/instancetype/overhead"
+	nodeclaimcreation "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/creation"
 	nodeclaimgarbagecollection "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/garbagecollection"
 	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclaim/inplaceupdate"
+	nodeclasshash "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/hash"
+	nodeclassstatus "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	nodeclasstermination "github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/termination"
+	pricingoverrides "github.com/Azure/karpenter-provider-azure/pkg/controllers/pricing/overrides"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils/project"
 )
 
-func NewControllers(ctx context.Context, kubeClient client.Client, cloudProvider *cloudprovider.CloudProvider, instanceProvider *instance.Provider) []controller.Controller {
+func NewControllers(ctx context.Context, kubeClient client.Client, kubeReader client.Reader, cloudProvider *cloudprovider.CloudProvider, instanceProvider *instance.Provider,
+	instanceTypeProvider *instancetype.Provider, pricingProvider *pricing.Provider, imageProvider *imagefamily.Provider, subnetsClient instance.SubnetsAPI, recorder events.Recorder) []controller.Controller {
 	logging.FromContext(ctx).With("version", project.Version).Debugf("discovered version")
 	controllers := []controller.Controller{
 		nodeclaimgarbagecollection.NewController(kubeClient, cloudProvider),
-		inplaceupdate.NewController(kubeClient, instanceProvider),
+		inplaceupdate.NewController(kubeClient, instanceProvider, recorder),
+		nodeclaimcreation.NewController(kubeClient, instanceProvider, recorder),
+		overhead.NewController(kubeReader, instanceTypeProvider),
+		pricingoverrides.NewController(kubeClient, kubeReader, pricingProvider),
+		nodeclasshash.NewController(kubeClient),
+		nodeclassstatus.NewController(kubeClient, imageProvider, subnetsClient),
+		nodeclasstermination.NewController(kubeClient, recorder),
 	}
 	return controllers
 }
@@ -0,0 +1,81 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overhead
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/karpenter/pkg/operator/controller"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/configmap"
+)
+
+// ConfigMapName is the name of the optional ConfigMap, in the namespace of Karpenter, which overrides the overhead
+// options (kube-reserved-policy, kube-reserved-memory-brackets, kube-reserved-cpu-brackets, vm-memory-overhead-percent
+// and vm-memory-overhead-percent-overrides, keyed by flag name) without a restart
+const ConfigMapName = "karpenter-overhead"
+
+// Controller applies the overhead ConfigMap to the instance types, on top of the overhead options. The instance types
+// are recomputed once the overhead changes, so that the next launches use it without a restart.
+type Controller struct {
+	kubeReader           client.Reader
+	instanceTypeProvider *instancetype.Provider
+}
+
+// NewController takes an uncached reader for the ConfigMap, see configmap.Poll
+func NewController(kubeReader client.Reader, instanceTypeProvider *instancetype.Provider) *Controller {
+	return &Controller{
+		kubeReader:           kubeReader,
+		instanceTypeProvider: instanceTypeProvider,
+	}
+}
+
+func (c *Controller) Name() string {
+	return "instancetype.overhead"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	return configmap.Poll(ctx, c.kubeReader, ConfigMapName, func(configMap *v1.ConfigMap) error {
+		if configMap == nil {
+			if c.instanceTypeProvider.SetOverheadSettings(nil) {
+				logging.FromContext(ctx).Infof("overhead configmap removed, using the overhead options")
+			}
+			return nil
+		}
+		// an invalid ConfigMap keeps the last valid overhead in place
+		overheadSettings, err := options.FromContext(ctx).OverheadOverrides(configMap.Data)
+		if err != nil {
+			return fmt.Errorf("parsing overhead configmap, %w", err)
+		}
+		if c.instanceTypeProvider.SetOverheadSettings(overheadSettings) {
+			logging.FromContext(ctx).With("data", configMap.Data).Infof("applied overhead configmap")
+		}
+		return nil
+	})
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) controller.Builder {
+	return controller.NewSingletonManagedBy(m)
+}
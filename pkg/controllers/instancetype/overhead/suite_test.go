@@ -0,0 +1,120 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overhead_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/instancetype/overhead"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+var env *coretest.Environment
+var azureEnv *test.Environment
+var overheadController corecontroller.Controller
+
+func TestOverhead(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/InstanceType/Overhead")
+}
+
+var _ = BeforeSuite(func() {
+	os.Setenv("SYSTEM_NAMESPACE", "default")
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	ctx, stop = context.WithCancel(ctx)
+	azureEnv = test.NewEnvironment(ctx, env)
+
+	overheadController = overhead.NewController(env.Client, azureEnv.InstanceTypesProvider)
+})
+
+var _ = AfterSuite(func() {
+	stop()
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Overhead", func() {
+	var configMap *v1.ConfigMap
+
+	BeforeEach(func() {
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: overhead.ConfigMapName, Namespace: "default"},
+			Data:       map[string]string{"kube-reserved-policy": options.KubeReservedPolicyAKS},
+		}
+		azureEnv.Reset()
+	})
+
+	AfterEach(func() {
+		ExpectDeleted(ctx, env.Client, configMap)
+	})
+
+	kubeReservedMemory := func() string {
+		GinkgoHelper()
+		instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, test.AKSNodeClass())
+		Expect(err).ToNot(HaveOccurred())
+		instanceType, ok := lo.Find(instanceTypes, func(instanceType *corecloudprovider.InstanceType) bool { return instanceType.Name == "Standard_D2s_v3" })
+		Expect(ok).To(BeTrue())
+		return instanceType.Overhead.KubeReserved.Memory().String()
+	}
+
+	It("should use the overhead options without the configmap", func() {
+		ExpectReconcileSucceeded(ctx, overheadController, client.ObjectKey{})
+		Expect(kubeReservedMemory()).To(Equal("1843Mi"))
+	})
+	It("should apply the configmap and revert when it is deleted", func() {
+		ExpectApplied(ctx, env.Client, configMap)
+		ExpectReconcileSucceeded(ctx, overheadController, client.ObjectKey{})
+		Expect(kubeReservedMemory()).To(Equal("2Gi"))
+
+		ExpectDeleted(ctx, env.Client, configMap)
+		ExpectReconcileSucceeded(ctx, overheadController, client.ObjectKey{})
+		Expect(kubeReservedMemory()).To(Equal("1843Mi"))
+	})
+	It("should keep the last valid overrides when the configmap is invalid", func() {
+		ExpectApplied(ctx, env.Client, configMap)
+		ExpectReconcileSucceeded(ctx, overheadController, client.ObjectKey{})
+
+		configMap.Data = map[string]string{"kube-reserved-policy": "aks-next"}
+		ExpectApplied(ctx, env.Client, configMap)
+		ExpectReconcileFailed(ctx, overheadController, client.ObjectKey{})
+		Expect(kubeReservedMemory()).To(Equal("2Gi"))
+	})
+})
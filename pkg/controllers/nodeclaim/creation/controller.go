@@ -0,0 +1,135 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package creation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"knative.dev/pkg/logging"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/events"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+// pollInterval is how often the provisioning state of a VM being created is polled
+const pollInterval = 10 * time.Second
+
+// Controller tracks the VMs created asynchronously, polling their provisioning state until it is final. Once the VM
+// is provisioned, the annotation marking its creation as accepted is removed. When the creation fails, the NodeClaim
+// is deleted, as it is when its launch fails, which deletes what was created of the VM and its NIC.
+type Controller struct {
+	kubeClient       client.Client
+	instanceProvider *instance.Provider
+	recorder         events.Recorder
+}
+
+var _ corecontroller.TypedController[*v1beta1.NodeClaim] = &Controller{}
+
+func NewController(
+	kubeClient client.Client,
+	instanceProvider *instance.Provider,
+	recorder events.Recorder,
+) corecontroller.Controller {
+	controller := &Controller{
+		kubeClient:       kubeClient,
+		instanceProvider: instanceProvider,
+		recorder:         recorder,
+	}
+
+	return corecontroller.Typed[*v1beta1.NodeClaim](kubeClient, controller)
+}
+
+func (c *Controller) Name() string {
+	return "nodeclaim.creation"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClaim *v1beta1.NodeClaim) (reconcile.Result, error) {
+	accepted, ok := nodeClaim.Annotations[v1alpha2.AnnotationVMCreationAccepted]
+	if !ok || !nodeClaim.DeletionTimestamp.IsZero() || nodeClaim.Status.ProviderID == "" {
+		return reconcile.Result{}, nil
+	}
+	vmName, err := utils.GetVMName(nodeClaim.Status.ProviderID)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	state, err := c.instanceProvider.PollCreation(ctx, vmName)
+	if err != nil {
+		if !corecloudprovider.IsNodeClaimNotFoundError(err) {
+			return reconcile.Result{}, fmt.Errorf("polling creation of VM %s, %w", vmName, err)
+		}
+		// the VM of a creation which failed may have been deleted already
+		state = instance.CreationState{ProvisioningState: instance.ProvisioningStateFailed, Err: err}
+	}
+
+	switch state.ProvisioningState {
+	case instance.ProvisioningStateSucceeded:
+		observeCreationDuration(accepted, state.ProvisioningState)
+		stored := nodeClaim.DeepCopy()
+		delete(nodeClaim.Annotations, v1alpha2.AnnotationVMCreationAccepted)
+		if err := c.kubeClient.Patch(ctx, nodeClaim, client.MergeFrom(stored)); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+		return reconcile.Result{}, nil
+	case instance.ProvisioningStateFailed:
+		observeCreationDuration(accepted, state.ProvisioningState)
+		logging.FromContext(ctx).With("vm", vmName).Errorf("creating VM failed, deleting node claim, %s", state.Err)
+		c.recorder.Publish(cloudproviderevents.NodeClaimFailedToCreateVM(nodeClaim, state.Err))
+		if err := c.kubeClient.Delete(ctx, nodeClaim); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+		return reconcile.Result{}, nil
+	default:
+		return reconcile.Result{RequeueAfter: pollInterval}, nil
+	}
+}
+
+// observeCreationDuration records the time from ARM accepting the creation of the VM to its final provisioning state
+func observeCreationDuration(accepted string, provisioningState string) {
+	acceptedAt, err := time.Parse(time.RFC3339, accepted)
+	if err != nil {
+		return
+	}
+	metrics.InstanceCreationDuration.WithLabelValues(provisioningState).Observe(time.Since(acceptedAt).Seconds())
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.NewControllerManagedBy(m).For(
+		&v1beta1.NodeClaim{},
+		// only the NodeClaims whose VM is being created asynchronously
+		builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			_, ok := o.GetAnnotations()[v1alpha2.AnnotationVMCreationAccepted]
+			return ok
+		})),
+	).WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
@@ -0,0 +1,159 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package creation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+var env *coretest.Environment
+var azureEnv *test.Environment
+var recorder *coretest.EventRecorder
+var creationController corecontroller.Controller
+
+func TestCreation(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/Creation")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+
+	ctx, stop = context.WithCancel(ctx)
+	azureEnv = test.NewEnvironment(ctx, env)
+
+	recorder = coretest.NewEventRecorder()
+	creationController = NewController(env.Client, azureEnv.InstanceProvider, recorder)
+})
+
+var _ = AfterSuite(func() {
+	stop()
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Creation Controller", func() {
+	var vmName string
+	var vmID string
+	var nodeClaim *corev1beta1.NodeClaim
+
+	// storeVM stores the VM of the NodeClaim, in the provisioning state. The creations accepted by the instance
+	// provider of the test environment are not tracked, so the controller reads the provisioning state from the VM.
+	storeVM := func(provisioningState string) {
+		azureEnv.VirtualMachinesAPI.Instances.Store(vmID, armcompute.VirtualMachine{
+			ID:   lo.ToPtr(vmID),
+			Name: lo.ToPtr(vmName),
+			Properties: &armcompute.VirtualMachineProperties{
+				ProvisioningState: lo.ToPtr(provisioningState),
+			},
+		})
+	}
+
+	BeforeEach(func() {
+		vmName = "vm-a"
+		vmID = utils.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName)
+		nodeClaim = coretest.NodeClaim(corev1beta1.NodeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					v1alpha2.AnnotationVMCreationAccepted: time.Now().Add(-time.Minute).Format(time.RFC3339),
+				},
+			},
+			Status: corev1beta1.NodeClaimStatus{
+				ProviderID: utils.ResourceIDToProviderID(ctx, vmID),
+			},
+		})
+
+		ctx = options.ToContext(ctx, test.Options())
+
+		azureEnv.Reset()
+		recorder.Reset()
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should remove the annotation once the VM is provisioned", func() {
+		storeVM(instance.ProvisioningStateSucceeded)
+		ExpectApplied(ctx, env.Client, nodeClaim)
+		result := ExpectReconcileSucceeded(ctx, creationController, client.ObjectKeyFromObject(nodeClaim))
+		Expect(result.RequeueAfter).To(BeZero())
+
+		nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+		Expect(nodeClaim.Annotations).ToNot(HaveKey(v1alpha2.AnnotationVMCreationAccepted))
+		Expect(recorder.Calls("FailedVMCreation")).To(Equal(0))
+	})
+	It("should requeue while the VM is being created", func() {
+		storeVM(instance.ProvisioningStateCreating)
+		ExpectApplied(ctx, env.Client, nodeClaim)
+		result := ExpectReconcileSucceeded(ctx, creationController, client.ObjectKeyFromObject(nodeClaim))
+		Expect(result.RequeueAfter).To(Equal(pollInterval))
+
+		nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+		Expect(nodeClaim.Annotations).To(HaveKey(v1alpha2.AnnotationVMCreationAccepted))
+	})
+	It("should delete the NodeClaim when the VM fails to be created", func() {
+		storeVM(instance.ProvisioningStateFailed)
+		ExpectApplied(ctx, env.Client, nodeClaim)
+		ExpectReconcileSucceeded(ctx, creationController, client.ObjectKeyFromObject(nodeClaim))
+
+		ExpectNotFound(ctx, env.Client, nodeClaim)
+		Expect(recorder.Calls("FailedVMCreation")).To(Equal(1))
+	})
+	It("should delete the NodeClaim when the VM is gone", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim)
+		ExpectReconcileSucceeded(ctx, creationController, client.ObjectKeyFromObject(nodeClaim))
+
+		ExpectNotFound(ctx, env.Client, nodeClaim)
+		Expect(recorder.Calls("FailedVMCreation")).To(Equal(1))
+	})
+	It("should ignore NodeClaims whose VM was not created asynchronously", func() {
+		delete(nodeClaim.Annotations, v1alpha2.AnnotationVMCreationAccepted)
+		ExpectApplied(ctx, env.Client, nodeClaim)
+		ExpectReconcileSucceeded(ctx, creationController, client.ObjectKeyFromObject(nodeClaim))
+
+		ExpectExists(ctx, env.Client, nodeClaim)
+		Expect(azureEnv.VirtualMachinesAPI.VirtualMachineGetBehavior.Calls()).To(Equal(0))
+	})
+})
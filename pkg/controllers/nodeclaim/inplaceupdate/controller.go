@@ -20,9 +20,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/samber/lo"
 	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/logging"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -32,18 +38,26 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/events"
 	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	nodeclaimutil "sigs.k8s.io/karpenter/pkg/utils/nodeclaim"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 )
 
+// Controller reconciles the properties of the instance of a NodeClaim which can be updated without replacing it:
+// the node identities, the tags of the VM, NIC and OS disk, the security groups of the NIC and the extensions of the
+// VM. Updates which Azure rejects are published as events and retried with the exponential backoff of the controller.
 type Controller struct {
 	kubeClient       client.Client
 	instanceProvider *instance.Provider
+	recorder         events.Recorder
 }
 
 var _ corecontroller.TypedController[*v1beta1.NodeClaim] = &Controller{}
@@ -51,10 +65,12 @@ var _ corecontroller.TypedController[*v1beta1.NodeClaim] = &Controller{}
 func NewController(
 	kubeClient client.Client,
 	instanceProvider *instance.Provider,
+	recorder events.Recorder,
 ) corecontroller.Controller {
 	controller := &Controller{
 		kubeClient:       kubeClient,
 		instanceProvider: instanceProvider,
+		recorder:         recorder,
 	}
 
 	return corecontroller.Typed[*v1beta1.NodeClaim](kubeClient, controller)
@@ -76,13 +92,14 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClaim *v1beta1.NodeClaim
 
 	stored := nodeClaim.DeepCopy()
 
-	// TODO: When we have sources of truth coming from NodePool we can do:
-	// nodePool, err := nodeclaimutil.Owner(ctx, c.kubeClient, nodeClaim)
-	// TODO: To look it up and use that as input to calculate the goal state as well
+	nodeClass, err := c.resolveNodeClass(ctx, nodeClaim)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
 
 	// Compare the expected hash with the actual hash
 	options := options.FromContext(ctx)
-	goalHash, err := HashFromNodeClaim(options, nodeClaim)
+	goalHash, err := HashFromNodeClaim(options, nodeClaim, nodeClass)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -95,6 +112,12 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClaim *v1beta1.NodeClaim
 		return reconcile.Result{}, nil
 	}
 
+	// The NIC and extensions of VMs created asynchronously can't be updated until they are created. Their creation
+	// only changes annotations, which don't trigger reconciliation, so check again later.
+	if _, ok := nodeClaim.Annotations[v1alpha2.AnnotationVMCreationAccepted]; ok {
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
 	vmName, err := utils.GetVMName(nodeClaim.Status.ProviderID)
 	if err != nil {
 		return reconcile.Result{}, err
@@ -105,17 +128,14 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClaim *v1beta1.NodeClaim
 		return reconcile.Result{}, fmt.Errorf("getting azure VM for machine, %w", err)
 	}
 
-	update := calculateVMPatch(options, vm)
-	// This is safe only as long as we're not updating fields which we consider secret.
-	// If we do/are, we need to redact them.
-	logVMPatch(ctx, update)
-
-	// Apply the update, if one is needed
-	if update != nil {
-		err = c.instanceProvider.Update(ctx, vmName, *update)
-		if err != nil {
-			return reconcile.Result{}, fmt.Errorf("failed to apply update to VM, %w", err)
-		}
+	var goalTags map[string]*string
+	if nodeClass != nil {
+		goalTags = instance.GetTags(options.ClusterName, nodeClass, nodeClaim)
+	}
+	owned := ownedFromAnnotations(nodeClaim.Annotations)
+	if err = c.applyUpdates(ctx, vm, calculateVMPatch(options, goalTags, owned.tagKeys, vm), nodeClass, goalTags, owned); err != nil {
+		c.recorder.Publish(cloudproviderevents.NodeClaimFailedToUpdateInPlace(nodeClaim, err))
+		return reconcile.Result{}, err
 	}
 
 	if nodeClaim.Annotations == nil {
@@ -124,6 +144,11 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClaim *v1beta1.NodeClaim
 	// Regardless of whether we actually changed anything in Azure, we have confirmed that
 	// the goal shape is in alignment with our expected shape, so update the annotation to reflect that
 	nodeClaim.Annotations[v1alpha2.AnnotationInPlaceUpdateHash] = goalHash
+	if nodeClass != nil {
+		nodeClaim.Annotations[v1alpha2.AnnotationInPlaceUpdateTagKeys] = TagKeysAnnotation(goalTags)
+		nodeClaim.Annotations[v1alpha2.AnnotationInPlaceUpdateSecurityGroupIDs] = SecurityGroupIDsAnnotation(nodeClass)
+		nodeClaim.Annotations[v1alpha2.AnnotationInPlaceUpdateExtensionNames] = ExtensionNamesAnnotation(nodeClass)
+	}
 	err = c.kubeClient.Patch(ctx, nodeClaim, client.MergeFrom(stored))
 	if err != nil {
 		return reconcile.Result{}, client.IgnoreNotFound(err)
@@ -132,11 +157,118 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClaim *v1beta1.NodeClaim
 	return reconcile.Result{}, nil
 }
 
+// applyUpdates patches the VM, then brings the tags of its NIC and OS disk, the security groups of its NIC and its
+// extensions in line with the AKSNodeClass, if it is known. Only what Karpenter applied before is removed.
+func (c *Controller) applyUpdates(ctx context.Context, vm *armcompute.VirtualMachine, update *armcompute.VirtualMachineUpdate,
+	nodeClass *v1alpha2.AKSNodeClass, goalTags map[string]*string, owned ownership) error {
+	vmName := lo.FromPtr(vm.Name)
+	// This is safe only as long as we're not updating fields which we consider secret.
+	// If we do/are, we need to redact them.
+	logVMPatch(ctx, update)
+
+	// Apply the update, if one is needed
+	if update != nil {
+		if err := c.instanceProvider.Update(ctx, vmName, *update); err != nil {
+			return fmt.Errorf("failed to apply update to VM, %w", err)
+		}
+	}
+	if nodeClass == nil {
+		return nil
+	}
+	for _, nicName := range networkInterfaceNames(vm) {
+		if err := c.updateNetworkInterface(ctx, nicName, nodeClass, goalTags, owned); err != nil {
+			return err
+		}
+	}
+	if diskName, ok := managedOSDiskName(vm); ok {
+		current, err := c.instanceProvider.OSDiskTags(ctx, diskName)
+		if err != nil {
+			return fmt.Errorf("failed to get tags of OS disk %s, %w", diskName, err)
+		}
+		if tags := mergeTags(current, goalTags, owned.tagKeys); !tagsEqual(tags, current) {
+			if err := c.instanceProvider.UpdateOSDiskTags(ctx, diskName, tags); err != nil {
+				return fmt.Errorf("failed to update tags of OS disk %s, %w", diskName, err)
+			}
+		}
+	}
+	return c.updateExtensions(ctx, vm, nodeClass, owned.extensionNames)
+}
+
+// updateNetworkInterface brings the tags and security groups of the NIC in line with the AKSNodeClass. Security groups
+// can't be patched, so changing them replaces the NIC, along with its tags.
+func (c *Controller) updateNetworkInterface(ctx context.Context, nicName string, nodeClass *v1alpha2.AKSNodeClass,
+	goalTags map[string]*string, owned ownership) error {
+	nic, err := c.instanceProvider.NetworkInterface(ctx, nicName)
+	if err != nil {
+		return fmt.Errorf("failed to get network interface %s, %w", nicName, err)
+	}
+	tags := mergeTags(nic.Tags, goalTags, owned.tagKeys)
+	if mergeSecurityGroups(nic, nodeClass, owned.securityGroupIDs) {
+		nic.Tags = tags
+		if err := c.instanceProvider.UpdateNetworkInterface(ctx, nicName, *nic); err != nil {
+			return fmt.Errorf("failed to update security groups of network interface %s, %w", nicName, err)
+		}
+		return nil
+	}
+	if !tagsEqual(tags, nic.Tags) {
+		if err := c.instanceProvider.UpdateNetworkInterfaceTags(ctx, nicName, tags); err != nil {
+			return fmt.Errorf("failed to update tags of network interface %s, %w", nicName, err)
+		}
+	}
+	return nil
+}
+
+// updateExtensions installs the extensions of the AKSNodeClass which are missing from the VM or differ from the ones
+// installed, and uninstalls the ones Karpenter installed before which the AKSNodeClass no longer has
+func (c *Controller) updateExtensions(ctx context.Context, vm *armcompute.VirtualMachine, nodeClass *v1alpha2.AKSNodeClass, ownedNames sets.Set[string]) error {
+	vmName := lo.FromPtr(vm.Name)
+	for _, extension := range nodeClass.Spec.Extensions {
+		current, _ := lo.Find(vm.Resources, func(installed *armcompute.VirtualMachineExtension) bool {
+			return installed != nil && strings.EqualFold(lo.FromPtr(installed.Name), extension.Name)
+		})
+		if extensionUpToDate(current, extension) {
+			continue
+		}
+		if err := c.instanceProvider.CreateOrUpdateExtension(ctx, vmName, extension); err != nil {
+			return err
+		}
+	}
+	for _, name := range sets.List(ownedNames) {
+		if lo.ContainsBy(nodeClass.Spec.Extensions, func(extension v1alpha2.Extension) bool { return strings.EqualFold(extension.Name, name) }) {
+			continue
+		}
+		if err := c.instanceProvider.DeleteExtension(ctx, vmName, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveNodeClass returns the AKSNodeClass of the NodeClaim, or nil if it doesn't exist (anymore)
+func (c *Controller) resolveNodeClass(ctx context.Context, nodeClaim *v1beta1.NodeClaim) (*v1alpha2.AKSNodeClass, error) {
+	if nodeClaim.Spec.NodeClassRef == nil {
+		return nil, nil
+	}
+	nodeClass := &v1alpha2.AKSNodeClass{}
+	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: nodeClaim.Spec.NodeClassRef.Name}, nodeClass); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("resolving node class, %w", err)
+	}
+	return nodeClass, nil
+}
+
 func calculateVMPatch(
 	options *options.Options,
-	// TODO: Can pass and consider NodeClaim and/or NodePool here if we need to in the future
+	// goalTags is nil when the tags are not known, in which case they are left untouched
+	goalTags map[string]*string,
+	// ownedTagKeys are the keys of the tags Karpenter applied before, the only ones which are removed
+	ownedTagKeys sets.Set[string],
 	currentVM *armcompute.VirtualMachine,
 ) *armcompute.VirtualMachineUpdate {
+	update := &armcompute.VirtualMachineUpdate{}
+
 	// Determine the differences between the current state and the goal state
 	expectedIdentities := options.NodeIdentities
 	var currentIdentities []string
@@ -148,16 +280,58 @@ func calculateVMPatch(
 	// It's not possible to PATCH identities away, so for now we never remove them even if they've been removed from
 	// the configmap. This matches the RPs behavior and also ensures that we don't remove identities which users have
 	// manually added.
+	if len(toAdd) > 0 {
+		update.Identity = instance.ConvertToVirtualMachineIdentity(toAdd)
+	}
 
-	if len(toAdd) == 0 {
+	// Unlike identities, tags are replaced as a whole, so the goal tags are merged into the current ones, removing the
+	// tags removed from the AKSNodeClass.
+	if goalTags != nil {
+		if tags := mergeTags(currentVM.Tags, goalTags, ownedTagKeys); !tagsEqual(tags, currentVM.Tags) {
+			update.Tags = tags
+		}
+	}
+
+	if update.Identity == nil && update.Tags == nil {
 		return nil // No update to perform
 	}
+	return update
+}
 
-	identity := instance.ConvertToVirtualMachineIdentity(toAdd)
+func tagsEqual(a, b map[string]*string) bool {
+	toValues := func(tags map[string]*string) map[string]string {
+		return lo.MapValues(tags, func(v *string, _ string) string { return lo.FromPtr(v) })
+	}
+	return equality.Semantic.DeepEqual(toValues(a), toValues(b))
+}
+
+// networkInterfaceNames returns the names of the NICs attached to the VM
+func networkInterfaceNames(vm *armcompute.VirtualMachine) []string {
+	if vm.Properties == nil || vm.Properties.NetworkProfile == nil {
+		return nil
+	}
+	return lo.FilterMap(vm.Properties.NetworkProfile.NetworkInterfaces, func(nic *armcompute.NetworkInterfaceReference, _ int) (string, bool) {
+		if nic == nil || nic.ID == nil {
+			return "", false
+		}
+		id, err := arm.ParseResourceID(*nic.ID)
+		if err != nil {
+			return "", false
+		}
+		return id.Name, true
+	})
+}
 
-	return &armcompute.VirtualMachineUpdate{
-		Identity: identity,
+// managedOSDiskName returns the name of the OS disk of the VM, unless it is ephemeral and has no disk resource to tag
+func managedOSDiskName(vm *armcompute.VirtualMachine) (string, bool) {
+	if vm.Properties == nil || vm.Properties.StorageProfile == nil || vm.Properties.StorageProfile.OSDisk == nil {
+		return "", false
+	}
+	osDisk := vm.Properties.StorageProfile.OSDisk
+	if osDisk.DiffDiskSettings != nil || osDisk.Name == nil {
+		return "", false
 	}
+	return *osDisk.Name, true
 }
 
 func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
@@ -167,7 +341,12 @@ func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontrolle
 			predicate.Or(
 				predicate.GenerationChangedPredicate{}, // Note that this will trigger on pod restart for all Machines.
 			),
-		)).WithOptions(controller.Options{MaxConcurrentReconciles: 10}),
+		)).
+		// Changes to the AKSNodeClass (e.g. tags) flow down to the VMs of its NodeClaims
+		Watches(
+			&v1alpha2.AKSNodeClass{},
+			nodeclaimutil.NodeClassEventHandler(c.kubeClient),
+		).WithOptions(controller.Options{MaxConcurrentReconciles: 10}),
 	// TODO: Can add .Watches(&v1beta1.NodePool{}, nodeclaimutil.NodePoolEventHandler(c.kubeClient))
 	// TODO: similar to https://github.com/kubernetes-sigs/karpenter/blob/main/pkg/controllers/nodeclaim/disruption/controller.go#L214C3-L217C5
 	// TODO: if/when we need to monitor provisoner changes and flow updates on the NodePool down to the underlying VMs.
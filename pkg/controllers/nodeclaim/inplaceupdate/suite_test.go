@@ -18,12 +18,20 @@ package inplaceupdate
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	. "knative.dev/pkg/logging/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
@@ -36,6 +44,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/apis"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 )
@@ -44,6 +53,7 @@ var ctx context.Context
 var stop context.CancelFunc
 var env *coretest.Environment
 var azureEnv *test.Environment
+var recorder *coretest.EventRecorder
 var inPlaceUpdateController corecontroller.Controller
 
 func TestInPlaceUpdate(t *testing.T) {
@@ -60,7 +70,8 @@ var _ = BeforeSuite(func() {
 	ctx, stop = context.WithCancel(ctx)
 	azureEnv = test.NewEnvironment(ctx, env)
 
-	inPlaceUpdateController = NewController(env.Client, azureEnv.InstanceProvider)
+	recorder = coretest.NewEventRecorder()
+	inPlaceUpdateController = NewController(env.Client, azureEnv.InstanceProvider, recorder)
 })
 
 var _ = AfterSuite(func() {
@@ -115,6 +126,28 @@ var _ = Describe("Unit tests", func() {
 		})
 	})
 
+	Context("HashFromVM tags", func() {
+		It("should match the hash of the NodeClaim the VM was launched for", func() {
+			nodeClass := test.AKSNodeClass(v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{Tags: map[string]string{"team": "a"}}})
+			nodeClaim := coretest.NodeClaim(corev1beta1.NodeClaim{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{corev1beta1.NodePoolLabelKey: "default"}},
+			})
+			options := test.Options()
+
+			vm := &armcompute.VirtualMachine{Tags: instance.GetTags(options.ClusterName, nodeClass, nodeClaim)}
+			vmHash, err := HashFromVM(vm)
+			Expect(err).ToNot(HaveOccurred())
+			nodeClaimHash, err := HashFromNodeClaim(options, nodeClaim, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmHash).To(Equal(nodeClaimHash))
+
+			nodeClass.Spec.Tags["team"] = "b"
+			nodeClaimHash, err = HashFromNodeClaim(options, nodeClaim, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmHash).ToNot(Equal(nodeClaimHash))
+		})
+	})
+
 	Context("HashFromNodeClaim", func() {
 		It("should not depend on identity ordering", func() {
 			options := test.Options()
@@ -124,7 +157,7 @@ var _ = Describe("Unit tests", func() {
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid3",
 			}
 
-			hash1, err := HashFromNodeClaim(options, nil)
+			hash1, err := HashFromNodeClaim(options, nil, nil)
 			Expect(err).ToNot(HaveOccurred())
 
 			options.NodeIdentities = []string{
@@ -132,7 +165,7 @@ var _ = Describe("Unit tests", func() {
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1",
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid3",
 			}
-			hash2, err := HashFromNodeClaim(options, nil)
+			hash2, err := HashFromNodeClaim(options, nil, nil)
 			Expect(err).ToNot(HaveOccurred())
 
 			options.NodeIdentities = []string{
@@ -140,7 +173,7 @@ var _ = Describe("Unit tests", func() {
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid2",
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1",
 			}
-			hash3, err := HashFromNodeClaim(options, nil)
+			hash3, err := HashFromNodeClaim(options, nil, nil)
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(hash1).To(Equal(hash2))
@@ -148,6 +181,118 @@ var _ = Describe("Unit tests", func() {
 		})
 	})
 
+	Context("HashFromNodeClaim security groups and extensions", func() {
+		It("should not change the hash of AKSNodeClasses without security groups and extensions", func() {
+			nodeClass := test.AKSNodeClass()
+			nodeClaim := coretest.NodeClaim()
+			options := test.Options()
+
+			hash, err := HashFromNodeClaim(options, nodeClaim, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			expected, err := (&inPlaceUpdateFields{
+				Identities: sets.New(options.NodeIdentities...),
+				Tags:       lo.MapValues(instance.GetTags(options.ClusterName, nodeClass, nodeClaim), func(v *string, _ string) string { return lo.FromPtr(v) }),
+			}).CalculateHash()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hash).To(Equal(expected))
+		})
+		It("should change the hash when the security groups or extensions change", func() {
+			nodeClass := test.AKSNodeClass()
+			nodeClaim := coretest.NodeClaim()
+			options := test.Options()
+
+			hash1, err := HashFromNodeClaim(options, nodeClaim, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			nodeClass.Spec.ApplicationSecurityGroupIDs = []string{asgID("asg-a")}
+			hash2, err := HashFromNodeClaim(options, nodeClaim, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{monitorExtension()}
+			hash3, err := HashFromNodeClaim(options, nodeClaim, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(hash1).ToNot(Equal(hash2))
+			Expect(hash2).ToNot(Equal(hash3))
+		})
+	})
+
+	Context("mergeSecurityGroups", func() {
+		newNIC := func(nsgID string, asgIDs ...string) *armnetwork.Interface {
+			nic := &armnetwork.Interface{Properties: &armnetwork.InterfacePropertiesFormat{
+				IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
+					{Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{ApplicationSecurityGroups: instance.NewApplicationSecurityGroups(asgIDs)}},
+				},
+			}}
+			if nsgID != "" {
+				nic.Properties.NetworkSecurityGroup = &armnetwork.SecurityGroup{ID: lo.ToPtr(nsgID)}
+			}
+			return nic
+		}
+		asgIDsOf := func(nic *armnetwork.Interface) []string {
+			return lo.Map(nic.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups, func(asg *armnetwork.ApplicationSecurityGroup, _ int) string {
+				return lo.FromPtr(asg.ID)
+			})
+		}
+
+		It("should associate the security groups of the AKSNodeClass", func() {
+			nodeClass := test.AKSNodeClass(v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{
+				NetworkSecurityGroupID:      lo.ToPtr(nsgID("nsg-a")),
+				ApplicationSecurityGroupIDs: []string{asgID("asg-a")},
+			}})
+			nic := newNIC("")
+
+			Expect(mergeSecurityGroups(nic, nodeClass, sets.New[string]())).To(BeTrue())
+			Expect(lo.FromPtr(nic.Properties.NetworkSecurityGroup.ID)).To(Equal(nsgID("nsg-a")))
+			Expect(asgIDsOf(nic)).To(ConsistOf(asgID("asg-a")))
+		})
+		It("should dissociate the security groups Karpenter associated and keep the ones associated outside Karpenter", func() {
+			nodeClass := test.AKSNodeClass()
+			nic := newNIC(nsgID("nsg-a"), asgID("asg-a"), asgID("asg-other"))
+
+			Expect(mergeSecurityGroups(nic, nodeClass, sets.New(strings.ToLower(nsgID("nsg-a")), strings.ToLower(asgID("asg-a"))))).To(BeTrue())
+			Expect(nic.Properties.NetworkSecurityGroup).To(BeNil())
+			Expect(asgIDsOf(nic)).To(ConsistOf(asgID("asg-other")))
+		})
+		It("should keep a network security group associated outside Karpenter", func() {
+			nodeClass := test.AKSNodeClass()
+			nic := newNIC(nsgID("nsg-other"))
+
+			Expect(mergeSecurityGroups(nic, nodeClass, sets.New(strings.ToLower(nsgID("nsg-a"))))).To(BeFalse())
+			Expect(lo.FromPtr(nic.Properties.NetworkSecurityGroup.ID)).To(Equal(nsgID("nsg-other")))
+		})
+		It("should not change security groups which only differ in case", func() {
+			nodeClass := test.AKSNodeClass(v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{
+				NetworkSecurityGroupID:      lo.ToPtr(nsgID("nsg-a")),
+				ApplicationSecurityGroupIDs: []string{asgID("asg-a")},
+			}})
+			nic := newNIC(strings.ToUpper(nsgID("nsg-a")), strings.ToUpper(asgID("asg-a")))
+
+			Expect(mergeSecurityGroups(nic, nodeClass, sets.New(strings.ToLower(nsgID("nsg-a")), strings.ToLower(asgID("asg-a"))))).To(BeFalse())
+		})
+	})
+
+	Context("extensionUpToDate", func() {
+		It("should match the extension installed from the AKSNodeClass", func() {
+			extension := monitorExtension()
+			installed := &armcompute.VirtualMachineExtension{
+				Name: lo.ToPtr(extension.Name),
+				Properties: &armcompute.VirtualMachineExtensionProperties{
+					Publisher:               lo.ToPtr(extension.Publisher),
+					Type:                    lo.ToPtr(extension.Type),
+					TypeHandlerVersion:      lo.ToPtr(extension.TypeHandlerVersion),
+					AutoUpgradeMinorVersion: lo.ToPtr(true),
+					Settings:                map[string]any{"enableAMA": "true"},
+				},
+			}
+			Expect(extensionUpToDate(installed, extension)).To(BeTrue())
+
+			extension.Settings = &runtime.RawExtension{Raw: []byte(`{"enableAMA":"false"}`)}
+			Expect(extensionUpToDate(installed, extension)).To(BeFalse())
+		})
+		It("should not match a missing extension", func() {
+			Expect(extensionUpToDate(nil, monitorExtension())).To(BeFalse())
+		})
+	})
+
 	Context("calculateVMPatch", func() {
 		It("should add missing identities when there are no existing identities", func() {
 			currentVM := &armcompute.VirtualMachine{}
@@ -156,7 +301,7 @@ var _ = Describe("Unit tests", func() {
 			options.NodeIdentities = []string{
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1",
 			}
-			update := calculateVMPatch(options, currentVM)
+			update := calculateVMPatch(options, nil, nil, currentVM)
 
 			Expect(update).ToNot(BeNil())
 			Expect(update.Identity).ToNot(BeNil())
@@ -177,7 +322,7 @@ var _ = Describe("Unit tests", func() {
 			options.NodeIdentities = []string{
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid2",
 			}
-			update := calculateVMPatch(options, currentVM)
+			update := calculateVMPatch(options, nil, nil, currentVM)
 
 			Expect(update).ToNot(BeNil())
 			Expect(update.Identity).ToNot(BeNil())
@@ -200,7 +345,58 @@ var _ = Describe("Unit tests", func() {
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid2",
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1",
 			}
-			update := calculateVMPatch(options, currentVM)
+			update := calculateVMPatch(options, nil, nil, currentVM)
+
+			Expect(update).To(BeNil())
+		})
+
+		It("should replace tags which differ from the goal tags", func() {
+			currentVM := &armcompute.VirtualMachine{
+				Tags: map[string]*string{"team": lo.ToPtr("a"), "removed": lo.ToPtr("true")},
+			}
+			update := calculateVMPatch(test.Options(), map[string]*string{"team": lo.ToPtr("b")}, sets.New("team", "removed"), currentVM)
+
+			Expect(update).ToNot(BeNil())
+			Expect(update.Identity).To(BeNil())
+			Expect(update.Tags).To(HaveLen(1))
+			Expect(lo.FromPtr(update.Tags["team"])).To(Equal("b"))
+		})
+
+		It("should keep the tags added outside Karpenter", func() {
+			currentVM := &armcompute.VirtualMachine{
+				Tags: map[string]*string{"team": lo.ToPtr("a"), "costcenter": lo.ToPtr("1234")},
+			}
+			update := calculateVMPatch(test.Options(), map[string]*string{"team": lo.ToPtr("b")}, sets.New("team"), currentVM)
+
+			Expect(update).ToNot(BeNil())
+			Expect(update.Tags).To(HaveLen(2))
+			Expect(lo.FromPtr(update.Tags["team"])).To(Equal("b"))
+			Expect(lo.FromPtr(update.Tags["costcenter"])).To(Equal("1234"))
+		})
+
+		It("should not update tags when only tags added outside Karpenter differ from the goal tags", func() {
+			currentVM := &armcompute.VirtualMachine{
+				Tags: map[string]*string{"team": lo.ToPtr("a"), "costcenter": lo.ToPtr("1234")},
+			}
+			update := calculateVMPatch(test.Options(), map[string]*string{"team": lo.ToPtr("a")}, sets.New("team"), currentVM)
+
+			Expect(update).To(BeNil())
+		})
+
+		It("should not update tags which match the goal tags", func() {
+			currentVM := &armcompute.VirtualMachine{
+				Tags: map[string]*string{"team": lo.ToPtr("a")},
+			}
+			update := calculateVMPatch(test.Options(), map[string]*string{"team": lo.ToPtr("a")}, nil, currentVM)
+
+			Expect(update).To(BeNil())
+		})
+
+		It("should not update tags when the goal tags are unknown", func() {
+			currentVM := &armcompute.VirtualMachine{
+				Tags: map[string]*string{"team": lo.ToPtr("a")},
+			}
+			update := calculateVMPatch(test.Options(), nil, nil, currentVM)
 
 			Expect(update).To(BeNil())
 		})
@@ -219,7 +415,7 @@ var _ = Describe("Unit tests", func() {
 			options.NodeIdentities = []string{
 				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1",
 			}
-			update := calculateVMPatch(options, currentVM)
+			update := calculateVMPatch(options, nil, nil, currentVM)
 
 			Expect(update).To(BeNil())
 		})
@@ -247,6 +443,7 @@ var _ = Describe("In Place Update Controller", func() {
 		ctx = options.ToContext(ctx, test.Options())
 
 		azureEnv.Reset()
+		recorder.Reset()
 	})
 
 	AfterEach(func() {
@@ -256,7 +453,7 @@ var _ = Describe("In Place Update Controller", func() {
 	Context("Basic tests", func() {
 		It("should not call Azure if the hash matches", func() {
 			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
-			hash, err := HashFromNodeClaim(options.FromContext(ctx), nodeClaim)
+			hash, err := HashFromNodeClaim(options.FromContext(ctx), nodeClaim, nil)
 			Expect(err).ToNot(HaveOccurred())
 
 			// Force the goal hash into annotations here, which should prevent the reconciler from doing anything on Azure
@@ -369,4 +566,280 @@ var _ = Describe("In Place Update Controller", func() {
 			Expect(nodeClaim.Annotations[v1alpha2.AnnotationInPlaceUpdateHash]).ToNot(BeEmpty())
 		})
 	})
+
+	Context("Tag tests", func() {
+		var nodeClass *v1alpha2.AKSNodeClass
+		var nicName string
+
+		BeforeEach(func() {
+			nodeClass = test.AKSNodeClass(v1alpha2.AKSNodeClass{
+				Spec: v1alpha2.AKSNodeClassSpec{
+					Tags: map[string]string{"team": "a"},
+				},
+			})
+			nodeClaim.Spec.NodeClassRef = &corev1beta1.NodeClassReference{Name: nodeClass.Name}
+
+			nicName = vmName
+			nicID := fmt.Sprintf("/subscriptions/subscriptionID/resourceGroups/%s/providers/Microsoft.Network/networkInterfaces/%s", azureEnv.AzureResourceGraphAPI.ResourceGroup, nicName)
+			azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(nicID, armnetwork.Interface{ID: lo.ToPtr(nicID), Name: lo.ToPtr(nicName)})
+			vm.Tags = map[string]*string{"team": lo.ToPtr("old")}
+			vm.Properties = &armcompute.VirtualMachineProperties{
+				NetworkProfile: &armcompute.NetworkProfile{
+					NetworkInterfaces: []*armcompute.NetworkInterfaceReference{{ID: lo.ToPtr(nicID)}},
+				},
+				StorageProfile: &armcompute.StorageProfile{
+					OSDisk: &armcompute.OSDisk{Name: lo.ToPtr(vmName)},
+				},
+			}
+		})
+
+		It("should update the tags of the VM, NIC and OS disk", func() {
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			updatedVM, err := azureEnv.InstanceProvider.Get(ctx, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lo.FromPtr(updatedVM.Tags["team"])).To(Equal("a"))
+			Expect(updatedVM.Tags).To(HaveKey("karpenter.azure.com_cluster"))
+
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+			nicInput := azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Pop()
+			Expect(nicInput.InterfaceName).To(Equal(nicName))
+			Expect(lo.FromPtr(nicInput.Tags.Tags["team"])).To(Equal("a"))
+
+			Expect(azureEnv.DisksAPI.DiskUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			diskInput := azureEnv.DisksAPI.DiskUpdateBehavior.CalledWithInput.Pop()
+			Expect(diskInput.DiskName).To(Equal(vmName))
+			Expect(lo.FromPtr(diskInput.Updates.Tags["team"])).To(Equal("a"))
+
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			expectedHash, err := HashFromNodeClaim(options.FromContext(ctx), nodeClaim, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateHash, expectedHash))
+		})
+
+		It("should keep the tags added outside Karpenter and remove the ones it applied before", func() {
+			nicID := lo.FromPtr(vm.Properties.NetworkProfile.NetworkInterfaces[0].ID)
+			azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(nicID, armnetwork.Interface{
+				ID:   lo.ToPtr(nicID),
+				Name: lo.ToPtr(nicName),
+				Tags: map[string]*string{"costcenter": lo.ToPtr("1234"), "removed": lo.ToPtr("true")},
+			})
+			vm.Tags = map[string]*string{"team": lo.ToPtr("old"), "costcenter": lo.ToPtr("1234"), "removed": lo.ToPtr("true")}
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+			nodeClaim.Annotations = map[string]string{v1alpha2.AnnotationInPlaceUpdateTagKeys: `["removed","team"]`}
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			updatedVM, err := azureEnv.InstanceProvider.Get(ctx, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lo.FromPtr(updatedVM.Tags["team"])).To(Equal("a"))
+			Expect(lo.FromPtr(updatedVM.Tags["costcenter"])).To(Equal("1234"))
+			Expect(updatedVM.Tags).ToNot(HaveKey("removed"))
+
+			nicInput := azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Pop()
+			Expect(lo.FromPtr(nicInput.Tags.Tags["team"])).To(Equal("a"))
+			Expect(lo.FromPtr(nicInput.Tags.Tags["costcenter"])).To(Equal("1234"))
+			Expect(nicInput.Tags.Tags).ToNot(HaveKey("removed"))
+
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			Expect(nodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateTagKeys,
+				TagKeysAnnotation(instance.GetTags(options.FromContext(ctx).ClusterName, nodeClass, nodeClaim))))
+		})
+
+		It("should not update the tags of an ephemeral OS disk", func() {
+			vm.Properties.StorageProfile.OSDisk.DiffDiskSettings = &armcompute.DiffDiskSettings{Option: lo.ToPtr(armcompute.DiffDiskOptionsLocal)}
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.Calls()).To(Equal(1))
+			Expect(azureEnv.DisksAPI.DiskUpdateBehavior.Calls()).To(Equal(0))
+		})
+
+		It("should wait for VMs still being created asynchronously", func() {
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+			nodeClaim.Annotations = map[string]string{v1alpha2.AnnotationVMCreationAccepted: "2024-01-01T00:00:00Z"}
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			result := ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			Expect(result.RequeueAfter).ToNot(BeZero())
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Calls()).To(Equal(0))
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			Expect(nodeClaim.Annotations).ToNot(HaveKey(v1alpha2.AnnotationInPlaceUpdateHash))
+		})
+
+		It("should publish an event and not update the hash when Azure rejects the update", func() {
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+			azureEnv.VirtualMachinesAPI.VirtualMachineUpdateBehavior.Error.Set(&azcore.ResponseError{ErrorCode: "RequestDisallowedByPolicy", StatusCode: http.StatusForbidden})
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileFailed(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			Expect(recorder.Calls("FailedInPlaceUpdate")).To(Equal(1))
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.Calls()).To(Equal(0))
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			Expect(nodeClaim.Annotations).ToNot(HaveKey(v1alpha2.AnnotationInPlaceUpdateHash))
+		})
+	})
+
+	Context("Security group and extension tests", func() {
+		var nodeClass *v1alpha2.AKSNodeClass
+		var nicID string
+
+		BeforeEach(func() {
+			nodeClass = test.AKSNodeClass()
+			nodeClaim.Spec.NodeClassRef = &corev1beta1.NodeClassReference{Name: nodeClass.Name}
+
+			nicID = fmt.Sprintf("/subscriptions/subscriptionID/resourceGroups/%s/providers/Microsoft.Network/networkInterfaces/%s", azureEnv.AzureResourceGraphAPI.ResourceGroup, vmName)
+			azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(nicID, armnetwork.Interface{
+				ID:   lo.ToPtr(nicID),
+				Name: lo.ToPtr(vmName),
+				Properties: &armnetwork.InterfacePropertiesFormat{
+					IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
+						{Name: lo.ToPtr(vmName), Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Primary: lo.ToPtr(true)}},
+						{Name: lo.ToPtr("ipconfig2"), Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Primary: lo.ToPtr(false)}},
+					},
+				},
+			})
+			vm.Tags = instance.GetTags(options.FromContext(ctx).ClusterName, nodeClass, nodeClaim)
+			vm.Properties = &armcompute.VirtualMachineProperties{
+				NetworkProfile: &armcompute.NetworkProfile{
+					NetworkInterfaces: []*armcompute.NetworkInterfaceReference{{ID: lo.ToPtr(nicID)}},
+				},
+			}
+		})
+
+		It("should associate the NIC with the security groups of the AKSNodeClass", func() {
+			nodeClass.Spec.NetworkSecurityGroupID = lo.ToPtr(nsgID("nsg-a"))
+			nodeClass.Spec.ApplicationSecurityGroupIDs = []string{asgID("asg-a")}
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			nic := azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Pop().Interface
+			Expect(lo.FromPtr(nic.Properties.NetworkSecurityGroup.ID)).To(Equal(nsgID("nsg-a")))
+			for _, ipConfiguration := range nic.Properties.IPConfigurations {
+				Expect(ipConfiguration.Properties.ApplicationSecurityGroups).To(HaveLen(1))
+				Expect(lo.FromPtr(ipConfiguration.Properties.ApplicationSecurityGroups[0].ID)).To(Equal(asgID("asg-a")))
+			}
+			Expect(nic.Tags).To(HaveKey("karpenter.azure.com_cluster"))
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.Calls()).To(Equal(0))
+
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			Expect(nodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateSecurityGroupIDs, SecurityGroupIDsAnnotation(nodeClass)))
+		})
+
+		It("should dissociate the security groups Karpenter associated once removed from the AKSNodeClass", func() {
+			azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Store(nicID, armnetwork.Interface{
+				ID:   lo.ToPtr(nicID),
+				Name: lo.ToPtr(vmName),
+				Properties: &armnetwork.InterfacePropertiesFormat{
+					NetworkSecurityGroup: &armnetwork.SecurityGroup{ID: lo.ToPtr(nsgID("nsg-a"))},
+					IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
+						{Name: lo.ToPtr(vmName), Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+							ApplicationSecurityGroups: instance.NewApplicationSecurityGroups([]string{asgID("asg-a"), asgID("asg-other")}),
+						}},
+					},
+				},
+			})
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+			nodeClaim.Annotations = map[string]string{
+				v1alpha2.AnnotationInPlaceUpdateSecurityGroupIDs: fmt.Sprintf(`[%q,%q]`, strings.ToLower(asgID("asg-a")), strings.ToLower(nsgID("nsg-a"))),
+			}
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			nic := azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Pop().Interface
+			Expect(nic.Properties.NetworkSecurityGroup).To(BeNil())
+			Expect(nic.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups).To(HaveLen(1))
+			Expect(lo.FromPtr(nic.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups[0].ID)).To(Equal(asgID("asg-other")))
+
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			Expect(nodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateSecurityGroupIDs, "[]"))
+		})
+
+		It("should install the extensions of the AKSNodeClass missing from the VM", func() {
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{monitorExtension()}
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			input := azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Pop()
+			Expect(input.VirtualMachineName).To(Equal(vmName))
+			Expect(input.VirtualMachineExtensionName).To(Equal("AzureMonitorLinuxAgent"))
+			Expect(lo.FromPtr(input.VirtualMachineExtension.Properties.Publisher)).To(Equal("Microsoft.Azure.Monitor"))
+			Expect(input.VirtualMachineExtension.Properties.Settings).To(Equal(map[string]any{"enableAMA": "true"}))
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.Calls()).To(Equal(0))
+
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			Expect(nodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateExtensionNames, `["azuremonitorlinuxagent"]`))
+		})
+
+		It("should not reinstall extensions which are up to date", func() {
+			extension := monitorExtension()
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{extension}
+			vm.Resources = []*armcompute.VirtualMachineExtension{{
+				Name: lo.ToPtr(extension.Name),
+				Properties: &armcompute.VirtualMachineExtensionProperties{
+					Publisher:               lo.ToPtr(extension.Publisher),
+					Type:                    lo.ToPtr(extension.Type),
+					TypeHandlerVersion:      lo.ToPtr(extension.TypeHandlerVersion),
+					AutoUpgradeMinorVersion: lo.ToPtr(true),
+					Settings:                map[string]any{"enableAMA": "true"},
+				},
+			}}
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.Calls()).To(Equal(0))
+		})
+
+		It("should uninstall only the extensions Karpenter installed once removed from the AKSNodeClass", func() {
+			azureEnv.VirtualMachinesAPI.Instances.Store(lo.FromPtr(vm.ID), *vm)
+			nodeClaim.Annotations = map[string]string{v1alpha2.AnnotationInPlaceUpdateExtensionNames: `["azuremonitorlinuxagent"]`}
+
+			ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+			ExpectReconcileSucceeded(ctx, inPlaceUpdateController, client.ObjectKeyFromObject(nodeClaim))
+
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsDeleteBehavior.CalledWithInput.Len()).To(Equal(1))
+			input := azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsDeleteBehavior.CalledWithInput.Pop()
+			Expect(input.VirtualMachineName).To(Equal(vmName))
+			Expect(input.VirtualMachineExtensionName).To(Equal("azuremonitorlinuxagent"))
+
+			nodeClaim = ExpectExists(ctx, env.Client, nodeClaim)
+			Expect(nodeClaim.Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateExtensionNames, "[]"))
+		})
+	})
 })
+
+func nsgID(name string) string {
+	return fmt.Sprintf("/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/%s", name)
+}
+
+func asgID(name string) string {
+	return fmt.Sprintf("/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/%s", name)
+}
+
+func monitorExtension() v1alpha2.Extension {
+	return v1alpha2.Extension{
+		Name:                    "AzureMonitorLinuxAgent",
+		Publisher:               "Microsoft.Azure.Monitor",
+		Type:                    "AzureMonitorLinuxAgent",
+		TypeHandlerVersion:      "1.0",
+		AutoUpgradeMinorVersion: lo.ToPtr(true),
+		Settings:                &runtime.RawExtension{Raw: []byte(`{"enableAMA":"true"}`)},
+	}
+}
@@ -19,19 +19,30 @@ package inplaceupdate
 import (
 	"encoding/json"
 	"hash/fnv"
+	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 )
 
 // According to https://pkg.go.dev/encoding/json#Marshal, it's safe to use map-types (and encoding/json in general) to produce
 // strings deterministically.
 type inPlaceUpdateFields struct {
-	Identities sets.Set[string] `json:"identities,omitempty"`
+	Identities                  sets.Set[string]              `json:"identities,omitempty"`
+	Tags                        map[string]string             `json:"tags,omitempty"`
+	NetworkSecurityGroupID      string                        `json:"networkSecurityGroupID,omitempty"`
+	ApplicationSecurityGroupIDs sets.Set[string]              `json:"applicationSecurityGroupIDs,omitempty"`
+	Extensions                  map[string]v1alpha2.Extension `json:"extensions,omitempty"`
 }
 
 func (i *inPlaceUpdateFields) CalculateHash() (string, error) {
@@ -58,16 +69,155 @@ func HashFromVM(vm *armcompute.VirtualMachine) (string, error) {
 
 	hashStruct := &inPlaceUpdateFields{
 		Identities: identities,
+		Tags:       lo.MapValues(vm.Tags, func(v *string, _ string) string { return lo.FromPtr(v) }),
 	}
 
 	return hashStruct.CalculateHash()
 }
 
-// HashFromNodeClaim calculates an inplace update hash from the specified machine and options
-func HashFromNodeClaim(options *options.Options, _ *v1beta1.NodeClaim) (string, error) {
+// HashFromNodeClaim calculates an inplace update hash from the specified machine, options and the AKSNodeClass of the machine.
+// The AKSNodeClass may be nil if it could not be resolved, in which case tags, security groups and extensions are left
+// out of the goal state.
+func HashFromNodeClaim(options *options.Options, nodeClaim *v1beta1.NodeClaim, nodeClass *v1alpha2.AKSNodeClass) (string, error) {
 	hashStruct := &inPlaceUpdateFields{
 		Identities: sets.New(options.NodeIdentities...),
 	}
+	if nodeClass != nil {
+		hashStruct.Tags = lo.MapValues(instance.GetTags(options.ClusterName, nodeClass, nodeClaim), func(v *string, _ string) string { return lo.FromPtr(v) })
+		hashStruct.NetworkSecurityGroupID = strings.ToLower(lo.FromPtr(nodeClass.Spec.NetworkSecurityGroupID))
+		hashStruct.ApplicationSecurityGroupIDs = sets.New(lo.Map(nodeClass.Spec.ApplicationSecurityGroupIDs, func(id string, _ int) string { return strings.ToLower(id) })...)
+		hashStruct.Extensions = lo.SliceToMap(nodeClass.Spec.Extensions, func(extension v1alpha2.Extension) (string, v1alpha2.Extension) {
+			return extension.Name, extension
+		})
+	}
 
 	return hashStruct.CalculateHash()
 }
+
+// TagKeysAnnotation returns the value of the annotation recording the keys of the tags Karpenter applied
+func TagKeysAnnotation(tags map[string]*string) string {
+	return listAnnotation(lo.Keys(tags))
+}
+
+// SecurityGroupIDsAnnotation returns the value of the annotation recording the IDs of the security groups of the
+// AKSNodeClass Karpenter associated
+func SecurityGroupIDsAnnotation(nodeClass *v1alpha2.AKSNodeClass) string {
+	ids := lo.Map(nodeClass.Spec.ApplicationSecurityGroupIDs, func(id string, _ int) string { return strings.ToLower(id) })
+	if nodeClass.Spec.NetworkSecurityGroupID != nil {
+		ids = append(ids, strings.ToLower(*nodeClass.Spec.NetworkSecurityGroupID))
+	}
+	return listAnnotation(ids)
+}
+
+// ExtensionNamesAnnotation returns the value of the annotation recording the names of the extensions of the
+// AKSNodeClass Karpenter installed
+func ExtensionNamesAnnotation(nodeClass *v1alpha2.AKSNodeClass) string {
+	return listAnnotation(lo.Map(nodeClass.Spec.Extensions, func(extension v1alpha2.Extension, _ int) string { return strings.ToLower(extension.Name) }))
+}
+
+func listAnnotation(values []string) string {
+	values = lo.Uniq(values)
+	sort.Strings(values)
+	encoded, _ := json.Marshal(values)
+	return string(encoded)
+}
+
+// setFromAnnotation returns the values recorded in an ownership annotation, none if they were not recorded, e.g. for
+// NodeClaims launched before they were
+func setFromAnnotation(value string) sets.Set[string] {
+	var values []string
+	if value == "" || json.Unmarshal([]byte(value), &values) != nil {
+		return sets.New[string]()
+	}
+	return sets.New(values...)
+}
+
+// ownership is what Karpenter applied to the instance of a NodeClaim, the only tags, security groups and extensions it
+// removes once they are removed from the AKSNodeClass. Those added outside Karpenter (e.g. by Azure Policy) are kept.
+// Security group IDs and extension names are lowercase, as Azure matches them case-insensitively.
+type ownership struct {
+	tagKeys          sets.Set[string]
+	securityGroupIDs sets.Set[string]
+	extensionNames   sets.Set[string]
+}
+
+func ownedFromAnnotations(annotations map[string]string) ownership {
+	return ownership{
+		tagKeys:          setFromAnnotation(annotations[v1alpha2.AnnotationInPlaceUpdateTagKeys]),
+		securityGroupIDs: setFromAnnotation(annotations[v1alpha2.AnnotationInPlaceUpdateSecurityGroupIDs]),
+		extensionNames:   setFromAnnotation(annotations[v1alpha2.AnnotationInPlaceUpdateExtensionNames]),
+	}
+}
+
+// mergeSecurityGroups associates the NIC with the network security group of the AKSNodeClass and makes its IP
+// configurations members of the application security groups of the AKSNodeClass, dissociating the ones Karpenter
+// associated before which the AKSNodeClass no longer has, and returns whether that changed the NIC. A NIC has a single
+// network security group, so the one of the AKSNodeClass replaces one associated outside Karpenter.
+func mergeSecurityGroups(nic *armnetwork.Interface, nodeClass *v1alpha2.AKSNodeClass, ownedIDs sets.Set[string]) bool {
+	if nic.Properties == nil {
+		return false
+	}
+	isOwned := func(id *string) bool {
+		return id != nil && ownedIDs.Has(strings.ToLower(*id))
+	}
+	changed := false
+	goalNSG, currentNSG := nodeClass.Spec.NetworkSecurityGroupID, nic.Properties.NetworkSecurityGroup
+	switch {
+	case goalNSG != nil && (currentNSG == nil || !strings.EqualFold(lo.FromPtr(currentNSG.ID), *goalNSG)):
+		nic.Properties.NetworkSecurityGroup = &armnetwork.SecurityGroup{ID: lo.ToPtr(*goalNSG)}
+		changed = true
+	case goalNSG == nil && currentNSG != nil && isOwned(currentNSG.ID):
+		nic.Properties.NetworkSecurityGroup = nil
+		changed = true
+	}
+
+	isGoalASG := func(id *string) bool {
+		return lo.ContainsBy(nodeClass.Spec.ApplicationSecurityGroupIDs, func(goal string) bool { return strings.EqualFold(goal, lo.FromPtr(id)) })
+	}
+	for _, ipConfiguration := range nic.Properties.IPConfigurations {
+		if ipConfiguration == nil || ipConfiguration.Properties == nil {
+			continue
+		}
+		current := ipConfiguration.Properties.ApplicationSecurityGroups
+		asgs := lo.Reject(current, func(asg *armnetwork.ApplicationSecurityGroup, _ int) bool {
+			return asg == nil || (isOwned(asg.ID) && !isGoalASG(asg.ID))
+		})
+		removed := len(asgs) < len(current)
+		missing := lo.Reject(nodeClass.Spec.ApplicationSecurityGroupIDs, func(goal string, _ int) bool {
+			return lo.ContainsBy(asgs, func(asg *armnetwork.ApplicationSecurityGroup) bool {
+				return strings.EqualFold(lo.FromPtr(asg.ID), goal)
+			})
+		})
+		if removed || len(missing) > 0 {
+			ipConfiguration.Properties.ApplicationSecurityGroups = append(asgs, instance.NewApplicationSecurityGroups(missing)...)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// extensionUpToDate returns whether the extension installed on the VM, if any, is the extension of the AKSNodeClass
+func extensionUpToDate(current *armcompute.VirtualMachineExtension, goal v1alpha2.Extension) bool {
+	if current == nil || current.Properties == nil {
+		return false
+	}
+	settings, err := instance.ExtensionSettings(goal)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(lo.FromPtr(current.Properties.Publisher), goal.Publisher) &&
+		strings.EqualFold(lo.FromPtr(current.Properties.Type), goal.Type) &&
+		lo.FromPtr(current.Properties.TypeHandlerVersion) == goal.TypeHandlerVersion &&
+		lo.FromPtr(current.Properties.AutoUpgradeMinorVersion) == lo.FromPtr(goal.AutoUpgradeMinorVersion) &&
+		equality.Semantic.DeepEqual(current.Properties.Settings, settings)
+}
+
+// mergeTags returns the current tags with the goal tags applied, without the tags Karpenter applied before which are
+// no longer goal tags. Tags added outside Karpenter are kept.
+func mergeTags(current, goal map[string]*string, ownedKeys sets.Set[string]) map[string]*string {
+	merged := lo.OmitBy(current, func(key string, _ *string) bool {
+		_, isGoal := goal[key]
+		return ownedKeys.Has(key) && !isGoal
+	})
+	return lo.Assign(merged, goal)
+}
@@ -0,0 +1,116 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hash
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+var _ corecontroller.TypedController[*v1alpha2.AKSNodeClass] = (*Controller)(nil)
+
+// Controller stamps the hash of the fields of the AKSNodeClass considered for static drift on the AKSNodeClass.
+// NodeClaims are stamped with the same hash at launch, and are drifted once both hashes diverge.
+type Controller struct {
+	kubeClient client.Client
+}
+
+func NewController(kubeClient client.Client) corecontroller.Controller {
+	return corecontroller.Typed[*v1alpha2.AKSNodeClass](kubeClient, &Controller{
+		kubeClient: kubeClient,
+	})
+}
+
+func (c *Controller) Name() string {
+	return "nodeclass.hash"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (reconcile.Result, error) {
+	stored := nodeClass.DeepCopy()
+
+	if nodeClass.Annotations[v1alpha2.AnnotationAKSNodeClassHashVersion] != v1alpha2.AKSNodeClassHashVersion {
+		if err := c.updateNodeClaimHash(ctx, nodeClass); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	nodeClass.Annotations = lo.Assign(nodeClass.Annotations, map[string]string{
+		v1alpha2.AnnotationAKSNodeClassHash:        nodeClass.Hash(),
+		v1alpha2.AnnotationAKSNodeClassHashVersion: v1alpha2.AKSNodeClassHashVersion,
+	})
+
+	if !equality.Semantic.DeepEqual(stored, nodeClass) {
+		if err := c.kubeClient.Patch(ctx, nodeClass, client.MergeFrom(stored)); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.
+		NewControllerManagedBy(m).
+		For(&v1alpha2.AKSNodeClass{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
+
+// updateNodeClaimHash re-stamps the NodeClaims of the AKSNodeClass after a breaking change to the hash calculation
+// (a bump of AKSNodeClassHashVersion). The hash on these NodeClaims can no longer be compared to the AKSNodeClass, so it
+// is replaced by the current hash, unless the NodeClaim is already drifted, in which case it remains drifted.
+func (c *Controller) updateNodeClaimHash(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) error {
+	nodeClaimList := &corev1beta1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return err
+	}
+
+	var errs error
+	for i := range nodeClaimList.Items {
+		nodeClaim := nodeClaimList.Items[i]
+		if nodeClaim.Spec.NodeClassRef == nil || nodeClaim.Spec.NodeClassRef.Name != nodeClass.Name {
+			continue
+		}
+		if nodeClaim.Annotations[v1alpha2.AnnotationAKSNodeClassHashVersion] == v1alpha2.AKSNodeClassHashVersion {
+			continue
+		}
+		stored := nodeClaim.DeepCopy()
+		nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, map[string]string{
+			v1alpha2.AnnotationAKSNodeClassHashVersion: v1alpha2.AKSNodeClassHashVersion,
+		})
+		if nodeClaim.StatusConditions().GetCondition(corev1beta1.Drifted) == nil {
+			nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, map[string]string{
+				v1alpha2.AnnotationAKSNodeClassHash: nodeClass.Hash(),
+			})
+		}
+		if !equality.Semantic.DeepEqual(stored, nodeClaim) {
+			if err := c.kubeClient.Patch(ctx, &nodeClaim, client.MergeFrom(stored)); err != nil {
+				errs = multierr.Append(errs, client.IgnoreNotFound(err))
+			}
+		}
+	}
+	return errs
+}
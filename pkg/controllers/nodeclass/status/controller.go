@@ -0,0 +1,106 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	"sigs.k8s.io/karpenter/pkg/utils/result"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+type nodeClassStatusReconciler interface {
+	Reconcile(context.Context, *v1alpha2.AKSNodeClass) (reconcile.Result, error)
+}
+
+// Controller resolves the images and kubernetes version of an AKSNodeClass, validates the subnet and identities
+// nodes are launched with, and publishes the results in the status of the AKSNodeClass
+type Controller struct {
+	kubeClient client.Client
+
+	images            *Images
+	kubernetesVersion *KubernetesVersion
+	subnet            *Subnet
+	identities        *Identities
+}
+
+var _ corecontroller.TypedController[*v1alpha2.AKSNodeClass] = &Controller{}
+
+func NewController(kubeClient client.Client, imageProvider *imagefamily.Provider, subnetsClient instance.SubnetsAPI) corecontroller.Controller {
+	controller := &Controller{
+		kubeClient:        kubeClient,
+		images:            &Images{imageProvider: imageProvider},
+		kubernetesVersion: &KubernetesVersion{imageProvider: imageProvider},
+		subnet:            &Subnet{subnetsClient: subnetsClient},
+		identities:        &Identities{},
+	}
+	return corecontroller.Typed[*v1alpha2.AKSNodeClass](kubeClient, controller)
+}
+
+func (c *Controller) Name() string {
+	return "nodeclass.status"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (reconcile.Result, error) {
+	if !nodeClass.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, nil
+	}
+	stored := nodeClass.DeepCopy()
+
+	var results []reconcile.Result
+	var errs error
+	for _, reconciler := range []nodeClassStatusReconciler{
+		c.images,
+		c.kubernetesVersion,
+		c.subnet,
+		c.identities,
+	} {
+		res, err := reconciler.Reconcile(ctx, nodeClass)
+		errs = multierr.Append(errs, err)
+		results = append(results, res)
+	}
+
+	if !equality.Semantic.DeepEqual(stored, nodeClass) {
+		if err := c.kubeClient.Status().Patch(ctx, nodeClass, client.MergeFrom(stored)); err != nil {
+			errs = multierr.Append(errs, client.IgnoreNotFound(err))
+		}
+	}
+	if errs != nil {
+		return reconcile.Result{}, errs
+	}
+	return result.Min(results...), nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.
+		NewControllerManagedBy(m).
+		For(&v1alpha2.AKSNodeClass{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
@@ -0,0 +1,61 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"go.uber.org/multierr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+const userAssignedIdentityResourceType = "Microsoft.ManagedIdentity/userAssignedIdentities"
+
+type Identities struct{}
+
+// Reconcile validates the user assigned identities that are applied onto each VM.
+// These come from the operator options today, so they only need to be well formed ARM resource IDs.
+func (i *Identities) Reconcile(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (reconcile.Result, error) {
+	var errs error
+	for _, identity := range options.FromContext(ctx).NodeIdentities {
+		errs = multierr.Append(errs, validateIdentity(identity))
+	}
+	if errs != nil {
+		nodeClass.StatusConditions().MarkFalse(v1alpha2.ConditionTypeIdentitiesReady, "IdentitiesInvalid", "%s", errs)
+		// retrying won't fix a malformed identity
+		return reconcile.Result{}, nil
+	}
+	nodeClass.StatusConditions().MarkTrue(v1alpha2.ConditionTypeIdentitiesReady)
+	return reconcile.Result{}, nil
+}
+
+func validateIdentity(identity string) error {
+	resourceID, err := arm.ParseResourceID(identity)
+	if err != nil {
+		return fmt.Errorf("parsing identity %q, %w", identity, err)
+	}
+	if !strings.EqualFold(resourceID.ResourceType.String(), userAssignedIdentityResourceType) {
+		return fmt.Errorf("identity %q is not a user assigned identity", identity)
+	}
+	return nil
+}
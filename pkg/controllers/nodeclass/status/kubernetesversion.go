@@ -0,0 +1,43 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+)
+
+type KubernetesVersion struct {
+	imageProvider *imagefamily.Provider
+}
+
+func (k *KubernetesVersion) Reconcile(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (reconcile.Result, error) {
+	version, err := k.imageProvider.KubeServerVersion(ctx)
+	if err != nil {
+		nodeClass.StatusConditions().MarkFalse(v1alpha2.ConditionTypeKubernetesVersionReady, "KubernetesVersionNotResolved", "%s", err)
+		return reconcile.Result{}, fmt.Errorf("resolving kubernetes version, %w", err)
+	}
+	nodeClass.Status.KubernetesVersion = version
+	nodeClass.StatusConditions().MarkTrue(v1alpha2.ConditionTypeKubernetesVersionReady)
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
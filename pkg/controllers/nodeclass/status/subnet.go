@@ -0,0 +1,62 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+type Subnet struct {
+	subnetsClient instance.SubnetsAPI
+}
+
+func (s *Subnet) Reconcile(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (reconcile.Result, error) {
+	subnetID := options.FromContext(ctx).SubnetID
+	subnetParts, err := utils.GetVnetSubnetIDComponents(subnetID)
+	if err != nil {
+		nodeClass.StatusConditions().MarkFalse(v1alpha2.ConditionTypeSubnetReady, "SubnetInvalid", "%s", err)
+		// retrying won't fix a malformed subnet ID
+		return reconcile.Result{}, nil
+	}
+	subnet, err := s.subnetsClient.Get(ctx, subnetParts.ResourceGroupName, subnetParts.VNetName, subnetParts.SubnetName, nil)
+	if err != nil {
+		if sdkerrors.IsNotFoundErr(err) {
+			nodeClass.StatusConditions().MarkFalse(v1alpha2.ConditionTypeSubnetReady, "SubnetNotFound", "subnet %s not found", subnetID)
+			return reconcile.Result{RequeueAfter: time.Minute}, nil
+		}
+		nodeClass.StatusConditions().MarkFalse(v1alpha2.ConditionTypeSubnetReady, "SubnetNotResolved", "%s", err)
+		return reconcile.Result{}, fmt.Errorf("getting subnet %s, %w", subnetID, err)
+	}
+	if subnet.Properties != nil && lo.FromPtr(subnet.Properties.ProvisioningState) != armnetwork.ProvisioningStateSucceeded {
+		nodeClass.StatusConditions().MarkFalse(v1alpha2.ConditionTypeSubnetReady, "SubnetNotSucceeded", "subnet %s is in provisioning state %s", subnetID, lo.FromPtr(subnet.Properties.ProvisioningState))
+		return reconcile.Result{RequeueAfter: time.Minute}, nil
+	}
+	nodeClass.StatusConditions().MarkTrue(v1alpha2.ConditionTypeSubnetReady)
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
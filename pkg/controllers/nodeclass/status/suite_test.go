@@ -0,0 +1,154 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	knativeapis "knative.dev/pkg/apis"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/status"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+var env *coretest.Environment
+var azureEnv *test.Environment
+var statusController corecontroller.Controller
+
+func TestAKSNodeClassStatus(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/NodeClass/Status")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+
+	ctx, stop = context.WithCancel(ctx)
+	azureEnv = test.NewEnvironment(ctx, env)
+
+	statusController = status.NewController(env.Client, azureEnv.ImageProvider, azureEnv.SubnetsAPI)
+})
+
+var _ = AfterSuite(func() {
+	stop()
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("AKSNodeClass Status", func() {
+	var nodeClass *v1alpha2.AKSNodeClass
+
+	BeforeEach(func() {
+		ctx = options.ToContext(ctx, test.Options())
+		nodeClass = test.AKSNodeClass()
+		azureEnv.Reset()
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should be ready when images, kubernetes version, subnet and identities are resolved", func() {
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, statusController, client.ObjectKeyFromObject(nodeClass))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+
+		Expect(nodeClass.StatusConditions().IsHappy()).To(BeTrue())
+		Expect(ExpectStatusConditionExists(nodeClass, knativeapis.ConditionReady).Status).To(Equal(v1.ConditionTrue))
+		Expect(nodeClass.Status.KubernetesVersion).ToNot(BeEmpty())
+	})
+	It("should publish one image per image definition of the image family", func() {
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, statusController, client.ObjectKeyFromObject(nodeClass))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+
+		Expect(nodeClass.Status.Images).To(HaveLen(3))
+		Expect(nodeClass.Status.Images[0].ID).To(ContainSubstring(imagefamily.Ubuntu2204Gen2CommunityImage))
+		Expect(nodeClass.Status.Images[1].ID).To(ContainSubstring(imagefamily.Ubuntu2204Gen1CommunityImage))
+		Expect(nodeClass.Status.Images[2].ID).To(ContainSubstring(imagefamily.Ubuntu2204Gen2ArmCommunityImage))
+		Expect(nodeClass.Status.Images[2].Requirements).To(ContainElement(v1.NodeSelectorRequirement{
+			Key:      v1.LabelArchStable,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{"arm64"},
+		}))
+	})
+	It("should publish FIPS images when FIPS mode is enabled", func() {
+		nodeClass.Spec.FIPSMode = lo.ToPtr(v1alpha2.FIPSModeEnabled)
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, statusController, client.ObjectKeyFromObject(nodeClass))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+
+		Expect(nodeClass.Status.Images).To(HaveLen(2))
+		Expect(nodeClass.Status.Images[0].ID).To(ContainSubstring(imagefamily.Ubuntu2204Gen2FIPSCommunityImage))
+		Expect(nodeClass.Status.Images[1].ID).To(ContainSubstring(imagefamily.Ubuntu2204Gen1FIPSCommunityImage))
+	})
+	It("should publish the imageID for the Custom image family", func() {
+		imageID := "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/custom/versions/1.0.0"
+		nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.CustomImageFamily)
+		nodeClass.Spec.ImageID = lo.ToPtr(imageID)
+		nodeClass.Spec.UserData = lo.ToPtr("#!/bin/bash")
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, statusController, client.ObjectKeyFromObject(nodeClass))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+
+		Expect(nodeClass.Status.Images).To(HaveLen(1))
+		Expect(nodeClass.Status.Images[0].ID).To(Equal(imageID))
+	})
+	It("should not be ready when the subnet does not exist", func() {
+		azureEnv.SubnetsAPI.SubnetGetBehavior.Error.Set(&azcore.ResponseError{ErrorCode: "ResourceNotFound", StatusCode: 404})
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, statusController, client.ObjectKeyFromObject(nodeClass))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+
+		Expect(ExpectStatusConditionExists(nodeClass, v1alpha2.ConditionTypeSubnetReady).Status).To(Equal(v1.ConditionFalse))
+		Expect(ExpectStatusConditionExists(nodeClass, v1alpha2.ConditionTypeSubnetReady).Reason).To(Equal("SubnetNotFound"))
+		Expect(ExpectStatusConditionExists(nodeClass, knativeapis.ConditionReady).Status).To(Equal(v1.ConditionFalse))
+	})
+	It("should not be ready when a node identity is not a user assigned identity", func() {
+		ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+			NodeIdentities: []string{"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.Compute/virtualMachines/myvm"},
+		}))
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, statusController, client.ObjectKeyFromObject(nodeClass))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+
+		Expect(ExpectStatusConditionExists(nodeClass, v1alpha2.ConditionTypeIdentitiesReady).Status).To(Equal(v1.ConditionFalse))
+		Expect(ExpectStatusConditionExists(nodeClass, knativeapis.ConditionReady).Status).To(Equal(v1.ConditionFalse))
+	})
+})
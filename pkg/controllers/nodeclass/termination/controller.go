@@ -0,0 +1,129 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package termination
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"knative.dev/pkg/logging"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/events"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
+)
+
+var _ corecontroller.FinalizingTypedController[*v1alpha2.AKSNodeClass] = (*Controller)(nil)
+
+// Controller adds a finalizer to every AKSNodeClass, and holds the deletion of an AKSNodeClass until all the
+// NodeClaims launched from it are gone, so that these NodeClaims can still resolve their AKSNodeClass while terminating.
+type Controller struct {
+	kubeClient client.Client
+	recorder   events.Recorder
+}
+
+func NewController(kubeClient client.Client, recorder events.Recorder) corecontroller.Controller {
+	return corecontroller.Typed[*v1alpha2.AKSNodeClass](kubeClient, &Controller{
+		kubeClient: kubeClient,
+		recorder:   recorder,
+	})
+}
+
+func (c *Controller) Name() string {
+	return "nodeclass.termination"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (reconcile.Result, error) {
+	stored := nodeClass.DeepCopy()
+	controllerutil.AddFinalizer(nodeClass, corev1beta1.TerminationFinalizer)
+	if !equality.Semantic.DeepEqual(stored, nodeClass) {
+		if err := c.kubeClient.Patch(ctx, nodeClass, client.MergeFrom(stored)); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) Finalize(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (reconcile.Result, error) {
+	stored := nodeClass.DeepCopy()
+	if !controllerutil.ContainsFinalizer(nodeClass, corev1beta1.TerminationFinalizer) {
+		return reconcile.Result{}, nil
+	}
+	nodeClaimList := &corev1beta1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing nodeclaims, %w", err)
+	}
+	names := lo.FilterMap(nodeClaimList.Items, func(nodeClaim corev1beta1.NodeClaim, _ int) (string, bool) {
+		return nodeClaim.Name, nodeClaim.Spec.NodeClassRef != nil && nodeClaim.Spec.NodeClassRef.Name == nodeClass.Name
+	})
+	if len(names) > 0 {
+		c.recorder.Publish(cloudproviderevents.NodeClassWaitingOnNodeClaimTermination(nodeClass, names))
+		// NodeClaim deletions requeue the AKSNodeClass, the periodic requeue only guards against missed events
+		return reconcile.Result{RequeueAfter: time.Minute * 10}, nil
+	}
+	// The AKSNodeClass does not own any Azure resources yet (every resource Karpenter creates is scoped to a
+	// NodeClaim and is deleted with it). Class scoped resources are to be released here, before the finalizer is removed.
+	controllerutil.RemoveFinalizer(nodeClass, corev1beta1.TerminationFinalizer)
+	if !equality.Semantic.DeepEqual(stored, nodeClass) {
+		// We use an optimistic lock to make sure the finalizer is not removed from a stale AKSNodeClass,
+		// a new NodeClaim may have been launched from it in between
+		if err := c.kubeClient.Patch(ctx, nodeClass, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(fmt.Errorf("removing termination finalizer, %w", err))
+		}
+		logging.FromContext(ctx).Infof("deleted nodeclass")
+	}
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.
+		NewControllerManagedBy(m).
+		For(&v1alpha2.AKSNodeClass{}).
+		Watches(
+			&corev1beta1.NodeClaim{},
+			handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []reconcile.Request {
+				nodeClaim := o.(*corev1beta1.NodeClaim)
+				if nodeClaim.Spec.NodeClassRef == nil {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: nodeClaim.Spec.NodeClassRef.Name}}}
+			}),
+			// Only NodeClaim deletions can unblock the termination of an AKSNodeClass
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc:  func(_ event.CreateEvent) bool { return false },
+				UpdateFunc:  func(_ event.UpdateEvent) bool { return false },
+				DeleteFunc:  func(_ event.DeleteEvent) bool { return true },
+				GenericFunc: func(_ event.GenericEvent) bool { return false },
+			}),
+		).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
@@ -0,0 +1,126 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package termination_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/nodeclass/termination"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var recorder *coretest.EventRecorder
+var terminationController corecontroller.Controller
+
+func TestAKSNodeClassTermination(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/NodeClass/Termination")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	recorder = coretest.NewEventRecorder()
+
+	terminationController = termination.NewController(env.Client, recorder)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("AKSNodeClass Termination", func() {
+	var nodeClass *v1alpha2.AKSNodeClass
+
+	BeforeEach(func() {
+		nodeClass = test.AKSNodeClass()
+		recorder.Reset()
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+
+	It("should add the termination finalizer to the AKSNodeClass", func() {
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+		Expect(nodeClass.Finalizers).To(ContainElement(corev1beta1.TerminationFinalizer))
+	})
+	It("should delete the AKSNodeClass once no NodeClaims reference it", func() {
+		ExpectApplied(ctx, env.Client, nodeClass)
+		ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+		ExpectNotFound(ctx, env.Client, nodeClass)
+	})
+	It("should not delete the AKSNodeClass while NodeClaims reference it", func() {
+		nodeClaim := coretest.NodeClaim(corev1beta1.NodeClaim{
+			Spec: corev1beta1.NodeClaimSpec{
+				NodeClassRef: &corev1beta1.NodeClassReference{Name: nodeClass.Name},
+			},
+		})
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+		ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		res := ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+		Expect(res.RequeueAfter).ToNot(BeZero())
+		nodeClass = ExpectExists(ctx, env.Client, nodeClass)
+		Expect(nodeClass.Finalizers).To(ContainElement(corev1beta1.TerminationFinalizer))
+		Expect(recorder.Calls("WaitingOnNodeClaimTermination")).To(Equal(1))
+
+		ExpectDeleted(ctx, env.Client, nodeClaim)
+		ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+		ExpectNotFound(ctx, env.Client, nodeClass)
+	})
+	It("should not wait on NodeClaims of other AKSNodeClasses", func() {
+		nodeClaim := coretest.NodeClaim(corev1beta1.NodeClaim{
+			Spec: corev1beta1.NodeClaimSpec{
+				NodeClassRef: &corev1beta1.NodeClassReference{Name: "other"},
+			},
+		})
+		ExpectApplied(ctx, env.Client, nodeClass, nodeClaim)
+		ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+
+		Expect(env.Client.Delete(ctx, nodeClass)).To(Succeed())
+		ExpectReconcileSucceeded(ctx, terminationController, client.ObjectKeyFromObject(nodeClass))
+		ExpectNotFound(ctx, env.Client, nodeClass)
+		Expect(recorder.Calls("WaitingOnNodeClaimTermination")).To(Equal(0))
+	})
+})
@@ -0,0 +1,104 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overrides
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/operator/controller"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/configmap"
+)
+
+// ConfigMapName is the name of the optional ConfigMap, in the namespace of Karpenter, which overrides the retail
+// prices with the prices actually paid (on-demand-discounts, spot-discounts and reserved-instances, see
+// pricing.ParseOverrides)
+const ConfigMapName = "karpenter-price-overrides"
+
+// Controller applies the price overrides ConfigMap to the pricing, along with the count of on-demand NodeClaims by
+// instance type, which tells which instance types still have reserved instances to spare. As that count changes with
+// every launch and deletion, it is taken again on every poll of the ConfigMap, even when the ConfigMap is unchanged.
+type Controller struct {
+	kubeClient      client.Client
+	kubeReader      client.Reader
+	pricingProvider *pricing.Provider
+}
+
+// NewController takes the cached client for the NodeClaims, and an uncached reader for the ConfigMap, see configmap.Poll
+func NewController(kubeClient client.Client, kubeReader client.Reader, pricingProvider *pricing.Provider) *Controller {
+	return &Controller{
+		kubeClient:      kubeClient,
+		kubeReader:      kubeReader,
+		pricingProvider: pricingProvider,
+	}
+}
+
+func (c *Controller) Name() string {
+	return "pricing.overrides"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	return configmap.Poll(ctx, c.kubeReader, ConfigMapName, func(configMap *v1.ConfigMap) error {
+		if configMap == nil {
+			if c.pricingProvider.SetOverrides(nil, nil) {
+				logging.FromContext(ctx).Infof("price overrides configmap removed, using the retail prices")
+			}
+			return nil
+		}
+		// an invalid ConfigMap keeps the last valid overrides in place
+		overrides, err := pricing.ParseOverrides(configMap.Data)
+		if err != nil {
+			return fmt.Errorf("parsing price overrides configmap, %w", err)
+		}
+		onDemandRunning, err := c.onDemandRunning(ctx)
+		if err != nil {
+			return err
+		}
+		if c.pricingProvider.SetOverrides(overrides, onDemandRunning) {
+			logging.FromContext(ctx).With("data", configMap.Data, "on-demand-running", onDemandRunning).Infof("applied price overrides configmap")
+		}
+		return nil
+	})
+}
+
+// onDemandRunning counts the on-demand NodeClaims by instance type, including the ones being deleted as their VMs
+// are paid for until they are gone
+func (c *Controller) onDemandRunning(ctx context.Context) (map[string]int, error) {
+	nodeClaims := &corev1beta1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaims, client.MatchingLabels{corev1beta1.CapacityTypeLabelKey: corev1beta1.CapacityTypeOnDemand}); err != nil {
+		return nil, fmt.Errorf("listing nodeclaims, %w", err)
+	}
+	running := map[string]int{}
+	for _, nodeClaim := range nodeClaims.Items {
+		if instanceType, ok := nodeClaim.Labels[v1.LabelInstanceTypeStable]; ok {
+			running[instanceType]++
+		}
+	}
+	return running, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) controller.Builder {
+	return controller.NewSingletonManagedBy(m)
+}
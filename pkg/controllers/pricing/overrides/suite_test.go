@@ -0,0 +1,151 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overrides_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/pricing/overrides"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+var env *coretest.Environment
+var azureEnv *test.Environment
+var overridesController corecontroller.Controller
+
+func TestOverrides(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/Pricing/Overrides")
+}
+
+var _ = BeforeSuite(func() {
+	os.Setenv("SYSTEM_NAMESPACE", "default")
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+	ctx = options.ToContext(ctx, test.Options())
+
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	ctx, stop = context.WithCancel(ctx)
+	azureEnv = test.NewEnvironment(ctx, env)
+
+	overridesController = overrides.NewController(env.Client, env.Client, azureEnv.PricingProvider)
+})
+
+var _ = AfterSuite(func() {
+	stop()
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = Describe("Overrides", func() {
+	var configMap *v1.ConfigMap
+
+	BeforeEach(func() {
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: overrides.ConfigMapName, Namespace: "default"},
+			Data: map[string]string{
+				pricing.OnDemandDiscountsKey: "D=0.5",
+				pricing.ReservedInstancesKey: "Standard_D4s_v3=1",
+			},
+		}
+		azureEnv.Reset()
+	})
+
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+		ExpectDeleted(ctx, env.Client, configMap)
+	})
+
+	onDemandPrice := func(name string) float64 {
+		GinkgoHelper()
+		instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, test.AKSNodeClass())
+		Expect(err).ToNot(HaveOccurred())
+		instanceType, ok := lo.Find(instanceTypes, func(instanceType *corecloudprovider.InstanceType) bool { return instanceType.Name == name })
+		Expect(ok).To(BeTrue())
+		offering, ok := lo.Find(instanceType.Offerings, func(offering corecloudprovider.Offering) bool {
+			return offering.CapacityType == corev1beta1.CapacityTypeOnDemand
+		})
+		Expect(ok).To(BeTrue())
+		return offering.Price
+	}
+
+	It("should use the retail prices without the configmap", func() {
+		ExpectReconcileSucceeded(ctx, overridesController, client.ObjectKey{})
+		retailPrice, ok := azureEnv.PricingProvider.OnDemandPrice("Standard_D2s_v3")
+		Expect(ok).To(BeTrue())
+		Expect(onDemandPrice("Standard_D2s_v3")).To(BeNumerically("==", retailPrice))
+	})
+	It("should apply the configmap and revert when it is deleted", func() {
+		retailPrice, ok := azureEnv.PricingProvider.OnDemandPrice("Standard_D2s_v3")
+		Expect(ok).To(BeTrue())
+		ExpectApplied(ctx, env.Client, configMap)
+		ExpectReconcileSucceeded(ctx, overridesController, client.ObjectKey{})
+		Expect(onDemandPrice("Standard_D2s_v3")).To(BeNumerically("~", retailPrice*0.5))
+
+		ExpectDeleted(ctx, env.Client, configMap)
+		ExpectReconcileSucceeded(ctx, overridesController, client.ObjectKey{})
+		Expect(onDemandPrice("Standard_D2s_v3")).To(BeNumerically("==", retailPrice))
+	})
+	It("should price reserved instances at the discount once they are all running", func() {
+		retailPrice, ok := azureEnv.PricingProvider.OnDemandPrice("Standard_D4s_v3")
+		Expect(ok).To(BeTrue())
+		ExpectApplied(ctx, env.Client, configMap)
+		ExpectReconcileSucceeded(ctx, overridesController, client.ObjectKey{})
+		Expect(onDemandPrice("Standard_D4s_v3")).To(BeNumerically("==", 0))
+
+		ExpectApplied(ctx, env.Client, coretest.NodeClaim(corev1beta1.NodeClaim{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				corev1beta1.CapacityTypeLabelKey: corev1beta1.CapacityTypeOnDemand,
+				v1.LabelInstanceTypeStable:       "Standard_D4s_v3",
+			}},
+		}))
+		ExpectReconcileSucceeded(ctx, overridesController, client.ObjectKey{})
+		Expect(onDemandPrice("Standard_D4s_v3")).To(BeNumerically("~", retailPrice*0.5))
+	})
+	It("should keep the last valid overrides when the configmap is invalid", func() {
+		retailPrice, ok := azureEnv.PricingProvider.OnDemandPrice("Standard_D2s_v3")
+		Expect(ok).To(BeTrue())
+		ExpectApplied(ctx, env.Client, configMap)
+		ExpectReconcileSucceeded(ctx, overridesController, client.ObjectKey{})
+
+		configMap.Data = map[string]string{pricing.OnDemandDiscountsKey: "D=50"}
+		ExpectApplied(ctx, env.Client, configMap)
+		ExpectReconcileFailed(ctx, overridesController, client.ObjectKey{})
+		Expect(onDemandPrice("Standard_D2s_v3")).To(BeNumerically("~", retailPrice*0.5))
+	})
+})
@@ -19,12 +19,15 @@ package fake
 import (
 	"context"
 	"encoding/json"
+	"strings"
+	"sync"
 
 	"github.com/samber/lo"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotadvisor"
 )
 
 type AzureResourceGraphResourcesInput struct {
@@ -41,12 +44,23 @@ type AzureResourceGraphBehavior struct {
 // assert that the fake implements the interface
 var _ instance.AzureResourceGraphAPI = &AzureResourceGraphAPI{}
 
+// assert that the fake implements the interface
+var _ spotadvisor.ResourceGraphAPI = &AzureResourceGraphAPI{}
+
 type AzureResourceGraphAPI struct {
 	AzureResourceGraphBehavior
+	// SpotEvictionRates are the eviction rate buckets of the SpotResources table, e.g. "0-5" or "20+", by SKU name
+	SpotEvictionRates sync.Map
 }
 
 // Reset must be called between tests otherwise tests will pollute each other.
-func (c *AzureResourceGraphAPI) Reset() {}
+func (c *AzureResourceGraphAPI) Reset() {
+	c.AzureResourceGraphResourcesBehavior.Reset()
+	c.SpotEvictionRates.Range(func(k, _ any) bool {
+		c.SpotEvictionRates.Delete(k)
+		return true
+	})
+}
 
 func (c *AzureResourceGraphAPI) Resources(_ context.Context, query armresourcegraph.QueryRequest, options *armresourcegraph.ClientResourcesOptions) (armresourcegraph.ClientResourcesResponse, error) {
 	input := &AzureResourceGraphResourcesInput{
@@ -76,6 +90,14 @@ func (c *AzureResourceGraphAPI) getResourceList(query string) []interface{} {
 		})
 		return resourceList
 	}
+	if strings.HasPrefix(query, "SpotResources") {
+		var resourceList []interface{}
+		c.SpotEvictionRates.Range(func(k, v any) bool {
+			resourceList = append(resourceList, map[string]interface{}{"skuName": strings.ToLower(k.(string)), "evictionRate": v})
+			return true
+		})
+		return resourceList
+	}
 	return nil
 }
 
@@ -0,0 +1,97 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+type DiskUpdateInput struct {
+	ResourceGroupName string
+	DiskName          string
+	Updates           armcompute.DiskUpdate
+	Options           *armcompute.DisksClientBeginUpdateOptions
+}
+
+type DisksBehavior struct {
+	DiskUpdateBehavior MockedLRO[DiskUpdateInput, armcompute.DisksClientUpdateResponse]
+	Disks              sync.Map
+}
+
+// assert that the fake implements the interface
+var _ instance.DisksAPI = &DisksAPI{}
+
+type DisksAPI struct {
+	DisksBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (c *DisksAPI) Reset() {
+	c.DiskUpdateBehavior.Reset()
+	c.Disks.Range(func(k, v any) bool {
+		c.Disks.Delete(k)
+		return true
+	})
+}
+
+// Get returns the disk, or an untagged one if it was not updated yet, since VM creation does not store its OS disk
+func (c *DisksAPI) Get(_ context.Context, resourceGroupName string, diskName string, _ *armcompute.DisksClientGetOptions) (armcompute.DisksClientGetResponse, error) {
+	id := mkDiskID(resourceGroupName, diskName)
+	if stored, ok := c.Disks.Load(id); ok {
+		return armcompute.DisksClientGetResponse{Disk: stored.(armcompute.Disk)}, nil
+	}
+	return armcompute.DisksClientGetResponse{Disk: armcompute.Disk{ID: lo.ToPtr(id), Name: lo.ToPtr(diskName)}}, nil
+}
+
+// BeginUpdate updates the tags of the disk, the disk is stored on first update since VM creation does not store its OS disk
+func (c *DisksAPI) BeginUpdate(_ context.Context, resourceGroupName string, diskName string, updates armcompute.DiskUpdate, options *armcompute.DisksClientBeginUpdateOptions) (*runtime.Poller[armcompute.DisksClientUpdateResponse], error) {
+	input := &DiskUpdateInput{
+		ResourceGroupName: resourceGroupName,
+		DiskName:          diskName,
+		Updates:           updates,
+		Options:           options,
+	}
+	return c.DiskUpdateBehavior.Invoke(input, func(input *DiskUpdateInput) (*armcompute.DisksClientUpdateResponse, error) {
+		id := mkDiskID(input.ResourceGroupName, input.DiskName)
+		disk := armcompute.Disk{
+			ID:   lo.ToPtr(id),
+			Name: lo.ToPtr(input.DiskName),
+		}
+		if stored, ok := c.Disks.Load(id); ok {
+			disk = stored.(armcompute.Disk)
+		}
+		if input.Updates.Tags != nil {
+			disk.Tags = input.Updates.Tags
+		}
+		c.Disks.Store(id, disk)
+		return &armcompute.DisksClientUpdateResponse{Disk: disk}, nil
+	})
+}
+
+func mkDiskID(resourceGroupName, diskName string) string {
+	const subscriptionID = "subscriptionID" // not important for fake
+	const idFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/disks/%s"
+	return fmt.Sprintf(idFormat, subscriptionID, resourceGroupName, diskName)
+}
@@ -40,9 +40,16 @@ type NetworkInterfaceDeleteInput struct {
 	ResourceGroupName, InterfaceName string
 }
 
+type NetworkInterfaceUpdateTagsInput struct {
+	ResourceGroupName string
+	InterfaceName     string
+	Tags              armnetwork.TagsObject
+}
+
 type NetworkInterfacesBehavior struct {
 	NetworkInterfacesCreateOrUpdateBehavior MockedLRO[NetworkInterfaceCreateOrUpdateInput, armnetwork.InterfacesClientCreateOrUpdateResponse]
 	NetworkInterfacesDeleteBehavior         MockedLRO[NetworkInterfaceDeleteInput, armnetwork.InterfacesClientDeleteResponse]
+	NetworkInterfacesUpdateTagsBehavior     MockedFunction[NetworkInterfaceUpdateTagsInput, armnetwork.InterfacesClientUpdateTagsResponse]
 	NetworkInterfaces                       sync.Map
 }
 
@@ -57,6 +64,7 @@ type NetworkInterfacesAPI struct {
 // Reset must be called between tests otherwise tests will pollute each other.
 func (c *NetworkInterfacesAPI) Reset() {
 	c.NetworkInterfacesCreateOrUpdateBehavior.Reset()
+	c.NetworkInterfacesUpdateTagsBehavior.Reset()
 	c.NetworkInterfaces.Range(func(k, v any) bool {
 		c.NetworkInterfaces.Delete(k)
 		return true
@@ -105,6 +113,25 @@ func (c *NetworkInterfacesAPI) BeginDelete(_ context.Context, resourceGroupName
 	})
 }
 
+func (c *NetworkInterfacesAPI) UpdateTags(_ context.Context, resourceGroupName string, interfaceName string, tags armnetwork.TagsObject, _ *armnetwork.InterfacesClientUpdateTagsOptions) (armnetwork.InterfacesClientUpdateTagsResponse, error) {
+	input := &NetworkInterfaceUpdateTagsInput{
+		ResourceGroupName: resourceGroupName,
+		InterfaceName:     interfaceName,
+		Tags:              tags,
+	}
+	return c.NetworkInterfacesUpdateTagsBehavior.Invoke(input, func(input *NetworkInterfaceUpdateTagsInput) (armnetwork.InterfacesClientUpdateTagsResponse, error) {
+		id := mkNetworkInterfaceID(input.ResourceGroupName, input.InterfaceName)
+		stored, ok := c.NetworkInterfaces.Load(id)
+		if !ok {
+			return armnetwork.InterfacesClientUpdateTagsResponse{}, &azcore.ResponseError{ErrorCode: errors.ResourceNotFound}
+		}
+		iface := stored.(armnetwork.Interface)
+		iface.Tags = input.Tags.Tags
+		c.NetworkInterfaces.Store(id, iface)
+		return armnetwork.InterfacesClientUpdateTagsResponse{Interface: iface}, nil
+	})
+}
+
 func mkNetworkInterfaceID(resourceGroupName, interfaceName string) string {
 	const subscriptionID = "subscriptionID" // not important for fake
 	const idFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/networkInterfaces/%s"
@@ -19,6 +19,8 @@ package fake
 import (
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
@@ -69,3 +71,26 @@ func testSKUExistenceForRegion(t *testing.T, region string, expectedSKUs sets.Se
 		}
 	}
 }
+
+// TestSKUZoneRestrictions ensures the generated SKUs keep covering zone restrictions for the subscription
+func TestSKUZoneRestrictions(t *testing.T) {
+	expectedZoneRestrictions := map[string]sets.Set[string]{
+		"Standard_M8-2ms":  sets.New("1"),
+		"Standard_NC6s_v3": sets.New("1", "2", "3"),
+	}
+	for _, sku := range ResourceSkus["eastus"] {
+		expectedZones, ok := expectedZoneRestrictions[*sku.Name]
+		if !ok {
+			continue
+		}
+		zones := sets.New[string]()
+		for _, restriction := range *sku.Restrictions {
+			if restriction.Type == compute.Zone && restriction.ReasonCode == compute.NotAvailableForSubscription {
+				zones.Insert(*restriction.RestrictionInfo.Zones...)
+			}
+		}
+		if !zones.Equal(expectedZones) {
+			t.Errorf("SKU %s is restricted in zones %v, expected %v", *sku.Name, sets.List(zones), sets.List(expectedZones))
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
+)
+
+type SubnetGetInput struct {
+	ResourceGroupName, VirtualNetworkName, SubnetName string
+}
+
+type SubnetsBehavior struct {
+	SubnetGetBehavior MockedFunction[SubnetGetInput, armnetwork.SubnetsClientGetResponse]
+}
+
+// assert that the fake implements the interface
+var _ instance.SubnetsAPI = &SubnetsAPI{}
+
+type SubnetsAPI struct {
+	SubnetsBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (c *SubnetsAPI) Reset() {
+	c.SubnetGetBehavior.Reset()
+}
+
+// Get returns a succeeded subnet for any name, unless overridden by the behavior
+func (c *SubnetsAPI) Get(_ context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, _ *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error) {
+	input := &SubnetGetInput{
+		ResourceGroupName:  resourceGroupName,
+		VirtualNetworkName: virtualNetworkName,
+		SubnetName:         subnetName,
+	}
+	return c.SubnetGetBehavior.Invoke(input, func(input *SubnetGetInput) (armnetwork.SubnetsClientGetResponse, error) {
+		return armnetwork.SubnetsClientGetResponse{
+			Subnet: armnetwork.Subnet{
+				ID:   lo.ToPtr(mkSubnetID(input.ResourceGroupName, input.VirtualNetworkName, input.SubnetName)),
+				Name: lo.ToPtr(input.SubnetName),
+				Properties: &armnetwork.SubnetPropertiesFormat{
+					ProvisioningState: lo.ToPtr(armnetwork.ProvisioningStateSucceeded),
+				},
+			},
+		}, nil
+	})
+}
+
+func mkSubnetID(resourceGroupName, virtualNetworkName, subnetName string) string {
+	const subscriptionID = "subscriptionID" // not important for fake
+	const idFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s/subnets/%s"
+	return fmt.Sprintf(idFormat, subscriptionID, resourceGroupName, virtualNetworkName, subnetName)
+}
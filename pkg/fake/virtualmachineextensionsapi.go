@@ -34,8 +34,13 @@ type VirtualMachineExtensionCreateOrUpdateInput struct {
 	Options                     *armcompute.VirtualMachineExtensionsClientBeginCreateOrUpdateOptions
 }
 
+type VirtualMachineExtensionDeleteInput struct {
+	ResourceGroupName, VirtualMachineName, VirtualMachineExtensionName string
+}
+
 type VirtualMachineExtensionsBehavior struct {
 	VirtualMachineExtensionsCreateOrUpdateBehavior MockedLRO[VirtualMachineExtensionCreateOrUpdateInput, armcompute.VirtualMachineExtensionsClientCreateOrUpdateResponse]
+	VirtualMachineExtensionsDeleteBehavior         MockedLRO[VirtualMachineExtensionDeleteInput, armcompute.VirtualMachineExtensionsClientDeleteResponse]
 	// not keeping track of extensions
 }
 
@@ -50,6 +55,7 @@ type VirtualMachineExtensionsAPI struct {
 // Reset must be called between tests otherwise tests will pollute each other.
 func (c *VirtualMachineExtensionsAPI) Reset() {
 	c.VirtualMachineExtensionsCreateOrUpdateBehavior.Reset()
+	c.VirtualMachineExtensionsDeleteBehavior.Reset()
 }
 
 func (c *VirtualMachineExtensionsAPI) BeginCreateOrUpdate(_ context.Context, resourceGroupName, vmName, extensionName string, extension armcompute.VirtualMachineExtension, options *armcompute.VirtualMachineExtensionsClientBeginCreateOrUpdateOptions) (*runtime.Poller[armcompute.VirtualMachineExtensionsClientCreateOrUpdateResponse], error) {
@@ -70,6 +76,17 @@ func (c *VirtualMachineExtensionsAPI) BeginCreateOrUpdate(_ context.Context, res
 	})
 }
 
+func (c *VirtualMachineExtensionsAPI) BeginDelete(_ context.Context, resourceGroupName, vmName, extensionName string, _ *armcompute.VirtualMachineExtensionsClientBeginDeleteOptions) (*runtime.Poller[armcompute.VirtualMachineExtensionsClientDeleteResponse], error) {
+	input := &VirtualMachineExtensionDeleteInput{
+		ResourceGroupName:           resourceGroupName,
+		VirtualMachineName:          vmName,
+		VirtualMachineExtensionName: extensionName,
+	}
+	return c.VirtualMachineExtensionsDeleteBehavior.Invoke(input, func(_ *VirtualMachineExtensionDeleteInput) (*armcompute.VirtualMachineExtensionsClientDeleteResponse, error) {
+		return &armcompute.VirtualMachineExtensionsClientDeleteResponse{}, nil
+	})
+}
+
 func mkVMExtensionID(resourceGroupName, vmName, extensionName string) string {
 	const idFormat = "/subscriptions/subscriptionID/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s/extensions/%s"
 	return fmt.Sprintf(idFormat, resourceGroupName, vmName, extensionName)
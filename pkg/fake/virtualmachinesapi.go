@@ -137,7 +137,9 @@ func (c *VirtualMachinesAPI) BeginUpdate(_ context.Context, resourceGroupName st
 
 		// If other fields need to be updated in the future, you can similarly
 		// update the VM object by merging with updates.<New Field>.
-		vm.Tags = updates.Tags
+		if updates.Tags != nil {
+			vm.Tags = updates.Tags
+		}
 		if updates.Identity != nil {
 			if vm.Identity == nil {
 				vm.Identity = &armcompute.VirtualMachineIdentity{}
@@ -21,5 +21,10 @@ const (
 	Namespace = "karpenter"
 
 	// Subsystem(s).
-	imageFamilySubsystem = "image"
+	imageFamilySubsystem  = "image"
+	instanceSubsystem     = "instance"
+	instanceTypeSubsystem = "instance_type"
+	pricingSubsystem      = "pricing"
+	quotaSubsystem        = "quota"
+	spotSubsystem         = "spot"
 )
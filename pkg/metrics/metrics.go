@@ -31,10 +31,112 @@ var (
 		},
 		[]string{"family"},
 	)
+	InstanceCreationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: instanceSubsystem,
+			Name:      "creation_duration_seconds",
+			Help:      "The duration from ARM accepting the creation of a VM created asynchronously to its provisioning state becoming final, by provisioning state (Succeeded or Failed).",
+			Buckets:   prometheus.ExponentialBuckets(5, 1.5, 12),
+		},
+		[]string{"provisioning_state"},
+	)
+	InstanceTypesFilteredCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: instanceTypeSubsystem,
+			Name:      "filtered_count",
+			Help:      "The number of SKUs of the region not offered as instance types, by the reason they were filtered out.",
+		},
+		[]string{"reason"},
+	)
+	InstanceTypeZoneRestricted = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: instanceTypeSubsystem,
+			Name:      "zone_restricted",
+			Help:      "Whether the instance type is restricted in the zone for the subscription, by the reason code of the restriction. Its offerings in the zone are unavailable.",
+		},
+		[]string{"instance_type", "zone", "reason"},
+	)
+	InstanceTypeEffectivePrice = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: instanceTypeSubsystem,
+			Name:      "effective_price",
+			Help:      "The hourly price of the instance type actually paid, after the price overrides (discounts and reserved instances), by capacity type.",
+		},
+		[]string{"instance_type", "capacity_type"},
+	)
+	PricingLastUpdated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: pricingSubsystem,
+			Name:      "last_updated_timestamp_seconds",
+			Help:      "The time the pricing in use was fetched, by capacity type, in seconds since the epoch. Static pricing reports the time it was generated.",
+		},
+		[]string{"capacity_type"},
+	)
+	PricingStaticFallback = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: pricingSubsystem,
+			Name:      "static_fallback",
+			Help:      "Whether the on-demand pricing of the region is the static pricing of static_region, the region itself or the nearest one with static pricing, as no pricing was fetched yet.",
+		},
+		[]string{"region", "static_region"},
+	)
+	PricingFetchDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: pricingSubsystem,
+			Name:      "fetch_duration_seconds",
+			Help:      "The duration of fetching all the pages of the retail prices of the region, by result (success or error).",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+		},
+		[]string{"result"},
+	)
+	PricingRequestErrorCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: pricingSubsystem,
+			Name:      "request_error_count",
+			Help:      "The number of failed requests to the retail prices API, including retried ones, by status code, or transport or decode for errors without one.",
+		},
+		[]string{"status"},
+	)
+	VCPUQuotaRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: quotaSubsystem,
+			Name:      "remaining_vcpus",
+			Help:      "The vCPU quota left in the region, by usage: cores (regional), lowPriorityCores (regional spot) or a SKU family.",
+		},
+		[]string{"usage"},
+	)
+	SpotEvictionRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: spotSubsystem,
+			Name:      "eviction_rate_percent",
+			Help:      "The lower bound, in percent, of the spot eviction rate bucket of an instance type in the region.",
+		},
+		[]string{"instance_type"},
+	)
 )
 
 func init() {
 	crmetrics.Registry.MustRegister(
 		ImageSelectionErrorCount,
+		InstanceCreationDuration,
+		InstanceTypesFilteredCount,
+		InstanceTypeZoneRestricted,
+		InstanceTypeEffectivePrice,
+		PricingLastUpdated,
+		PricingStaticFallback,
+		PricingFetchDuration,
+		PricingRequestErrorCount,
+		VCPUQuotaRemaining,
+		SpotEvictionRate,
 	)
 }
@@ -27,6 +27,7 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/transport"
 	"knative.dev/pkg/ptr"
+	"knative.dev/pkg/system"
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/operator/scheme"
 
@@ -42,6 +43,8 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/quota"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotadvisor"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
 	"sigs.k8s.io/karpenter/pkg/operator"
@@ -57,10 +60,14 @@ type Operator struct {
 
 	UnavailableOfferingsCache *azurecache.UnavailableOfferings
 
+	AZClient *instance.AZClient
+
 	ImageProvider          *imagefamily.Provider
 	ImageResolver          *imagefamily.Resolver
 	LaunchTemplateProvider *launchtemplate.Provider
 	PricingProvider        *pricing.Provider
+	QuotaProvider          *quota.Provider
+	SpotAdvisor            *spotadvisor.Provider
 	InstanceTypesProvider  *instancetype.Provider
 	InstanceProvider       *instance.Provider
 	LoadBalancerProvider   *loadbalancer.Provider
@@ -79,7 +86,22 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 	unavailableOfferingsCache := azurecache.NewUnavailableOfferings()
 	pricingProvider := pricing.NewProvider(
 		ctx,
-		pricing.NewAPI(),
+		pricing.NewAPI(azConfig.Cloud, options.FromContext(ctx).PricingAPIURL, options.FromContext(ctx).PricingCurrency),
+		pricing.NewConfigMapSnapshotStore(operator.KubernetesInterface, system.Namespace()),
+		azConfig.Location,
+		options.FromContext(ctx).PricingCurrency,
+		operator.Elected(),
+	)
+	quotaProvider := quota.NewProvider(
+		ctx,
+		azClient.UsageClient,
+		azConfig.Location,
+		operator.Elected(),
+	)
+	spotAdvisor := spotadvisor.NewProvider(
+		ctx,
+		azClient.AzureResourceGraphClient(),
+		azConfig.SubscriptionID,
 		azConfig.Location,
 		operator.Elected(),
 	)
@@ -112,6 +134,8 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		cache.New(instancetype.InstanceTypesCacheTTL, azurecache.DefaultCleanupInterval),
 		azClient.SKUClient,
 		pricingProvider,
+		quotaProvider,
+		spotAdvisor,
 		unavailableOfferingsCache,
 	)
 	loadBalancerProvider := loadbalancer.NewProvider(
@@ -124,6 +148,9 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		instanceTypeProvider,
 		launchTemplateProvider,
 		loadBalancerProvider,
+		quotaProvider,
+		pricingProvider,
+		spotAdvisor,
 		unavailableOfferingsCache,
 		azConfig.Location,
 		azConfig.NodeResourceGroup,
@@ -134,10 +161,13 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 	return ctx, &Operator{
 		Operator:                  operator,
 		UnavailableOfferingsCache: unavailableOfferingsCache,
+		AZClient:                  azClient,
 		ImageProvider:             imageProvider,
 		ImageResolver:             imageResolver,
 		LaunchTemplateProvider:    launchTemplateProvider,
 		PricingProvider:           pricingProvider,
+		QuotaProvider:             quotaProvider,
+		SpotAdvisor:               spotAdvisor,
 		InstanceTypesProvider:     instanceTypeProvider,
 		InstanceProvider:          instanceProvider,
 		LoadBalancerProvider:      loadBalancerProvider,
@@ -25,13 +25,40 @@ import (
 	"math/rand"
 	"net/url"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 
+	"github.com/samber/lo"
+
 	"k8s.io/apimachinery/pkg/util/sets"
 	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
 	"sigs.k8s.io/karpenter/pkg/utils/env"
 )
 
+const (
+	NetworkPluginAzure   = "azure"
+	NetworkPluginKubenet = "kubenet"
+
+	// NetworkPluginModeOverlay is the Azure CNI Overlay mode, nodes and pods then get IPs from different address spaces.
+	// Without a mode, Azure CNI assigns pods IPs from the node subnet, or from the pod subnet when there is one.
+	NetworkPluginModeOverlay = "overlay"
+
+	// KubeReservedPolicyAKSLegacy reserves memory and CPU with the regressive brackets of AKS before 1.29
+	KubeReservedPolicyAKSLegacy = "aks-legacy"
+	// KubeReservedPolicyAKS reserves memory as AKS 1.29+ does, 20MiB per pod plus 50MiB up to 25% of the memory,
+	// with a 100Mi memory.available hard eviction threshold, and CPU with the brackets of AKS
+	KubeReservedPolicyAKS = "aks"
+	// KubeReservedPolicyCustom reserves memory and CPU with the kube-reserved-memory-brackets and kube-reserved-cpu-brackets
+	KubeReservedPolicyCustom = "custom"
+
+	// VMCreationModeLegacy creates the NIC, the VM and the AKS billing extension with a call each
+	VMCreationModeLegacy = "legacy"
+	// VMCreationModeSingleCall creates the VM with the NIC declared inline in a single call, the NIC being deleted with the
+	// VM, then tags the NIC and creates the AKS billing extension
+	VMCreationModeSingleCall = "single-call"
+)
+
 func init() {
 	coreoptions.Injectables = append(coreoptions.Injectables, &Options{})
 }
@@ -55,6 +82,112 @@ func (s *nodeIdentitiesValue) Get() any { return []string(*s) }
 
 func (s *nodeIdentitiesValue) String() string { return strings.Join(*s, ",") }
 
+// TaxBracket is a bracket of a regressive tax on the resources of nodes: the amount above the upper bound
+// of the previous bracket (0 for the first one), up to UpperBound, is taxed at Rate
+type TaxBracket struct {
+	// UpperBound is the largest value this bracket is applied to.
+	UpperBound float64
+
+	// Rate is the percent rate of tax expressed as a float i.e. .5 for 50%.
+	Rate float64
+}
+
+// taxBracketsValue parses tax brackets from comma separated upperBound:rate pairs, e.g. 4:0.25,8:0.2,inf:0.1
+type taxBracketsValue []TaxBracket
+
+func newTaxBracketsValue(val string, p *[]TaxBracket) *taxBracketsValue {
+	*p = nil
+	lo.Must0((*taxBracketsValue)(p).Set(val), "parsing tax brackets")
+	return (*taxBracketsValue)(p)
+}
+
+func (s *taxBracketsValue) Set(val string) error {
+	var brackets []TaxBracket
+	for _, bracket := range lo.Compact(strings.Split(val, ",")) {
+		upperBound, rate, ok := strings.Cut(bracket, ":")
+		if !ok {
+			return fmt.Errorf("tax bracket %q is not in the upperBound:rate format", bracket)
+		}
+		parsedUpperBound, err := strconv.ParseFloat(upperBound, 64)
+		if err != nil {
+			return fmt.Errorf("parsing upper bound of tax bracket %q, %w", bracket, err)
+		}
+		parsedRate, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return fmt.Errorf("parsing rate of tax bracket %q, %w", bracket, err)
+		}
+		brackets = append(brackets, TaxBracket{UpperBound: parsedUpperBound, Rate: parsedRate})
+	}
+	*s = brackets
+	return nil
+}
+
+func (s *taxBracketsValue) Get() any { return []TaxBracket(*s) }
+
+func (s *taxBracketsValue) String() string {
+	return strings.Join(lo.Map(*s, func(bracket TaxBracket, _ int) string {
+		return fmt.Sprintf("%s:%s", strconv.FormatFloat(bracket.UpperBound, 'g', -1, 64), strconv.FormatFloat(bracket.Rate, 'g', -1, 64))
+	}), ",")
+}
+
+// percentsValue parses percents by key from comma separated key=percent pairs, e.g. D=0.06,E=0.08
+type percentsValue map[string]float64
+
+func newPercentsValue(val string, p *map[string]float64) *percentsValue {
+	*p = map[string]float64{}
+	lo.Must0((*percentsValue)(p).Set(val), "parsing percents")
+	return (*percentsValue)(p)
+}
+
+func (s *percentsValue) Set(val string) error {
+	percents := map[string]float64{}
+	for _, pair := range lo.Compact(strings.Split(val, ",")) {
+		key, percent, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("%q is not in the key=percent format", pair)
+		}
+		parsedPercent, err := strconv.ParseFloat(percent, 64)
+		if err != nil {
+			return fmt.Errorf("parsing percent of %q, %w", pair, err)
+		}
+		percents[key] = parsedPercent
+	}
+	*s = percents
+	return nil
+}
+
+func (s *percentsValue) Get() any { return map[string]float64(*s) }
+
+func (s *percentsValue) String() string {
+	return strings.Join(lo.Map(lo.Keys(*s), func(key string, _ int) string {
+		return fmt.Sprintf("%s=%s", key, strconv.FormatFloat((*s)[key], 'g', -1, 64))
+	}), ",")
+}
+
+// globsValue parses comma separated glob patterns, as matched by path.Match, e.g. Standard_D*_v5,Standard_E*
+type globsValue []string
+
+func newGlobsValue(val string, p *[]string) *globsValue {
+	*p = nil
+	lo.Must0((*globsValue)(p).Set(val), "parsing globs")
+	return (*globsValue)(p)
+}
+
+func (s *globsValue) Set(val string) error {
+	globs := lo.Compact(strings.Split(val, ","))
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("parsing glob %q, %w", glob, err)
+		}
+	}
+	*s = globs
+	return nil
+}
+
+func (s *globsValue) Get() any { return []string(*s) }
+
+func (s *globsValue) String() string { return strings.Join(*s, ",") }
+
 type optionsKey struct{}
 
 type Options struct {
@@ -65,10 +198,33 @@ type Options struct {
 	KubeletClientTLSBootstrapToken string   // => TLSBootstrapToken in bootstrap (may need to be per node/nodepool)
 	SSHPublicKey                   string   // ssh.publicKeys.keyData => VM SSH public key // TODO: move to v1alpha2.AKSNodeClass?
 	NetworkPlugin                  string   // => NetworkPlugin in bootstrap
+	NetworkPluginMode              string   // => with NetworkPlugin, determines the default max pods of nodes
 	NetworkPolicy                  string   // => NetworkPolicy in bootstrap
 	NodeIdentities                 []string // => Applied onto each VM
 
-	SubnetID string // => VnetSubnetID to use (for nodes in Azure CNI Overlay and Azure CNI + pod subnet; for for nodes and pods in Azure CNI), unless overridden via AKSNodeClass
+	SubnetID    string // => VnetSubnetID to use (for nodes in Azure CNI Overlay and Azure CNI + pod subnet; for for nodes and pods in Azure CNI), unless overridden via AKSNodeClass
+	PodSubnetID string // => subnet pods get IPs from in Azure CNI + pod subnet, empty otherwise
+
+	// overhead of nodes, overridable at runtime by the overhead ConfigMap, see OverheadSettings
+	KubeReservedPolicy               string
+	KubeReservedMemoryBrackets       []TaxBracket       // in GiB, for the custom policy
+	KubeReservedCPUBrackets          []TaxBracket       // in vCPUs, for the custom policy
+	VMMemoryOverheadPercentOverrides map[string]float64 // by SKU family, replacing VMMemoryOverheadPercent
+
+	// instance type policy, on top of the SKUs AKS does not support
+	InstanceTypesInclude             []string // globs on SKU names, all SKUs when empty
+	InstanceTypesExclude             []string // globs on SKU names
+	SKUFamiliesInclude               []string // globs on SKU families, all families when empty
+	SKUFamiliesExclude               []string // globs on SKU families
+	AllowBurstableInstanceTypes      bool     // B-series
+	AllowConstrainedCPUInstanceTypes bool     // e.g. Standard_E4-2s_v3
+
+	PricingAPIURL   string // retail prices API, the public one when empty
+	PricingCurrency string // ISO 4217 currency code of the prices, e.g. USD
+
+	MaxLaunchAttempts int    // instance type and zone combinations tried by a single launch
+	VMCreationMode    string // legacy or single-call
+	AsyncVMCreation   bool   // launches return once ARM accepts the VM, rather than once it is provisioned, bypassing the retries and fallback of launches
 
 	setFlags map[string]bool
 }
@@ -80,9 +236,26 @@ func (o *Options) AddFlags(fs *coreoptions.FlagSet) {
 	fs.StringVar(&o.KubeletClientTLSBootstrapToken, "kubelet-bootstrap-token", env.WithDefaultString("KUBELET_BOOTSTRAP_TOKEN", ""), "[REQUIRED] The bootstrap token for new nodes to join the cluster.")
 	fs.StringVar(&o.SSHPublicKey, "ssh-public-key", env.WithDefaultString("SSH_PUBLIC_KEY", ""), "[REQUIRED] VM SSH public key.")
 	fs.StringVar(&o.NetworkPlugin, "network-plugin", env.WithDefaultString("NETWORK_PLUGIN", "azure"), "The network plugin used by the cluster.")
+	fs.StringVar(&o.NetworkPluginMode, "network-plugin-mode", env.WithDefaultString("NETWORK_PLUGIN_MODE", NetworkPluginModeOverlay), "The network plugin mode used by the cluster: overlay, or empty for Azure CNI with pod IPs from the node or pod subnet.")
 	fs.StringVar(&o.NetworkPolicy, "network-policy", env.WithDefaultString("NETWORK_POLICY", ""), "The network policy used by the cluster.")
 	fs.StringVar(&o.SubnetID, "vnet-subnet-id", env.WithDefaultString("VNET_SUBNET_ID", ""), "The default subnet ID to use for new nodes. This must be a valid ARM resource ID for subnet that does not overlap with the service CIDR or the pod CIDR")
+	fs.StringVar(&o.PodSubnetID, "pod-subnet-id", env.WithDefaultString("POD_SUBNET_ID", ""), "The subnet ID pods get IPs from, for clusters using Azure CNI with a pod subnet.")
 	fs.Var(newNodeIdentitiesValue(env.WithDefaultString("NODE_IDENTITIES", ""), &o.NodeIdentities), "node-identities", "User assigned identities for nodes.")
+	fs.StringVar(&o.KubeReservedPolicy, "kube-reserved-policy", env.WithDefaultString("KUBE_RESERVED_POLICY", KubeReservedPolicyAKSLegacy), "The policy for the kube-reserved resources of nodes: aks-legacy, aks (AKS 1.29+) or custom.")
+	fs.Var(newTaxBracketsValue(env.WithDefaultString("KUBE_RESERVED_MEMORY_BRACKETS", ""), &o.KubeReservedMemoryBrackets), "kube-reserved-memory-brackets", "The memory brackets of the custom kube-reserved policy, as upperBoundGiB:rate pairs, e.g. 4:0.25,8:0.2,inf:0.1. Defaults to the aks-legacy ones.")
+	fs.Var(newTaxBracketsValue(env.WithDefaultString("KUBE_RESERVED_CPU_BRACKETS", ""), &o.KubeReservedCPUBrackets), "kube-reserved-cpu-brackets", "The CPU brackets of the custom kube-reserved policy, as upperBoundVCPUs:rate pairs, e.g. 1:0.06,2:0.04,inf:0.01. Defaults to the aks-legacy ones.")
+	fs.Var(newPercentsValue(env.WithDefaultString("VM_MEMORY_OVERHEAD_PERCENT_OVERRIDES", ""), &o.VMMemoryOverheadPercentOverrides), "vm-memory-overhead-percent-overrides", "The VM memory overhead percents of SKU families (as in the karpenter.azure.com/sku-family label) which differ from vm-memory-overhead-percent, e.g. D=0.06,E=0.08.")
+	fs.Var(newGlobsValue(env.WithDefaultString("INSTANCE_TYPES_INCLUDE", ""), &o.InstanceTypesInclude), "instance-types-include", "Globs on the SKU names of the instance types to consider, e.g. Standard_D*_v5,Standard_E*_v5. All SKUs when empty.")
+	fs.Var(newGlobsValue(env.WithDefaultString("INSTANCE_TYPES_EXCLUDE", ""), &o.InstanceTypesExclude), "instance-types-exclude", "Globs on the SKU names of the instance types not to consider, e.g. Standard_*_v2.")
+	fs.Var(newGlobsValue(env.WithDefaultString("SKU_FAMILIES_INCLUDE", ""), &o.SKUFamiliesInclude), "sku-families-include", "Globs on the SKU families (as in the karpenter.azure.com/sku-family label) of the instance types to consider, e.g. D,E. All families when empty.")
+	fs.Var(newGlobsValue(env.WithDefaultString("SKU_FAMILIES_EXCLUDE", ""), &o.SKUFamiliesExclude), "sku-families-exclude", "Globs on the SKU families (as in the karpenter.azure.com/sku-family label) of the instance types not to consider, e.g. L,M.")
+	fs.BoolVar(&o.AllowBurstableInstanceTypes, "allow-burstable-instance-types", env.WithDefaultBool("ALLOW_BURSTABLE_INSTANCE_TYPES", true), "Consider burstable B-series instance types.")
+	fs.BoolVar(&o.AllowConstrainedCPUInstanceTypes, "allow-constrained-cpu-instance-types", env.WithDefaultBool("ALLOW_CONSTRAINED_CPU_INSTANCE_TYPES", false), "Consider constrained vCPU instance types, e.g. Standard_E4-2s_v3.")
+	fs.StringVar(&o.PricingAPIURL, "pricing-api-url", env.WithDefaultString("PRICING_API_URL", ""), "The URL of the retail prices API, e.g. for a local stand-in. Defaults to https://prices.azure.com/api/retail/prices.")
+	fs.StringVar(&o.PricingCurrency, "pricing-currency", env.WithDefaultString("PRICING_CURRENCY", "USD"), "The currency of the retail prices, e.g. EUR. The static pricing, used until prices are fetched, is in USD.")
+	fs.IntVar(&o.MaxLaunchAttempts, "max-launch-attempts", env.WithDefaultInt("MAX_LAUNCH_ATTEMPTS", 3), "The number of instance type and zone combinations a launch tries, moving on to the next cheapest one when a VM can't be created for lack of capacity, before giving up until the next provisioning loop. Falling back from spot to on-demand adds an attempt.")
+	fs.StringVar(&o.VMCreationMode, "vm-creation-mode", env.WithDefaultString("VM_CREATION_MODE", VMCreationModeLegacy), "How VMs are created: legacy, creating the NIC, the VM and the AKS billing extension with a call each, or single-call, declaring the NIC inline in the VM and creating the extension once the VM is.")
+	fs.BoolVar(&o.AsyncVMCreation, "async-vm-creation", env.WithDefaultBool("ASYNC_VM_CREATION", false), "Return from launches as soon as ARM accepts the VM, tracking its provisioning state afterwards and deleting the NodeClaim if it fails. A creation failing for lack of capacity marks the offering unavailable for the replacement NodeClaim, but is neither retried with another offering nor falls back from spot to on-demand, as synchronous launches do. Requires vm-creation-mode single-call.")
 }
 
 func (o Options) GetAPIServerName() string {
@@ -90,6 +263,71 @@ func (o Options) GetAPIServerName() string {
 	return endpoint.Hostname()
 }
 
+// IsAzureCNINodeSubnet returns whether pods get IPs from the node subnet, which then get reserved on the NIC of the nodes
+func (o Options) IsAzureCNINodeSubnet() bool {
+	return o.NetworkPlugin == NetworkPluginAzure && o.NetworkPluginMode != NetworkPluginModeOverlay && o.PodSubnetID == ""
+}
+
+// OverheadSettings are the options of the overhead of nodes, which the overhead ConfigMap overrides at runtime
+type OverheadSettings struct {
+	KubeReservedPolicy               string
+	KubeReservedMemoryBrackets       []TaxBracket
+	KubeReservedCPUBrackets          []TaxBracket
+	VMMemoryOverheadPercent          float64
+	VMMemoryOverheadPercentOverrides map[string]float64
+}
+
+// OverheadSettings returns the overhead options
+func (o Options) OverheadSettings() OverheadSettings {
+	return OverheadSettings{
+		KubeReservedPolicy:               o.KubeReservedPolicy,
+		KubeReservedMemoryBrackets:       o.KubeReservedMemoryBrackets,
+		KubeReservedCPUBrackets:          o.KubeReservedCPUBrackets,
+		VMMemoryOverheadPercent:          o.VMMemoryOverheadPercent,
+		VMMemoryOverheadPercentOverrides: o.VMMemoryOverheadPercentOverrides,
+	}
+}
+
+// WithOverheadSettings returns a copy of the options with the overhead options replaced by the settings
+func (o Options) WithOverheadSettings(settings OverheadSettings) *Options {
+	o.KubeReservedPolicy = settings.KubeReservedPolicy
+	o.KubeReservedMemoryBrackets = settings.KubeReservedMemoryBrackets
+	o.KubeReservedCPUBrackets = settings.KubeReservedCPUBrackets
+	o.VMMemoryOverheadPercent = settings.VMMemoryOverheadPercent
+	o.VMMemoryOverheadPercentOverrides = settings.VMMemoryOverheadPercentOverrides
+	return &o
+}
+
+// OverheadOverrides returns the overhead options overridden by the data of the overhead ConfigMap, whose keys are
+// the names of the flags
+func (o Options) OverheadOverrides(data map[string]string) (*OverheadSettings, error) {
+	overridden := o.OverheadSettings()
+	for key, value := range data {
+		var err error
+		switch key {
+		case "kube-reserved-policy":
+			overridden.KubeReservedPolicy = value
+		case "kube-reserved-memory-brackets":
+			err = (*taxBracketsValue)(&overridden.KubeReservedMemoryBrackets).Set(value)
+		case "kube-reserved-cpu-brackets":
+			err = (*taxBracketsValue)(&overridden.KubeReservedCPUBrackets).Set(value)
+		case "vm-memory-overhead-percent":
+			overridden.VMMemoryOverheadPercent, err = strconv.ParseFloat(value, 64)
+		case "vm-memory-overhead-percent-overrides":
+			err = (*percentsValue)(&overridden.VMMemoryOverheadPercentOverrides).Set(value)
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("overriding %s, %w", key, err)
+		}
+	}
+	if err := o.WithOverheadSettings(overridden).validateOverhead(); err != nil {
+		return nil, err
+	}
+	return &overridden, nil
+}
+
 func (o *Options) Parse(fs *coreoptions.FlagSet, args ...string) error {
 	if err := fs.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -19,19 +19,29 @@ package options
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/multierr"
 )
 
+var currencyCodeRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+
 func (o Options) Validate() error {
 	validate := validator.New()
 	return multierr.Combine(
 		o.validateRequiredFields(),
 		o.validateEndpoint(),
-		o.validateVMMemoryOverheadPercent(),
+		o.validatePricingAPIURL(),
+		o.validatePricingCurrency(),
+		o.validateMaxLaunchAttempts(),
+		o.validateVMCreationMode(),
+		o.validateAsyncVMCreation(),
+		o.validateOverhead(),
 		o.validateVnetSubnetID(),
+		o.validateNetworkPluginMode(),
+		o.validatePodSubnetID(),
 		validate.Struct(o),
 	)
 }
@@ -44,6 +54,26 @@ func (o Options) validateVnetSubnetID() error {
 	return nil
 }
 
+func (o Options) validateNetworkPluginMode() error {
+	if o.NetworkPluginMode != "" && o.NetworkPluginMode != NetworkPluginModeOverlay {
+		return fmt.Errorf("network-plugin-mode %q is invalid, must be %q or empty", o.NetworkPluginMode, NetworkPluginModeOverlay)
+	}
+	return nil
+}
+
+func (o Options) validatePodSubnetID() error {
+	if o.PodSubnetID == "" {
+		return nil
+	}
+	if o.NetworkPluginMode == NetworkPluginModeOverlay {
+		return fmt.Errorf("pod-subnet-id is not supported with network-plugin-mode %q", NetworkPluginModeOverlay)
+	}
+	if _, err := utils.GetVnetSubnetIDComponents(o.PodSubnetID); err != nil {
+		return fmt.Errorf("pod-subnet-id is invalid: %w", err)
+	}
+	return nil
+}
+
 func (o Options) validateEndpoint() error {
 	if o.ClusterEndpoint == "" {
 		return nil
@@ -57,10 +87,86 @@ func (o Options) validateEndpoint() error {
 	return nil
 }
 
+func (o Options) validatePricingAPIURL() error {
+	if o.PricingAPIURL == "" {
+		return nil
+	}
+	pricingAPIURL, err := url.Parse(o.PricingAPIURL)
+	if err != nil || !pricingAPIURL.IsAbs() || pricingAPIURL.Hostname() == "" {
+		return fmt.Errorf("pricing-api-url %q is not a valid URL", o.PricingAPIURL)
+	}
+	return nil
+}
+
+func (o Options) validatePricingCurrency() error {
+	if !currencyCodeRegex.MatchString(o.PricingCurrency) {
+		return fmt.Errorf("pricing-currency %q is invalid, must be an ISO 4217 currency code, e.g. USD", o.PricingCurrency)
+	}
+	return nil
+}
+
+func (o Options) validateMaxLaunchAttempts() error {
+	if o.MaxLaunchAttempts < 1 {
+		return fmt.Errorf("max-launch-attempts %d is invalid, must be at least 1", o.MaxLaunchAttempts)
+	}
+	return nil
+}
+
+func (o Options) validateVMCreationMode() error {
+	if o.VMCreationMode != VMCreationModeLegacy && o.VMCreationMode != VMCreationModeSingleCall {
+		return fmt.Errorf("vm-creation-mode %q is invalid, must be %s or %s", o.VMCreationMode, VMCreationModeLegacy, VMCreationModeSingleCall)
+	}
+	return nil
+}
+
+func (o Options) validateAsyncVMCreation() error {
+	// creating the NIC before the VM would hold the launch for it, asynchronous creation declares it inline
+	if o.AsyncVMCreation && o.VMCreationMode != VMCreationModeSingleCall {
+		return fmt.Errorf("async-vm-creation requires vm-creation-mode %s", VMCreationModeSingleCall)
+	}
+	return nil
+}
+
+func (o Options) validateOverhead() error {
+	return multierr.Combine(
+		o.validateVMMemoryOverheadPercent(),
+		o.validateKubeReservedPolicy(),
+		validateTaxBrackets("kube-reserved-memory-brackets", o.KubeReservedMemoryBrackets),
+		validateTaxBrackets("kube-reserved-cpu-brackets", o.KubeReservedCPUBrackets),
+	)
+}
+
 func (o Options) validateVMMemoryOverheadPercent() error {
 	if o.VMMemoryOverheadPercent < 0 {
 		return fmt.Errorf("vm-memory-overhead-percent cannot be negative")
 	}
+	for family, percent := range o.VMMemoryOverheadPercentOverrides {
+		if percent < 0 {
+			return fmt.Errorf("vm-memory-overhead-percent-overrides cannot be negative, got %v for %s", percent, family)
+		}
+	}
+	return nil
+}
+
+func (o Options) validateKubeReservedPolicy() error {
+	switch o.KubeReservedPolicy {
+	case KubeReservedPolicyAKSLegacy, KubeReservedPolicyAKS, KubeReservedPolicyCustom:
+		return nil
+	default:
+		return fmt.Errorf("kube-reserved-policy %q is invalid, must be one of %s, %s or %s",
+			o.KubeReservedPolicy, KubeReservedPolicyAKSLegacy, KubeReservedPolicyAKS, KubeReservedPolicyCustom)
+	}
+}
+
+func validateTaxBrackets(name string, brackets []TaxBracket) error {
+	for i, bracket := range brackets {
+		if bracket.Rate < 0 || bracket.Rate > 1 {
+			return fmt.Errorf("%s rates must be between 0 and 1, got %v", name, bracket.Rate)
+		}
+		if i > 0 && bracket.UpperBound <= brackets[i-1].UpperBound {
+			return fmt.Errorf("%s upper bounds must be increasing", name)
+		}
+	}
 	return nil
 }
 
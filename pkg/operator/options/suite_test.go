@@ -19,6 +19,7 @@ package options_test
 import (
 	"context"
 	"flag"
+	"math"
 	"os"
 	"testing"
 
@@ -46,12 +47,29 @@ var _ = Describe("Options", func() {
 		"CLUSTER_NAME",
 		"CLUSTER_ENDPOINT",
 		"VM_MEMORY_OVERHEAD_PERCENT",
+		"VM_MEMORY_OVERHEAD_PERCENT_OVERRIDES",
+		"KUBE_RESERVED_POLICY",
+		"KUBE_RESERVED_MEMORY_BRACKETS",
+		"KUBE_RESERVED_CPU_BRACKETS",
+		"INSTANCE_TYPES_INCLUDE",
+		"INSTANCE_TYPES_EXCLUDE",
+		"SKU_FAMILIES_INCLUDE",
+		"SKU_FAMILIES_EXCLUDE",
+		"ALLOW_BURSTABLE_INSTANCE_TYPES",
+		"ALLOW_CONSTRAINED_CPU_INSTANCE_TYPES",
+		"PRICING_API_URL",
+		"PRICING_CURRENCY",
+		"MAX_LAUNCH_ATTEMPTS",
+		"VM_CREATION_MODE",
+		"ASYNC_VM_CREATION",
 		"CLUSTER_ID",
 		"KUBELET_BOOTSTRAP_TOKEN",
 		"SSH_PUBLIC_KEY",
 		"NETWORK_PLUGIN",
+		"NETWORK_PLUGIN_MODE",
 		"NETWORK_POLICY",
 		"NODE_IDENTITIES",
+		"POD_SUBNET_ID",
 	}
 
 	var fs *coreoptions.FlagSet
@@ -87,10 +105,27 @@ var _ = Describe("Options", func() {
 			os.Setenv("CLUSTER_NAME", "env-cluster")
 			os.Setenv("CLUSTER_ENDPOINT", "https://environment-cluster-id-value-for-testing")
 			os.Setenv("VM_MEMORY_OVERHEAD_PERCENT", "0.3")
+			os.Setenv("VM_MEMORY_OVERHEAD_PERCENT_OVERRIDES", "D=0.06,E=0.08")
+			os.Setenv("KUBE_RESERVED_POLICY", "custom")
+			os.Setenv("KUBE_RESERVED_MEMORY_BRACKETS", "4:0.25,inf:0.1")
+			os.Setenv("KUBE_RESERVED_CPU_BRACKETS", "1:0.06,inf:0.01")
+			os.Setenv("INSTANCE_TYPES_INCLUDE", "Standard_D*_v5,Standard_E*_v5")
+			os.Setenv("INSTANCE_TYPES_EXCLUDE", "Standard_D2*")
+			os.Setenv("SKU_FAMILIES_INCLUDE", "D,E")
+			os.Setenv("SKU_FAMILIES_EXCLUDE", "N")
+			os.Setenv("ALLOW_BURSTABLE_INSTANCE_TYPES", "false")
+			os.Setenv("ALLOW_CONSTRAINED_CPU_INSTANCE_TYPES", "true")
+			os.Setenv("PRICING_API_URL", "http://localhost:8080/api/retail/prices")
+			os.Setenv("PRICING_CURRENCY", "EUR")
+			os.Setenv("MAX_LAUNCH_ATTEMPTS", "5")
+			os.Setenv("VM_CREATION_MODE", "single-call")
+			os.Setenv("ASYNC_VM_CREATION", "true")
 			os.Setenv("KUBELET_BOOTSTRAP_TOKEN", "env-bootstrap-token")
 			os.Setenv("SSH_PUBLIC_KEY", "env-ssh-public-key")
 			os.Setenv("NETWORK_PLUGIN", "env-network-plugin")
+			os.Setenv("NETWORK_PLUGIN_MODE", "")
 			os.Setenv("NETWORK_POLICY", "env-network-policy")
+			os.Setenv("POD_SUBNET_ID", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpenterpodsub")
 			os.Setenv("NODE_IDENTITIES", "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid1,/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid2")
 			os.Setenv("VNET_SUBNET_ID", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub")
 			fs = &coreoptions.FlagSet{
@@ -100,18 +135,47 @@ var _ = Describe("Options", func() {
 			err := opts.Parse(fs)
 			Expect(err).ToNot(HaveOccurred())
 			expectOptionsEqual(opts, test.Options(test.OptionsFields{
-				ClusterName:                    lo.ToPtr("env-cluster"),
-				ClusterEndpoint:                lo.ToPtr("https://environment-cluster-id-value-for-testing"),
-				VMMemoryOverheadPercent:        lo.ToPtr(0.3),
-				ClusterID:                      lo.ToPtr("46593302"),
-				KubeletClientTLSBootstrapToken: lo.ToPtr("env-bootstrap-token"),
-				SSHPublicKey:                   lo.ToPtr("env-ssh-public-key"),
-				NetworkPlugin:                  lo.ToPtr("env-network-plugin"),
-				NetworkPolicy:                  lo.ToPtr("env-network-policy"),
-				SubnetID:                       lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
-				NodeIdentities:                 []string{"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid1", "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid2"},
+				ClusterName:                      lo.ToPtr("env-cluster"),
+				ClusterEndpoint:                  lo.ToPtr("https://environment-cluster-id-value-for-testing"),
+				VMMemoryOverheadPercent:          lo.ToPtr(0.3),
+				VMMemoryOverheadPercentOverrides: map[string]float64{"D": 0.06, "E": 0.08},
+				KubeReservedPolicy:               lo.ToPtr("custom"),
+				KubeReservedMemoryBrackets:       []options.TaxBracket{{UpperBound: 4, Rate: 0.25}, {UpperBound: math.Inf(1), Rate: 0.1}},
+				KubeReservedCPUBrackets:          []options.TaxBracket{{UpperBound: 1, Rate: 0.06}, {UpperBound: math.Inf(1), Rate: 0.01}},
+				InstanceTypesInclude:             []string{"Standard_D*_v5", "Standard_E*_v5"},
+				InstanceTypesExclude:             []string{"Standard_D2*"},
+				SKUFamiliesInclude:               []string{"D", "E"},
+				SKUFamiliesExclude:               []string{"N"},
+				AllowBurstableInstanceTypes:      lo.ToPtr(false),
+				AllowConstrainedCPUInstanceTypes: lo.ToPtr(true),
+				PricingAPIURL:                    lo.ToPtr("http://localhost:8080/api/retail/prices"),
+				PricingCurrency:                  lo.ToPtr("EUR"),
+				MaxLaunchAttempts:                lo.ToPtr(5),
+				VMCreationMode:                   lo.ToPtr("single-call"),
+				AsyncVMCreation:                  lo.ToPtr(true),
+				ClusterID:                        lo.ToPtr("46593302"),
+				KubeletClientTLSBootstrapToken:   lo.ToPtr("env-bootstrap-token"),
+				SSHPublicKey:                     lo.ToPtr("env-ssh-public-key"),
+				NetworkPlugin:                    lo.ToPtr("env-network-plugin"),
+				NetworkPluginMode:                lo.ToPtr(""),
+				NetworkPolicy:                    lo.ToPtr("env-network-policy"),
+				PodSubnetID:                      lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpenterpodsub"),
+				SubnetID:                         lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
+				NodeIdentities:                   []string{"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid1", "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid2"},
 			}))
 		})
+		It("should allow burstable instance types by default", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "flag-cluster-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.AllowBurstableInstanceTypes).To(BeTrue())
+		})
 	})
 
 	Context("Validation", func() {
@@ -194,6 +258,185 @@ var _ = Describe("Options", func() {
 			)
 			Expect(err).To(MatchError(ContainSubstring("vm-memory-overhead-percent cannot be negative")))
 		})
+		It("should fail when networkPluginMode is invalid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--network-plugin-mode", "underlay",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`network-plugin-mode "underlay" is invalid`)))
+		})
+		It("should fail when podSubnetID is set with networkPluginMode overlay", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--pod-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpenterpodsub",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`pod-subnet-id is not supported with network-plugin-mode "overlay"`)))
+		})
+		It("should fail when podSubnetID is invalid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--network-plugin-mode", "",
+				"--pod-subnet-id", "invalid-pod-subnet-id",
+			)
+			Expect(err).To(MatchError(ContainSubstring("pod-subnet-id is invalid")))
+		})
+		It("should fail when kubeReservedPolicy is invalid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--kube-reserved-policy", "aks-next",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`kube-reserved-policy "aks-next" is invalid`)))
+		})
+		It("should fail when kubeReservedMemoryBrackets are not increasing", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--kube-reserved-policy", "custom",
+				"--kube-reserved-memory-brackets", "8:0.2,4:0.25",
+			)
+			Expect(err).To(MatchError(ContainSubstring("kube-reserved-memory-brackets upper bounds must be increasing")))
+		})
+		It("should fail when a kubeReservedCPUBrackets rate is above 1", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--kube-reserved-policy", "custom",
+				"--kube-reserved-cpu-brackets", "inf:6",
+			)
+			Expect(err).To(MatchError(ContainSubstring("kube-reserved-cpu-brackets rates must be between 0 and 1")))
+		})
+		It("should fail when a vmMemoryOverheadPercentOverrides percent is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vm-memory-overhead-percent-overrides", "D=-0.01",
+			)
+			Expect(err).To(MatchError(ContainSubstring("vm-memory-overhead-percent-overrides cannot be negative")))
+		})
+		It("should fail when an instanceTypesInclude glob is malformed", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--instance-types-include", "Standard_D[",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`parsing glob "Standard_D["`)))
+		})
+		It("should fail when pricingAPIURL is not a URL", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--pricing-api-url", "prices.azure.com",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`pricing-api-url "prices.azure.com" is not a valid URL`)))
+		})
+		It("should fail when pricingCurrency is not a currency code", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--pricing-currency", "euro",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`pricing-currency "euro" is invalid`)))
+		})
+		It("should fail when maxLaunchAttempts is below 1", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--max-launch-attempts", "0",
+			)
+			Expect(err).To(MatchError(ContainSubstring("max-launch-attempts 0 is invalid")))
+		})
+		It("should fail when vmCreationMode is not a known mode", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vm-creation-mode", "batch",
+			)
+			Expect(err).To(MatchError(ContainSubstring(`vm-creation-mode "batch" is invalid`)))
+		})
+		It("should fail when asyncVMCreation is set without the single-call vmCreationMode", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--async-vm-creation",
+			)
+			Expect(err).To(MatchError(ContainSubstring("async-vm-creation requires vm-creation-mode single-call")))
+		})
+	})
+
+	Context("Overhead Overrides", func() {
+		It("should override the overhead options by flag name", func() {
+			overridden, err := test.Options().OverheadOverrides(map[string]string{
+				"kube-reserved-policy":                 "custom",
+				"kube-reserved-memory-brackets":        "inf:0.1",
+				"vm-memory-overhead-percent":           "0.1",
+				"vm-memory-overhead-percent-overrides": "D=0.06",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(overridden.KubeReservedPolicy).To(Equal(options.KubeReservedPolicyCustom))
+			Expect(overridden.KubeReservedMemoryBrackets).To(Equal([]options.TaxBracket{{UpperBound: math.Inf(1), Rate: 0.1}}))
+			Expect(overridden.VMMemoryOverheadPercent).To(Equal(0.1))
+			Expect(overridden.VMMemoryOverheadPercentOverrides).To(Equal(map[string]float64{"D": 0.06}))
+			Expect(overridden.KubeReservedCPUBrackets).To(Equal(test.Options().KubeReservedCPUBrackets))
+		})
+		It("should only replace the overhead options", func() {
+			opts := test.Options()
+			overridden := opts.WithOverheadSettings(options.OverheadSettings{KubeReservedPolicy: options.KubeReservedPolicyAKS})
+			Expect(overridden.KubeReservedPolicy).To(Equal(options.KubeReservedPolicyAKS))
+			Expect(overridden.VMMemoryOverheadPercent).To(BeZero())
+			Expect(overridden.ClusterName).To(Equal(opts.ClusterName))
+			Expect(opts.KubeReservedPolicy).To(Equal(test.Options().KubeReservedPolicy))
+		})
+		It("should fail on unknown keys", func() {
+			_, err := test.Options().OverheadOverrides(map[string]string{"cluster-name": "my-name"})
+			Expect(err).To(MatchError(ContainSubstring("overriding cluster-name, unknown key")))
+		})
+		It("should fail on invalid overrides", func() {
+			_, err := test.Options().OverheadOverrides(map[string]string{"kube-reserved-policy": "aks-next"})
+			Expect(err).To(MatchError(ContainSubstring(`kube-reserved-policy "aks-next" is invalid`)))
+		})
 	})
 })
 
@@ -202,10 +445,27 @@ func expectOptionsEqual(optsA *options.Options, optsB *options.Options) {
 	Expect(optsA.ClusterName).To(Equal(optsB.ClusterName))
 	Expect(optsA.ClusterEndpoint).To(Equal(optsB.ClusterEndpoint))
 	Expect(optsA.VMMemoryOverheadPercent).To(Equal(optsB.VMMemoryOverheadPercent))
+	Expect(optsA.VMMemoryOverheadPercentOverrides).To(Equal(optsB.VMMemoryOverheadPercentOverrides))
+	Expect(optsA.KubeReservedPolicy).To(Equal(optsB.KubeReservedPolicy))
+	Expect(optsA.KubeReservedMemoryBrackets).To(Equal(optsB.KubeReservedMemoryBrackets))
+	Expect(optsA.KubeReservedCPUBrackets).To(Equal(optsB.KubeReservedCPUBrackets))
+	Expect(optsA.InstanceTypesInclude).To(Equal(optsB.InstanceTypesInclude))
+	Expect(optsA.InstanceTypesExclude).To(Equal(optsB.InstanceTypesExclude))
+	Expect(optsA.SKUFamiliesInclude).To(Equal(optsB.SKUFamiliesInclude))
+	Expect(optsA.SKUFamiliesExclude).To(Equal(optsB.SKUFamiliesExclude))
+	Expect(optsA.AllowBurstableInstanceTypes).To(Equal(optsB.AllowBurstableInstanceTypes))
+	Expect(optsA.AllowConstrainedCPUInstanceTypes).To(Equal(optsB.AllowConstrainedCPUInstanceTypes))
+	Expect(optsA.PricingAPIURL).To(Equal(optsB.PricingAPIURL))
+	Expect(optsA.PricingCurrency).To(Equal(optsB.PricingCurrency))
+	Expect(optsA.MaxLaunchAttempts).To(Equal(optsB.MaxLaunchAttempts))
+	Expect(optsA.VMCreationMode).To(Equal(optsB.VMCreationMode))
+	Expect(optsA.AsyncVMCreation).To(Equal(optsB.AsyncVMCreation))
 	Expect(optsA.ClusterID).To(Equal(optsB.ClusterID))
 	Expect(optsA.KubeletClientTLSBootstrapToken).To(Equal(optsB.KubeletClientTLSBootstrapToken))
 	Expect(optsA.SSHPublicKey).To(Equal(optsB.SSHPublicKey))
 	Expect(optsA.NetworkPlugin).To(Equal(optsB.NetworkPlugin))
+	Expect(optsA.NetworkPluginMode).To(Equal(optsB.NetworkPluginMode))
 	Expect(optsA.NetworkPolicy).To(Equal(optsB.NetworkPolicy))
+	Expect(optsA.PodSubnetID).To(Equal(optsB.PodSubnetID))
 	Expect(optsA.NodeIdentities).To(Equal(optsB.NodeIdentities))
 }
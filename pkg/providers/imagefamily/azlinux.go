@@ -17,10 +17,12 @@ limitations under the License.
 package imagefamily
 
 import (
+	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
 
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
@@ -32,6 +34,9 @@ const (
 	AzureLinuxGen2CommunityImage    = "V2gen2"
 	AzureLinuxGen1CommunityImage    = "V2"
 	AzureLinuxGen2ArmCommunityImage = "V2gen2arm64"
+
+	AzureLinuxGen2FIPSCommunityImage = "V2gen2fips"
+	AzureLinuxGen1FIPSCommunityImage = "V2fips"
 )
 
 type AzureLinux struct {
@@ -42,7 +47,28 @@ func (u AzureLinux) Name() string {
 	return v1alpha2.AzureLinuxImageFamily
 }
 
-func (u AzureLinux) DefaultImages() []DefaultImageOutput {
+func (u AzureLinux) DefaultImages(fipsMode *v1alpha2.FIPSMode) []DefaultImageOutput {
+	if lo.FromPtr(fipsMode) == v1alpha2.FIPSModeEnabled {
+		// FIPS images are only published for amd64
+		return []DefaultImageOutput{
+			{
+				CommunityImage:   AzureLinuxGen2FIPSCommunityImage,
+				PublicGalleryURL: AKSAzureLinuxPublicGalleryURL,
+				Requirements: scheduling.NewRequirements(
+					scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+					scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+				),
+			},
+			{
+				CommunityImage:   AzureLinuxGen1FIPSCommunityImage,
+				PublicGalleryURL: AKSAzureLinuxPublicGalleryURL,
+				Requirements: scheduling.NewRequirements(
+					scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+					scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV1),
+				),
+			},
+		}
+	}
 	// image provider will select these images in order, first match wins. This is why we chose to put Gen2 first in the defaultImages, as we prefer gen2 over gen1
 	return []DefaultImageOutput{
 		{
@@ -73,7 +99,7 @@ func (u AzureLinux) DefaultImages() []DefaultImageOutput {
 }
 
 // UserData returns the default userdata script for the image Family
-func (u AzureLinux) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, _ *cloudprovider.InstanceType) bootstrap.Bootstrapper {
+func (u AzureLinux) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, instanceType *cloudprovider.InstanceType) bootstrap.Bootstrapper {
 	return bootstrap.AKS{
 		Options: bootstrap.Options{
 			ClusterName:     u.Options.ClusterName,
@@ -98,5 +124,7 @@ func (u AzureLinux) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, ta
 		NetworkPlugin:                  u.Options.NetworkPlugin,
 		NetworkPolicy:                  u.Options.NetworkPolicy,
 		KubernetesVersion:              u.Options.KubernetesVersion,
+		KubeletOnTempDisk:              u.Options.KubeletOnTemporaryDisk && instancetype.HasTempDisk(instanceType),
+		EnableFIPS:                     u.Options.EnableFIPS,
 	}
 }
@@ -30,6 +30,7 @@ import (
 
 	agentbakercommon "github.com/Azure/agentbaker/pkg/agent/common"
 	nbcontractv1 "github.com/Azure/agentbaker/pkg/proto/nbcontract/v1"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -49,6 +50,9 @@ type AKS struct {
 	NetworkPlugin                  string
 	NetworkPolicy                  string
 	KubernetesVersion              string
+	EnableFIPS                     bool
+	// KubeletOnTempDisk places the kubelet root directory on the temp disk instead of the OS disk
+	KubeletOnTempDisk bool
 }
 
 var _ Bootstrapper = (*AKS)(nil) // assert AKS implements Bootstrapper
@@ -245,6 +249,11 @@ func (a AKS) applyOptions(v *nbcontractv1.Configuration) (*nbcontractv1.Configur
 	// merge and stringify labels
 	kubeletLabels := lo.Assign(kubeletNodeLabelsBase, a.Labels)
 	getAgentbakerGeneratedLabels(a.ResourceGroup, kubeletLabels)
+	// FIPS compliance itself comes from the FIPS image variant; the node bootstrap contract
+	// version we currently consume does not carry a FIPS flag, so only the node label is applied here.
+	if a.EnableFIPS {
+		kubeletLabels[v1alpha2.AKSLabelFIPSEnabled] = "true"
+	}
 
 	subnetParts, _ := utils.GetVnetSubnetIDComponents(a.SubnetID)
 	contractBuilder.GetNodeBootstrapConfig().ClusterConfig.ClusterNetworkConfig.Subnet = subnetParts.SubnetName
@@ -253,6 +262,9 @@ func (a AKS) applyOptions(v *nbcontractv1.Configuration) (*nbcontractv1.Configur
 
 	contractBuilder.GetNodeBootstrapConfig().KubeletConfig.KubeletNodeLabels = kubeletLabels
 	contractBuilder.GetNodeBootstrapConfig().KubeletConfig.KubeletFlags = a.getKubeletFlags()
+	if a.KubeletOnTempDisk {
+		contractBuilder.GetNodeBootstrapConfig().KubeletConfig.KubeletDiskType = nbcontractv1.KubeletDisk_TEMP_DISK
+	}
 	contractBuilder.GetNodeBootstrapConfig().EnableArtifactStreaming = true
 
 	if error := contractBuilder.ValidateNBContract(); error != nil {
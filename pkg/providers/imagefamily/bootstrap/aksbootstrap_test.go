@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	nbcontractv1 "github.com/Azure/agentbaker/pkg/proto/nbcontract/v1"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -145,6 +146,44 @@ var _ = Describe("Aksbootstrap", func() {
 				Expect(nbconfig).To(BeNil())
 			},
 		),
+		Entry("with FIPS enabled should expect the FIPS node label",
+			func(a *bootstrap.AKS) {
+				a.EnableFIPS = true
+				nbconfig, err := bootstrap.ExportAKSApplyOptions(a, &nbcontractv1.Configuration{
+					ClusterConfig: &nbcontractv1.ClusterConfig{
+						Location:      "AKS location",
+						ResourceGroup: "AKS resourcegroup",
+					},
+				})
+				Expect(err).To(BeNil())
+				Expect(nbconfig.KubeletConfig.KubeletNodeLabels).To(HaveKeyWithValue(v1alpha2.AKSLabelFIPSEnabled, "true"))
+			},
+		),
+		Entry("with FIPS disabled should expect no FIPS node label",
+			func(a *bootstrap.AKS) {
+				nbconfig, err := bootstrap.ExportAKSApplyOptions(a, &nbcontractv1.Configuration{
+					ClusterConfig: &nbcontractv1.ClusterConfig{
+						Location:      "AKS location",
+						ResourceGroup: "AKS resourcegroup",
+					},
+				})
+				Expect(err).To(BeNil())
+				Expect(nbconfig.KubeletConfig.KubeletNodeLabels).ToNot(HaveKey(v1alpha2.AKSLabelFIPSEnabled))
+			},
+		),
+		Entry("with the kubelet on the temp disk should expect the temp disk kubelet disk type",
+			func(a *bootstrap.AKS) {
+				a.KubeletOnTempDisk = true
+				nbconfig, err := bootstrap.ExportAKSApplyOptions(a, &nbcontractv1.Configuration{
+					ClusterConfig: &nbcontractv1.ClusterConfig{
+						Location:      "AKS location",
+						ResourceGroup: "AKS resourcegroup",
+					},
+				})
+				Expect(err).To(BeNil())
+				Expect(nbconfig.KubeletConfig.KubeletDiskType).To(Equal(nbcontractv1.KubeletDisk_TEMP_DISK))
+			},
+		),
 	)
 
 })
@@ -0,0 +1,88 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+)
+
+// Custom renders a user supplied Go template as the bootstrap script,
+// for images whose join logic is not known to Karpenter.
+// The template is executed against the Custom struct itself, e.g. {{ .ClusterEndpoint }}.
+type Custom struct {
+	Options
+
+	// Template is the Go template of the user data
+	Template string
+
+	Arch                           string
+	TenantID                       string
+	SubscriptionID                 string
+	Location                       string
+	ResourceGroup                  string
+	ClusterID                      string
+	APIServerName                  string
+	KubeletClientTLSBootstrapToken string
+	NetworkPlugin                  string
+	NetworkPolicy                  string
+	KubernetesVersion              string
+	// KubeletOnTempDisk is whether the template should place the kubelet root directory on the temp disk,
+	// as the ephemeral-storage capacity of the node assumes
+	KubeletOnTempDisk bool
+}
+
+var _ Bootstrapper = (*Custom)(nil) // assert Custom implements Bootstrapper
+
+func (c Custom) Script() (string, error) {
+	tmpl, err := template.New("userdata").Funcs(customFuncMap()).Parse(c.Template)
+	if err != nil {
+		return "", fmt.Errorf("error parsing custom user data template: %w", err)
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, c); err != nil {
+		return "", fmt.Errorf("error executing custom user data template: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+func customFuncMap() template.FuncMap {
+	return template.FuncMap{
+		// caBundle dereferences the optional CA bundle
+		"caBundle": func(caBundle *string) string { return lo.FromPtr(caBundle) },
+		// b64enc base64 encodes a value, e.g. to write the CA bundle to a file
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		// joinLabels formats labels as --node-labels expects them: k1=v1,k2=v2
+		"joinLabels": func(labels map[string]string) string { return createSortedKeyValuePairs(labels, ",") },
+		// joinTaints formats taints as --register-with-taints expects them: k1=v1:NoSchedule,k2:NoExecute
+		"joinTaints": func(taints []v1.Taint) string {
+			return strings.Join(lo.Map(taints, func(taint v1.Taint, _ int) string { return taint.ToString() }), ",")
+		},
+		// kubeletFlags formats the kubelet configuration resolved by Karpenter (max pods, reservations, evictions, ...)
+		// as space separated kubelet flags
+		"kubeletFlags": func(kubeletConfig *corev1beta1.KubeletConfiguration) string {
+			return createSortedKeyValuePairs(KubeletConfigToMap(kubeletConfig), " ")
+		},
+	}
+}
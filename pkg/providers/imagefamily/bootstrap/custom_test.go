@@ -0,0 +1,66 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap_test
+
+import (
+	"encoding/base64"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	core "k8s.io/api/core/v1"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+)
+
+var _ = Describe("Custom", func() {
+	DescribeTable("custom Script", func(template string, expectedUserData string, expectError bool) {
+		c := bootstrap.Custom{
+			Options: bootstrap.Options{
+				ClusterName:     "clustername",
+				ClusterEndpoint: "https://clusterendpoint:443",
+				KubeletConfig:   &corev1beta1.KubeletConfiguration{MaxPods: lo.ToPtr(int32(30))},
+				Taints: []core.Taint{
+					{Key: "dedicated", Value: "gpu", Effect: core.TaintEffectNoSchedule},
+					{Key: "startup", Effect: core.TaintEffectNoExecute},
+				},
+				Labels:   map[string]string{"b": "2", "a": "1"},
+				CABundle: lo.ToPtr("cabundle"),
+			},
+			Template:                       template,
+			KubeletClientTLSBootstrapToken: "token",
+			KubernetesVersion:              "1.29.2",
+		}
+		script, err := c.Script()
+		if expectError {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		userData, err := base64.StdEncoding.DecodeString(script)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(userData)).To(Equal(expectedUserData))
+	},
+		Entry("should render static parameters", "{{ .ClusterEndpoint }} {{ .KubeletClientTLSBootstrapToken }} {{ .KubernetesVersion }}", "https://clusterendpoint:443 token 1.29.2", false),
+		Entry("should render the CA bundle", "{{ caBundle .CABundle }} {{ caBundle .CABundle | b64enc }}", "cabundle Y2FidW5kbGU=", false),
+		Entry("should render labels", "--node-labels={{ joinLabels .Labels }}", "--node-labels=a=1,b=2", false),
+		Entry("should render taints", "--register-with-taints={{ joinTaints .Taints }}", "--register-with-taints=dedicated=gpu:NoSchedule,startup:NoExecute", false),
+		Entry("should render kubelet flags", "{{ kubeletFlags .KubeletConfig }}", "--max-pods=30", false),
+		Entry("should fail to parse an invalid template", "{{ .ClusterEndpoint ", "", true),
+		Entry("should fail to execute a template referencing unknown fields", "{{ .Unknown }}", "", true),
+	)
+})
@@ -0,0 +1,74 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+)
+
+// Custom is the image family for images unknown to Karpenter.
+// The image and the user data template are both supplied by the AKSNodeClass.
+type Custom struct {
+	Options          *parameters.StaticParameters
+	UserDataTemplate string
+}
+
+func (c Custom) Name() string {
+	return v1alpha2.CustomImageFamily
+}
+
+// DefaultImages returns no images, the image of the Custom family always comes from the AKSNodeClass imageID
+func (c Custom) DefaultImages(_ *v1alpha2.FIPSMode) []DefaultImageOutput {
+	return nil
+}
+
+// UserData returns the user supplied userdata template for the image Family
+func (c Custom) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, instanceType *cloudprovider.InstanceType) bootstrap.Bootstrapper {
+	return bootstrap.Custom{
+		Options: bootstrap.Options{
+			ClusterName:     c.Options.ClusterName,
+			ClusterEndpoint: c.Options.ClusterEndpoint,
+			KubeletConfig:   kubeletConfig,
+			Taints:          taints,
+			Labels:          labels,
+			CABundle:        caBundle,
+			SubnetID:        c.Options.SubnetID,
+			VMSize:          c.Options.VMSize,
+		},
+		Template:                       c.UserDataTemplate,
+		Arch:                           c.Options.Arch,
+		TenantID:                       c.Options.TenantID,
+		SubscriptionID:                 c.Options.SubscriptionID,
+		Location:                       c.Options.Location,
+		ResourceGroup:                  c.Options.ResourceGroup,
+		ClusterID:                      c.Options.ClusterID,
+		APIServerName:                  c.Options.APIServerName,
+		KubeletClientTLSBootstrapToken: c.Options.KubeletClientTLSBootstrapToken,
+		NetworkPlugin:                  c.Options.NetworkPlugin,
+		NetworkPolicy:                  c.Options.NetworkPolicy,
+		KubernetesVersion:              c.Options.KubernetesVersion,
+		KubeletOnTempDisk:              c.Options.KubeletOnTemporaryDisk && instancetype.HasTempDisk(instanceType),
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,8 +28,10 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"knative.dev/pkg/logging"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 )
@@ -64,7 +67,14 @@ func NewProvider(kubernetesInterface kubernetes.Interface, kubernetesVersionCach
 
 // Get returns Image ID for the given instance type. Images may vary due to architecture, accelerator, etc
 func (p *Provider) Get(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType, imageFamily ImageFamily) (string, error) {
-	defaultImages := imageFamily.DefaultImages()
+	// the Custom image family brings its own image
+	if imageFamily.Name() == v1alpha2.CustomImageFamily {
+		if lo.FromPtr(nodeClass.Spec.ImageID) == "" {
+			return "", fmt.Errorf("imageID is required for image family %s", v1alpha2.CustomImageFamily)
+		}
+		return lo.FromPtr(nodeClass.Spec.ImageID), nil
+	}
+	defaultImages := imageFamily.DefaultImages(nodeClass.Spec.FIPSMode)
 	for _, defaultImage := range defaultImages {
 		if err := instanceType.Requirements.Compatible(defaultImage.Requirements, v1alpha2.AllowUndefinedLabels); err == nil {
 			communityImageName, publicGalleryURL := defaultImage.CommunityImage, defaultImage.PublicGalleryURL
@@ -75,6 +85,33 @@ func (p *Provider) Get(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, in
 	return "", fmt.Errorf("no compatible images found for instance type %s", instanceType.Name)
 }
 
+// List returns the current image for each image definition of the AKSNodeClass image family, in order of preference
+func (p *Provider) List(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) ([]v1alpha2.Image, error) {
+	imageFamily := getImageFamily(nodeClass, nil)
+	if imageFamily.Name() == v1alpha2.CustomImageFamily {
+		if lo.FromPtr(nodeClass.Spec.ImageID) == "" {
+			return nil, fmt.Errorf("imageID is required for image family %s", v1alpha2.CustomImageFamily)
+		}
+		// the requirements of custom images are unknown, see AKSNodeClassSpec.ImageID
+		return []v1alpha2.Image{{ID: lo.FromPtr(nodeClass.Spec.ImageID), Requirements: []v1.NodeSelectorRequirement{}}}, nil
+	}
+
+	var images []v1alpha2.Image
+	for _, defaultImage := range imageFamily.DefaultImages(nodeClass.Spec.FIPSMode) {
+		imageID, err := p.GetImageID(ctx, defaultImage.CommunityImage, defaultImage.PublicGalleryURL, nodeClass.Spec.GetImageVersion())
+		if err != nil {
+			return nil, fmt.Errorf("getting image id for %s, %w", defaultImage.CommunityImage, err)
+		}
+		requirements := lo.Map(defaultImage.Requirements.NodeSelectorRequirements(), func(r corev1beta1.NodeSelectorRequirementWithMinValues, _ int) v1.NodeSelectorRequirement {
+			return r.NodeSelectorRequirement
+		})
+		// sort for a stable status
+		sort.Slice(requirements, func(i, j int) bool { return requirements[i].Key < requirements[j].Key })
+		images = append(images, v1alpha2.Image{ID: imageID, Requirements: requirements})
+	}
+	return images, nil
+}
+
 func (p *Provider) KubeServerVersion(ctx context.Context) (string, error) {
 	if version, ok := p.kubernetesVersionCache.Get(kubernetesVersionCacheKey); ok {
 		return version.(string), nil
@@ -124,6 +161,11 @@ func (p *Provider) GetImageID(ctx context.Context, communityImageName, publicGal
 	return selectedImageID, nil
 }
 
+// IsCommunityImageID returns whether the imageID refers to a community gallery image, as opposed to an ARM resource ID
+func IsCommunityImageID(imageID string) bool {
+	return strings.HasPrefix(strings.ToLower(imageID), "/communitygalleries/")
+}
+
 func BuildImageID(publicGalleryURL, communityImageName, imageVersion string) string {
 	return fmt.Sprintf(imageIDFormat, publicGalleryURL, communityImageName, imageVersion)
 }
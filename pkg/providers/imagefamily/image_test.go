@@ -55,3 +55,17 @@ var _ = Describe("Image ID Parsing", func() {
 		Entry("empty image id should not parse", "badimageid", "", "", "", true),
 	)
 })
+
+var _ = Describe("FIPS Community Images", func() {
+	DescribeTable("IsFIPSCommunityImage",
+		func(communityImageName string, expected bool) {
+			Expect(imagefamily.IsFIPSCommunityImage(communityImageName)).To(Equal(expected))
+		},
+		Entry("Ubuntu2204 Gen2 FIPS image", imagefamily.Ubuntu2204Gen2FIPSCommunityImage, true),
+		Entry("Ubuntu2204 Gen1 FIPS image", imagefamily.Ubuntu2204Gen1FIPSCommunityImage, true),
+		Entry("AzureLinux Gen2 FIPS image", imagefamily.AzureLinuxGen2FIPSCommunityImage, true),
+		Entry("AzureLinux Gen1 FIPS image", imagefamily.AzureLinuxGen1FIPSCommunityImage, true),
+		Entry("Ubuntu2204 Gen2 image", imagefamily.Ubuntu2204Gen2CommunityImage, false),
+		Entry("AzureLinux Gen2 ARM image", imagefamily.AzureLinuxGen2ArmCommunityImage, false),
+	)
+})
@@ -34,18 +34,6 @@ import (
 	"sigs.k8s.io/karpenter/pkg/utils/resources"
 )
 
-const (
-	networkPluginAzure   = "azure"
-	networkPluginKubenet = "kubenet"
-
-	// defaultKubernetesMaxPodsAzure is the maximum number of pods to run on a node for Azure CNI Overlay.
-	defaultKubernetesMaxPodsAzure = 250
-	// defaultKubernetesMaxPodsKubenet is the maximum number of pods to run on a node for Kubenet.
-	defaultKubernetesMaxPodsKubenet = 100
-	// defaultKubernetesMaxPods is the maximum number of pods on a node.
-	defaultKubernetesMaxPods = 110
-)
-
 // Resolver is able to fill-in dynamic launch template parameters
 type Resolver struct {
 	imageProvider *Provider
@@ -64,7 +52,8 @@ type ImageFamily interface {
 	// DefaultImages returns a list of default CommunityImage definitions for this ImageFamily.
 	// Our Image Selection logic relies on the ordering of the default images to be ordered from most preferred to least, then we will select the latest image version available for that CommunityImage definition.
 	// Our Release pipeline ensures all images are released together within 24 hours of each other for community image gallery, so selecting based on image feature priorities, then by date, and not vice-versa is acceptable.
-	DefaultImages() []DefaultImageOutput
+	// When fipsMode is Enabled only FIPS compliant images are returned.
+	DefaultImages(fipsMode *v1alpha2.FIPSMode) []DefaultImageOutput
 }
 
 // New constructs a new launch template Resolver
@@ -77,7 +66,7 @@ func New(_ client.Client, imageProvider *Provider) *Resolver {
 // Resolve fills in dynamic launch template parameters
 func (r Resolver) Resolve(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim, instanceType *cloudprovider.InstanceType,
 	staticParameters *template.StaticParameters) (*template.Parameters, error) {
-	imageFamily := getImageFamily(nodeClass.Spec.ImageFamily, staticParameters)
+	imageFamily := getImageFamily(nodeClass, staticParameters)
 	imageID, err := r.imageProvider.Get(ctx, nodeClass, instanceType, imageFamily)
 	if err != nil {
 		metrics.ImageSelectionErrorCount.WithLabelValues(imageFamily.Name()).Inc()
@@ -94,7 +83,7 @@ func (r Resolver) Resolve(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass,
 	kubeletConfig.SystemReserved = resources.StringMap(instanceType.Overhead.SystemReserved)
 	kubeletConfig.EvictionHard = map[string]string{
 		instancetype.MemoryAvailable: instanceType.Overhead.EvictionThreshold.Memory().String()}
-	kubeletConfig.MaxPods = lo.ToPtr(getMaxPods(staticParameters.NetworkPlugin))
+	kubeletConfig.MaxPods = lo.ToPtr(instancetype.MaxPods(ctx, kubeletConfig, nodeClass))
 	logging.FromContext(ctx).Infof("Resolved image %s for instance type %s", imageID, instanceType.Name)
 	template := &template.Parameters{
 		StaticParameters: staticParameters,
@@ -111,22 +100,15 @@ func (r Resolver) Resolve(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass,
 	return template, nil
 }
 
-func getImageFamily(familyName *string, parameters *template.StaticParameters) ImageFamily {
-	switch lo.FromPtr(familyName) {
+func getImageFamily(nodeClass *v1alpha2.AKSNodeClass, parameters *template.StaticParameters) ImageFamily {
+	switch lo.FromPtr(nodeClass.Spec.ImageFamily) {
 	case v1alpha2.Ubuntu2204ImageFamily:
 		return &Ubuntu2204{Options: parameters}
 	case v1alpha2.AzureLinuxImageFamily:
 		return &AzureLinux{Options: parameters}
+	case v1alpha2.CustomImageFamily:
+		return &Custom{Options: parameters, UserDataTemplate: lo.FromPtr(nodeClass.Spec.UserData)}
 	default:
 		return &Ubuntu2204{Options: parameters}
 	}
 }
-
-func getMaxPods(networkPlugin string) int32 {
-	if networkPlugin == networkPluginAzure {
-		return defaultKubernetesMaxPodsAzure
-	} else if networkPlugin == networkPluginKubenet {
-		return defaultKubernetesMaxPodsKubenet
-	}
-	return defaultKubernetesMaxPods
-}
@@ -19,6 +19,7 @@ package imagefamily
 import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	armcomputev5 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/samber/lo"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
 )
 
@@ -27,6 +28,16 @@ const (
 	AKSAzureLinuxPublicGalleryURL = "AKSAzureLinux-f7c7cda5-1c9a-4bdc-a222-9614c968580b"
 )
 
+// IsFIPSCommunityImage returns whether the given community image definition is a FIPS compliant image
+func IsFIPSCommunityImage(communityImageName string) bool {
+	return lo.Contains([]string{
+		Ubuntu2204Gen2FIPSCommunityImage,
+		Ubuntu2204Gen1FIPSCommunityImage,
+		AzureLinuxGen2FIPSCommunityImage,
+		AzureLinuxGen1FIPSCommunityImage,
+	}, communityImageName)
+}
+
 // DefaultImageOutput is the Stub of an Image we return from an ImageFamily De
 type DefaultImageOutput struct {
 	CommunityImage   string
@@ -17,10 +17,12 @@ limitations under the License.
 package imagefamily
 
 import (
+	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
 
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
@@ -32,6 +34,9 @@ const (
 	Ubuntu2204Gen2CommunityImage    = "2204gen2containerd"
 	Ubuntu2204Gen1CommunityImage    = "2204containerd"
 	Ubuntu2204Gen2ArmCommunityImage = "2204gen2arm64containerd"
+
+	Ubuntu2204Gen2FIPSCommunityImage = "2204gen2fipscontainerd"
+	Ubuntu2204Gen1FIPSCommunityImage = "2204fipscontainerd"
 )
 
 type Ubuntu2204 struct {
@@ -42,7 +47,28 @@ func (u Ubuntu2204) Name() string {
 	return v1alpha2.Ubuntu2204ImageFamily
 }
 
-func (u Ubuntu2204) DefaultImages() []DefaultImageOutput {
+func (u Ubuntu2204) DefaultImages(fipsMode *v1alpha2.FIPSMode) []DefaultImageOutput {
+	if lo.FromPtr(fipsMode) == v1alpha2.FIPSModeEnabled {
+		// FIPS images are only published for amd64
+		return []DefaultImageOutput{
+			{
+				CommunityImage:   Ubuntu2204Gen2FIPSCommunityImage,
+				PublicGalleryURL: AKSUbuntuPublicGalleryURL,
+				Requirements: scheduling.NewRequirements(
+					scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+					scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+				),
+			},
+			{
+				CommunityImage:   Ubuntu2204Gen1FIPSCommunityImage,
+				PublicGalleryURL: AKSUbuntuPublicGalleryURL,
+				Requirements: scheduling.NewRequirements(
+					scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+					scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV1),
+				),
+			},
+		}
+	}
 	// image provider will select these images in order, first match wins. This is why we chose to put Ubuntu2204Gen2containerd first in the defaultImages
 	return []DefaultImageOutput{
 		{
@@ -73,7 +99,7 @@ func (u Ubuntu2204) DefaultImages() []DefaultImageOutput {
 }
 
 // UserData returns the default userdata script for the image Family
-func (u Ubuntu2204) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, _ *cloudprovider.InstanceType) bootstrap.Bootstrapper {
+func (u Ubuntu2204) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, instanceType *cloudprovider.InstanceType) bootstrap.Bootstrapper {
 	return bootstrap.AKS{
 		Options: bootstrap.Options{
 			ClusterName:     u.Options.ClusterName,
@@ -97,5 +123,7 @@ func (u Ubuntu2204) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, ta
 		NetworkPlugin:                  u.Options.NetworkPlugin,
 		NetworkPolicy:                  u.Options.NetworkPolicy,
 		KubernetesVersion:              u.Options.KubernetesVersion,
+		KubeletOnTempDisk:              u.Options.KubeletOnTemporaryDisk && instancetype.HasTempDisk(instanceType),
+		EnableFIPS:                     u.Options.EnableFIPS,
 	}
 }
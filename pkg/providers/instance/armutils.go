@@ -75,6 +75,21 @@ func createVirtualMachineExtension(ctx context.Context, client VirtualMachineExt
 	return &res.VirtualMachineExtension, nil
 }
 
+func deleteVirtualMachineExtension(ctx context.Context, client VirtualMachineExtensionsAPI, rg, vmName, extensionName string) error {
+	poller, err := client.BeginDelete(ctx, rg, vmName, extensionName, nil)
+	if err != nil {
+		return err
+	}
+	_, err = poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		if sdkerrors.IsNotFoundErr(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
 func createNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string, nic armnetwork.Interface) (*armnetwork.Interface, error) {
 	poller, err := client.BeginCreateOrUpdate(ctx, rg, nicName, nic, nil)
 	if err != nil {
@@ -103,6 +118,20 @@ func deleteNic(ctx context.Context, client NetworkInterfacesAPI, rg, nicName str
 	return nil
 }
 
+func updateNicTags(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string, tags map[string]*string) error {
+	_, err := client.UpdateTags(ctx, rg, nicName, armnetwork.TagsObject{Tags: tags}, nil)
+	return err
+}
+
+func updateDiskTags(ctx context.Context, client DisksAPI, rg, diskName string, tags map[string]*string) error {
+	poller, err := client.BeginUpdate(ctx, rg, diskName, armcompute.DiskUpdate{Tags: tags}, nil)
+	if err != nil {
+		return err
+	}
+	_, err = poller.PollUntilDone(ctx, nil)
+	return err
+}
+
 func deleteNicIfExists(ctx context.Context, client NetworkInterfacesAPI, rg, nicName string) error {
 	_, err := client.Get(ctx, rg, nicName, nil)
 	if err != nil {
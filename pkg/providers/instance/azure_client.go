@@ -29,6 +29,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/skuclient"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/quota"
 
 	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
 	klog "k8s.io/klog/v2"
@@ -47,12 +48,23 @@ type AzureResourceGraphAPI interface {
 
 type VirtualMachineExtensionsAPI interface {
 	BeginCreateOrUpdate(ctx context.Context, resourceGroupName string, vmName string, vmExtensionName string, extensionParameters armcompute.VirtualMachineExtension, options *armcompute.VirtualMachineExtensionsClientBeginCreateOrUpdateOptions) (*runtime.Poller[armcompute.VirtualMachineExtensionsClientCreateOrUpdateResponse], error)
+	BeginDelete(ctx context.Context, resourceGroupName string, vmName string, vmExtensionName string, options *armcompute.VirtualMachineExtensionsClientBeginDeleteOptions) (*runtime.Poller[armcompute.VirtualMachineExtensionsClientDeleteResponse], error)
 }
 
 type NetworkInterfacesAPI interface {
 	BeginCreateOrUpdate(ctx context.Context, resourceGroupName string, networkInterfaceName string, parameters armnetwork.Interface, options *armnetwork.InterfacesClientBeginCreateOrUpdateOptions) (*runtime.Poller[armnetwork.InterfacesClientCreateOrUpdateResponse], error)
 	BeginDelete(ctx context.Context, resourceGroupName string, networkInterfaceName string, options *armnetwork.InterfacesClientBeginDeleteOptions) (*runtime.Poller[armnetwork.InterfacesClientDeleteResponse], error)
 	Get(ctx context.Context, resourceGroupName string, networkInterfaceName string, options *armnetwork.InterfacesClientGetOptions) (armnetwork.InterfacesClientGetResponse, error)
+	UpdateTags(ctx context.Context, resourceGroupName string, networkInterfaceName string, parameters armnetwork.TagsObject, options *armnetwork.InterfacesClientUpdateTagsOptions) (armnetwork.InterfacesClientUpdateTagsResponse, error)
+}
+
+type DisksAPI interface {
+	Get(ctx context.Context, resourceGroupName string, diskName string, options *armcompute.DisksClientGetOptions) (armcompute.DisksClientGetResponse, error)
+	BeginUpdate(ctx context.Context, resourceGroupName string, diskName string, disk armcompute.DiskUpdate, options *armcompute.DisksClientBeginUpdateOptions) (*runtime.Poller[armcompute.DisksClientUpdateResponse], error)
+}
+
+type SubnetsAPI interface {
+	Get(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, options *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error)
 }
 
 // TODO: Move this to another package that more correctly reflects its usage across multiple providers
@@ -61,11 +73,14 @@ type AZClient struct {
 	virtualMachinesClient          VirtualMachinesAPI
 	virtualMachinesExtensionClient VirtualMachineExtensionsAPI
 	networkInterfacesClient        NetworkInterfacesAPI
+	disksClient                    DisksAPI
 
 	ImageVersionsClient imagefamily.CommunityGalleryImageVersionsAPI
 	// SKU CLIENT is still using track 1 because skewer does not support the track 2 path. We need to refactor this once skewer supports track 2
 	SKUClient           skuclient.SkuClient
 	LoadBalancersClient loadbalancer.LoadBalancersAPI
+	SubnetsClient       SubnetsAPI
+	UsageClient         quota.UsageAPI
 }
 
 func NewAZClientFromAPI(
@@ -76,18 +91,29 @@ func NewAZClientFromAPI(
 	loadBalancersClient loadbalancer.LoadBalancersAPI,
 	imageVersionsClient imagefamily.CommunityGalleryImageVersionsAPI,
 	skuClient skuclient.SkuClient,
+	subnetsClient SubnetsAPI,
+	disksClient DisksAPI,
+	usageClient quota.UsageAPI,
 ) *AZClient {
 	return &AZClient{
 		virtualMachinesClient:          virtualMachinesClient,
 		azureResourceGraphClient:       azureResourceGraphClient,
 		virtualMachinesExtensionClient: virtualMachinesExtensionClient,
 		networkInterfacesClient:        interfacesClient,
+		disksClient:                    disksClient,
 		ImageVersionsClient:            imageVersionsClient,
 		SKUClient:                      skuClient,
 		LoadBalancersClient:            loadBalancersClient,
+		SubnetsClient:                  subnetsClient,
+		UsageClient:                    usageClient,
 	}
 }
 
+// AzureResourceGraphClient returns the Azure Resource Graph client, for the providers querying other tables than resources
+func (c *AZClient) AzureResourceGraphClient() AzureResourceGraphAPI {
+	return c.azureResourceGraphClient
+}
+
 func CreateAZClient(ctx context.Context, cfg *auth.Config) (*AZClient, error) {
 	// Defaulting env to Azure Public Cloud.
 	env := azure.PublicCloud
@@ -148,6 +174,24 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *azure.Environment)
 	}
 	klog.V(5).Infof("Created load balancers client %v, using a token credential", loadBalancersClient)
 
+	subnetsClient, err := armnetwork.NewSubnetsClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("Created subnets client %v, using a token credential", subnetsClient)
+
+	disksClient, err := armcompute.NewDisksClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("Created disks client %v, using a token credential", disksClient)
+
+	usageClient, err := armcompute.NewUsageClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("Created usage client %v, using a token credential", usageClient)
+
 	// TODO: this one is not enabled for rate limiting / throttling ...
 	// TODO Move this over to track 2 when skewer is migrated
 	skuClient := skuclient.NewSkuClient(ctx, cfg, env)
@@ -158,5 +202,8 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *azure.Environment)
 		interfacesClient,
 		loadBalancersClient,
 		imageVersionsClient,
-		skuClient), nil
+		skuClient,
+		subnetsClient,
+		disksClient,
+		usageClient), nil
 }
@@ -0,0 +1,148 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/samber/lo"
+	"knative.dev/pkg/logging"
+
+	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+)
+
+// Provisioning states of VMs
+const (
+	ProvisioningStateCreating  = "Creating"
+	ProvisioningStateSucceeded = "Succeeded"
+	ProvisioningStateFailed    = "Failed"
+)
+
+const vmIDFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s"
+
+// creation is the creation of a VM ARM accepted, along with the offering it launches, to mark it unavailable if the
+// creation fails for lack of capacity, and the extensions of the AKSNodeClass to install once it is created
+type creation struct {
+	poller       *runtime.Poller[armcompute.VirtualMachinesClientCreateOrUpdateResponse]
+	extensions   []v1alpha2.Extension
+	instanceType *corecloudprovider.InstanceType
+	zone         string
+	capacityType string
+}
+
+// CreationState is the state of the creation of a VM created asynchronously
+type CreationState struct {
+	ProvisioningState string
+	// Err is why the creation failed, when the provisioning state is Failed
+	Err error
+}
+
+// beginCreateVirtualMachine starts creating the VM, returning it as soon as ARM accepts the request rather than once it is
+// provisioned. The creation is polled through PollCreation.
+func (p *Provider) beginCreateVirtualMachine(ctx context.Context, vm armcompute.VirtualMachine, vmName string, extensions []v1alpha2.Extension,
+	instanceType *corecloudprovider.InstanceType, zone, capacityType string) (*armcompute.VirtualMachine, error) {
+	poller, err := p.azClient.virtualMachinesClient.BeginCreateOrUpdate(ctx, p.resourceGroup, vmName, vm, nil)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Creating virtual machine %q failed: %v", vmName, err)
+		return nil, fmt.Errorf("virtualMachine.BeginCreateOrUpdate for VM %q failed: %w", vmName, err)
+	}
+	p.creations.Store(vmName, &creation{poller: poller, extensions: extensions, instanceType: instanceType, zone: zone, capacityType: capacityType})
+
+	// the VM is returned as requested, with the properties ARM sets which launches depend on
+	properties := *vm.Properties
+	properties.TimeCreated = to.Ptr(time.Now())
+	properties.ProvisioningState = to.Ptr(ProvisioningStateCreating)
+	vm.Properties = &properties
+	vm.ID = to.Ptr(fmt.Sprintf(vmIDFormat, p.subscriptionID, p.resourceGroup, vmName))
+	vm.Name = to.Ptr(vmName)
+	logging.FromContext(ctx).Debugf("Accepted creation of virtual machine %s", *vm.ID)
+	return &vm, nil
+}
+
+// PollCreation polls the creation of a VM created asynchronously once, completing it once the VM is created. Failures for
+// lack of capacity mark the offering unavailable, as they do for VMs created synchronously, but the launch has returned
+// by then, so neither another offering nor on-demand is tried in its stead. The creations accepted before this process
+// started are not tracked, so their provisioning state is read from the VM instead, and the extensions of their
+// AKSNodeClass are left to the in-place update controller.
+func (p *Provider) PollCreation(ctx context.Context, vmName string) (CreationState, error) {
+	value, ok := p.creations.Load(vmName)
+	if !ok {
+		vm, err := p.Get(ctx, vmName)
+		if err != nil {
+			return CreationState{}, err
+		}
+		state := lo.FromPtr(vm.Properties.ProvisioningState)
+		switch state {
+		case ProvisioningStateFailed:
+			return CreationState{ProvisioningState: state, Err: fmt.Errorf("provisioning state of VM %q is %s", vmName, state)}, nil
+		case ProvisioningStateSucceeded:
+			// whether it was completed before this process started is unknown, completing it again is harmless
+			return p.completedCreationState(ctx, vm, nil), nil
+		}
+		return CreationState{ProvisioningState: state}, nil
+	}
+
+	c := value.(*creation)
+	if _, err := c.poller.Poll(ctx); err != nil && !c.poller.Done() {
+		return CreationState{}, fmt.Errorf("polling creation of VM %q, %w", vmName, err)
+	}
+	if !c.poller.Done() {
+		return CreationState{ProvisioningState: ProvisioningStateCreating}, nil
+	}
+	p.creations.Delete(vmName)
+	resp, err := c.poller.Result(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Creating virtual machine %q failed: %v", vmName, err)
+		return CreationState{ProvisioningState: ProvisioningStateFailed, Err: p.handleResponseErrors(ctx, c.instanceType, c.zone, c.capacityType, err)}, nil
+	}
+	logging.FromContext(ctx).Debugf("Created virtual machine %s", vmName)
+	return p.completedCreationState(ctx, &resp.VirtualMachine, c.extensions), nil
+}
+
+// completedCreationState completes the creation of the VM, failing the creation if that fails, as it fails launches of
+// VMs created synchronously
+func (p *Provider) completedCreationState(ctx context.Context, vm *armcompute.VirtualMachine, extensions []v1alpha2.Extension) CreationState {
+	if err := p.completeCreation(ctx, vm, extensions); err != nil {
+		return CreationState{ProvisioningState: ProvisioningStateFailed, Err: err}
+	}
+	return CreationState{ProvisioningState: ProvisioningStateSucceeded}
+}
+
+// completeCreation tags the network interfaces declared inline in the VM, which CRP creates untagged, and creates the
+// AKS identifying extension and the extensions of the AKSNodeClass, all of which need the VM to be created
+func (p *Provider) completeCreation(ctx context.Context, vm *armcompute.VirtualMachine, extensions []v1alpha2.Extension) error {
+	if vm.Properties != nil && vm.Properties.NetworkProfile != nil {
+		for _, nic := range vm.Properties.NetworkProfile.NetworkInterfaceConfigurations {
+			p.tagNetworkInterface(ctx, lo.FromPtr(nic.Name), vm.Tags)
+		}
+	}
+	if err := p.createAKSIdentifyingExtension(ctx, lo.FromPtr(vm.Name)); err != nil {
+		return err
+	}
+	for _, extension := range extensions {
+		if err := p.CreateOrUpdateExtension(ctx, lo.FromPtr(vm.Name), extension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -23,21 +23,24 @@ import (
 	"fmt"
 	"math"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
 
-	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/logging"
 
 	"github.com/Azure/azure-kusto-go/kusto/kql"
 	"github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/quota"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotadvisor"
 
 	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
@@ -85,10 +88,15 @@ type Provider struct {
 	instanceTypeProvider   *instancetype.Provider
 	launchTemplateProvider *launchtemplate.Provider
 	loadBalancerProvider   *loadbalancer.Provider
+	quotaProvider          *quota.Provider
+	pricingProvider        *pricing.Provider
+	spotAdvisor            *spotadvisor.Provider
 	resourceGroup          string
 	subnetID               string
 	subscriptionID         string
 	unavailableOfferings   *cache.UnavailableOfferings
+	zoneSelector           *zoneSelector
+	creations              sync.Map // VM name to *creation, for the VMs created asynchronously
 }
 
 func NewProvider(
@@ -96,6 +104,9 @@ func NewProvider(
 	instanceTypeProvider *instancetype.Provider,
 	launchTemplateProvider *launchtemplate.Provider,
 	loadBalancerProvider *loadbalancer.Provider,
+	quotaProvider *quota.Provider,
+	pricingProvider *pricing.Provider,
+	spotAdvisor *spotadvisor.Provider,
 	offeringsCache *cache.UnavailableOfferings,
 	location string,
 	resourceGroup string,
@@ -103,29 +114,38 @@ func NewProvider(
 	subscriptionID string,
 ) *Provider {
 	listQuery = GetListQueryBuilder(resourceGroup).String()
-	return &Provider{
+	p := &Provider{
 		azClient:               azClient,
 		instanceTypeProvider:   instanceTypeProvider,
 		launchTemplateProvider: launchTemplateProvider,
 		loadBalancerProvider:   loadBalancerProvider,
+		quotaProvider:          quotaProvider,
+		pricingProvider:        pricingProvider,
+		spotAdvisor:            spotAdvisor,
 		location:               location,
 		resourceGroup:          resourceGroup,
 		subnetID:               subnetID,
 		subscriptionID:         subscriptionID,
 		unavailableOfferings:   offeringsCache,
 	}
+	p.zoneSelector = newZoneSelector(p.List, offeringsCache)
+	return p
 }
 
-// Create an instance given the constraints.
+// Create an instance given the constraints, returning the fallback from spot to on-demand if one happened.
 // instanceTypes should be sorted by priority for spot capacity type.
-func (p *Provider) Create(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim, instanceTypes []*corecloudprovider.InstanceType) (*armcompute.VirtualMachine, error) {
-	instanceTypes = orderInstanceTypesByPrice(instanceTypes, scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...))
-	vm, instanceType, err := p.launchInstance(ctx, nodeClass, nodeClaim, instanceTypes)
+func (p *Provider) Create(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim, instanceTypes []*corecloudprovider.InstanceType) (*armcompute.VirtualMachine, *SpotToOnDemandFallback, error) {
+	if constrainsSpotEvictionRate(nodeClaim) {
+		// the eviction rate is only meaningful for spot VMs, neither launch nor fall back to on-demand ones
+		nodeClaim = withCapacityType(nodeClaim, corev1beta1.CapacityTypeSpot)
+	}
+	instanceTypes = orderInstanceTypesByPrice(instanceTypes, scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...), p.spotPriceWeight(nodeClass))
+	vm, fallback, err := p.launchInstance(ctx, nodeClass, nodeClaim, instanceTypes)
 	if err != nil {
 		if cleanupErr := p.cleanupAzureResources(ctx, GenerateResourceName(nodeClaim.Name)); cleanupErr != nil {
 			logging.FromContext(ctx).Errorf("failed to cleanup resources for node claim %s, %w", nodeClaim.Name, cleanupErr)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 	zone, err := GetZoneID(vm)
 	if err != nil {
@@ -136,15 +156,81 @@ func (p *Provider) Create(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass,
 		"hostname", *vm.Name,
 		"type", string(*vm.Properties.HardwareProfile.VMSize),
 		"zone", zone,
-		"capacity-type", p.getPriorityForInstanceType(nodeClaim, instanceType)).Infof("launched new instance")
+		"capacity-type", GetCapacityType(vm)).Infof("launched new instance")
+
+	return vm, fallback, nil
+}
 
-	return vm, nil
+// Reset drops the VMs counted per zone to balance launches across zones, and the VM creations being tracked
+func (p *Provider) Reset() {
+	p.zoneSelector.Reset()
+	p.creations.Range(func(vmName, _ any) bool {
+		p.creations.Delete(vmName)
+		return true
+	})
 }
 
 func (p *Provider) Update(ctx context.Context, vmName string, update armcompute.VirtualMachineUpdate) error {
 	return UpdateVirtualMachine(ctx, p.azClient.virtualMachinesClient, p.resourceGroup, vmName, update)
 }
 
+// NetworkInterface returns the network interface of an instance
+func (p *Provider) NetworkInterface(ctx context.Context, nicName string) (*armnetwork.Interface, error) {
+	nic, err := p.azClient.networkInterfacesClient.Get(ctx, p.resourceGroup, nicName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &nic.Interface, nil
+}
+
+// OSDiskTags returns the tags of the managed OS disk of an instance
+func (p *Provider) OSDiskTags(ctx context.Context, diskName string) (map[string]*string, error) {
+	disk, err := p.azClient.disksClient.Get(ctx, p.resourceGroup, diskName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return disk.Tags, nil
+}
+
+// UpdateNetworkInterfaceTags replaces the tags of the network interface of an instance
+func (p *Provider) UpdateNetworkInterfaceTags(ctx context.Context, nicName string, tags map[string]*string) error {
+	return updateNicTags(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, nicName, tags)
+}
+
+// UpdateNetworkInterface replaces the network interface of an instance, for the changes which can't be patched, such
+// as its security groups
+func (p *Provider) UpdateNetworkInterface(ctx context.Context, nicName string, nic armnetwork.Interface) error {
+	_, err := createNic(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, nicName, nic)
+	return err
+}
+
+// CreateOrUpdateExtension installs an extension of the AKSNodeClass on the VM of an instance, or updates it
+func (p *Provider) CreateOrUpdateExtension(ctx context.Context, vmName string, extension v1alpha2.Extension) error {
+	vmExt, err := p.newExtension(extension)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Debugf("Creating virtual machine extension %s for %s", extension.Name, vmName)
+	if _, err = createVirtualMachineExtension(ctx, p.azClient.virtualMachinesExtensionClient, p.resourceGroup, vmName, extension.Name, vmExt); err != nil {
+		return fmt.Errorf("creating VM extension %q for VM %q, %w", extension.Name, vmName, err)
+	}
+	return nil
+}
+
+// DeleteExtension uninstalls an extension from the VM of an instance, succeeding if it is not installed
+func (p *Provider) DeleteExtension(ctx context.Context, vmName string, extensionName string) error {
+	logging.FromContext(ctx).Debugf("Deleting virtual machine extension %s of %s", extensionName, vmName)
+	if err := deleteVirtualMachineExtension(ctx, p.azClient.virtualMachinesExtensionClient, p.resourceGroup, vmName, extensionName); err != nil {
+		return fmt.Errorf("deleting VM extension %q of VM %q, %w", extensionName, vmName, err)
+	}
+	return nil
+}
+
+// UpdateOSDiskTags replaces the tags of the managed OS disk of an instance
+func (p *Provider) UpdateOSDiskTags(ctx context.Context, diskName string, tags map[string]*string) error {
+	return updateDiskTags(ctx, p.azClient.disksClient, p.resourceGroup, diskName, tags)
+}
+
 func (p *Provider) Get(ctx context.Context, vmName string) (*armcompute.VirtualMachine, error) {
 	var vm armcompute.VirtualMachinesClientGetResponse
 	var err error
@@ -179,6 +265,7 @@ func (p *Provider) List(ctx context.Context) ([]*armcompute.VirtualMachine, erro
 
 func (p *Provider) Delete(ctx context.Context, resourceName string) error {
 	logging.FromContext(ctx).Debugf("Deleting virtual machine %s and associated resources")
+	p.creations.Delete(resourceName)
 	return p.cleanupAzureResources(ctx, resourceName)
 }
 
@@ -196,6 +283,14 @@ func (p *Provider) createAKSIdentifyingExtension(ctx context.Context, vmName str
 	return nil
 }
 
+// tagNetworkInterface tags the network interface declared inline in a VM, which CRP creates untagged. The VM is up by
+// then, so failing to tag its network interface doesn't fail the launch.
+func (p *Provider) tagNetworkInterface(ctx context.Context, nicName string, tags map[string]*string) {
+	if err := updateNicTags(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, nicName, tags); err != nil {
+		logging.FromContext(ctx).Errorf("Tagging network interface %q failed, %s", nicName, err)
+	}
+}
+
 func (p *Provider) newNetworkInterfaceForVM(vmName string, backendPools *loadbalancer.BackendAddressPools, instanceType *corecloudprovider.InstanceType) armnetwork.Interface {
 	var ipv4BackendPools []*armnetwork.BackendAddressPool
 	for _, poolID := range backendPools.IPv4PoolIDs {
@@ -234,18 +329,108 @@ func (p *Provider) newNetworkInterfaceForVM(vmName string, backendPools *loadbal
 	}
 }
 
+// newNetworkInterfaceConfiguration declares the network interface inline in the VM, to be created with the VM and
+// deleted with it. Tags can't be declared inline, the NIC is tagged once the VM is created.
+func newNetworkInterfaceConfiguration(nicName string, nic armnetwork.Interface) *armcompute.VirtualMachineNetworkInterfaceConfiguration {
+	subResource := func(id *string) *armcompute.SubResource {
+		return &armcompute.SubResource{ID: id}
+	}
+	configuration := &armcompute.VirtualMachineNetworkInterfaceConfiguration{
+		Name: to.Ptr(nicName),
+		Properties: &armcompute.VirtualMachineNetworkInterfaceConfigurationProperties{
+			Primary:                     to.Ptr(true),
+			DeleteOption:                to.Ptr(armcompute.DeleteOptionsDelete),
+			EnableAcceleratedNetworking: nic.Properties.EnableAcceleratedNetworking,
+			EnableIPForwarding:          nic.Properties.EnableIPForwarding,
+			IPConfigurations: lo.Map(nic.Properties.IPConfigurations, func(ipConfiguration *armnetwork.InterfaceIPConfiguration, _ int) *armcompute.VirtualMachineNetworkInterfaceIPConfiguration {
+				return &armcompute.VirtualMachineNetworkInterfaceIPConfiguration{
+					Name: ipConfiguration.Name,
+					Properties: &armcompute.VirtualMachineNetworkInterfaceIPConfigurationProperties{
+						Primary: ipConfiguration.Properties.Primary,
+						Subnet:  subResource(ipConfiguration.Properties.Subnet.ID),
+						LoadBalancerBackendAddressPools: lo.Map(ipConfiguration.Properties.LoadBalancerBackendAddressPools, func(pool *armnetwork.BackendAddressPool, _ int) *armcompute.SubResource {
+							return subResource(pool.ID)
+						}),
+						ApplicationSecurityGroups: lo.Map(ipConfiguration.Properties.ApplicationSecurityGroups, func(asg *armnetwork.ApplicationSecurityGroup, _ int) *armcompute.SubResource {
+							return subResource(asg.ID)
+						}),
+					},
+				}
+			}),
+		},
+	}
+	if nic.Properties.NetworkSecurityGroup != nil {
+		configuration.Properties.NetworkSecurityGroup = subResource(nic.Properties.NetworkSecurityGroup.ID)
+	}
+	return configuration
+}
+
+// applySecurityGroups associates the NIC with the network security group of the AKSNodeClass, and makes all its IP
+// configurations members of the application security groups of the AKSNodeClass
+func applySecurityGroups(nic *armnetwork.Interface, nodeClass *v1alpha2.AKSNodeClass) {
+	if nodeClass.Spec.NetworkSecurityGroupID != nil {
+		nic.Properties.NetworkSecurityGroup = &armnetwork.SecurityGroup{ID: to.Ptr(*nodeClass.Spec.NetworkSecurityGroupID)}
+	}
+	if len(nodeClass.Spec.ApplicationSecurityGroupIDs) == 0 {
+		return
+	}
+	for _, ipConfiguration := range nic.Properties.IPConfigurations {
+		ipConfiguration.Properties.ApplicationSecurityGroups = NewApplicationSecurityGroups(nodeClass.Spec.ApplicationSecurityGroupIDs)
+	}
+}
+
+// NewApplicationSecurityGroups returns references to the application security groups of the IDs
+func NewApplicationSecurityGroups(ids []string) []*armnetwork.ApplicationSecurityGroup {
+	return lo.Map(ids, func(id string, _ int) *armnetwork.ApplicationSecurityGroup {
+		return &armnetwork.ApplicationSecurityGroup{ID: to.Ptr(id)}
+	})
+}
+
+// newPodIPConfigurations reserves one secondary IP configuration in the node subnet per pod the node can run,
+// for Azure CNI assigning pods IPs from the node subnet
+func (p *Provider) newPodIPConfigurations(instanceType *corecloudprovider.InstanceType) []*armnetwork.InterfaceIPConfiguration {
+	return lo.Times(int(instanceType.Capacity.Pods().Value()), func(i int) *armnetwork.InterfaceIPConfiguration {
+		return &armnetwork.InterfaceIPConfiguration{
+			Name: to.Ptr(fmt.Sprintf("ipconfig%d", i+2)), // the primary IP configuration being the first
+			Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+				Primary:                   to.Ptr(false),
+				PrivateIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodDynamic),
+				Subnet: &armnetwork.Subnet{
+					ID: &p.subnetID,
+				},
+			},
+		}
+	})
+}
+
 func GenerateResourceName(nodeClaimName string) string {
 	return fmt.Sprintf("aks-%s", nodeClaimName)
 }
 
-func (p *Provider) createNetworkInterface(ctx context.Context, nicName string, launchTemplateConfig *launchtemplate.Template, instanceType *corecloudprovider.InstanceType) (string, error) {
+// newNetworkInterface returns the NIC of the VM of the instance type, with the load balancer backend pools of the cluster
+// and the security groups of the AKSNodeClass
+func (p *Provider) newNetworkInterface(ctx context.Context, nicName string, nodeClass *v1alpha2.AKSNodeClass, launchTemplateConfig *launchtemplate.Template,
+	instanceType *corecloudprovider.InstanceType) (armnetwork.Interface, error) {
 	backendPools, err := p.loadBalancerProvider.LoadBalancerBackendPools(ctx)
 	if err != nil {
-		return "", err
+		return armnetwork.Interface{}, err
 	}
 
 	nic := p.newNetworkInterfaceForVM(nicName, backendPools, instanceType)
+	if options.FromContext(ctx).IsAzureCNINodeSubnet() {
+		nic.Properties.IPConfigurations = append(nic.Properties.IPConfigurations, p.newPodIPConfigurations(instanceType)...)
+	}
+	applySecurityGroups(&nic, nodeClass)
 	p.applyTemplateToNic(&nic, launchTemplateConfig)
+	return nic, nil
+}
+
+func (p *Provider) createNetworkInterface(ctx context.Context, nicName string, nodeClass *v1alpha2.AKSNodeClass, launchTemplateConfig *launchtemplate.Template,
+	instanceType *corecloudprovider.InstanceType) (string, error) {
+	nic, err := p.newNetworkInterface(ctx, nicName, nodeClass, launchTemplateConfig, instanceType)
+	if err != nil {
+		return "", err
+	}
 	logging.FromContext(ctx).Debugf("Creating network interface %s", nicName)
 	res, err := createNic(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, nicName, nic)
 	if err != nil {
@@ -267,11 +452,18 @@ func newVMObject(
 	nodeIdentities []string,
 	nodeClass *v1alpha2.AKSNodeClass,
 	launchTemplate *launchtemplate.Template,
-	instanceType *corecloudprovider.InstanceType) armcompute.VirtualMachine {
+	instanceType *corecloudprovider.InstanceType,
+	osDiskPlacement *armcompute.DiffDiskPlacement) armcompute.VirtualMachine {
 	// Build the image reference from template
 	imageReference := armcompute.ImageReference{
 		CommunityGalleryImageID: &launchTemplate.ImageID,
 	}
+	// custom images may also be gallery image versions or managed images referenced by their ARM resource ID
+	if !imagefamily.IsCommunityImageID(launchTemplate.ImageID) {
+		imageReference = armcompute.ImageReference{
+			ID: &launchTemplate.ImageID,
+		}
+	}
 	vm := armcompute.VirtualMachine{
 		Location: to.Ptr(location),
 		Identity: ConvertToVirtualMachineIdentity(nodeIdentities),
@@ -325,19 +517,18 @@ func newVMObject(
 		Zones: lo.Ternary(len(zone) > 0, []*string{&zone}, []*string{}),
 		Tags:  launchTemplate.Tags,
 	}
-	setVMPropertiesStorageProfile(vm.Properties, instanceType, nodeClass)
+	setVMPropertiesStorageProfile(vm.Properties, osDiskPlacement)
 	setVMPropertiesBillingProfile(vm.Properties, capacityType)
 
 	return vm
 }
 
-// setVMPropertiesStorageProfile enables ephemeral os disk for instance types that support it
-func setVMPropertiesStorageProfile(vmProperties *armcompute.VirtualMachineProperties, instanceType *corecloudprovider.InstanceType, nodeClass *v1alpha2.AKSNodeClass) {
-	// use ephemeral disk if it is large enough
-	if *nodeClass.Spec.OSDiskSizeGB <= getEphemeralMaxSizeGB(instanceType) {
+// setVMPropertiesStorageProfile enables ephemeral os disk with the placement of the instance type, if it has one
+func setVMPropertiesStorageProfile(vmProperties *armcompute.VirtualMachineProperties, osDiskPlacement *armcompute.DiffDiskPlacement) {
+	if osDiskPlacement != nil {
 		vmProperties.StorageProfile.OSDisk.DiffDiskSettings = &armcompute.DiffDiskSettings{
-			Option: to.Ptr(armcompute.DiffDiskOptionsLocal),
-			// placement (cache/resource) is left to CRP
+			Option:    to.Ptr(armcompute.DiffDiskOptionsLocal),
+			Placement: osDiskPlacement,
 		}
 		vmProperties.StorageProfile.OSDisk.Caching = to.Ptr(armcompute.CachingTypesReadOnly)
 	}
@@ -353,6 +544,13 @@ func setVMPropertiesBillingProfile(vmProperties *armcompute.VirtualMachineProper
 	}
 }
 
+// GetTags returns the tags of the VM, NIC and OS disk of the instance of a NodeClaim
+func GetTags(clusterName string, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim) map[string]*string {
+	tags := launchtemplate.Tags(clusterName, nodeClass.Spec.Tags)
+	setNodePoolNameTag(tags, nodeClaim)
+	return tags
+}
+
 // setNodePoolNameTag sets "karpenter.sh/nodepool" tag
 func setNodePoolNameTag(tags map[string]*string, nodeClaim *corev1beta1.NodeClaim) {
 	if val, ok := nodeClaim.Labels[corev1beta1.NodePoolLabelKey]; ok {
@@ -370,15 +568,66 @@ func (p *Provider) createVirtualMachine(ctx context.Context, vm armcompute.Virtu
 	return result, nil
 }
 
-func (p *Provider) launchInstance(
-	ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim, instanceTypes []*corecloudprovider.InstanceType) (*armcompute.VirtualMachine, *corecloudprovider.InstanceType, error) {
-	instanceType, capacityType, zone := p.pickSkuSizePriorityAndZone(ctx, nodeClaim, instanceTypes)
-	if instanceType == nil {
-		return nil, nil, corecloudprovider.NewInsufficientCapacityError(fmt.Errorf("no instance types available"))
+// launchInstance launches the first instance type and zone that has capacity, trying the next cheapest ones when
+// the VM can't be created for lack of capacity, up to the max launch attempts. When launching spot fails for lack of
+// capacity or quota, the rest of the attempts launch on-demand if the node claim allows it, unless the policy of its
+// NodePool is to never fall back. Falling back adds an attempt, so that the on-demand launch is tried even when
+// the last spot attempt failed.
+func (p *Provider) launchInstance(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
+	instanceTypes []*corecloudprovider.InstanceType) (*armcompute.VirtualMachine, *SpotToOnDemandFallback, error) {
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
+	var fallback *SpotToOnDemandFallback
+	var errs []error
+	maxAttempts := options.FromContext(ctx).MaxLaunchAttempts
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		instanceType, capacityType, zone := p.pickSkuSizePriorityAndZone(ctx, nodeClaim, instanceTypes)
+		if instanceType == nil {
+			return nil, nil, corecloudprovider.NewInsufficientCapacityError(errors.Join(append(errs, fmt.Errorf("no instance types available"))...))
+		}
+		vm, retryable, err := p.launchInstanceOfType(ctx, nodeClass, nodeClaim, instanceType, capacityType, zone)
+		if err == nil {
+			p.zoneSelector.Launched(nodeClaim.Labels[corev1beta1.NodePoolLabelKey], zone)
+			return vm, fallback, nil
+		}
+		if !retryable {
+			return nil, nil, err
+		}
+		errs = append(errs, err)
+		logging.FromContext(ctx).With("instance-type", instanceType.Name, "zone", zone, "capacity-type", capacityType, "attempt", attempt).
+			Infof("launching instance failed for lack of capacity, trying the next instance type and zone")
+		// the NIC is created for the instance type, and a VM may have been created in a failed state
+		if cleanupErr := p.cleanupAzureResources(ctx, GenerateResourceName(nodeClaim.Name)); cleanupErr != nil {
+			return nil, nil, errors.Join(append(errs, cleanupErr)...)
+		}
+		if capacityType == corev1beta1.CapacityTypeSpot && requirements.Get(corev1beta1.CapacityTypeLabelKey).Has(corev1beta1.CapacityTypeOnDemand) {
+			if spotToOnDemandFallbackAllowed(nodeClaim) {
+				logging.FromContext(ctx).With("instance-type", instanceType.Name).Infof("falling back from spot to on-demand")
+				fallback = &SpotToOnDemandFallback{InstanceType: instanceType.Name, Err: err}
+				nodeClaim = withCapacityType(nodeClaim, corev1beta1.CapacityTypeOnDemand)
+				maxAttempts++
+			} else {
+				nodeClaim = withCapacityType(nodeClaim, corev1beta1.CapacityTypeSpot)
+			}
+			requirements = scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
+		}
+		instanceTypes = orderInstanceTypesByPrice(
+			p.withoutUnavailableOfferings(instanceTypes, requirements, instanceType.Name, zone, capacityType), requirements, p.spotPriceWeight(nodeClass))
 	}
+	return nil, nil, errors.Join(errs...)
+}
+
+// launchInstanceOfType launches an instance of the instance type in the zone, returning whether the error is for
+// lack of capacity of the offering, so that another instance type or zone may succeed
+func (p *Provider) launchInstanceOfType(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
+	instanceType *corecloudprovider.InstanceType, capacityType, zone string) (*armcompute.VirtualMachine, bool, error) {
 	launchTemplate, err := p.getLaunchTemplate(ctx, nodeClass, nodeClaim, instanceType, capacityType)
 	if err != nil {
-		return nil, nil, fmt.Errorf("getting launch template: %w", err)
+		return nil, false, fmt.Errorf("getting launch template: %w", err)
+	}
+
+	osDiskPlacement, err := p.ephemeralOSDiskPlacement(ctx, nodeClass, instanceType)
+	if err != nil {
+		return nil, false, err
 	}
 
 	// set provisioner tag for NIC, VM, and Disk
@@ -387,29 +636,150 @@ func (p *Provider) launchInstance(
 	// resourceName for the NIC, VM, and Disk
 	resourceName := GenerateResourceName(nodeClaim.Name)
 
-	// create network interface
-	nicReference, err := p.createNetworkInterface(ctx, resourceName, launchTemplate, instanceType)
-	if err != nil {
-		return nil, nil, err
-	}
-
+	singleCall := options.FromContext(ctx).VMCreationMode == options.VMCreationModeSingleCall
 	sshPublicKey := options.FromContext(ctx).SSHPublicKey
 	nodeIdentityIDs := options.FromContext(ctx).NodeIdentities
-	vm := newVMObject(resourceName, nicReference, zone, capacityType, p.location, sshPublicKey, nodeIdentityIDs, nodeClass, launchTemplate, instanceType)
+	var vm armcompute.VirtualMachine
+	if singleCall {
+		// declare the network interface inline, for CRP to create it with the VM
+		nic, err := p.newNetworkInterface(ctx, resourceName, nodeClass, launchTemplate, instanceType)
+		if err != nil {
+			return nil, false, err
+		}
+		vm = newVMObject(resourceName, "", zone, capacityType, p.location, sshPublicKey, nodeIdentityIDs, nodeClass, launchTemplate, instanceType, osDiskPlacement)
+		vm.Properties.NetworkProfile = &armcompute.NetworkProfile{
+			NetworkAPIVersion:              to.Ptr(armcompute.NetworkAPIVersionTwoThousandTwenty1101),
+			NetworkInterfaceConfigurations: []*armcompute.VirtualMachineNetworkInterfaceConfiguration{newNetworkInterfaceConfiguration(resourceName, nic)},
+		}
+	} else {
+		// create network interface
+		nicReference, err := p.createNetworkInterface(ctx, resourceName, nodeClass, launchTemplate, instanceType)
+		if err != nil {
+			return nil, false, err
+		}
+		vm = newVMObject(resourceName, nicReference, zone, capacityType, p.location, sshPublicKey, nodeIdentityIDs, nodeClass, launchTemplate, instanceType, osDiskPlacement)
+	}
 
 	logging.FromContext(ctx).Debugf("Creating virtual machine %s (%s)", resourceName, instanceType.Name)
+	release := p.holdLaunch(ctx, instanceType, capacityType)
 	// Uses AZ Client to create a new virtual machine using the vm object we prepared earlier
-	resp, err := p.createVirtualMachine(ctx, vm, resourceName)
+	var resp *armcompute.VirtualMachine
+	if options.FromContext(ctx).AsyncVMCreation {
+		resp, err = p.beginCreateVirtualMachine(ctx, vm, resourceName, nodeClass.Spec.Extensions, instanceType, zone, capacityType)
+	} else {
+		resp, err = p.createVirtualMachine(ctx, vm, resourceName)
+	}
+	release(err == nil)
 	if err != nil {
-		azErr := p.handleResponseErrors(ctx, instanceType, zone, capacityType, err)
-		return nil, nil, azErr
+		return nil, isCapacityError(err), p.handleResponseErrors(ctx, instanceType, zone, capacityType, err)
+	}
+
+	// VMs created asynchronously are completed once polling finds them created
+	if !options.FromContext(ctx).AsyncVMCreation {
+		if err = p.completeCreation(ctx, resp, nodeClass.Spec.Extensions); err != nil {
+			return nil, false, err
+		}
+	}
+	return resp, false, nil
+}
+
+// isCapacityError returns whether creating a VM failed for lack of capacity of the instance type, in the zone or
+// for the capacity type, rather than for reasons other instance types and zones would fail for as well
+func isCapacityError(err error) bool {
+	return sdkerrors.IsSKUNotAvailable(err) || sdkerrors.ZonalAllocationFailureOccurred(err) || sdkerrors.LowPriorityQuotaHasBeenReached(err)
+}
+
+// SpotToOnDemandFallback describes an instance launched on-demand because launching it as spot failed
+type SpotToOnDemandFallback struct {
+	// InstanceType is the instance type which failed to launch as spot
+	InstanceType string
+	// Err is why launching spot failed
+	Err error
+}
+
+// spotToOnDemandFallbackAllowed returns whether the node claim may launch on-demand when launching spot fails,
+// which its NodePool sets through the annotations of its template
+func spotToOnDemandFallbackAllowed(nodeClaim *corev1beta1.NodeClaim) bool {
+	policy, _ := v1alpha2.SpotToOnDemandFallbackPolicy(nodeClaim.Annotations)
+	return policy != v1alpha2.SpotToOnDemandFallbackNever
+}
+
+// constrainsSpotEvictionRate returns whether the node claim requires a spot eviction rate, and allows spot
+func constrainsSpotEvictionRate(nodeClaim *corev1beta1.NodeClaim) bool {
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
+	if !requirements.Has(v1alpha2.LabelSKUSpotEvictionRate) || !requirements.Get(corev1beta1.CapacityTypeLabelKey).Has(corev1beta1.CapacityTypeSpot) {
+		return false
+	}
+	operator := requirements.Get(v1alpha2.LabelSKUSpotEvictionRate).Operator()
+	return operator == v1.NodeSelectorOpIn || operator == v1.NodeSelectorOpExists
+}
+
+// withCapacityType returns a copy of the node claim which requires the capacity type
+func withCapacityType(nodeClaim *corev1beta1.NodeClaim, capacityType string) *corev1beta1.NodeClaim {
+	nodeClaim = nodeClaim.DeepCopy()
+	nodeClaim.Spec.Requirements = append(
+		lo.Reject(nodeClaim.Spec.Requirements, func(requirement corev1beta1.NodeSelectorRequirementWithMinValues, _ int) bool {
+			return requirement.Key == corev1beta1.CapacityTypeLabelKey
+		}),
+		corev1beta1.NodeSelectorRequirementWithMinValues{
+			NodeSelectorRequirement: v1.NodeSelectorRequirement{
+				Key:      corev1beta1.CapacityTypeLabelKey,
+				Operator: v1.NodeSelectorOpIn,
+				Values:   []string{capacityType},
+			},
+		})
+	return nodeClaim
+}
+
+// withoutUnavailableOfferings returns copies of the instance types without the offerings which were marked unavailable,
+// nor the offering of the failed launch, dropping the instance types left without offerings compatible with the requirements
+func (p *Provider) withoutUnavailableOfferings(instanceTypes []*corecloudprovider.InstanceType, requirements scheduling.Requirements,
+	failedInstanceType, failedZone, failedCapacityType string) []*corecloudprovider.InstanceType {
+	var result []*corecloudprovider.InstanceType
+	for _, instanceType := range instanceTypes {
+		offerings := lo.Filter(instanceType.Offerings, func(offering corecloudprovider.Offering, _ int) bool {
+			failed := instanceType.Name == failedInstanceType && offering.CapacityType == failedCapacityType && zoneID(offering.Zone) == failedZone
+			return !failed && !p.unavailableOfferings.IsUnavailable(instanceType.Name, offering.Zone, offering.CapacityType)
+		})
+		if len(corecloudprovider.Offerings(offerings).Available().Compatible(requirements)) == 0 {
+			continue
+		}
+		// instance types are shared with the instance type provider cache, so are not modified
+		result = append(result, &corecloudprovider.InstanceType{
+			Name:         instanceType.Name,
+			Requirements: instanceType.Requirements,
+			Offerings:    offerings,
+			Capacity:     instanceType.Capacity,
+			Overhead:     instanceType.Overhead,
+		})
+	}
+	return result
+}
+
+// holdLaunch holds the launch against the vCPU quota and, when on-demand, the reserved instances while the VM is created,
+// so that concurrent launches neither pick offerings the quota has no room left for nor price reserved instances in use as free
+func (p *Provider) holdLaunch(ctx context.Context, instanceType *corecloudprovider.InstanceType, capacityType string) func(created bool) {
+	releaseQuota := p.reserveQuota(ctx, instanceType, capacityType)
+	if capacityType != corev1beta1.CapacityTypeOnDemand {
+		return releaseQuota
+	}
+	releaseReserved := p.pricingProvider.Launch(instanceType.Name)
+	return func(created bool) {
+		releaseQuota(created)
+		releaseReserved(created)
 	}
+}
 
-	err = p.createAKSIdentifyingExtension(ctx, resourceName)
+// reserveQuota holds the vCPUs of the instance against the vCPU quota while it is created,
+// so that concurrent launches do not pick offerings the quota has no room left for
+func (p *Provider) reserveQuota(ctx context.Context, instanceType *corecloudprovider.InstanceType, capacityType string) func(created bool) {
+	sku, err := p.instanceTypeProvider.SKU(ctx, instanceType.Name)
 	if err != nil {
-		return nil, nil, err
+		logging.FromContext(ctx).Errorf("reserving vCPU quota, %s", err)
+		return func(bool) {}
 	}
-	return resp, instanceType, nil
+	vcpus, _ := sku.VCPU()
+	return p.quotaProvider.Reserve(lo.FromPtr(sku.Family), capacityType, vcpus)
 }
 
 // nolint:gocyclo
@@ -444,7 +814,7 @@ func (p *Provider) handleResponseErrors(ctx context.Context, instanceType *corec
 		// https://aka.ms/azureskunotavailable: either not available for a location or zone, or out of capacity for Spot.
 		// We only expect to observe the Spot case, not location or zone restrictions, because:
 		// - SKUs with location restriction are already filtered out via sku.HasLocationRestriction
-		// - zonal restrictions are filtered out internally by sku.AvailabilityZones, and don't get offerings
+		// - zonal restrictions get unavailable offerings, see instancetype.zoneRestrictions
 		skuNotAvailableTTL := SKUNotAvailableSpotTTL
 		err = fmt.Errorf("out of spot capacity for %s: %w", instanceType.Name, err)
 		if capacityType == corev1beta1.CapacityTypeOnDemand { // should not happen, defensive check
@@ -464,8 +834,8 @@ func (p *Provider) handleResponseErrors(ctx context.Context, instanceType *corec
 	}
 	if sdkerrors.ZonalAllocationFailureOccurred(err) {
 		logging.FromContext(ctx).With("zone", zone).Error(err)
-		p.unavailableOfferings.MarkUnavailable(ctx, ZonalAllocationFailureReason, instanceType.Name, zone, corev1beta1.CapacityTypeOnDemand)
-		p.unavailableOfferings.MarkUnavailable(ctx, ZonalAllocationFailureReason, instanceType.Name, zone, corev1beta1.CapacityTypeSpot)
+		p.unavailableOfferings.MarkUnavailable(ctx, ZonalAllocationFailureReason, instanceType.Name, p.offeringZone(zone), corev1beta1.CapacityTypeOnDemand)
+		p.unavailableOfferings.MarkUnavailable(ctx, ZonalAllocationFailureReason, instanceType.Name, p.offeringZone(zone), corev1beta1.CapacityTypeSpot)
 
 		return fmt.Errorf("unable to allocate resources in the selected zone (%s). (will try a different zone to fulfill your request)", zone)
 	}
@@ -477,17 +847,18 @@ func (p *Provider) handleResponseErrors(ctx context.Context, instanceType *corec
 	return err
 }
 
-func getEphemeralMaxSizeGB(instanceType *corecloudprovider.InstanceType) int32 {
-	reqs := instanceType.Requirements.Get(v1alpha2.LabelSKUStorageEphemeralOSMaxSize).Values()
-	if len(reqs) == 0 || len(reqs) > 1 {
-		return 0
+// ephemeralOSDiskPlacement returns the placement of the ephemeral OS disk on the instance type, or nil for a managed
+// OS disk: the one its ephemeral-storage capacity is computed from
+func (p *Provider) ephemeralOSDiskPlacement(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, instanceType *corecloudprovider.InstanceType) (*armcompute.DiffDiskPlacement, error) {
+	sku, err := p.instanceTypeProvider.SKU(ctx, instanceType.Name)
+	if err != nil {
+		return nil, fmt.Errorf("getting SKU: %w", err)
 	}
-	maxSize, err := strconv.ParseFloat(reqs[0], 32)
+	vmsize, err := sku.GetVMSize()
 	if err != nil {
-		return 0
+		return nil, fmt.Errorf("parsing VM size of SKU %s: %w", instanceType.Name, err)
 	}
-	// decimal places are truncated, so we round down
-	return int32(maxSize)
+	return instancetype.EphemeralOSDiskPlacement(sku, vmsize, nodeClass), nil
 }
 
 func cpuLimitIsZero(err error) bool {
@@ -537,23 +908,35 @@ func (p *Provider) pickSkuSizePriorityAndZone(ctx context.Context, nodeClaim *co
 	logging.FromContext(ctx).Infof("Selected instance type %s", instanceType.Name)
 	// Priority - Nodepool defaults to Regular, so pick Spot if it is explicitly included in requirements (and is offered in at least one zone)
 	priority := p.getPriorityForInstanceType(nodeClaim, instanceType)
-	// Zone - ideally random/spread from requested zones that support given Priority
+	// Zone - the least populated by the NodePool of the requested zones that support given Priority
 	requestedZones := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...).Get(v1.LabelTopologyZone)
 	priorityOfferings := lo.Filter(instanceType.Offerings.Available(), func(o corecloudprovider.Offering, _ int) bool {
 		return o.CapacityType == priority && requestedZones.Has(o.Zone)
 	})
 	zonesWithPriority := lo.Map(priorityOfferings, func(o corecloudprovider.Offering, _ int) string { return o.Zone })
-	if zone, ok := sets.New(zonesWithPriority...).PopAny(); ok {
-		if len(zone) > 0 {
-			// Zones in zonal Offerings have <region>-<number> format; the zone returned from here will be used for VM instantiation,
-			// which expects just the zone number, without region
-			zone = string(zone[len(zone)-1])
-		}
-		return instanceType, priority, zone
+	if zone, ok := p.zoneSelector.Select(ctx, nodeClaim.Labels[corev1beta1.NodePoolLabelKey], zonesWithPriority); ok {
+		return instanceType, priority, zoneID(zone)
 	}
 	return nil, "", ""
 }
 
+// offeringZone returns the zone of offerings, <region>-<number>, from the zone number VM instantiation uses
+func (p *Provider) offeringZone(zoneID string) string {
+	if zoneID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s", p.location, zoneID)
+}
+
+// zoneID returns the zone number of the zone of an offering, as VM instantiation expects it.
+// Zones in zonal offerings have the <region>-<number> format, non-zonal offerings have an empty zone.
+func zoneID(zone string) string {
+	if len(zone) > 0 {
+		return string(zone[len(zone)-1])
+	}
+	return zone
+}
+
 func (p *Provider) cleanupAzureResources(ctx context.Context, resourceName string) (err error) {
 	vmErr := deleteVirtualMachineIfExists(ctx, p.azClient.virtualMachinesClient, p.resourceGroup, resourceName)
 	if vmErr != nil {
@@ -588,17 +971,32 @@ func (p *Provider) getPriorityForInstanceType(nodeClaim *corev1beta1.NodeClaim,
 	return corev1beta1.CapacityTypeOnDemand
 }
 
-func orderInstanceTypesByPrice(instanceTypes []*corecloudprovider.InstanceType, requirements scheduling.Requirements) []*corecloudprovider.InstanceType {
+// spotPriceWeight returns what the spot prices of instance types are multiplied with when ordering them,
+// which with the PriceCapacityOptimized strategy of the AKSNodeClass favors instance types with lower eviction rates
+func (p *Provider) spotPriceWeight(nodeClass *v1alpha2.AKSNodeClass) func(instanceType string) float64 {
+	if !nodeClass.Spec.IsSpotPriceCapacityOptimized() {
+		return func(string) float64 { return 1 }
+	}
+	return p.spotAdvisor.PriceWeight
+}
+
+func orderInstanceTypesByPrice(instanceTypes []*corecloudprovider.InstanceType, requirements scheduling.Requirements, spotPriceWeight func(instanceType string) float64) []*corecloudprovider.InstanceType {
+	price := func(instanceType *corecloudprovider.InstanceType) float64 {
+		offerings := instanceType.Offerings.Available().Compatible(requirements)
+		if len(offerings) == 0 {
+			return math.MaxFloat64
+		}
+		return lo.Min(lo.Map(offerings, func(offering corecloudprovider.Offering, _ int) float64 {
+			if offering.CapacityType == corev1beta1.CapacityTypeSpot {
+				return offering.Price * spotPriceWeight(instanceType.Name)
+			}
+			return offering.Price
+		}))
+	}
 	// Order instance types so that we get the cheapest instance types of the available offerings
 	sort.Slice(instanceTypes, func(i, j int) bool {
-		iPrice := math.MaxFloat64
-		jPrice := math.MaxFloat64
-		if len(instanceTypes[i].Offerings.Available().Compatible(requirements)) > 0 {
-			iPrice = instanceTypes[i].Offerings.Available().Compatible(requirements).Cheapest().Price
-		}
-		if len(instanceTypes[j].Offerings.Available().Compatible(requirements)) > 0 {
-			jPrice = instanceTypes[j].Offerings.Available().Compatible(requirements).Cheapest().Price
-		}
+		iPrice := price(instanceTypes[i])
+		jPrice := price(instanceTypes[j])
 		if iPrice == jPrice {
 			return instanceTypes[i].Name < instanceTypes[j].Name
 		}
@@ -614,9 +1012,10 @@ func GetCapacityType(instance *armcompute.VirtualMachine) string {
 	return ""
 }
 
+const vmExtensionType = "Microsoft.Compute/virtualMachines/extensions"
+
 func (p *Provider) getAKSIdentifyingExtension() *armcompute.VirtualMachineExtension {
 	const (
-		vmExtensionType                  = "Microsoft.Compute/virtualMachines/extensions"
 		aksIdentifyingExtensionName      = "computeAksLinuxBilling"
 		aksIdentifyingExtensionPublisher = "Microsoft.AKS"
 		aksIdentifyingExtensionTypeLinux = "Compute.AKS.Linux.Billing"
@@ -638,6 +1037,38 @@ func (p *Provider) getAKSIdentifyingExtension() *armcompute.VirtualMachineExtens
 	return vmExtension
 }
 
+// newExtension returns the VM extension of an extension of the AKSNodeClass
+func (p *Provider) newExtension(extension v1alpha2.Extension) (armcompute.VirtualMachineExtension, error) {
+	settings, err := ExtensionSettings(extension)
+	if err != nil {
+		return armcompute.VirtualMachineExtension{}, err
+	}
+	return armcompute.VirtualMachineExtension{
+		Location: to.Ptr(p.location),
+		Name:     to.Ptr(extension.Name),
+		Properties: &armcompute.VirtualMachineExtensionProperties{
+			Publisher:               to.Ptr(extension.Publisher),
+			TypeHandlerVersion:      to.Ptr(extension.TypeHandlerVersion),
+			AutoUpgradeMinorVersion: extension.AutoUpgradeMinorVersion,
+			Settings:                settings,
+			Type:                    to.Ptr(extension.Type),
+		},
+		Type: to.Ptr(vmExtensionType),
+	}, nil
+}
+
+// ExtensionSettings returns the public settings of an extension of the AKSNodeClass, nil if it has none
+func ExtensionSettings(extension v1alpha2.Extension) (any, error) {
+	if extension.Settings == nil || len(extension.Settings.Raw) == 0 {
+		return nil, nil
+	}
+	var settings any
+	if err := json.Unmarshal(extension.Settings.Raw, &settings); err != nil {
+		return nil, fmt.Errorf("parsing settings of extension %q, %w", extension.Name, err)
+	}
+	return settings, nil
+}
+
 // GetZoneID returns the zone ID for the given virtual machine, or an empty string if there is no zone specified
 func GetZoneID(vm *armcompute.VirtualMachine) (string, error) {
 	if vm == nil {
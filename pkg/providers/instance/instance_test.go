@@ -22,10 +22,15 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
 )
 
 func TestGetPriorityCapacityAndInstanceType(t *testing.T) {
@@ -77,7 +82,7 @@ func TestGetPriorityCapacityAndInstanceType(t *testing.T) {
 			expectedPriority:     corev1beta1.CapacityTypeOnDemand,
 		},
 	}
-	provider := NewProvider(nil, nil, nil, nil, cache.NewUnavailableOfferings(),
+	provider := NewProvider(nil, nil, nil, nil, nil, nil, nil, cache.NewUnavailableOfferings(),
 		"westus-2",
 		"MC_xxxxx_yyyy-region",
 		"/subscriptions/0000000-0000-0000-0000-0000000000/resourceGroups/fake-resource-group-name/providers/Microsoft.Network/virtualNetworks/karpenter/subnets/nodesubnet",
@@ -219,3 +224,313 @@ func TestCreateVMFromQueryResponseData(t *testing.T) {
 		}
 	}
 }
+
+func TestOrderInstanceTypesByPrice(t *testing.T) {
+	spotOffering := func(price float64) cloudprovider.Offering {
+		return cloudprovider.Offering{Price: price, Zone: "westus-2", CapacityType: corev1beta1.CapacityTypeSpot, Available: true}
+	}
+	instanceTypes := func() []*cloudprovider.InstanceType {
+		return []*cloudprovider.InstanceType{
+			{Name: "Standard_D2s_v3", Offerings: []cloudprovider.Offering{spotOffering(0.10)}},
+			{Name: "Standard_D2as_v4", Offerings: []cloudprovider.Offering{spotOffering(0.09)}},
+			{Name: "Standard_D2_v3", Offerings: []cloudprovider.Offering{{Price: 0.05, Zone: "westus-2", CapacityType: corev1beta1.CapacityTypeSpot}}},
+		}
+	}
+	evictionWeights := map[string]float64{"Standard_D2s_v3": 1.0, "Standard_D2as_v4": 1.25, "Standard_D2_v3": 1.0}
+	requirements := scheduling.NewRequirements()
+
+	cases := []struct {
+		name            string
+		spotPriceWeight func(string) float64
+		expected        []string
+	}{
+		{
+			name:            "cheapest first",
+			spotPriceWeight: func(string) float64 { return 1 },
+			expected:        []string{"Standard_D2as_v4", "Standard_D2s_v3", "Standard_D2_v3"},
+		},
+		{
+			name:            "spot prices weighed with the eviction rates",
+			spotPriceWeight: func(instanceType string) float64 { return evictionWeights[instanceType] },
+			expected:        []string{"Standard_D2s_v3", "Standard_D2as_v4", "Standard_D2_v3"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ordered := orderInstanceTypesByPrice(instanceTypes(), requirements, c.spotPriceWeight)
+			assert.Equal(t, c.expected, lo.Map(ordered, func(instanceType *cloudprovider.InstanceType, _ int) string { return instanceType.Name }))
+		})
+	}
+}
+
+func TestWithoutUnavailableOfferings(t *testing.T) {
+	offering := func(zone string, capacityType string) cloudprovider.Offering {
+		return cloudprovider.Offering{Price: 0.1, Zone: zone, CapacityType: capacityType, Available: true}
+	}
+	instanceTypes := []*cloudprovider.InstanceType{
+		{Name: "Standard_D2s_v3", Offerings: []cloudprovider.Offering{
+			offering("westus-1", corev1beta1.CapacityTypeOnDemand),
+			offering("westus-2", corev1beta1.CapacityTypeOnDemand),
+			offering("westus-2", corev1beta1.CapacityTypeSpot),
+		}},
+		{Name: "Standard_D2_v3", Offerings: []cloudprovider.Offering{
+			offering("westus-1", corev1beta1.CapacityTypeOnDemand),
+		}},
+		{Name: "Standard_D2as_v4", Offerings: []cloudprovider.Offering{
+			offering("westus-2", corev1beta1.CapacityTypeOnDemand),
+		}},
+	}
+	unavailableOfferings := cache.NewUnavailableOfferings()
+	unavailableOfferings.MarkUnavailable(context.TODO(), "test", "Standard_D2_v3", "westus-1", corev1beta1.CapacityTypeOnDemand)
+	provider := NewProvider(nil, nil, nil, nil, nil, nil, nil, unavailableOfferings,
+		"westus",
+		"MC_xxxxx_yyyy-region",
+		"/subscriptions/0000000-0000-0000-0000-0000000000/resourceGroups/fake-resource-group-name/providers/Microsoft.Network/virtualNetworks/karpenter/subnets/nodesubnet",
+		"0000000-0000-0000-0000-0000000000",
+	)
+
+	remaining := provider.withoutUnavailableOfferings(instanceTypes, scheduling.NewRequirements(), "Standard_D2s_v3", "2", corev1beta1.CapacityTypeOnDemand)
+	assert.Equal(t, []string{"Standard_D2s_v3", "Standard_D2as_v4"}, lo.Map(remaining, func(instanceType *cloudprovider.InstanceType, _ int) string { return instanceType.Name }))
+	assert.Equal(t, cloudprovider.Offerings{
+		offering("westus-1", corev1beta1.CapacityTypeOnDemand),
+		offering("westus-2", corev1beta1.CapacityTypeSpot),
+	}, remaining[0].Offerings)
+	// the instance types passed in are left as they are
+	assert.Len(t, instanceTypes[0].Offerings, 3)
+}
+
+func TestWithCapacityType(t *testing.T) {
+	nodeClaim := &corev1beta1.NodeClaim{
+		Spec: corev1beta1.NodeClaimSpec{
+			Requirements: []corev1beta1.NodeSelectorRequirementWithMinValues{
+				{NodeSelectorRequirement: v1.NodeSelectorRequirement{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"Standard_D2_v3"}}},
+				{NodeSelectorRequirement: v1.NodeSelectorRequirement{Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeSpot, corev1beta1.CapacityTypeOnDemand}}},
+			},
+		},
+	}
+	onDemand := withCapacityType(nodeClaim, corev1beta1.CapacityTypeOnDemand)
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(onDemand.Spec.Requirements...)
+	assert.Equal(t, []string{corev1beta1.CapacityTypeOnDemand}, requirements.Get(corev1beta1.CapacityTypeLabelKey).Values())
+	assert.True(t, requirements.Get(v1.LabelInstanceTypeStable).Has("Standard_D2_v3"))
+	// the node claim passed in is left as it is
+	assert.Len(t, nodeClaim.Spec.Requirements[1].Values, 2)
+}
+
+func TestSpotToOnDemandFallbackAllowed(t *testing.T) {
+	cases := []struct {
+		policy   *string
+		expected bool
+	}{
+		{policy: nil, expected: true},
+		{policy: lo.ToPtr(v1alpha2.SpotToOnDemandFallbackAllowed), expected: true},
+		{policy: lo.ToPtr(v1alpha2.SpotToOnDemandFallbackNever), expected: false},
+		{policy: lo.ToPtr("never"), expected: false},
+		{policy: lo.ToPtr("NEVER"), expected: false},
+		{policy: lo.ToPtr("Nope"), expected: true},
+	}
+	for _, c := range cases {
+		t.Run(lo.FromPtrOr(c.policy, "unset"), func(t *testing.T) {
+			nodeClaim := &corev1beta1.NodeClaim{}
+			if c.policy != nil {
+				nodeClaim.Annotations = map[string]string{v1alpha2.AnnotationSpotToOnDemandFallback: *c.policy}
+			}
+			assert.Equal(t, c.expected, spotToOnDemandFallbackAllowed(nodeClaim))
+		})
+	}
+}
+
+func TestConstrainsSpotEvictionRate(t *testing.T) {
+	bothCapacityTypes := corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: v1.NodeSelectorRequirement{
+		Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeSpot, corev1beta1.CapacityTypeOnDemand}}}
+	onDemand := corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: v1.NodeSelectorRequirement{
+		Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeOnDemand}}}
+	evictionRate := func(operator v1.NodeSelectorOperator, values ...string) corev1beta1.NodeSelectorRequirementWithMinValues {
+		return corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: v1.NodeSelectorRequirement{
+			Key: v1alpha2.LabelSKUSpotEvictionRate, Operator: operator, Values: values}}
+	}
+	cases := []struct {
+		name         string
+		requirements []corev1beta1.NodeSelectorRequirementWithMinValues
+		expected     bool
+	}{
+		{name: "no eviction rate requirement", requirements: []corev1beta1.NodeSelectorRequirementWithMinValues{bothCapacityTypes}},
+		{name: "eviction rate in", requirements: []corev1beta1.NodeSelectorRequirementWithMinValues{bothCapacityTypes, evictionRate(v1.NodeSelectorOpIn, "0")}, expected: true},
+		{name: "eviction rate less than", requirements: []corev1beta1.NodeSelectorRequirementWithMinValues{bothCapacityTypes, evictionRate(v1.NodeSelectorOpLt, "10")}, expected: true},
+		{name: "eviction rate not in", requirements: []corev1beta1.NodeSelectorRequirementWithMinValues{bothCapacityTypes, evictionRate(v1.NodeSelectorOpNotIn, "20")}},
+		{name: "no eviction rate", requirements: []corev1beta1.NodeSelectorRequirementWithMinValues{bothCapacityTypes, evictionRate(v1.NodeSelectorOpDoesNotExist)}},
+		{name: "on-demand only", requirements: []corev1beta1.NodeSelectorRequirementWithMinValues{onDemand, evictionRate(v1.NodeSelectorOpIn, "0")}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nodeClaim := &corev1beta1.NodeClaim{Spec: corev1beta1.NodeClaimSpec{Requirements: c.requirements}}
+			assert.Equal(t, c.expected, constrainsSpotEvictionRate(nodeClaim))
+		})
+	}
+}
+
+func TestZoneSelector(t *testing.T) {
+	vm := func(nodePool string, zone string) *armcompute.VirtualMachine {
+		return &armcompute.VirtualMachine{
+			Name:  lo.ToPtr("aks-" + nodePool),
+			Zones: []*string{lo.ToPtr(zone)},
+			Tags:  map[string]*string{NodePoolTagKey: lo.ToPtr(nodePool)},
+		}
+	}
+	vms := []*armcompute.VirtualMachine{
+		vm("default", "1"), vm("default", "1"), vm("default", "2"),
+		vm("other", "3"), vm("other", "3"),
+	}
+	zones := []string{"westus-1", "westus-2", "westus-3"}
+
+	t.Run("least populated zone of the NodePool", func(t *testing.T) {
+		selector := newZoneSelector(func(context.Context) ([]*armcompute.VirtualMachine, error) { return vms, nil }, cache.NewUnavailableOfferings())
+		zone, ok := selector.Select(context.TODO(), "default", zones)
+		assert.True(t, ok)
+		assert.Equal(t, "westus-3", zone)
+	})
+	t.Run("recent zonal allocation failures count against the zone", func(t *testing.T) {
+		unavailableOfferings := cache.NewUnavailableOfferings()
+		unavailableOfferings.MarkUnavailable(context.TODO(), ZonalAllocationFailureReason, "Standard_D2s_v3", "westus-3", corev1beta1.CapacityTypeOnDemand)
+		unavailableOfferings.MarkUnavailable(context.TODO(), ZonalAllocationFailureReason, "Standard_D2s_v3", "westus-3", corev1beta1.CapacityTypeSpot)
+		selector := newZoneSelector(func(context.Context) ([]*armcompute.VirtualMachine, error) { return vms, nil }, unavailableOfferings)
+		zone, _ := selector.Select(context.TODO(), "default", zones)
+		assert.Equal(t, "westus-2", zone)
+	})
+	t.Run("zonal allocation failures count once per instance type, whatever the capacity types marked", func(t *testing.T) {
+		vms := []*armcompute.VirtualMachine{vm("default", "1"), vm("default", "1"), vm("default", "1")}
+		zones := []string{"westus-1", "westus-3"}
+		unavailableOfferings := cache.NewUnavailableOfferings()
+		unavailableOfferings.MarkUnavailable(context.TODO(), ZonalAllocationFailureReason, "Standard_D2s_v3", "westus-3", corev1beta1.CapacityTypeOnDemand)
+		unavailableOfferings.MarkUnavailable(context.TODO(), ZonalAllocationFailureReason, "Standard_D2s_v3", "westus-3", corev1beta1.CapacityTypeSpot)
+		selector := newZoneSelector(func(context.Context) ([]*armcompute.VirtualMachine, error) { return vms, nil }, unavailableOfferings)
+		// one failing instance type counts as 2 VMs, fewer than the 3 VMs of westus-1
+		zone, _ := selector.Select(context.TODO(), "default", zones)
+		assert.Equal(t, "westus-3", zone)
+
+		// two failing instance types count as 4 VMs
+		unavailableOfferings.MarkUnavailable(context.TODO(), ZonalAllocationFailureReason, "Standard_D4s_v3", "westus-3", corev1beta1.CapacityTypeOnDemand)
+		unavailableOfferings.MarkUnavailable(context.TODO(), ZonalAllocationFailureReason, "Standard_D4s_v3", "westus-3", corev1beta1.CapacityTypeSpot)
+		zone, _ = selector.Select(context.TODO(), "default", zones)
+		assert.Equal(t, "westus-1", zone)
+	})
+	t.Run("launches are counted until the VMs are listed again", func(t *testing.T) {
+		listed := 0
+		selector := newZoneSelector(func(context.Context) ([]*armcompute.VirtualMachine, error) { listed++; return vms, nil }, cache.NewUnavailableOfferings())
+		zone, _ := selector.Select(context.TODO(), "default", zones)
+		assert.Equal(t, "westus-3", zone)
+		selector.Launched("default", "3")
+		selector.Launched("default", "3")
+		zone, _ = selector.Select(context.TODO(), "default", zones)
+		assert.Equal(t, "westus-2", zone)
+		assert.Equal(t, 1, listed)
+	})
+	t.Run("launches do not wait on the list of another launch, and are counted after it", func(t *testing.T) {
+		listing, release := make(chan struct{}), make(chan struct{})
+		selector := newZoneSelector(func(context.Context) ([]*armcompute.VirtualMachine, error) {
+			close(listing)
+			<-release
+			return vms, nil
+		}, cache.NewUnavailableOfferings())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			selector.Select(context.TODO(), "default", zones)
+		}()
+		<-listing
+		_, ok := selector.Select(context.TODO(), "default", zones)
+		assert.True(t, ok)
+		selector.Launched("default", "3")
+		selector.Launched("default", "3")
+		close(release)
+		<-done
+		zone, _ := selector.Select(context.TODO(), "default", zones)
+		assert.Equal(t, "westus-2", zone)
+	})
+	t.Run("non-zonal", func(t *testing.T) {
+		selector := newZoneSelector(func(context.Context) ([]*armcompute.VirtualMachine, error) { return vms, nil }, cache.NewUnavailableOfferings())
+		zone, ok := selector.Select(context.TODO(), "default", []string{"", ""})
+		assert.True(t, ok)
+		assert.Equal(t, "", zone)
+		_, ok = selector.Select(context.TODO(), "default", nil)
+		assert.False(t, ok)
+	})
+}
+
+func TestNewNetworkInterfaceConfiguration(t *testing.T) {
+	subnetID := "/subscriptions/0000000-0000-0000-0000-0000000000/resourceGroups/fake-resource-group-name/providers/Microsoft.Network/virtualNetworks/karpenter/subnets/nodesubnet"
+	poolID := "/subscriptions/0000000-0000-0000-0000-0000000000/resourceGroups/fake-resource-group-name/providers/Microsoft.Network/loadBalancers/kubernetes/backendAddressPools/kubernetes"
+	nic := armnetwork.Interface{
+		Properties: &armnetwork.InterfacePropertiesFormat{
+			IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
+				{
+					Name: lo.ToPtr("aks-nodeclaim"),
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+						Primary:                         lo.ToPtr(true),
+						Subnet:                          &armnetwork.Subnet{ID: &subnetID},
+						LoadBalancerBackendAddressPools: []*armnetwork.BackendAddressPool{{ID: &poolID}},
+					},
+				},
+				{
+					Name: lo.ToPtr("ipconfig2"),
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+						Primary: lo.ToPtr(false),
+						Subnet:  &armnetwork.Subnet{ID: &subnetID},
+					},
+				},
+			},
+			EnableAcceleratedNetworking: lo.ToPtr(true),
+			EnableIPForwarding:          lo.ToPtr(true),
+		},
+	}
+
+	configuration := newNetworkInterfaceConfiguration("aks-nodeclaim", nic)
+	assert.Equal(t, "aks-nodeclaim", lo.FromPtr(configuration.Name))
+	assert.Equal(t, armcompute.DeleteOptionsDelete, lo.FromPtr(configuration.Properties.DeleteOption))
+	assert.True(t, lo.FromPtr(configuration.Properties.EnableAcceleratedNetworking))
+	assert.True(t, lo.FromPtr(configuration.Properties.EnableIPForwarding))
+	assert.Len(t, configuration.Properties.IPConfigurations, 2)
+	primary := configuration.Properties.IPConfigurations[0]
+	assert.True(t, lo.FromPtr(primary.Properties.Primary))
+	assert.Equal(t, subnetID, lo.FromPtr(primary.Properties.Subnet.ID))
+	assert.Equal(t, []*armcompute.SubResource{{ID: &poolID}}, primary.Properties.LoadBalancerBackendAddressPools)
+	assert.False(t, lo.FromPtr(configuration.Properties.IPConfigurations[1].Properties.Primary))
+}
+
+func TestNewNetworkInterfaceConfigurationSecurityGroups(t *testing.T) {
+	subnetID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"
+	nsgID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"
+	asgID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg"
+	nic := armnetwork.Interface{
+		Properties: &armnetwork.InterfacePropertiesFormat{
+			IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
+				{
+					Name:       lo.ToPtr("aks-nodeclaim"),
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Primary: lo.ToPtr(true), Subnet: &armnetwork.Subnet{ID: &subnetID}},
+				},
+				{
+					Name:       lo.ToPtr("ipconfig2"),
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Primary: lo.ToPtr(false), Subnet: &armnetwork.Subnet{ID: &subnetID}},
+				},
+			},
+		},
+	}
+	applySecurityGroups(&nic, &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{
+		NetworkSecurityGroupID:      lo.ToPtr(nsgID),
+		ApplicationSecurityGroupIDs: []string{asgID},
+	}})
+
+	configuration := newNetworkInterfaceConfiguration("aks-nodeclaim", nic)
+	assert.Equal(t, nsgID, lo.FromPtr(configuration.Properties.NetworkSecurityGroup.ID))
+	for _, ipConfiguration := range configuration.Properties.IPConfigurations {
+		assert.Equal(t, []*armcompute.SubResource{{ID: &asgID}}, ipConfiguration.Properties.ApplicationSecurityGroups)
+	}
+}
+
+func TestNewNetworkInterfaceConfigurationWithoutSecurityGroups(t *testing.T) {
+	nic := armnetwork.Interface{Properties: &armnetwork.InterfacePropertiesFormat{}}
+	applySecurityGroups(&nic, &v1alpha2.AKSNodeClass{})
+
+	configuration := newNetworkInterfaceConfiguration("aks-nodeclaim", nic)
+	assert.Nil(t, configuration.Properties.NetworkSecurityGroup)
+	assert.Nil(t, nic.Properties.NetworkSecurityGroup)
+}
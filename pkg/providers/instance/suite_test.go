@@ -17,24 +17,35 @@ limitations under the License.
 package instance_test
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"net/http"
 	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clock "k8s.io/utils/clock/testing"
 
 	"k8s.io/client-go/tools/record"
 
+	sdkerrors "github.com/Azure/azure-sdk-for-go-extensions/pkg/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
+	. "github.com/Azure/karpenter-provider-azure/pkg/test/expectations"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"sigs.k8s.io/karpenter/pkg/controllers/provisioning"
 	"sigs.k8s.io/karpenter/pkg/controllers/state"
 	"sigs.k8s.io/karpenter/pkg/events"
@@ -60,6 +71,7 @@ var cloudProviderNonZonal *cloudprovider.CloudProvider
 var fakeClock *clock.FakeClock
 var cluster *state.Cluster
 var coreProvisioner *provisioning.Provisioner
+var recorder *coretest.EventRecorder
 
 func TestAzure(t *testing.T) {
 	ctx = TestContextWithLogger(t)
@@ -72,7 +84,8 @@ func TestAzure(t *testing.T) {
 	ctx, stop = context.WithCancel(ctx)
 	azureEnv = test.NewEnvironment(ctx, env)
 	azureEnvNonZonal = test.NewEnvironmentNonZonal(ctx, env)
-	cloudProvider = cloudprovider.New(azureEnv.InstanceTypesProvider, azureEnv.InstanceProvider, events.NewRecorder(&record.FakeRecorder{}), env.Client, azureEnv.ImageProvider)
+	recorder = coretest.NewEventRecorder()
+	cloudProvider = cloudprovider.New(azureEnv.InstanceTypesProvider, azureEnv.InstanceProvider, recorder, env.Client, azureEnv.ImageProvider)
 	cloudProviderNonZonal = cloudprovider.New(azureEnvNonZonal.InstanceTypesProvider, azureEnvNonZonal.InstanceProvider, events.NewRecorder(&record.FakeRecorder{}), env.Client, azureEnvNonZonal.ImageProvider)
 	fakeClock = &clock.FakeClock{}
 	cluster = state.NewCluster(fakeClock, env.Client, cloudProvider)
@@ -90,8 +103,10 @@ var _ = Describe("InstanceProvider", func() {
 	var nodeClass *v1alpha2.AKSNodeClass
 	var nodePool *corev1beta1.NodePool
 	var nodeClaim *corev1beta1.NodeClaim
+	var originalOptions *options.Options
 
 	BeforeEach(func() {
+		originalOptions = options.FromContext(ctx)
 		nodeClass = test.AKSNodeClass()
 		nodePool = coretest.NodePool(corev1beta1.NodePool{
 			Spec: corev1beta1.NodePoolSpec{
@@ -116,11 +131,14 @@ var _ = Describe("InstanceProvider", func() {
 				},
 			},
 		})
+		cluster.Reset()
 		azureEnv.Reset()
 		azureEnvNonZonal.Reset()
+		recorder.Reset()
 	})
 
 	var _ = AfterEach(func() {
+		ctx = options.ToContext(ctx, originalOptions)
 		ExpectCleanedUp(ctx, env.Client)
 	})
 
@@ -143,7 +161,7 @@ var _ = Describe("InstanceProvider", func() {
 			instanceTypes = lo.Filter(instanceTypes, func(i *corecloudprovider.InstanceType, _ int) bool { return i.Name == "Standard_D2_v2" })
 
 			// Since all the offerings are unavailable, this should return back an ICE error
-			instance, err := azEnv.InstanceProvider.Create(ctx, nodeClass, nodeClaim, instanceTypes)
+			instance, _, err := azEnv.InstanceProvider.Create(ctx, nodeClass, nodeClaim, instanceTypes)
 			Expect(corecloudprovider.IsInsufficientCapacityError(err)).To(BeTrue())
 			Expect(instance).To(BeNil())
 		},
@@ -176,4 +194,518 @@ var _ = Describe("InstanceProvider", func() {
 			return strings.Contains(key, "/") // ARM tags can't contain '/'
 		})).To(HaveLen(0))
 	})
+
+	Context("Spot to On-Demand Fallback", func() {
+		It("should fall back to on-demand of the same instance type in the same launch when spot is not available", func() {
+			coretest.ReplaceRequirements(nodePool,
+				corev1beta1.NodeSelectorRequirementWithMinValues{
+					NodeSelectorRequirement: v1.NodeSelectorRequirement{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"Standard_D2_v2"}}},
+				corev1beta1.NodeSelectorRequirementWithMinValues{
+					NodeSelectorRequirement: v1.NodeSelectorRequirement{Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeOnDemand, corev1beta1.CapacityTypeSpot}}},
+			)
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{ErrorCode: sdkerrors.SKUNotAvailableErrorCode},
+			)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "Standard_D2_v2"))
+			Expect(node.Labels).To(HaveKeyWithValue(corev1beta1.CapacityTypeLabelKey, corev1beta1.CapacityTypeOnDemand))
+			Expect(recorder.Calls("SpotToOnDemandFallback")).To(Equal(1))
+		})
+		It("should not fall back to on-demand when the NodePool never allows it", func() {
+			coretest.ReplaceRequirements(nodePool, corev1beta1.NodeSelectorRequirementWithMinValues{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      corev1beta1.CapacityTypeLabelKey,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{corev1beta1.CapacityTypeOnDemand, corev1beta1.CapacityTypeSpot},
+				}})
+			nodePool.Spec.Template.Annotations = map[string]string{
+				v1alpha2.AnnotationSpotToOnDemandFallback: v1alpha2.SpotToOnDemandFallbackNever,
+			}
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(lowPriorityCoresQuotaError())
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(recorder.Calls("SpotToOnDemandFallback")).To(Equal(0))
+
+			// spot is marked unavailable, so the next provisioning loop launches on-demand
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels[corev1beta1.CapacityTypeLabelKey]).To(Equal(corev1beta1.CapacityTypeOnDemand))
+			Expect(recorder.Calls("SpotToOnDemandFallback")).To(Equal(0))
+		})
+		It("should match the fallback policy case-insensitively", func() {
+			coretest.ReplaceRequirements(nodePool, corev1beta1.NodeSelectorRequirementWithMinValues{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      corev1beta1.CapacityTypeLabelKey,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{corev1beta1.CapacityTypeOnDemand, corev1beta1.CapacityTypeSpot},
+				}})
+			nodePool.Spec.Template.Annotations = map[string]string{v1alpha2.AnnotationSpotToOnDemandFallback: "never"}
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(lowPriorityCoresQuotaError())
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(recorder.Calls("SpotToOnDemandFallback")).To(Equal(0))
+			Expect(recorder.Calls("InvalidSpotToOnDemandFallback")).To(Equal(0))
+		})
+		It("should warn about an invalid fallback policy and fall back", func() {
+			coretest.ReplaceRequirements(nodePool, corev1beta1.NodeSelectorRequirementWithMinValues{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      corev1beta1.CapacityTypeLabelKey,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{corev1beta1.CapacityTypeOnDemand, corev1beta1.CapacityTypeSpot},
+				}})
+			nodePool.Spec.Template.Annotations = map[string]string{v1alpha2.AnnotationSpotToOnDemandFallback: "Nope"}
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(lowPriorityCoresQuotaError())
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels[corev1beta1.CapacityTypeLabelKey]).To(Equal(corev1beta1.CapacityTypeOnDemand))
+			Expect(recorder.Calls("InvalidSpotToOnDemandFallback")).To(Equal(1))
+			Expect(recorder.Calls("SpotToOnDemandFallback")).To(Equal(1))
+		})
+		It("should fall back to on-demand when the last spot attempt fails", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				MaxLaunchAttempts: lo.ToPtr(1),
+			}))
+			coretest.ReplaceRequirements(nodePool, corev1beta1.NodeSelectorRequirementWithMinValues{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      corev1beta1.CapacityTypeLabelKey,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{corev1beta1.CapacityTypeOnDemand, corev1beta1.CapacityTypeSpot},
+				}})
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(lowPriorityCoresQuotaError())
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels[corev1beta1.CapacityTypeLabelKey]).To(Equal(corev1beta1.CapacityTypeOnDemand))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.FailedCalls()).To(Equal(1))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.SuccessfulCalls()).To(Equal(1))
+			Expect(recorder.Calls("SpotToOnDemandFallback")).To(Equal(1))
+		})
+	})
+
+	Context("Launch Retries", func() {
+		networkInterfaces := func() int {
+			count := 0
+			azureEnv.NetworkInterfacesAPI.NetworkInterfaces.Range(func(_, _ any) bool {
+				count++
+				return true
+			})
+			return count
+		}
+		BeforeEach(func() {
+			coretest.ReplaceRequirements(nodePool,
+				corev1beta1.NodeSelectorRequirementWithMinValues{
+					NodeSelectorRequirement: v1.NodeSelectorRequirement{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"Standard_D2_v3", "Standard_D2s_v3"}}},
+				corev1beta1.NodeSelectorRequirementWithMinValues{
+					NodeSelectorRequirement: v1.NodeSelectorRequirement{Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeOnDemand}}},
+			)
+		})
+		AfterEach(func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(nil)
+		})
+
+		It("should try another zone within the same launch on zonal allocation failure", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{ErrorCode: sdkerrors.ZoneAllocationFailed},
+			)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "Standard_D2_v3"))
+
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.FailedCalls()).To(Equal(1))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.SuccessfulCalls()).To(Equal(1))
+			failedZones := lo.Filter([]string{"1", "2", "3"}, func(zone string, _ int) bool {
+				return azureEnv.UnavailableOfferingsCache.IsUnavailable("Standard_D2_v3", fmt.Sprintf("%s-%s", fake.Region, zone), corev1beta1.CapacityTypeOnDemand)
+			})
+			Expect(failedZones).To(HaveLen(1))
+			Expect(node.Labels).ToNot(HaveKeyWithValue(v1.LabelTopologyZone, fmt.Sprintf("%s-%s", fake.Region, failedZones[0])))
+
+			// the nic of the failed attempt should be cleaned up, only the one of the launched vm remains
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(2))
+			Expect(networkInterfaces()).To(Equal(1))
+		})
+		It("should try the next instance type within the same launch when the SKU is not available", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{ErrorCode: sdkerrors.SKUNotAvailableErrorCode},
+			)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "Standard_D2s_v3"))
+
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.FailedCalls()).To(Equal(1))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.SuccessfulCalls()).To(Equal(1))
+			for _, zone := range []string{"1", "2", "3"} {
+				ExpectUnavailable(azureEnv, "Standard_D2_v3", zone, corev1beta1.CapacityTypeOnDemand)
+			}
+		})
+		It("should give up after max launch attempts", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				MaxLaunchAttempts: lo.ToPtr(2),
+			}))
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{ErrorCode: sdkerrors.ZoneAllocationFailed}, fake.MaxCalls(3),
+			)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.FailedCalls()).To(Equal(2))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.SuccessfulCalls()).To(Equal(0))
+			Expect(networkInterfaces()).To(Equal(0))
+		})
+		It("should not retry errors that are not capacity related", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{
+					ErrorCode: fmt.Sprint(http.StatusNotFound),
+					RawResponse: &http.Response{
+						Body: createSDKErrorBody(fmt.Sprint(http.StatusNotFound), "test error"),
+					},
+				},
+			)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.FailedCalls()).To(Equal(1))
+		})
+	})
+
+	Context("Single-call VM creation", func() {
+		BeforeEach(func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMCreationMode: lo.ToPtr(options.VMCreationModeSingleCall),
+			}))
+		})
+
+		It("should declare the network interface inline in the VM, then tag it and create the AKS billing extension", func() {
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			input := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop()
+			vm := input.VM
+			Expect(vm.Resources).To(BeEmpty())
+
+			Expect(vm.Properties.NetworkProfile.NetworkInterfaces).To(BeEmpty())
+			Expect(vm.Properties.NetworkProfile.NetworkInterfaceConfigurations).To(HaveLen(1))
+			nic := vm.Properties.NetworkProfile.NetworkInterfaceConfigurations[0]
+			Expect(lo.FromPtr(nic.Name)).To(Equal(input.VMName))
+			Expect(lo.FromPtr(nic.Properties.Primary)).To(BeTrue())
+			Expect(lo.FromPtr(nic.Properties.DeleteOption)).To(Equal(armcompute.DeleteOptionsDelete))
+			Expect(nic.Properties.IPConfigurations).To(HaveLen(1))
+			Expect(lo.FromPtr(nic.Properties.IPConfigurations[0].Properties.Primary)).To(BeTrue())
+			Expect(lo.FromPtr(nic.Properties.IPConfigurations[0].Properties.Subnet.ID)).To(Equal(options.FromContext(ctx).SubnetID))
+			Expect(lo.FromPtr(vm.Properties.StorageProfile.OSDisk.DeleteOption)).To(Equal(armcompute.DiskDeleteOptionTypesDelete))
+
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+			tagsInput := azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Pop()
+			Expect(tagsInput.InterfaceName).To(Equal(input.VMName))
+			Expect(tagsInput.Tags.Tags).To(Equal(vm.Tags))
+
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			extension := azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Pop()
+			Expect(extension.VirtualMachineName).To(Equal(input.VMName))
+			Expect(lo.FromPtr(extension.VirtualMachineExtension.Name)).To(Equal("computeAksLinuxBilling"))
+			Expect(lo.FromPtr(extension.VirtualMachineExtension.Properties.Type)).To(Equal("Compute.AKS.Linux.Billing"))
+		})
+		It("should declare the security groups of the AKSNodeClass inline and install its extensions", func() {
+			nsgID := "/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"
+			asgID := "/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg"
+			nodeClass.Spec.NetworkSecurityGroupID = lo.ToPtr(nsgID)
+			nodeClass.Spec.ApplicationSecurityGroupIDs = []string{asgID}
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{{
+				Name:               "AzureMonitorLinuxAgent",
+				Publisher:          "Microsoft.Azure.Monitor",
+				Type:               "AzureMonitorLinuxAgent",
+				TypeHandlerVersion: "1.0",
+			}}
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			nic := vm.Properties.NetworkProfile.NetworkInterfaceConfigurations[0]
+			Expect(lo.FromPtr(nic.Properties.NetworkSecurityGroup.ID)).To(Equal(nsgID))
+			Expect(nic.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups).To(Equal([]*armcompute.SubResource{{ID: lo.ToPtr(asgID)}}))
+
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(2))
+			names := lo.Times(2, func(int) string {
+				return azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Pop().VirtualMachineExtensionName
+			})
+			Expect(names).To(ConsistOf("computeAksLinuxBilling", "AzureMonitorLinuxAgent"))
+
+			nodeClaims := &corev1beta1.NodeClaimList{}
+			Expect(env.Client.List(ctx, nodeClaims)).To(Succeed())
+			Expect(nodeClaims.Items[0].Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateExtensionNames, `["azuremonitorlinuxagent"]`))
+			Expect(nodeClaims.Items[0].Annotations).To(HaveKeyWithValue(v1alpha2.AnnotationInPlaceUpdateSecurityGroupIDs,
+				fmt.Sprintf(`[%q,%q]`, strings.ToLower(asgID), strings.ToLower(nsgID))))
+		})
+		It("should reserve pod IPs inline for Azure CNI with pod IPs from the node subnet", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMCreationMode:    lo.ToPtr(options.VMCreationModeSingleCall),
+				NetworkPluginMode: lo.ToPtr(""),
+			}))
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			nic := vm.Properties.NetworkProfile.NetworkInterfaceConfigurations[0]
+			Expect(nic.Properties.IPConfigurations).To(HaveLen(31))
+			for _, ipConfiguration := range nic.Properties.IPConfigurations[1:] {
+				Expect(lo.FromPtr(ipConfiguration.Properties.Primary)).To(BeFalse())
+			}
+		})
+		It("should make no other calls when the VM fails to be created", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{
+					ErrorCode: fmt.Sprint(http.StatusNotFound),
+					RawResponse: &http.Response{
+						Body: createSDKErrorBody(fmt.Sprint(http.StatusNotFound), "test error"),
+					},
+				},
+			)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+
+			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(nil)
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+		})
+	})
+
+	Context("Asynchronous VM creation", func() {
+		BeforeEach(func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMCreationMode:  lo.ToPtr(options.VMCreationModeSingleCall),
+				AsyncVMCreation: lo.ToPtr(true),
+			}))
+		})
+		launchedNodeClaim := func() corev1beta1.NodeClaim {
+			nodeClaims := &corev1beta1.NodeClaimList{}
+			Expect(env.Client.List(ctx, nodeClaims)).To(Succeed())
+			Expect(nodeClaims.Items).To(HaveLen(1))
+			return nodeClaims.Items[0]
+		}
+
+		It("should launch once the VM creation is accepted and track its provisioning", func() {
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			nodeClaim := launchedNodeClaim()
+			Expect(nodeClaim.Annotations).To(HaveKey(v1alpha2.AnnotationVMCreationAccepted))
+			vmName, err := utils.GetVMName(nodeClaim.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmName).To(Equal(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VMName))
+
+			// the NIC is tagged and the AKS billing extension is created once the VM is
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+			state, err := azureEnv.InstanceProvider.PollCreation(ctx, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.ProvisioningState).To(Equal(instance.ProvisioningStateSucceeded))
+			Expect(state.Err).ToNot(HaveOccurred())
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+			Expect(azureEnv.NetworkInterfacesAPI.NetworkInterfacesUpdateTagsBehavior.CalledWithInput.Pop().InterfaceName).To(Equal(vmName))
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			extension := azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Pop()
+			Expect(extension.VirtualMachineName).To(Equal(vmName))
+			Expect(lo.FromPtr(extension.VirtualMachineExtension.Name)).To(Equal("computeAksLinuxBilling"))
+		})
+		It("should install the extensions of the AKSNodeClass once the VM is created", func() {
+			nodeClass.Spec.Extensions = []v1alpha2.Extension{{
+				Name:               "AzureMonitorLinuxAgent",
+				Publisher:          "Microsoft.Azure.Monitor",
+				Type:               "AzureMonitorLinuxAgent",
+				TypeHandlerVersion: "1.0",
+			}}
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			vmName, err := utils.GetVMName(launchedNodeClaim().Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(0))
+			state, err := azureEnv.InstanceProvider.PollCreation(ctx, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.ProvisioningState).To(Equal(instance.ProvisioningStateSucceeded))
+			Expect(azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(2))
+			names := lo.Times(2, func(int) string {
+				return azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.CalledWithInput.Pop().VirtualMachineExtensionName
+			})
+			Expect(names).To(ConsistOf("computeAksLinuxBilling", "AzureMonitorLinuxAgent"))
+		})
+		It("should fail the creation when the AKS billing extension fails to be created", func() {
+			azureEnv.VirtualMachineExtensionsAPI.VirtualMachineExtensionsCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{ErrorCode: sdkerrors.OperationNotAllowed},
+			)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			vmName, err := utils.GetVMName(launchedNodeClaim().Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			state, err := azureEnv.InstanceProvider.PollCreation(ctx, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.ProvisioningState).To(Equal(instance.ProvisioningStateFailed))
+			Expect(state.Err).To(MatchError(ContainSubstring("AKS identifying extension")))
+		})
+		It("should mark the offering unavailable when the VM creation fails for lack of capacity in the zone", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{ErrorCode: sdkerrors.ZoneAllocationFailed},
+			)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			nodeClaim := launchedNodeClaim()
+			vmName, err := utils.GetVMName(nodeClaim.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			state, err := azureEnv.InstanceProvider.PollCreation(ctx, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.ProvisioningState).To(Equal(instance.ProvisioningStateFailed))
+			Expect(state.Err).To(MatchError(ContainSubstring("unable to allocate resources in the selected zone")))
+			Expect(azureEnv.UnavailableOfferingsCache.IsUnavailable(
+				nodeClaim.Labels[v1.LabelInstanceTypeStable],
+				nodeClaim.Labels[v1alpha2.AlternativeLabelTopologyZone],
+				nodeClaim.Labels[corev1beta1.CapacityTypeLabelKey],
+			)).To(BeTrue())
+		})
+		It("should leave trying another offering to the next launch when the VM creation fails for lack of capacity", func() {
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
+				&azcore.ResponseError{ErrorCode: sdkerrors.ZoneAllocationFailed},
+			)
+			// the pods can't share a node, so that the second one launches another VM
+			spreadPod := func() *v1.Pod {
+				return coretest.UnschedulablePod(coretest.PodOptions{
+					PodAntiRequirements: []v1.PodAffinityTerm{{
+						LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "spread"}},
+						TopologyKey:   v1.LabelHostname,
+					}},
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "spread"}},
+				})
+			}
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := spreadPod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			// the launch returned before the failure, so it neither retried nor fell back
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			failed := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			vmName, err := utils.GetVMName(launchedNodeClaim().Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			state, err := azureEnv.InstanceProvider.PollCreation(ctx, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.ProvisioningState).To(Equal(instance.ProvisioningStateFailed))
+
+			// the next launch avoids the offering which failed
+			pod = spreadPod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			next := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			Expect([]any{*next.Properties.HardwareProfile.VMSize, *next.Zones[0]}).ToNot(
+				Equal([]any{*failed.Properties.HardwareProfile.VMSize, *failed.Zones[0]}))
+		})
+	})
+
+	Context("Zone Balancing", func() {
+		storeVM := func(name string, nodePoolName string, zoneID string) {
+			id := utils.MkVMID(azureEnv.AzureResourceGraphAPI.ResourceGroup, name)
+			azureEnv.VirtualMachinesAPI.Instances.Store(id, armcompute.VirtualMachine{
+				ID:       lo.ToPtr(id),
+				Name:     lo.ToPtr(name),
+				Location: lo.ToPtr(fake.Region),
+				Zones:    []*string{lo.ToPtr(zoneID)},
+				Tags:     map[string]*string{instance.NodePoolTagKey: lo.ToPtr(nodePoolName)},
+			})
+		}
+
+		It("should launch in the zone with the fewest VMs of the NodePool", func() {
+			storeVM("aks-default-a", nodePool.Name, "1")
+			storeVM("aks-default-b", nodePool.Name, "2")
+			storeVM("aks-other-a", "other", "3")
+			storeVM("aks-other-b", "other", "3")
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelTopologyZone, fmt.Sprintf("%s-3", fake.Region)))
+		})
+		It("should avoid zones with recent zonal allocation failures", func() {
+			storeVM("aks-default-a", nodePool.Name, "1")
+			storeVM("aks-default-b", nodePool.Name, "3")
+			// failures of another instance type count against the zone too
+			azureEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, instance.ZonalAllocationFailureReason, "Standard_D64s_v3", fmt.Sprintf("%s-2", fake.Region), corev1beta1.CapacityTypeOnDemand)
+			azureEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, instance.ZonalAllocationFailureReason, "Standard_D64s_v3", fmt.Sprintf("%s-2", fake.Region), corev1beta1.CapacityTypeSpot)
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).ToNot(HaveKeyWithValue(v1.LabelTopologyZone, fmt.Sprintf("%s-2", fake.Region)))
+		})
+		It("should spread consecutive launches of the NodePool across zones", func() {
+			ExpectApplied(ctx, env.Client, nodeClass, nodePool)
+			pods := []*v1.Pod{}
+			for i := 0; i < 3; i++ {
+				pod := coretest.UnschedulablePod(coretest.PodOptions{
+					PodAntiRequirements: []v1.PodAffinityTerm{{
+						LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "spread"}},
+						TopologyKey:   v1.LabelHostname,
+					}},
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "spread"}},
+				})
+				ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+				pods = append(pods, pod)
+			}
+			zones := lo.Map(pods, func(pod *v1.Pod, _ int) string {
+				return ExpectScheduled(ctx, env.Client, pod).Labels[v1.LabelTopologyZone]
+			})
+			Expect(lo.Uniq(zones)).To(HaveLen(3))
+		})
+	})
 })
+
+func lowPriorityCoresQuotaError() *azcore.ResponseError {
+	LowPriorityCoresQuotaErrorMessage := "Operation could not be completed as it results in exceeding approved Low Priority Cores quota. Additional details - Deployment Model: Resource Manager, Location: westus2, Current Limit: 0, Current Usage: 0, Additional Required: 32, (Minimum) New Limit Required: 32. Submit a request for Quota increase at https://aka.ms/ProdportalCRP/#blade/Microsoft_Azure_Capacity/UsageAndQuota.ReactView/Parameters/%7B%22subscriptionId%22:%(redacted)%22,%22command%22:%22openQuotaApprovalBlade%22,%22quotas%22:[%7B%22location%22:%22westus2%22,%22providerId%22:%22Microsoft.Compute%22,%22resourceName%22:%22LowPriorityCores%22,%22quotaRequest%22:%7B%22properties%22:%7B%22limit%22:32,%22unit%22:%22Count%22,%22name%22:%7B%22value%22:%22LowPriorityCores%22%7D%7D%7D%7D]%7D by specifying parameters listed in the ‘Details’ section for deployment to succeed. Please read more about quota limits at https://docs.microsoft.com/en-us/azure/azure-supportability/per-vm-quota-requests"
+	return &azcore.ResponseError{
+		ErrorCode: sdkerrors.OperationNotAllowed,
+		RawResponse: &http.Response{
+			Body: createSDKErrorBody(sdkerrors.OperationNotAllowed, LowPriorityCoresQuotaErrorMessage),
+		},
+	}
+}
+
+func createSDKErrorBody(code, message string) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader([]byte(fmt.Sprintf(`{"error":{"code": "%s", "message": "%s"}}`, code, message))))
+}
@@ -0,0 +1,156 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/samber/lo"
+	"knative.dev/pkg/logging"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/cache"
+)
+
+const (
+	// zoneCountsTTL is how long the VMs of NodePools counted per zone are used before the VMs are listed again
+	zoneCountsTTL = time.Minute
+	// zonalAllocationFailureWeight is how many VMs an instance type which recently failed zonal allocation in a zone counts as
+	zonalAllocationFailureWeight = 2
+)
+
+// zoneSelector picks the zones of launches, balancing the VMs of each NodePool across the zones a launch allows.
+// It lists the VMs of the cluster, an Azure Resource Graph query, on the first launch after the counts are out of date.
+type zoneSelector struct {
+	list                 func(context.Context) ([]*armcompute.VirtualMachine, error)
+	unavailableOfferings *cache.UnavailableOfferings
+
+	mu sync.Mutex
+	// counts are the VMs by zone ID by NodePool, as of the last list plus the launches since
+	counts  map[string]map[string]int
+	updated time.Time
+	listing bool
+	// launches are the launches since the list in progress started, which it may not return
+	launches []zoneLaunch
+}
+
+type zoneLaunch struct {
+	nodePool string
+	zoneID   string
+}
+
+func newZoneSelector(list func(context.Context) ([]*armcompute.VirtualMachine, error), unavailableOfferings *cache.UnavailableOfferings) *zoneSelector {
+	return &zoneSelector{
+		list:                 list,
+		unavailableOfferings: unavailableOfferings,
+	}
+}
+
+// Select returns the zone with the fewest VMs of the NodePool out of the offering zones, counting the instance types
+// which recently failed zonal allocation in a zone as VMs in it. Ties are broken at random.
+func (z *zoneSelector) Select(ctx context.Context, nodePool string, zones []string) (string, bool) {
+	zones = lo.Shuffle(lo.Uniq(zones))
+	if len(zones) == 0 {
+		return "", false
+	}
+	counts := z.nodePoolCounts(ctx, nodePool)
+	scores := lo.SliceToMap(zones, func(zone string) (string, int) {
+		return zone, counts[zoneID(zone)] + zonalAllocationFailureWeight*z.unavailableOfferings.UnavailableInZone(zone, ZonalAllocationFailureReason)
+	})
+	return lo.MinBy(zones, func(a, b string) bool { return scores[a] < scores[b] }), true
+}
+
+// Launched counts a VM launched for the NodePool in the zone, as listing VMs does not return them right away
+func (z *zoneSelector) Launched(nodePool string, zoneID string) {
+	if nodePool == "" {
+		return
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.listing {
+		z.launches = append(z.launches, zoneLaunch{nodePool: nodePool, zoneID: zoneID})
+	}
+	if z.counts == nil {
+		return
+	}
+	if z.counts[nodePool] == nil {
+		z.counts[nodePool] = map[string]int{}
+	}
+	z.counts[nodePool][zoneID]++
+}
+
+// Reset drops the counted VMs, so that they are listed again on the next launch
+func (z *zoneSelector) Reset() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.counts = nil
+}
+
+// nodePoolCounts returns the VMs of the NodePool by zone ID, listing the VMs when the counts are out of date. The VMs
+// are listed without holding the lock, concurrent launches use the counts they have rather than wait for the list.
+func (z *zoneSelector) nodePoolCounts(ctx context.Context, nodePool string) map[string]int {
+	if nodePool == "" {
+		return nil
+	}
+	z.mu.Lock()
+	if z.listing || (z.counts != nil && time.Since(z.updated) <= zoneCountsTTL) {
+		defer z.mu.Unlock()
+		return lo.Assign(z.counts[nodePool])
+	}
+	z.listing = true
+	z.launches = nil
+	z.mu.Unlock()
+
+	vms, err := z.list(ctx)
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.listing = false
+	if err != nil {
+		// balance with the counts we have, if any, rather than fail the launch
+		logging.FromContext(ctx).Errorf("listing instances to balance zones, %s", err)
+		return lo.Assign(z.counts[nodePool])
+	}
+	z.counts = countByNodePoolAndZone(vms)
+	for _, launch := range z.launches {
+		if z.counts[launch.nodePool] == nil {
+			z.counts[launch.nodePool] = map[string]int{}
+		}
+		z.counts[launch.nodePool][launch.zoneID]++
+	}
+	z.launches = nil
+	z.updated = time.Now()
+	return lo.Assign(z.counts[nodePool])
+}
+
+func countByNodePoolAndZone(vms []*armcompute.VirtualMachine) map[string]map[string]int {
+	counts := map[string]map[string]int{}
+	for _, vm := range vms {
+		nodePool := lo.FromPtr(vm.Tags[NodePoolTagKey])
+		zone, err := GetZoneID(vm)
+		if nodePool == "" || err != nil {
+			continue
+		}
+		if counts[nodePool] == nil {
+			counts[nodePool] = map[string]int{}
+		}
+		counts[nodePool][zone]++
+	}
+	return counts
+}
@@ -21,10 +21,13 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/skewer"
+	"github.com/alecthomas/units"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/ptr"
 
 	agentbakercommon "github.com/Azure/agentbaker/pkg/agent/common"
@@ -38,12 +41,35 @@ import (
 	"sigs.k8s.io/karpenter/pkg/utils/resources"
 )
 
+const (
+	// defaultMaxPodsAzureNodeSubnet is the maximum number of pods to run on a node for Azure CNI with pod IPs from the node subnet.
+	defaultMaxPodsAzureNodeSubnet = 30
+	// defaultMaxPodsAzure is the maximum number of pods to run on a node for Azure CNI Overlay and Azure CNI with a pod subnet.
+	defaultMaxPodsAzure = 250
+	// defaultMaxPodsKubenet is the maximum number of pods to run on a node for Kubenet.
+	defaultMaxPodsKubenet = 100
+	// defaultMaxPods is the maximum number of pods on a node.
+	defaultMaxPods = 110
+)
+
 const (
 	MemoryAvailable        = "memory.available"
 	DefaultMemoryAvailable = "750Mi"
+	AKSMemoryAvailable     = "100Mi"
 )
 
 var (
+	// amdSeriesWithoutAdditiveFeature are the AMD based series which predate the 'a' additive feature in VM size names
+	amdSeriesWithoutAdditiveFeature = sets.New("HBrs", "HBrs_v2", "HBrs_v3", "HBrs_v4", "HXrs", "Ls_v2")
+	// intelFamilies are the families whose x64 sizes run on Intel CPUs, unless they are AMD based. Families missing
+	// here get no CPU manufacturer label, e.g. A, whose sizes run on a mix of Intel and AMD hardware.
+	intelFamilies = sets.New("B", "D", "E", "F", "G", "H", "L", "M", "N")
+	// armVersionManufacturers maps the versions of the Arm64 series to the manufacturer of their CPUs
+	armVersionManufacturers = map[string]string{
+		"v5": v1alpha2.ManufacturerAmpere,    // Ampere Altra
+		"v6": v1alpha2.ManufacturerMicrosoft, // Azure Cobalt 100
+	}
+
 	// reservedMemoryTaxGi denotes the tax brackets for memory in Gi.
 	reservedMemoryTaxGi = TaxBrackets{
 		{
@@ -90,14 +116,7 @@ var (
 )
 
 // TaxBrackets implements a simple bracketed tax structure.
-type TaxBrackets []struct {
-	// UpperBound is the largest value this bracket is applied to.
-	// The first bracket's lower bound is always 0.
-	UpperBound float64
-
-	// Rate is the percent rate of tax expressed as a float i.e. .5 for 50%.
-	Rate float64
-}
+type TaxBrackets []options.TaxBracket
 
 // Calculate expects Memory in Gi and CPU in cores.
 func (t TaxBrackets) Calculate(amount float64) float64 {
@@ -119,22 +138,22 @@ func (t TaxBrackets) Calculate(amount float64) float64 {
 }
 
 func NewInstanceType(ctx context.Context, sku *skewer.SKU, vmsize *skewer.VMSizeType, kc *corev1beta1.KubeletConfiguration, region string,
-	offerings cloudprovider.Offerings, nodeClass *v1alpha2.AKSNodeClass, architecture string) *cloudprovider.InstanceType {
+	offerings cloudprovider.Offerings, nodeClass *v1alpha2.AKSNodeClass, architecture string, spotEvictionRate *int) *cloudprovider.InstanceType {
 	return &cloudprovider.InstanceType{
 		Name:         sku.GetName(),
-		Requirements: computeRequirements(sku, vmsize, architecture, offerings, region),
+		Requirements: computeRequirements(sku, vmsize, architecture, offerings, region, spotEvictionRate),
 		Offerings:    offerings,
-		Capacity:     computeCapacity(ctx, sku, kc, nodeClass),
+		Capacity:     computeCapacity(ctx, sku, vmsize, kc, nodeClass),
 		Overhead: &cloudprovider.InstanceTypeOverhead{
-			KubeReserved:      KubeReservedResources(lo.Must(sku.VCPU()), lo.Must(sku.Memory())),
+			KubeReserved:      KubeReservedResources(ctx, lo.Must(sku.VCPU()), lo.Must(sku.Memory()), MaxPods(ctx, kc, nodeClass)),
 			SystemReserved:    SystemReservedResources(),
-			EvictionThreshold: EvictionThreshold(),
+			EvictionThreshold: EvictionThreshold(ctx),
 		},
 	}
 }
 
 func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architecture string,
-	offerings cloudprovider.Offerings, region string) scheduling.Requirements {
+	offerings cloudprovider.Offerings, region string, spotEvictionRate *int) scheduling.Requirements {
 	requirements := scheduling.NewRequirements(
 		// Well Known Upstream
 		scheduling.NewRequirement(v1.LabelInstanceTypeStable, v1.NodeSelectorOpIn, sku.GetName()),
@@ -159,6 +178,7 @@ func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architectur
 		scheduling.NewRequirement(v1alpha2.LabelSKUGPUCount, v1.NodeSelectorOpIn, fmt.Sprint(gpuNvidiaCount(sku).Value())),
 		scheduling.NewRequirement(v1alpha2.LabelSKUGPUManufacturer, v1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha2.LabelSKUGPUName, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUCPUManufacturer, v1.NodeSelectorOpDoesNotExist),
 
 		// composites
 		scheduling.NewRequirement(v1alpha2.LabelSKUName, v1.NodeSelectorOpDoesNotExist),
@@ -174,6 +194,13 @@ func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architectur
 		scheduling.NewRequirement(v1alpha2.LabelSKUEncryptionAtHostSupported, v1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUACU, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUNetworkingMaxNICs, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageMaxDataDisks, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageTempDiskSize, v1.NodeSelectorOpDoesNotExist),
+
+		// spot
+		scheduling.NewRequirement(v1alpha2.LabelSKUSpotEvictionRate, v1.NodeSelectorOpDoesNotExist),
 		// all additive feature initialized elsewhere
 	)
 
@@ -191,6 +218,12 @@ func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architectur
 	setRequirementsGPU(requirements, sku, vmsize)
 	setRequirementsAccelerator(requirements, vmsize)
 	setRequirementsVersion(requirements, vmsize)
+	setRequirementsCPUManufacturer(requirements, vmsize, architecture)
+	setRequirementsIntegerCapability(requirements, sku, v1alpha2.LabelSKUACU, "ACUs")
+	setRequirementsIntegerCapability(requirements, sku, v1alpha2.LabelSKUNetworkingMaxNICs, "MaxNetworkInterfaces")
+	setRequirementsIntegerCapability(requirements, sku, v1alpha2.LabelSKUStorageMaxDataDisks, "MaxDataDiskCount")
+	setRequirementsTempDiskSize(requirements, sku)
+	setRequirementsSpotEvictionRate(requirements, offerings, spotEvictionRate)
 
 	return requirements
 }
@@ -201,6 +234,15 @@ func setRequirementsStoragePremiumCapable(requirements scheduling.Requirements,
 	}
 }
 
+// setRequirementsSpotEvictionRate sets the spot eviction rate bucket of the instance type in the region, when published
+// and the instance type has spot offerings, as the rate is only meaningful for spot VMs
+func setRequirementsSpotEvictionRate(requirements scheduling.Requirements, offerings cloudprovider.Offerings, spotEvictionRate *int) {
+	hasSpot := lo.ContainsBy(offerings.Available(), func(o cloudprovider.Offering) bool { return o.CapacityType == corev1beta1.CapacityTypeSpot })
+	if spotEvictionRate != nil && hasSpot {
+		requirements[v1alpha2.LabelSKUSpotEvictionRate].Insert(fmt.Sprint(*spotEvictionRate))
+	}
+}
+
 func setRequirementsEncryptionAtHostSupported(requirements scheduling.Requirements, sku *skewer.SKU) {
 	if sku.IsEncryptionAtHostSupported() {
 		requirements[v1alpha2.LabelSKUEncryptionAtHostSupported].Insert("true")
@@ -208,7 +250,7 @@ func setRequirementsEncryptionAtHostSupported(requirements scheduling.Requiremen
 }
 
 func setRequirementsEphemeralOSDiskSupported(requirements scheduling.Requirements, sku *skewer.SKU, vmsize *skewer.VMSizeType) {
-	if sku.IsEphemeralOSDiskSupported() && vmsize.Series != "Dlds_v5" { // Dlds_v5 does not support ephemeral OS disk, contrary to what it claims
+	if isEphemeralOSDiskSupported(sku, vmsize) {
 		requirements[v1alpha2.LabelSKUStorageEphemeralOSMaxSize].Insert(fmt.Sprint(MaxEphemeralOSDiskSizeGB(sku)))
 	}
 }
@@ -256,6 +298,40 @@ func setRequirementsVersion(requirements scheduling.Requirements, vmsize *skewer
 	requirements[v1alpha2.LabelSKUVersion].Insert(version)
 }
 
+// setRequirementsCPUManufacturer sets the CPU manufacturer, which is not a SKU capability, from the architecture and
+// the VM size name: AMD based x64 sizes have the 'a' additive feature (or are one of amdSeriesWithoutAdditiveFeature),
+// other x64 sizes of intelFamilies are Intel based, and Arm64 sizes are mapped by version. The label is left unset
+// when the manufacturer is not known.
+func setRequirementsCPUManufacturer(requirements scheduling.Requirements, vmsize *skewer.VMSizeType, architecture string) {
+	switch getArchitecture(architecture) {
+	case corev1beta1.ArchitectureArm64:
+		if manufacturer, ok := armVersionManufacturers[vmsize.Version]; ok {
+			requirements[v1alpha2.LabelSKUCPUManufacturer].Insert(manufacturer)
+		}
+	case corev1beta1.ArchitectureAmd64:
+		switch {
+		case lo.Contains(vmsize.AdditiveFeatures, 'a') || amdSeriesWithoutAdditiveFeature.Has(vmsize.Series):
+			requirements[v1alpha2.LabelSKUCPUManufacturer].Insert(v1alpha2.ManufacturerAMD)
+		case intelFamilies.Has(vmsize.Family):
+			requirements[v1alpha2.LabelSKUCPUManufacturer].Insert(v1alpha2.ManufacturerIntel)
+		}
+	}
+}
+
+// setRequirementsIntegerCapability sets the label from the integer SKU capability, if the SKU has it
+func setRequirementsIntegerCapability(requirements scheduling.Requirements, sku *skewer.SKU, label string, capability string) {
+	if value, err := sku.GetCapabilityIntegerQuantity(capability); err == nil {
+		requirements[label].Insert(fmt.Sprint(value))
+	}
+}
+
+// setRequirementsTempDiskSize sets the size of the local temp (resource) disk in GiB, for SKUs which have one
+func setRequirementsTempDiskSize(requirements scheduling.Requirements, sku *skewer.SKU) {
+	if tempDiskBytes := tempDiskBytes(sku); tempDiskBytes > 0 {
+		requirements[v1alpha2.LabelSKUStorageTempDiskSize].Insert(fmt.Sprint(tempDiskBytes / int64(units.Gibibyte)))
+	}
+}
+
 func getArchitecture(architecture string) string {
 	if value, ok := v1alpha2.AzureToKubeArchitectures[architecture]; ok {
 		return value
@@ -263,12 +339,12 @@ func getArchitecture(architecture string) string {
 	return architecture // unrecognized
 }
 
-func computeCapacity(ctx context.Context, sku *skewer.SKU, kc *corev1beta1.KubeletConfiguration, nodeClass *v1alpha2.AKSNodeClass) v1.ResourceList {
+func computeCapacity(ctx context.Context, sku *skewer.SKU, vmsize *skewer.VMSizeType, kc *corev1beta1.KubeletConfiguration, nodeClass *v1alpha2.AKSNodeClass) v1.ResourceList {
 	return v1.ResourceList{
 		v1.ResourceCPU:                    *cpu(sku),
-		v1.ResourceMemory:                 *memory(ctx, sku),
-		v1.ResourceEphemeralStorage:       *ephemeralStorage(nodeClass),
-		v1.ResourcePods:                   *pods(sku, kc),
+		v1.ResourceMemory:                 *memory(ctx, sku, vmsize),
+		v1.ResourceEphemeralStorage:       *ephemeralStorage(sku, vmsize, nodeClass),
+		v1.ResourcePods:                   *pods(ctx, sku, kc, nodeClass),
 		v1.ResourceName("nvidia.com/gpu"): *gpuNvidiaCount(sku),
 	}
 }
@@ -298,33 +374,98 @@ func memoryMiB(sku *skewer.SKU) int64 {
 	return int64(memoryGiB(sku) * 1024)
 }
 
-func memory(ctx context.Context, sku *skewer.SKU) *resource.Quantity {
+func memory(ctx context.Context, sku *skewer.SKU, vmsize *skewer.VMSizeType) *resource.Quantity {
 	memory := resources.Quantity(fmt.Sprintf("%dGi", int64(memoryGiB(sku))))
-	// Account for VM overhead in calculation
+	// Account for VM overhead in calculation, which differs by SKU family
+	vmMemoryOverheadPercent, ok := options.FromContext(ctx).VMMemoryOverheadPercentOverrides[vmsize.Family]
+	if !ok {
+		vmMemoryOverheadPercent = options.FromContext(ctx).VMMemoryOverheadPercent
+	}
 	memory.Sub(resource.MustParse(fmt.Sprintf("%dMi", int64(math.Ceil(
-		float64(memory.Value())*options.FromContext(ctx).VMMemoryOverheadPercent/1024/1024)))))
+		float64(memory.Value())*vmMemoryOverheadPercent/1024/1024)))))
 	return memory
 }
 
-func ephemeralStorage(nodeClass *v1alpha2.AKSNodeClass) *resource.Quantity {
-	return resource.NewScaledQuantity(int64(lo.FromPtr(nodeClass.Spec.OSDiskSizeGB)), resource.Giga)
+// ephemeralStorage returns the size of the disk the kubelet root directory is placed on: the temp disk, less the
+// ephemeral OS disk when it is placed there too, if the AKSNodeClass asks for it and the SKU has one, else the OS disk.
+// Azure disk sizes in "GB" are GiB.
+func ephemeralStorage(sku *skewer.SKU, vmsize *skewer.VMSizeType, nodeClass *v1alpha2.AKSNodeClass) *resource.Quantity {
+	osDiskBytes := int64(lo.FromPtr(nodeClass.Spec.OSDiskSizeGB)) * int64(units.Gibibyte)
+	tempDiskBytes := tempDiskBytes(sku)
+	if !nodeClass.Spec.IsKubeletOnTemporaryDisk() || tempDiskBytes == 0 {
+		return resource.NewQuantity(osDiskBytes, resource.BinarySI)
+	}
+	if lo.FromPtr(EphemeralOSDiskPlacement(sku, vmsize, nodeClass)) == armcompute.DiffDiskPlacementResourceDisk {
+		tempDiskBytes -= osDiskBytes
+	}
+	return resource.NewQuantity(tempDiskBytes, resource.BinarySI)
+}
+
+func isEphemeralOSDiskSupported(sku *skewer.SKU, vmsize *skewer.VMSizeType) bool {
+	return sku.IsEphemeralOSDiskSupported() && vmsize.Series != "Dlds_v5" // Dlds_v5 does not support ephemeral OS disk, contrary to what it claims
 }
 
-func pods(sku *skewer.SKU, kc *corev1beta1.KubeletConfiguration) *resource.Quantity {
-	// TODO: fine-tune pods calc
-	var count int64
-	switch {
-	case kc != nil && kc.MaxPods != nil:
-		count = int64(ptr.Int32Value(kc.MaxPods))
-	default:
-		count = 110
+// EphemeralOSDiskPlacement returns where the OS disk of the AKSNodeClass is placed on the SKU as an ephemeral OS disk,
+// or nil when it does not fit the ephemeral OS disk max size and is a managed disk instead. It is placed on the larger of
+// the cache and the temp disk, which the max size is computed from. The instance provider sets it on the VM, so that the
+// ephemeral-storage capacity, which is computed from it too, matches the VM.
+func EphemeralOSDiskPlacement(sku *skewer.SKU, vmsize *skewer.VMSizeType, nodeClass *v1alpha2.AKSNodeClass) *armcompute.DiffDiskPlacement {
+	if !isEphemeralOSDiskSupported(sku, vmsize) || lo.FromPtr(nodeClass.Spec.OSDiskSizeGB) > int32(MaxEphemeralOSDiskSizeGB(sku)) {
+		return nil
+	}
+	maxCachedDiskBytes, _ := sku.MaxCachedDiskBytes()
+	if tempDiskBytes(sku) > maxCachedDiskBytes {
+		return lo.ToPtr(armcompute.DiffDiskPlacementResourceDisk)
 	}
+	return lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)
+}
+
+// tempDiskBytes returns the size of the temp (resource) disk of the SKU, 0 if it has none
+func tempDiskBytes(sku *skewer.SKU) int64 {
+	maxResourceVolumeMB, err := sku.MaxResourceVolumeMB() // NOTE: this is a misnomer, MB is actually MiB
+	if err != nil {
+		return 0
+	}
+	return maxResourceVolumeMB * int64(units.Mebibyte)
+}
+
+// HasTempDisk returns whether the instance type has a temp disk, which the AKSNodeClass can place the kubelet root
+// directory on. The bootstrap must only do so when this is true, to agree with the ephemeral-storage capacity.
+func HasTempDisk(instanceType *cloudprovider.InstanceType) bool {
+	return instanceType != nil && len(instanceType.Requirements.Get(v1alpha2.LabelSKUStorageTempDiskSize).Values()) > 0
+}
+
+func pods(ctx context.Context, sku *skewer.SKU, kc *corev1beta1.KubeletConfiguration, nodeClass *v1alpha2.AKSNodeClass) *resource.Quantity {
+	count := int64(MaxPods(ctx, kc, nodeClass))
 	if kc != nil && ptr.Int32Value(kc.PodsPerCore) > 0 {
 		count = lo.Min([]int64{int64(ptr.Int32Value(kc.PodsPerCore)) * cpu(sku).Value(), count})
 	}
 	return resources.Quantity(fmt.Sprint(count))
 }
 
+// MaxPods returns the max pods of nodes, the kubelet --max-pods as well as the upper bound of the pods capacity:
+// the NodePool kubelet maxPods, or else the AKSNodeClass maxPods, or else the AKS default for the network plugin
+// and mode of the cluster
+func MaxPods(ctx context.Context, kc *corev1beta1.KubeletConfiguration, nodeClass *v1alpha2.AKSNodeClass) int32 {
+	if kc != nil && kc.MaxPods != nil {
+		return *kc.MaxPods
+	}
+	if nodeClass.Spec.MaxPods != nil {
+		return *nodeClass.Spec.MaxPods
+	}
+	opts := options.FromContext(ctx)
+	switch {
+	case opts.IsAzureCNINodeSubnet():
+		return defaultMaxPodsAzureNodeSubnet
+	case opts.NetworkPlugin == options.NetworkPluginAzure:
+		return defaultMaxPodsAzure
+	case opts.NetworkPlugin == options.NetworkPluginKubenet:
+		return defaultMaxPodsKubenet
+	default:
+		return defaultMaxPods
+	}
+}
+
 func SystemReservedResources() v1.ResourceList {
 	// AKS does not set system-reserved values and only CPU and memory are considered
 	// https://learn.microsoft.com/en-us/azure/aks/concepts-clusters-workloads#resource-reservations
@@ -334,9 +475,21 @@ func SystemReservedResources() v1.ResourceList {
 	}
 }
 
-func KubeReservedResources(vcpus int64, memoryGib float64) v1.ResourceList {
-	reservedMemoryMi := int64(1024 * reservedMemoryTaxGi.Calculate(memoryGib))
-	reservedCPUMilli := int64(1000 * reservedCPUTaxVCPU.Calculate(float64(vcpus)))
+// KubeReservedResources returns the kube-reserved resources of nodes, as computed by the kube-reserved policy
+func KubeReservedResources(ctx context.Context, vcpus int64, memoryGib float64, maxPods int32) v1.ResourceList {
+	opts := options.FromContext(ctx)
+	memoryTax, cpuTax := reservedMemoryTaxGi, reservedCPUTaxVCPU
+	if opts.KubeReservedPolicy == options.KubeReservedPolicyCustom {
+		memoryTax = lo.Ternary(len(opts.KubeReservedMemoryBrackets) > 0, TaxBrackets(opts.KubeReservedMemoryBrackets), memoryTax)
+		cpuTax = lo.Ternary(len(opts.KubeReservedCPUBrackets) > 0, TaxBrackets(opts.KubeReservedCPUBrackets), cpuTax)
+	}
+
+	reservedMemoryMi := int64(1024 * memoryTax.Calculate(memoryGib))
+	if opts.KubeReservedPolicy == options.KubeReservedPolicyAKS {
+		// https://learn.microsoft.com/en-us/azure/aks/node-resource-reservations#memory-reservations
+		reservedMemoryMi = lo.Min([]int64{20*int64(maxPods) + 50, int64(1024 * memoryGib * .25)})
+	}
+	reservedCPUMilli := int64(1000 * cpuTax.Calculate(float64(vcpus)))
 
 	resources := v1.ResourceList{
 		v1.ResourceCPU:    *resource.NewScaledQuantity(reservedCPUMilli, resource.Milli),
@@ -346,8 +499,13 @@ func KubeReservedResources(vcpus int64, memoryGib float64) v1.ResourceList {
 	return resources
 }
 
-func EvictionThreshold() v1.ResourceList {
+// EvictionThreshold returns the hard eviction threshold of nodes, which AKS lowered along with the memory reservation in 1.29
+func EvictionThreshold(ctx context.Context) v1.ResourceList {
+	memoryAvailable := DefaultMemoryAvailable
+	if options.FromContext(ctx).KubeReservedPolicy == options.KubeReservedPolicyAKS {
+		memoryAvailable = AKSMemoryAvailable
+	}
 	return v1.ResourceList{
-		v1.ResourceMemory: resource.MustParse(DefaultMemoryAvailable),
+		v1.ResourceMemory: resource.MustParse(memoryAvailable),
 	}
 }
@@ -0,0 +1,115 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	//nolint SA1019 - deprecated package
+	"github.com/Azure/skewer"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+func TestSetRequirementsCPUManufacturer(t *testing.T) {
+	cases := []struct {
+		name         string
+		vmSize       string
+		architecture string
+		expected     string
+	}{
+		{name: "Intel based x64 size", vmSize: "D2s_v3", architecture: "x64", expected: v1alpha2.ManufacturerIntel},
+		{name: "AMD based x64 size with the 'a' additive feature", vmSize: "D2as_v5", architecture: "x64", expected: v1alpha2.ManufacturerAMD},
+		{name: "AMD based x64 size without the 'a' additive feature", vmSize: "HB120rs_v3", architecture: "x64", expected: v1alpha2.ManufacturerAMD},
+		{name: "x64 size on mixed hardware", vmSize: "A2_v2", architecture: "x64"},
+		{name: "Ampere based Arm64 size", vmSize: "D2ps_v5", architecture: "Arm64", expected: v1alpha2.ManufacturerAmpere},
+		{name: "Azure Cobalt based Arm64 size", vmSize: "D2ps_v6", architecture: "Arm64", expected: v1alpha2.ManufacturerMicrosoft},
+		{name: "Arm64 size of an unknown version", vmSize: "D2ps_v7", architecture: "Arm64"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sku := &skewer.SKU{Size: lo.ToPtr(c.vmSize)}
+			vmsize, err := sku.GetVMSize()
+			assert.NoError(t, err)
+			requirements := scheduling.NewRequirements(scheduling.NewRequirement(v1alpha2.LabelSKUCPUManufacturer, v1.NodeSelectorOpDoesNotExist))
+			setRequirementsCPUManufacturer(requirements, vmsize, c.architecture)
+			if c.expected == "" {
+				assert.Equal(t, v1.NodeSelectorOpDoesNotExist, requirements.Get(v1alpha2.LabelSKUCPUManufacturer).Operator())
+			} else {
+				assert.ElementsMatch(t, []string{c.expected}, requirements.Get(v1alpha2.LabelSKUCPUManufacturer).Values())
+			}
+		})
+	}
+}
+
+func TestSetRequirementsSpotEvictionRate(t *testing.T) {
+	newRequirements := func() scheduling.Requirements {
+		return scheduling.NewRequirements(scheduling.NewRequirement(v1alpha2.LabelSKUSpotEvictionRate, v1.NodeSelectorOpDoesNotExist))
+	}
+	spot := cloudprovider.Offering{CapacityType: corev1beta1.CapacityTypeSpot, Zone: "eastus-1", Available: true}
+	onDemand := cloudprovider.Offering{CapacityType: corev1beta1.CapacityTypeOnDemand, Zone: "eastus-1", Available: true}
+
+	requirements := newRequirements()
+	setRequirementsSpotEvictionRate(requirements, cloudprovider.Offerings{spot, onDemand}, lo.ToPtr(5))
+	assert.ElementsMatch(t, []string{"5"}, requirements.Get(v1alpha2.LabelSKUSpotEvictionRate).Values())
+
+	requirements = newRequirements()
+	setRequirementsSpotEvictionRate(requirements, cloudprovider.Offerings{spot}, nil)
+	assert.Equal(t, v1.NodeSelectorOpDoesNotExist, requirements.Get(v1alpha2.LabelSKUSpotEvictionRate).Operator())
+
+	// the eviction rate is only set on instance types with spot offerings
+	requirements = newRequirements()
+	spot.Available = false
+	setRequirementsSpotEvictionRate(requirements, cloudprovider.Offerings{spot, onDemand}, lo.ToPtr(5))
+	assert.Equal(t, v1.NodeSelectorOpDoesNotExist, requirements.Get(v1alpha2.LabelSKUSpotEvictionRate).Operator())
+}
+
+func TestEphemeralOSDiskPlacement(t *testing.T) {
+	newSKU := func(cachedDiskBytes, maxResourceVolumeMB string) *skewer.SKU {
+		return &skewer.SKU{Size: lo.ToPtr("D8s_v3"), Capabilities: &[]compute.ResourceSkuCapabilities{
+			{Name: lo.ToPtr(skewer.EphemeralOSDisk), Value: lo.ToPtr("True")},
+			{Name: lo.ToPtr(skewer.CachedDiskBytes), Value: lo.ToPtr(cachedDiskBytes)},
+			{Name: lo.ToPtr(skewer.MaxResourceVolumeMB), Value: lo.ToPtr(maxResourceVolumeMB)},
+		}}
+	}
+	cases := []struct {
+		name         string
+		sku          *skewer.SKU
+		osDiskSizeGB int32
+		expected     *armcompute.DiffDiskPlacement
+	}{
+		{name: "cache disk larger than the temp disk", sku: newSKU("214748364800", "65536"), osDiskSizeGB: 128, expected: lo.ToPtr(armcompute.DiffDiskPlacementCacheDisk)},
+		{name: "temp disk larger than the cache disk", sku: newSKU("107374182400", "360448"), osDiskSizeGB: 128, expected: lo.ToPtr(armcompute.DiffDiskPlacementResourceDisk)},
+		{name: "OS disk larger than both", sku: newSKU("107374182400", "65536"), osDiskSizeGB: 128},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vmsize, err := c.sku.GetVMSize()
+			assert.NoError(t, err)
+			nodeClass := &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{OSDiskSizeGB: lo.ToPtr(c.osDiskSizeGB)}}
+			assert.Equal(t, c.expected, EphemeralOSDiskPlacement(c.sku, vmsize, nodeClass))
+		})
+	}
+}
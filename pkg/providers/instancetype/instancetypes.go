@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"path"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -30,15 +31,21 @@ import (
 	"github.com/samber/lo"
 
 	agentbakercommon "github.com/Azure/agentbaker/pkg/agent/common"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	kcache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/patrickmn/go-cache"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/logging"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/skuclient"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/quota"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotadvisor"
 
 	"github.com/Azure/skewer"
 	"github.com/alecthomas/units"
@@ -56,6 +63,8 @@ type Provider struct {
 	region               string
 	skuClient            skuclient.SkuClient
 	pricingProvider      *pricing.Provider
+	quotaProvider        *quota.Provider
+	spotAdvisor          *spotadvisor.Provider
 	unavailableOfferings *kcache.UnavailableOfferings
 
 	// Has one cache entry for all the instance types (key: InstanceTypesCacheKey)
@@ -68,14 +77,19 @@ type Provider struct {
 	cm *pretty.ChangeMonitor
 	// instanceTypesSeqNum is a monotonically increasing change counter used to avoid the expensive hashing operation on instance types
 	instanceTypesSeqNum uint64
+
+	// overheadSettings replace the overhead options of List when the overhead ConfigMap overrides them
+	overheadSettings atomic.Pointer[options.OverheadSettings]
 }
 
-func NewProvider(region string, cache *cache.Cache, skuClient skuclient.SkuClient, pricingProvider *pricing.Provider, offeringsCache *kcache.UnavailableOfferings) *Provider {
+func NewProvider(region string, cache *cache.Cache, skuClient skuclient.SkuClient, pricingProvider *pricing.Provider, quotaProvider *quota.Provider, spotAdvisor *spotadvisor.Provider, offeringsCache *kcache.UnavailableOfferings) *Provider {
 	return &Provider{
 		// TODO: skewer api, subnetprovider, pricing provider, unavailable offerings, ...
 		region:               region,
 		skuClient:            skuClient,
 		pricingProvider:      pricingProvider,
+		quotaProvider:        quotaProvider,
+		spotAdvisor:          spotAdvisor,
 		unavailableOfferings: offeringsCache,
 		cache:                cache,
 		cm:                   pretty.NewChangeMonitor(),
@@ -86,6 +100,9 @@ func NewProvider(region string, cache *cache.Cache, skuClient skuclient.SkuClien
 // Get all instance type options
 func (p *Provider) List(
 	ctx context.Context, kc *corev1beta1.KubeletConfiguration, nodeClass *v1alpha2.AKSNodeClass) ([]*cloudprovider.InstanceType, error) {
+	if overheadSettings := p.overheadSettings.Load(); overheadSettings != nil {
+		ctx = options.ToContext(ctx, options.FromContext(ctx).WithOverheadSettings(*overheadSettings))
+	}
 	// Get SKUs from Azure
 	skus, err := p.getInstanceTypes(ctx)
 	if err != nil {
@@ -94,12 +111,18 @@ func (p *Provider) List(
 
 	// Compute fully initialized instance types hash key
 	kcHash, _ := hashstructure.Hash(kc, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
-	key := fmt.Sprintf("%d-%d-%016x-%s-%d",
-		p.instanceTypesSeqNum,
+	key := fmt.Sprintf("%d-%d-%d-%d-%d-%016x-%s-%d-%t-%t-%d",
+		atomic.LoadUint64(&p.instanceTypesSeqNum),
 		p.unavailableOfferings.SeqNum,
+		p.quotaProvider.SeqNum(),
+		p.pricingProvider.SeqNum(),
+		p.spotAdvisor.SeqNum(),
 		kcHash,
 		to.String(nodeClass.Spec.ImageFamily),
 		to.Int32(nodeClass.Spec.OSDiskSizeGB),
+		nodeClass.Spec.IsFIPSEnabled(),
+		nodeClass.Spec.IsKubeletOnTemporaryDisk(),
+		MaxPods(ctx, kc, nodeClass),
 	)
 	if item, ok := p.cache.Get(key); ok {
 		return item.([]*cloudprovider.InstanceType), nil
@@ -120,7 +143,9 @@ func (p *Provider) List(
 			continue
 		}
 		instanceTypeZones := instanceTypeZones(sku, p.region)
-		instanceType := NewInstanceType(ctx, sku, vmsize, kc, p.region, p.createOfferings(sku, instanceTypeZones), nodeClass, architecture)
+		spotEvictionRate, ok := p.spotAdvisor.EvictionRate(sku.GetName())
+		instanceType := NewInstanceType(ctx, sku, vmsize, kc, p.region, p.createOfferings(sku, vmsize, instanceTypeZones), nodeClass, architecture,
+			lo.Ternary(ok, &spotEvictionRate, nil))
 		if len(instanceType.Offerings) == 0 {
 			continue
 		}
@@ -128,6 +153,10 @@ func (p *Provider) List(
 		if !p.isInstanceTypeSupportedByImageFamily(sku.GetName(), lo.FromPtr(nodeClass.Spec.ImageFamily)) {
 			continue
 		}
+		// FIPS images are only published for amd64
+		if nodeClass.Spec.IsFIPSEnabled() && getArchitecture(architecture) != corev1beta1.ArchitectureAmd64 {
+			continue
+		}
 		result = append(result, instanceType)
 	}
 
@@ -135,6 +164,30 @@ func (p *Provider) List(
 	return result, nil
 }
 
+// SKU returns the SKU of the instance type
+func (p *Provider) SKU(ctx context.Context, instanceTypeName string) (*skewer.SKU, error) {
+	skus, err := p.getInstanceTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sku, ok := skus[instanceTypeName]
+	if !ok {
+		return nil, fmt.Errorf("instance type %s not found", instanceTypeName)
+	}
+	return sku, nil
+}
+
+// SetOverheadSettings sets the overhead options, overridden by the overhead ConfigMap, that instance types are computed
+// with on top of the options of the context, or nil to use the overhead options of the context again. Instance types
+// are recomputed on change, which is returned.
+func (p *Provider) SetOverheadSettings(overheadSettings *options.OverheadSettings) bool {
+	if previous := p.overheadSettings.Swap(overheadSettings); !equality.Semantic.DeepEqual(previous, overheadSettings) {
+		atomic.AddUint64(&p.instanceTypesSeqNum, 1)
+		return true
+	}
+	return false
+}
+
 func (p *Provider) LivenessProbe(req *http.Request) error {
 	return p.pricingProvider.LivenessProbe(req)
 }
@@ -146,21 +199,52 @@ func instanceTypeZones(sku *skewer.SKU, region string) sets.Set[string] {
 	// prefix each zone with "<region>-", to have them match the labels placed on Node (e.g. "westus2-1")
 	// Note this data comes from LocationInfo, then skewer is used to get the SKU info
 	if hasZonalSupport(region) {
+		// skewer leaves out the zones the SKU is restricted in, which still get (unavailable) offerings
 		return sets.New(lo.Map(lo.Keys(sku.AvailabilityZones(region)), func(zone string, _ int) string {
 			return fmt.Sprintf("%s-%s", region, zone)
-		})...)
+		})...).Union(sets.KeySet(zoneRestrictions(sku, region)))
 	}
 
 	return sets.New("") // empty string means non-zonal offering
 }
 
-func (p *Provider) createOfferings(sku *skewer.SKU, zones sets.Set[string]) []cloudprovider.Offering {
+// zoneRestrictions returns the reason codes (e.g. NotAvailableForSubscription) of the zone restrictions
+// of the SKU in the region, by zone in the format of the zone labels of Nodes
+func zoneRestrictions(sku *skewer.SKU, region string) map[string]string {
+	restrictions := map[string]string{}
+	if !hasZonalSupport(region) {
+		return restrictions
+	}
+	for _, restriction := range lo.FromPtr(sku.Restrictions) {
+		if restriction.Type != compute.Zone || restriction.RestrictionInfo == nil ||
+			!lo.ContainsBy(lo.FromPtr(restriction.Values), func(location string) bool { return strings.EqualFold(location, region) }) {
+			continue
+		}
+		for _, zone := range lo.FromPtr(restriction.RestrictionInfo.Zones) {
+			restrictions[fmt.Sprintf("%s-%s", region, zone)] = string(restriction.ReasonCode)
+		}
+	}
+	return restrictions
+}
+
+func (p *Provider) createOfferings(sku *skewer.SKU, vmsize *skewer.VMSizeType, zones sets.Set[string]) []cloudprovider.Offering {
 	offerings := []cloudprovider.Offering{}
+	restrictions := zoneRestrictions(sku, p.region)
+	vcpus, _ := sku.VCPU()
+	onDemandQuota := p.quotaProvider.HasQuota(lo.FromPtr(sku.Family), corev1beta1.CapacityTypeOnDemand, vcpus)
+	spotQuota := p.quotaProvider.HasQuota(lo.FromPtr(sku.Family), corev1beta1.CapacityTypeSpot, vcpus)
+	onDemandPrice, onDemandOk := p.pricingProvider.EffectiveOnDemandPrice(*sku.Name, vmsize.Family)
+	spotPrice, spotOk := p.pricingProvider.EffectiveSpotPrice(*sku.Name, vmsize.Family)
+	if onDemandOk {
+		metrics.InstanceTypeEffectivePrice.WithLabelValues(*sku.Name, corev1beta1.CapacityTypeOnDemand).Set(onDemandPrice)
+	}
+	if spotOk {
+		metrics.InstanceTypeEffectivePrice.WithLabelValues(*sku.Name, corev1beta1.CapacityTypeSpot).Set(spotPrice)
+	}
 	for zone := range zones {
-		onDemandPrice, onDemandOk := p.pricingProvider.OnDemandPrice(*sku.Name)
-		spotPrice, spotOk := p.pricingProvider.SpotPrice(*sku.Name)
-		availableOnDemand := onDemandOk && !p.unavailableOfferings.IsUnavailable(*sku.Name, zone, corev1beta1.CapacityTypeOnDemand)
-		availableSpot := spotOk && !p.unavailableOfferings.IsUnavailable(*sku.Name, zone, corev1beta1.CapacityTypeSpot)
+		_, restricted := restrictions[zone]
+		availableOnDemand := onDemandOk && onDemandQuota && !restricted && !p.unavailableOfferings.IsUnavailable(*sku.Name, zone, corev1beta1.CapacityTypeOnDemand)
+		availableSpot := spotOk && spotQuota && !restricted && !p.unavailableOfferings.IsUnavailable(*sku.Name, zone, corev1beta1.CapacityTypeSpot)
 		offerings = append(offerings, cloudprovider.Offering{Zone: zone, CapacityType: corev1beta1.CapacityTypeSpot, Price: spotPrice, Available: availableSpot})
 		offerings = append(offerings, cloudprovider.Offering{Zone: zone, CapacityType: corev1beta1.CapacityTypeOnDemand, Price: onDemandPrice, Available: availableOnDemand})
 	}
@@ -177,6 +261,9 @@ func (p *Provider) isInstanceTypeSupportedByImageFamily(skuName, imageFamily str
 		return agentbakercommon.IsNvidiaEnabledSKU(skuName)
 	case v1alpha2.AzureLinuxImageFamily:
 		return agentbakercommon.IsMarinerEnabledGPUSKU(skuName)
+	case v1alpha2.CustomImageFamily:
+		// drivers are the responsibility of the custom image and its user data
+		return true
 	default:
 		return false
 	}
@@ -204,6 +291,7 @@ func (p *Provider) getInstanceTypes(ctx context.Context) (map[string]*skewer.SKU
 
 	skus := cache.List(ctx, skewer.ResourceTypeFilter(skewer.VirtualMachines))
 	logging.FromContext(ctx).Debugf("Discovered %d SKUs", len(skus))
+	filteredOut := map[string][]string{} // SKU names by reason
 	for i := range skus {
 		vmsize, err := skus[i].GetVMSize()
 		if err != nil {
@@ -211,30 +299,92 @@ func (p *Provider) getInstanceTypes(ctx context.Context) (map[string]*skewer.SKU
 			continue
 		}
 
-		if !skus[i].HasLocationRestriction(p.region) && p.isSupported(&skus[i], vmsize) {
-			instanceTypes[skus[i].GetName()] = &skus[i]
+		if reason := p.filterReason(ctx, &skus[i], vmsize); reason != "" {
+			filteredOut[reason] = append(filteredOut[reason], skus[i].GetName())
+			continue
 		}
+		instanceTypes[skus[i].GetName()] = &skus[i]
 	}
 
+	metrics.InstanceTypesFilteredCount.Reset()
+	for reason, names := range filteredOut {
+		metrics.InstanceTypesFilteredCount.WithLabelValues(reason).Set(float64(len(names)))
+	}
+	metrics.InstanceTypeZoneRestricted.Reset()
+	for name, sku := range instanceTypes {
+		for zone, reason := range zoneRestrictions(sku, p.region) {
+			metrics.InstanceTypeZoneRestricted.WithLabelValues(name, zone, reason).Set(1)
+		}
+	}
 	if p.cm.HasChanged("instance-types", instanceTypes) {
 		// Only update instanceTypesSeqNun with the instance types have been changed
 		// This is to not create new keys with duplicate instance types option
 		atomic.AddUint64(&p.instanceTypesSeqNum, 1)
 		logging.FromContext(ctx).With(
 			"count", len(instanceTypes)).Debugf("discovered instance types")
+		for reason, names := range filteredOut {
+			logging.FromContext(ctx).With("reason", reason, "instance-types", names).Debugf("filtered out instance types")
+		}
+		for name, sku := range instanceTypes {
+			if restrictions := zoneRestrictions(sku, p.region); len(restrictions) > 0 {
+				logging.FromContext(ctx).With("instance-type", name, "restrictions", restrictions).Debugf("instance type is restricted in zones")
+			}
+		}
 	}
 	p.cache.SetDefault(InstanceTypesCacheKey, instanceTypes)
 	return instanceTypes, nil
 }
 
-// isSupported indicates SKU is supported by AKS, based on SKU properties
-func (p *Provider) isSupported(sku *skewer.SKU, vmsize *skewer.VMSizeType) bool {
-	return p.hasMinimumCPU(sku) &&
-		p.hasMinimumMemory(sku) &&
-		!p.isUnsupportedByAKS(sku) &&
-		!p.isUnsupportedGPU(sku) &&
-		!p.hasConstrainedCPUs(vmsize) &&
-		!p.isConfidential(sku)
+// reasons SKUs are filtered out of the instance types
+const (
+	filterReasonLocationRestricted = "location-restricted"
+	filterReasonMinimumCPU         = "minimum-cpu"
+	filterReasonMinimumMemory      = "minimum-memory"
+	filterReasonUnsupportedByAKS   = "unsupported-by-aks"
+	filterReasonUnsupportedGPU     = "unsupported-gpu"
+	filterReasonConfidential       = "confidential"
+	filterReasonConstrainedCPU     = "constrained-cpu"
+	filterReasonBurstable          = "burstable"
+	filterReasonNotIncluded        = "not-included"
+	filterReasonExcluded           = "excluded"
+)
+
+// filterReason returns why the SKU is not offered as an instance type: because AKS does not support it,
+// based on SKU properties, or because of the instance type policy of the options; empty if it is offered
+func (p *Provider) filterReason(ctx context.Context, sku *skewer.SKU, vmsize *skewer.VMSizeType) string {
+	opts := options.FromContext(ctx)
+	switch {
+	case sku.HasLocationRestriction(p.region):
+		return filterReasonLocationRestricted
+	case !p.hasMinimumCPU(sku):
+		return filterReasonMinimumCPU
+	case !p.hasMinimumMemory(sku):
+		return filterReasonMinimumMemory
+	case p.isUnsupportedByAKS(sku):
+		return filterReasonUnsupportedByAKS
+	case p.isUnsupportedGPU(sku):
+		return filterReasonUnsupportedGPU
+	case p.isConfidential(sku):
+		return filterReasonConfidential
+	case p.hasConstrainedCPUs(vmsize) && !opts.AllowConstrainedCPUInstanceTypes:
+		return filterReasonConstrainedCPU
+	case p.isBurstable(vmsize) && !opts.AllowBurstableInstanceTypes:
+		return filterReasonBurstable
+	case len(opts.InstanceTypesInclude) > 0 && !matchesAny(opts.InstanceTypesInclude, sku.GetName()),
+		len(opts.SKUFamiliesInclude) > 0 && !matchesAny(opts.SKUFamiliesInclude, vmsize.Family):
+		return filterReasonNotIncluded
+	case matchesAny(opts.InstanceTypesExclude, sku.GetName()), matchesAny(opts.SKUFamiliesExclude, vmsize.Family):
+		return filterReasonExcluded
+	}
+	return ""
+}
+
+// matchesAny returns whether the value matches any of the globs, malformed ones (rejected by the options) match nothing
+func matchesAny(globs []string, value string) bool {
+	return lo.SomeBy(globs, func(glob string) bool {
+		matched, _ := path.Match(glob, value)
+		return matched
+	})
 }
 
 // at least 2 cpus
@@ -269,6 +419,11 @@ func (p *Provider) hasConstrainedCPUs(vmsize *skewer.VMSizeType) bool {
 	return vmsize.CpusConstrained != nil
 }
 
+// burstable B-series SKUs
+func (p *Provider) isBurstable(vmsize *skewer.VMSizeType) bool {
+	return vmsize.Family == "B"
+}
+
 // confidential VMs (DC, EC) are not yet supported by this Karpenter provider
 func (p *Provider) isConfidential(sku *skewer.SKU) bool {
 	size := sku.GetSize()
@@ -22,6 +22,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strings"
 	"testing"
@@ -29,6 +30,7 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -55,13 +57,17 @@ import (
 
 	agentbakercommon "github.com/Azure/agentbaker/pkg/agent/common"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	//nolint SA1019 - deprecated package
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/cloudprovider"
 	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/quota"
 	"github.com/Azure/karpenter-provider-azure/pkg/test"
 	. "github.com/Azure/karpenter-provider-azure/pkg/test/expectations"
 )
@@ -74,6 +80,7 @@ var fakeClock *clock.FakeClock
 var coreProvisioner, coreProvisionerNonZonal *provisioning.Provisioner
 var cluster, clusterNonZonal *state.Cluster
 var cloudProvider, cloudProviderNonZonal *cloudprovider.CloudProvider
+var recorder *coretest.EventRecorder
 
 func TestAzure(t *testing.T) {
 	ctx = TestContextWithLogger(t)
@@ -89,7 +96,8 @@ func TestAzure(t *testing.T) {
 	azureEnvNonZonal = test.NewEnvironmentNonZonal(ctx, env)
 
 	fakeClock = &clock.FakeClock{}
-	cloudProvider = cloudprovider.New(azureEnv.InstanceTypesProvider, azureEnv.InstanceProvider, events.NewRecorder(&record.FakeRecorder{}), env.Client, azureEnv.ImageProvider)
+	recorder = coretest.NewEventRecorder()
+	cloudProvider = cloudprovider.New(azureEnv.InstanceTypesProvider, azureEnv.InstanceProvider, recorder, env.Client, azureEnv.ImageProvider)
 	cloudProviderNonZonal = cloudprovider.New(azureEnvNonZonal.InstanceTypesProvider, azureEnvNonZonal.InstanceProvider, events.NewRecorder(&record.FakeRecorder{}), env.Client, azureEnvNonZonal.ImageProvider)
 
 	cluster = state.NewCluster(fakeClock, env.Client, cloudProvider)
@@ -111,8 +119,10 @@ var _ = AfterSuite(func() {
 var _ = Describe("InstanceType Provider", func() {
 	var nodeClass *v1alpha2.AKSNodeClass
 	var nodePool *corev1beta1.NodePool
+	var originalOptions *options.Options
 
 	BeforeEach(func() {
+		originalOptions = options.FromContext(ctx)
 		nodeClass = test.AKSNodeClass()
 		nodePool = coretest.NodePool(corev1beta1.NodePool{
 			Spec: corev1beta1.NodePoolSpec{
@@ -130,9 +140,11 @@ var _ = Describe("InstanceType Provider", func() {
 		clusterNonZonal.Reset()
 		azureEnv.Reset()
 		azureEnvNonZonal.Reset()
+		recorder.Reset()
 	})
 
 	AfterEach(func() {
+		ctx = options.ToContext(ctx, originalOptions)
 		ExpectCleanedUp(ctx, env.Client)
 	})
 
@@ -197,8 +209,7 @@ var _ = Describe("InstanceType Provider", func() {
 			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
 			ExpectScheduled(ctx, env.Client, pod)
 		})
-		It("should fail to provision when LowPriorityCoresQuota errors are hit, then switch capacity type and succeed", func() {
-			LowPriorityCoresQuotaErrorMessage := "Operation could not be completed as it results in exceeding approved Low Priority Cores quota. Additional details - Deployment Model: Resource Manager, Location: westus2, Current Limit: 0, Current Usage: 0, Additional Required: 32, (Minimum) New Limit Required: 32. Submit a request for Quota increase at https://aka.ms/ProdportalCRP/#blade/Microsoft_Azure_Capacity/UsageAndQuota.ReactView/Parameters/%7B%22subscriptionId%22:%(redacted)%22,%22command%22:%22openQuotaApprovalBlade%22,%22quotas%22:[%7B%22location%22:%22westus2%22,%22providerId%22:%22Microsoft.Compute%22,%22resourceName%22:%22LowPriorityCores%22,%22quotaRequest%22:%7B%22properties%22:%7B%22limit%22:32,%22unit%22:%22Count%22,%22name%22:%7B%22value%22:%22LowPriorityCores%22%7D%7D%7D%7D]%7D by specifying parameters listed in the ‘Details’ section for deployment to succeed. Please read more about quota limits at https://docs.microsoft.com/en-us/azure/azure-supportability/per-vm-quota-requests"
+		It("should fall back to on-demand in the same launch when LowPriorityCoresQuota errors are hit", func() {
 			// Create nodepool that has both ondemand and spot capacity types enabled
 			coretest.ReplaceRequirements(nodePool, corev1beta1.NodeSelectorRequirementWithMinValues{
 				NodeSelectorRequirement: v1.NodeSelectorRequirement{
@@ -208,27 +219,15 @@ var _ = Describe("InstanceType Provider", func() {
 				}})
 			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
 			// Set the LowPriorityCoresQuota error to be returned when creating the vm
-			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(
-				&azcore.ResponseError{
-					ErrorCode: sdkerrors.OperationNotAllowed,
-					RawResponse: &http.Response{
-						Body: createSDKErrorBody(sdkerrors.OperationNotAllowed, LowPriorityCoresQuotaErrorMessage),
-					},
-				},
-			)
-			// Create a pod that should fail to schedule
+			azureEnv.VirtualMachinesAPI.VirtualMachinesBehavior.VirtualMachineCreateOrUpdateBehavior.Error.Set(lowPriorityCoresQuotaError())
 			pod := coretest.UnschedulablePod()
 			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
-			ExpectNotScheduled(ctx, env.Client, pod)
-			azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.BeginError.Set(nil)
-			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
-			ExpectScheduled(ctx, env.Client, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
 
 			// Expect that on-demand nodes are selected if spot capacity is unavailable, and the nodepool uses both spot + on-demand
-			nodes, err := env.KubernetesInterface.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(len(nodes.Items)).To(Equal(1))
-			Expect(nodes.Items[0].Labels[corev1beta1.CapacityTypeLabelKey]).To(Equal(corev1beta1.CapacityTypeOnDemand))
+			Expect(node.Labels[corev1beta1.CapacityTypeLabelKey]).To(Equal(corev1beta1.CapacityTypeOnDemand))
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.FailedCalls()).To(Equal(1))
+			Expect(recorder.Calls("SpotToOnDemandFallback")).To(Equal(1))
 		})
 
 		It("should fail to provision when VM SKU family vCPU quota exceeded error is returned, and succeed when it is gone", func() {
@@ -342,7 +341,78 @@ var _ = Describe("InstanceType Provider", func() {
 		It("should not include confidential SKUs", func() {
 			Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_DC8s_v3"))))
 		})
+		It("should count the filtered out SKUs by reason", func() {
+			Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("minimum-cpu"))).To(BeNumerically("==", 2)) // Standard_A0, Standard_B1s
+			Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("constrained-cpu"))).To(BeNumerically("==", 1))
+			Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("confidential"))).To(BeNumerically("==", 1))
+		})
+
+		Context("Instance Type Policy", func() {
+			listWithOptions := func(optionsFields test.OptionsFields) corecloudprovider.InstanceTypes {
+				GinkgoHelper()
+				ctx = options.ToContext(ctx, test.Options(optionsFields))
+				azureEnv.InstanceTypeCache.Flush()
+				instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+				Expect(err).ToNot(HaveOccurred())
+				return instanceTypes
+			}
+
+			It("should include SKUs with constrained CPUs when allowed", func() {
+				instanceTypes := listWithOptions(test.OptionsFields{AllowConstrainedCPUInstanceTypes: lo.ToPtr(true)})
+				Expect(instanceTypes).Should(ContainElement(WithTransform(getName, Equal("Standard_M8-2ms"))))
+				Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("constrained-cpu"))).To(BeNumerically("==", 0))
+			})
+			Context("Burstable", func() {
+				BeforeEach(func() {
+					// The recorded B-series SKU, Standard_B1s, is filtered out for its single vCPU, add a larger one
+					skus := fake.ResourceSkus[fake.Region]
+					DeferCleanup(func() { fake.ResourceSkus[fake.Region] = skus })
+					b1s, ok := lo.Find(skus, func(sku compute.ResourceSku) bool { return lo.FromPtr(sku.Name) == "Standard_B1s" })
+					Expect(ok).To(BeTrue())
+					b2s := b1s
+					b2s.Name = lo.ToPtr("Standard_B2s")
+					b2s.Size = lo.ToPtr("B2s")
+					b2s.Capabilities = lo.ToPtr(lo.Map(*b1s.Capabilities, func(capability compute.ResourceSkuCapabilities, _ int) compute.ResourceSkuCapabilities {
+						switch lo.FromPtr(capability.Name) {
+						case "vCPUs", "vCPUsAvailable":
+							capability.Value = lo.ToPtr("2")
+						case "MemoryGB":
+							capability.Value = lo.ToPtr("4")
+						}
+						return capability
+					}))
+					fake.ResourceSkus[fake.Region] = append(append([]compute.ResourceSku{}, skus...), b2s)
+				})
 
+				It("should include burstable SKUs by default", func() {
+					instanceTypes := listWithOptions(test.OptionsFields{})
+					Expect(instanceTypes).Should(ContainElement(WithTransform(getName, Equal("Standard_B2s"))))
+					Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("burstable"))).To(BeNumerically("==", 0))
+				})
+				It("should not include burstable SKUs when not allowed", func() {
+					instanceTypes := listWithOptions(test.OptionsFields{AllowBurstableInstanceTypes: lo.ToPtr(false)})
+					Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, Equal("Standard_B2s"))))
+					Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("burstable"))).To(BeNumerically("==", 1))
+				})
+			})
+			It("should only include the SKUs matching the include globs", func() {
+				instanceTypes := listWithOptions(test.OptionsFields{InstanceTypesInclude: []string{"Standard_D*s_v3"}})
+				Expect(lo.Map(instanceTypes, func(instanceType *corecloudprovider.InstanceType, _ int) string { return instanceType.Name })).To(
+					ConsistOf("Standard_D2s_v3", "Standard_D4s_v3", "Standard_D64s_v3"))
+			})
+			It("should not include the SKUs matching the exclude globs", func() {
+				instanceTypes := listWithOptions(test.OptionsFields{InstanceTypesExclude: []string{"Standard_*_v2"}})
+				Expect(instanceTypes).ShouldNot(ContainElement(WithTransform(getName, HaveSuffix("_v2"))))
+				Expect(instanceTypes).Should(ContainElement(WithTransform(getName, Equal("Standard_D2_v3"))))
+				Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("excluded"))).To(BeNumerically(">", 0))
+			})
+			It("should only include the SKU families matching the include globs, less the excluded ones", func() {
+				instanceTypes := listWithOptions(test.OptionsFields{SKUFamiliesInclude: []string{"D", "N"}, SKUFamiliesExclude: []string{"N"}})
+				Expect(instanceTypes).ToNot(BeEmpty())
+				Expect(instanceTypes).Should(HaveEach(WithTransform(getName, HavePrefix("Standard_D"))))
+				Expect(testutil.ToFloat64(metrics.InstanceTypesFilteredCount.WithLabelValues("not-included"))).To(BeNumerically("==", 1)) // Standard_F16s_v2
+			})
+		})
 	})
 	Context("Filtering GPU SKUs ProviderList(AzureLinux)", func() {
 		var instanceTypes corecloudprovider.InstanceTypes
@@ -392,6 +462,30 @@ var _ = Describe("InstanceType Provider", func() {
 			// should have local disk attached
 			Expect(vm.Properties.StorageProfile.OSDisk.DiffDiskSettings).NotTo(BeNil())
 			Expect(lo.FromPtr(vm.Properties.StorageProfile.OSDisk.DiffDiskSettings.Option)).To(Equal(armcompute.DiffDiskOptionsLocal))
+			Expect(lo.FromPtr(vm.Properties.StorageProfile.OSDisk.DiffDiskSettings.Placement)).To(Equal(armcompute.DiffDiskPlacementCacheDisk))
+		})
+		It("should place the ephemeral disk on the temp disk when it is larger than the cache disk", func() {
+			// SKU Standard_NC16as_T4_v3 has 352GiB of Temp Disk space and 144GiB of CacheDisk space
+			np := coretest.NodePool()
+			np.Spec.Template.Spec.Requirements = append(np.Spec.Template.Spec.Requirements, corev1beta1.NodeSelectorRequirementWithMinValues{
+				NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      "node.kubernetes.io/instance-type",
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{"Standard_NC16as_T4_v3"},
+				}})
+			np.Spec.Template.Spec.NodeClassRef = &corev1beta1.NodeClassReference{
+				Name: nodeClass.Name,
+			}
+
+			ExpectApplied(ctx, env.Client, np, nodeClass)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			Expect(vm).NotTo(BeNil())
+			Expect(vm.Properties.StorageProfile.OSDisk.DiffDiskSettings).NotTo(BeNil())
+			Expect(lo.FromPtr(vm.Properties.StorageProfile.OSDisk.DiffDiskSettings.Placement)).To(Equal(armcompute.DiffDiskPlacementResourceDisk))
 		})
 
 		It("should use ephemeral disk if supported, and set disk size to OSDiskSizeGB from node class", func() {
@@ -449,6 +543,35 @@ var _ = Describe("InstanceType Provider", func() {
 		})
 	})
 
+	Context("Ephemeral Storage", func() {
+		ephemeralStorage := func(instanceTypes corecloudprovider.InstanceTypes, name string) string {
+			instanceType, ok := lo.Find(instanceTypes, func(it *corecloudprovider.InstanceType) bool { return it.Name == name })
+			Expect(ok).To(BeTrue())
+			return instanceType.Capacity.StorageEphemeral().String()
+		}
+
+		It("should report the OS disk size by default", func() {
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			for _, instanceType := range instanceTypes {
+				Expect(instanceType.Capacity.StorageEphemeral().String()).To(Equal("128Gi"))
+			}
+		})
+		It("should report the temp disk size when the kubelet is on the temp disk", func() {
+			nodeClass.Spec.KubeletDiskType = lo.ToPtr(v1alpha2.KubeletDiskTypeTemporary)
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			// ephemeral OS disk on the (larger) cache disk, the whole 16GiB temp disk is available
+			Expect(ephemeralStorage(instanceTypes, "Standard_D2s_v3")).To(Equal("16Gi"))
+			// managed OS disk, the whole 100GiB temp disk is available
+			Expect(ephemeralStorage(instanceTypes, "Standard_D2_v2")).To(Equal("100Gi"))
+			// ephemeral OS disk on the (larger) 352GiB temp disk, which it shares with the kubelet
+			Expect(ephemeralStorage(instanceTypes, "Standard_NC16as_T4_v3")).To(Equal("224Gi"))
+			// no temp disk, the kubelet stays on the OS disk
+			Expect(ephemeralStorage(instanceTypes, "Standard_D2_v5")).To(Equal("128Gi"))
+		})
+	})
+
 	Context("Nodepool with KubeletConfig", func() {
 		It("should support provisioning with kubeletConfig, computeResources and maxPods not specified", func() {
 			nodePool.Spec.Template.Spec.Kubelet = &corev1beta1.KubeletConfiguration{
@@ -499,10 +622,7 @@ var _ = Describe("InstanceType Provider", func() {
 	})
 
 	Context("Nodepool with KubeletConfig on a kubenet Cluster", func() {
-		var originalOptions *options.Options
-
 		BeforeEach(func() {
-			originalOptions = options.FromContext(ctx)
 			ctx = options.ToContext(
 				ctx,
 				test.Options(test.OptionsFields{
@@ -510,10 +630,6 @@ var _ = Describe("InstanceType Provider", func() {
 				}))
 		})
 
-		AfterEach(func() {
-			ctx = options.ToContext(ctx, originalOptions)
-		})
-
 		It("should support provisioning with kubeletConfig, computeResources and maxPods not specified", func() {
 			nodePool.Spec.Template.Spec.Kubelet = &corev1beta1.KubeletConfiguration{
 				PodsPerCore: lo.ToPtr(int32(110)),
@@ -554,7 +670,7 @@ var _ = Describe("InstanceType Provider", func() {
 			Expect(kubeletFlags).To(ContainSubstring("--eviction-hard=memory.available<750Mi")) // AKS default
 			Expect(kubeletFlags).To(ContainSubstring("--eviction-soft=memory.available<1Gi"))
 			Expect(kubeletFlags).To(ContainSubstring("--eviction-soft-grace-period=memory.available=10s"))
-			Expect(kubeletFlags).To(ContainSubstring("--max-pods=100")) // networkPlugin=kubenet
+			Expect(kubeletFlags).To(ContainSubstring("--max-pods=15"))
 			Expect(kubeletFlags).To(ContainSubstring("--pods-per-core=110"))
 			Expect(kubeletFlags).To(ContainSubstring("--image-gc-low-threshold=20"))
 			Expect(kubeletFlags).To(ContainSubstring("--image-gc-high-threshold=30"))
@@ -613,7 +729,7 @@ var _ = Describe("InstanceType Provider", func() {
 			Expect(kubeletFlags).To(ContainSubstring("--eviction-hard=memory.available<750Mi")) // AKS default
 			Expect(kubeletFlags).To(ContainSubstring("--eviction-soft=memory.available<1Gi"))
 			Expect(kubeletFlags).To(ContainSubstring("--eviction-soft-grace-period=memory.available=10s"))
-			Expect(kubeletFlags).To(ContainSubstring("--max-pods=100")) // networkPlugin=kubenet
+			Expect(kubeletFlags).To(ContainSubstring("--max-pods=15"))
 			Expect(kubeletFlags).To(ContainSubstring("--pods-per-core=110"))
 			Expect(kubeletFlags).To(ContainSubstring("--image-gc-low-threshold=20"))
 			Expect(kubeletFlags).To(ContainSubstring("--image-gc-high-threshold=30"))
@@ -621,6 +737,383 @@ var _ = Describe("InstanceType Provider", func() {
 		})
 	})
 
+	Context("Max Pods", func() {
+		getKubeletFlags := func() string {
+			GinkgoHelper()
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			decodedBytes, err := base64.StdEncoding.DecodeString(*vm.Properties.OSProfile.CustomData)
+			Expect(err).To(Succeed())
+			decodedString := string(decodedBytes[:])
+			return decodedString[strings.Index(decodedString, "KUBELET_FLAGS=")+len("KUBELET_FLAGS="):]
+		}
+
+		It("should use the network plugin default for both the pods capacity and the kubelet", func() {
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			for _, instanceType := range instanceTypes {
+				Expect(instanceType.Capacity.Pods().Value()).To(Equal(int64(250)))
+			}
+
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(getKubeletFlags()).To(ContainSubstring("--max-pods=250")) // networkPlugin=azure, networkPluginMode=overlay
+			nic := azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Pop()
+			Expect(nic.Interface.Properties.IPConfigurations).To(HaveLen(1))
+		})
+		It("should use the AKSNodeClass maxPods for both the pods capacity and the kubelet", func() {
+			nodeClass.Spec.MaxPods = lo.ToPtr(int32(50))
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			for _, instanceType := range instanceTypes {
+				Expect(instanceType.Capacity.Pods().Value()).To(Equal(int64(50)))
+			}
+
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(getKubeletFlags()).To(ContainSubstring("--max-pods=50"))
+		})
+		It("should use the NodePool kubelet maxPods over the AKSNodeClass maxPods for both the pods capacity and the kubelet", func() {
+			nodeClass.Spec.MaxPods = lo.ToPtr(int32(50))
+			nodePool.Spec.Template.Spec.Kubelet = &corev1beta1.KubeletConfiguration{MaxPods: lo.ToPtr(int32(40))}
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, nodePool.Spec.Template.Spec.Kubelet, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			for _, instanceType := range instanceTypes {
+				Expect(instanceType.Capacity.Pods().Value()).To(Equal(int64(40)))
+			}
+
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(getKubeletFlags()).To(ContainSubstring("--max-pods=40"))
+		})
+		It("should default to 30 and reserve pod IPs on the NIC for Azure CNI with pod IPs from the node subnet", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				NetworkPluginMode: lo.ToPtr(""),
+			}))
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			for _, instanceType := range instanceTypes {
+				Expect(instanceType.Capacity.Pods().Value()).To(Equal(int64(30)))
+			}
+
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(getKubeletFlags()).To(ContainSubstring("--max-pods=30"))
+			nic := azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Pop()
+			Expect(nic.Interface.Properties.IPConfigurations).To(HaveLen(31))
+			Expect(lo.FromPtr(nic.Interface.Properties.IPConfigurations[0].Properties.Primary)).To(BeTrue())
+			for _, ipConfiguration := range nic.Interface.Properties.IPConfigurations[1:] {
+				Expect(lo.FromPtr(ipConfiguration.Properties.Primary)).To(BeFalse())
+				Expect(ipConfiguration.Properties.Subnet.ID).To(Equal(nic.Interface.Properties.IPConfigurations[0].Properties.Subnet.ID))
+			}
+		})
+		It("should default to 250 and not reserve pod IPs on the NIC for Azure CNI with a pod subnet", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				NetworkPluginMode: lo.ToPtr(""),
+				PodSubnetID:       lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpenterpodsub"),
+			}))
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(getKubeletFlags()).To(ContainSubstring("--max-pods=250"))
+			nic := azureEnv.NetworkInterfacesAPI.NetworkInterfacesCreateOrUpdateBehavior.CalledWithInput.Pop()
+			Expect(nic.Interface.Properties.IPConfigurations).To(HaveLen(1))
+		})
+	})
+
+	Context("Overhead", func() {
+		getInstanceType := func(name string) *corecloudprovider.InstanceType {
+			GinkgoHelper()
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			instanceType, ok := lo.Find(instanceTypes, func(instanceType *corecloudprovider.InstanceType) bool { return instanceType.Name == name })
+			Expect(ok).To(BeTrue())
+			return instanceType
+		}
+
+		It("should reserve memory with the aks-legacy brackets by default", func() {
+			instanceType := getInstanceType("Standard_D2s_v3")
+			Expect(instanceType.Overhead.KubeReserved.Memory().String()).To(Equal("1843Mi"))
+			Expect(instanceType.Overhead.KubeReserved.Cpu().String()).To(Equal("100m"))
+			Expect(instanceType.Overhead.EvictionThreshold.Memory().String()).To(Equal("750Mi"))
+		})
+		It("should reserve memory per pod with the aks policy", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				KubeReservedPolicy: lo.ToPtr(options.KubeReservedPolicyAKS),
+			}))
+			nodeClass.Spec.MaxPods = lo.ToPtr(int32(30))
+			instanceType := getInstanceType("Standard_D2s_v3")
+			Expect(instanceType.Overhead.KubeReserved.Memory().String()).To(Equal("650Mi")) // 20Mi * 30 pods + 50Mi
+			Expect(instanceType.Overhead.KubeReserved.Cpu().String()).To(Equal("100m"))
+			Expect(instanceType.Overhead.EvictionThreshold.Memory().String()).To(Equal("100Mi"))
+		})
+		It("should reserve at most 25% of the memory with the aks policy", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				KubeReservedPolicy: lo.ToPtr(options.KubeReservedPolicyAKS),
+			}))
+			instanceType := getInstanceType("Standard_D2s_v3")
+			Expect(instanceType.Overhead.KubeReserved.Memory().String()).To(Equal("2Gi")) // 20Mi * 250 pods + 50Mi > 8Gi / 4
+		})
+		It("should reserve resources with the brackets of the custom policy", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				KubeReservedPolicy:         lo.ToPtr(options.KubeReservedPolicyCustom),
+				KubeReservedMemoryBrackets: []options.TaxBracket{{UpperBound: math.Inf(1), Rate: 0.1}},
+				KubeReservedCPUBrackets:    []options.TaxBracket{{UpperBound: 1, Rate: 0.1}, {UpperBound: math.Inf(1), Rate: 0.05}},
+			}))
+			instanceType := getInstanceType("Standard_D2s_v3")
+			Expect(instanceType.Overhead.KubeReserved.Memory().String()).To(Equal("819Mi"))
+			Expect(instanceType.Overhead.KubeReserved.Cpu().String()).To(Equal("150m"))
+		})
+		It("should use the VM memory overhead of the SKU family", func() {
+			Expect(getInstanceType("Standard_D2s_v3").Capacity.Memory().String()).To(Equal("7577Mi"))
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{
+				VMMemoryOverheadPercentOverrides: map[string]float64{"D": 0},
+			}))
+			Expect(getInstanceType("Standard_D2s_v3").Capacity.Memory().String()).To(Equal("8Gi"))
+		})
+		It("should recompute the instance types when the overhead options are overridden", func() {
+			Expect(getInstanceType("Standard_D2s_v3").Overhead.KubeReserved.Memory().String()).To(Equal("1843Mi"))
+
+			overheadSettings, err := options.FromContext(ctx).OverheadOverrides(map[string]string{
+				"kube-reserved-policy":                 options.KubeReservedPolicyAKS,
+				"vm-memory-overhead-percent-overrides": "D=0",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(azureEnv.InstanceTypesProvider.SetOverheadSettings(overheadSettings)).To(BeTrue())
+			Expect(azureEnv.InstanceTypesProvider.SetOverheadSettings(overheadSettings)).To(BeFalse())
+			instanceType := getInstanceType("Standard_D2s_v3")
+			Expect(instanceType.Overhead.KubeReserved.Memory().String()).To(Equal("2Gi"))
+			Expect(instanceType.Capacity.Memory().String()).To(Equal("8Gi"))
+
+			Expect(azureEnv.InstanceTypesProvider.SetOverheadSettings(nil)).To(BeTrue())
+			Expect(getInstanceType("Standard_D2s_v3").Overhead.KubeReserved.Memory().String()).To(Equal("1843Mi"))
+		})
+		It("should apply the overridden overhead options on top of the options of the context", func() {
+			overheadSettings, err := options.FromContext(ctx).OverheadOverrides(map[string]string{
+				"kube-reserved-policy": options.KubeReservedPolicyAKS,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(azureEnv.InstanceTypesProvider.SetOverheadSettings(overheadSettings)).To(BeTrue())
+			Expect(getInstanceType("Standard_D2s_v3").Capacity.Pods().Value()).To(Equal(int64(250)))
+
+			// Azure CNI with pod IPs from the node subnet defaults to 30 pods
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{NetworkPluginMode: lo.ToPtr("")}))
+			instanceType := getInstanceType("Standard_D2s_v3")
+			Expect(instanceType.Capacity.Pods().Value()).To(Equal(int64(30)))
+			Expect(instanceType.Overhead.KubeReserved.Memory().String()).To(Equal("650Mi")) // 20Mi * 30 pods + 50Mi
+		})
+	})
+
+	Context("Zone Restrictions", func() {
+		getInstanceType := func(name string) *corecloudprovider.InstanceType {
+			GinkgoHelper()
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			instanceType, ok := lo.Find(instanceTypes, func(instanceType *corecloudprovider.InstanceType) bool { return instanceType.Name == name })
+			Expect(ok).To(BeTrue())
+			return instanceType
+		}
+
+		It("should have unavailable offerings in all zones for a SKU restricted in all zones", func() {
+			instanceType := getInstanceType("Standard_NC6s_v3") // NotAvailableForSubscription in eastus-1, eastus-2 and eastus-3
+			Expect(instanceType.Offerings).To(HaveLen(6))
+			Expect(instanceType.Offerings.Available()).To(BeEmpty())
+		})
+		It("should have unavailable offerings only in the restricted zones", func() {
+			ctx = options.ToContext(ctx, test.Options(test.OptionsFields{AllowConstrainedCPUInstanceTypes: lo.ToPtr(true)}))
+			instanceType := getInstanceType("Standard_M8-2ms") // NotAvailableForSubscription in eastus-1
+			for _, offering := range instanceType.Offerings {
+				Expect(offering.Available).To(Equal(offering.Zone != fmt.Sprintf("%s-1", fake.Region)), offering.Zone)
+			}
+		})
+		It("should expose the zone restrictions and their reason", func() {
+			getInstanceType("Standard_NC6s_v3")
+			for _, zone := range azureEnv.Zones() {
+				Expect(testutil.ToFloat64(metrics.InstanceTypeZoneRestricted.WithLabelValues("Standard_NC6s_v3", zone, "NotAvailableForSubscription"))).To(BeNumerically("==", 1))
+			}
+			Expect(testutil.CollectAndCount(metrics.InstanceTypeZoneRestricted)).To(Equal(3)) // Standard_M8-2ms is filtered out by default
+		})
+		It("should not launch a SKU in the zones it is restricted in", func() {
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				NodeSelector: map[string]string{v1.LabelInstanceTypeStable: "Standard_NC6s_v3"},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+		})
+	})
+
+	Context("Quota", func() {
+		getInstanceType := func(name string) *corecloudprovider.InstanceType {
+			GinkgoHelper()
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			instanceType, ok := lo.Find(instanceTypes, func(instanceType *corecloudprovider.InstanceType) bool { return instanceType.Name == name })
+			Expect(ok).To(BeTrue())
+			return instanceType
+		}
+		capacityTypeAvailable := func(instanceType *corecloudprovider.InstanceType, capacityType string) bool {
+			return lo.ContainsBy(instanceType.Offerings.Available(), func(offering corecloudprovider.Offering) bool {
+				return offering.CapacityType == capacityType
+			})
+		}
+
+		BeforeEach(func() {
+			azureEnv.UsageAPI.Usages.Append(
+				fake.NewUsage(quota.RegionalVCPUsUsageName, 90, 100),
+				fake.NewUsage(quota.LowPriorityVCPUsUsageName, 0, 100),
+				fake.NewUsage("standardDSv3Family", 16, 20),
+			)
+			Expect(azureEnv.QuotaProvider.Update(ctx)).To(Succeed())
+		})
+
+		It("should have unavailable on-demand offerings without enough family quota", func() {
+			Expect(capacityTypeAvailable(getInstanceType("Standard_D4s_v3"), corev1beta1.CapacityTypeOnDemand)).To(BeTrue())
+			instanceType := getInstanceType("Standard_D64s_v3")
+			Expect(capacityTypeAvailable(instanceType, corev1beta1.CapacityTypeOnDemand)).To(BeFalse())
+			Expect(capacityTypeAvailable(instanceType, corev1beta1.CapacityTypeSpot)).To(BeTrue())
+		})
+		It("should have unavailable on-demand offerings without enough regional quota", func() {
+			instanceType := getInstanceType("Standard_F16s_v2") // no standardFSv2Family usage, only the regional one
+			Expect(capacityTypeAvailable(instanceType, corev1beta1.CapacityTypeOnDemand)).To(BeFalse())
+			Expect(capacityTypeAvailable(instanceType, corev1beta1.CapacityTypeSpot)).To(BeTrue())
+		})
+		It("should have unavailable spot offerings without enough low priority quota", func() {
+			azureEnv.UsageAPI.Usages.Reset()
+			azureEnv.UsageAPI.Usages.Append(fake.NewUsage(quota.LowPriorityVCPUsUsageName, 100, 100))
+			Expect(azureEnv.QuotaProvider.Update(ctx)).To(Succeed())
+			instanceType := getInstanceType("Standard_D2s_v3")
+			Expect(capacityTypeAvailable(instanceType, corev1beta1.CapacityTypeOnDemand)).To(BeTrue())
+			Expect(capacityTypeAvailable(instanceType, corev1beta1.CapacityTypeSpot)).To(BeFalse())
+		})
+		It("should hold launches in flight against the quota", func() {
+			Expect(capacityTypeAvailable(getInstanceType("Standard_D4s_v3"), corev1beta1.CapacityTypeOnDemand)).To(BeTrue())
+			release := azureEnv.QuotaProvider.Reserve("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 2)
+			Expect(capacityTypeAvailable(getInstanceType("Standard_D4s_v3"), corev1beta1.CapacityTypeOnDemand)).To(BeFalse())
+			release(false)
+			Expect(capacityTypeAvailable(getInstanceType("Standard_D4s_v3"), corev1beta1.CapacityTypeOnDemand)).To(BeTrue())
+		})
+		It("should not launch on-demand VMs without on-demand quota", func() {
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				NodeSelector: map[string]string{
+					v1.LabelInstanceTypeStable:       "Standard_F16s_v2",
+					corev1beta1.CapacityTypeLabelKey: corev1beta1.CapacityTypeOnDemand,
+				},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+		})
+	})
+
+	Context("Spot Eviction Rates", func() {
+		BeforeEach(func() {
+			azureEnv.AzureResourceGraphAPI.SpotEvictionRates.Store("Standard_D2_v3", "20+")
+			azureEnv.AzureResourceGraphAPI.SpotEvictionRates.Store("Standard_D2s_v3", "0-5")
+			Expect(azureEnv.SpotAdvisor.Update(ctx)).To(Succeed())
+			coretest.ReplaceRequirements(nodePool,
+				corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      v1.LabelInstanceTypeStable,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{"Standard_D2_v3", "Standard_D2s_v3"},
+				}},
+				corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      corev1beta1.CapacityTypeLabelKey,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{corev1beta1.CapacityTypeSpot},
+				}},
+			)
+		})
+		expectLaunched := func(instanceType string) {
+			GinkgoHelper()
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			Expect(string(lo.FromPtr(vm.Properties.HardwareProfile.VMSize))).To(Equal(instanceType))
+		}
+
+		It("should have the eviction rate requirement of instance types with a published eviction rate", func() {
+			instanceTypes, err := azureEnv.InstanceTypesProvider.List(ctx, &corev1beta1.KubeletConfiguration{}, nodeClass)
+			Expect(err).ToNot(HaveOccurred())
+			for _, instanceType := range instanceTypes {
+				switch instanceType.Name {
+				case "Standard_D2_v3":
+					Expect(instanceType.Requirements.Get(v1alpha2.LabelSKUSpotEvictionRate).Values()).To(ConsistOf("20"))
+				case "Standard_D2s_v3":
+					Expect(instanceType.Requirements.Get(v1alpha2.LabelSKUSpotEvictionRate).Values()).To(ConsistOf("0"))
+				default:
+					Expect(instanceType.Requirements.Get(v1alpha2.LabelSKUSpotEvictionRate).Operator()).To(Equal(v1.NodeSelectorOpDoesNotExist))
+				}
+			}
+		})
+		It("should schedule pods constraining the eviction rate on instance types with a lower one", func() {
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				NodeRequirements: []v1.NodeSelectorRequirement{{
+					Key:      v1alpha2.LabelSKUSpotEvictionRate,
+					Operator: v1.NodeSelectorOpLt,
+					Values:   []string{"10"},
+				}},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "Standard_D2s_v3"))
+			Expect(node.Labels).To(HaveKeyWithValue(v1alpha2.LabelSKUSpotEvictionRate, "0"))
+		})
+		It("should launch spot VMs for pods constraining the eviction rate when the NodePool allows on-demand", func() {
+			coretest.ReplaceRequirements(nodePool,
+				corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      v1.LabelInstanceTypeStable,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{"Standard_D2_v3", "Standard_D2s_v3"},
+				}},
+				corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: v1.NodeSelectorRequirement{
+					Key:      corev1beta1.CapacityTypeLabelKey,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{corev1beta1.CapacityTypeSpot, corev1beta1.CapacityTypeOnDemand},
+				}},
+			)
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				NodeRequirements: []v1.NodeSelectorRequirement{{
+					Key:      v1alpha2.LabelSKUSpotEvictionRate,
+					Operator: v1.NodeSelectorOpLt,
+					Values:   []string{"10"},
+				}},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			Expect(lo.FromPtr(vm.Properties.Priority)).To(Equal(armcompute.VirtualMachinePriorityTypesSpot))
+		})
+		It("should launch the cheapest spot instance type with the LowestPrice strategy", func() {
+			nodeClass.Spec.SpotAllocationStrategy = lo.ToPtr(v1alpha2.SpotAllocationStrategyLowestPrice)
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			// both cost the same, the first by name is launched
+			expectLaunched("Standard_D2_v3")
+		})
+		It("should launch the spot instance type with the lower eviction rate with the PriceCapacityOptimized strategy", func() {
+			nodeClass.Spec.SpotAllocationStrategy = lo.ToPtr(v1alpha2.SpotAllocationStrategyPriceCapacityOptimized)
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			expectLaunched("Standard_D2s_v3")
+		})
+		It("should not drift when the spot allocation strategy changes", func() {
+			hash := nodeClass.Hash()
+			nodeClass.Spec.SpotAllocationStrategy = lo.ToPtr(v1alpha2.SpotAllocationStrategyPriceCapacityOptimized)
+			Expect(nodeClass.Hash()).To(Equal(hash))
+		})
+	})
+
 	Context("Unavailable Offerings", func() {
 		It("should not allocate a vm in a zone marked as unavailable", func() {
 			azureEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "ZonalAllocationFailure", "Standard_D2_v2", fmt.Sprintf("%s-1", fake.Region), corev1beta1.CapacityTypeSpot)
@@ -808,6 +1301,12 @@ var _ = Describe("InstanceType Provider", func() {
 				Expect(reqs.Has(v1alpha2.LabelSKUAcceleratedNetworking)).To(BeTrue())
 				Expect(reqs.Has(v1alpha2.LabelSKUHyperVGeneration)).To(BeTrue())
 				Expect(reqs.Has(v1alpha2.LabelSKUStorageEphemeralOSMaxSize)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUCPUManufacturer)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUACU)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUNetworkingMaxNICs)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUStorageMaxDataDisks)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUStorageTempDiskSize)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUSpotEvictionRate)).To(BeTrue())
 			}
 		})
 
@@ -847,6 +1346,11 @@ var _ = Describe("InstanceType Provider", func() {
 				v1alpha2.LabelSKUCPU:                       "24",
 				v1alpha2.LabelSKUMemory:                    "8192",
 				v1alpha2.LabelSKUAccelerator:               "A100",
+				v1alpha2.LabelSKUCPUManufacturer:           "amd",
+				v1alpha2.LabelSKUNetworkingMaxNICs:         "2",
+				v1alpha2.LabelSKUStorageMaxDataDisks:       "8",
+				v1alpha2.LabelSKUStorageTempDiskSize:       "64",
+				v1alpha2.LabelSKUACU:                       "160", // not published for Standard_NC24ads_A100_v4
 				// Deprecated Labels
 				v1.LabelFailureDomainBetaRegion:    fake.Region,
 				v1.LabelFailureDomainBetaZone:      fmt.Sprintf("%s-1", fake.Region),
@@ -898,6 +1402,21 @@ var _ = Describe("InstanceType Provider", func() {
 			Expect(normalNode.Requirements.Get(v1alpha2.LabelSKUVersion).Values()).To(ConsistOf("2"))
 			Expect(gpuNode.Requirements.Get(v1alpha2.LabelSKUVersion).Values()).To(ConsistOf("4"))
 
+			Expect(normalNode.Requirements.Get(v1alpha2.LabelSKUCPUManufacturer).Values()).To(ConsistOf(v1alpha2.ManufacturerIntel))
+			Expect(gpuNode.Requirements.Get(v1alpha2.LabelSKUCPUManufacturer).Values()).To(ConsistOf(v1alpha2.ManufacturerAMD))
+
+			Expect(normalNode.Requirements.Get(v1alpha2.LabelSKUACU).Values()).To(ConsistOf("210"))
+			Expect(gpuNode.Requirements.Get(v1alpha2.LabelSKUACU).Operator()).To(Equal(v1.NodeSelectorOpDoesNotExist))
+
+			Expect(normalNode.Requirements.Get(v1alpha2.LabelSKUNetworkingMaxNICs).Values()).To(ConsistOf("2"))
+			Expect(gpuNode.Requirements.Get(v1alpha2.LabelSKUNetworkingMaxNICs).Values()).To(ConsistOf("2"))
+
+			Expect(normalNode.Requirements.Get(v1alpha2.LabelSKUStorageMaxDataDisks).Values()).To(ConsistOf("8"))
+			Expect(gpuNode.Requirements.Get(v1alpha2.LabelSKUStorageMaxDataDisks).Values()).To(ConsistOf("8"))
+
+			Expect(normalNode.Requirements.Get(v1alpha2.LabelSKUStorageTempDiskSize).Values()).To(ConsistOf("100"))
+			Expect(gpuNode.Requirements.Get(v1alpha2.LabelSKUStorageTempDiskSize).Values()).To(ConsistOf("64"))
+
 			// CPU (requirements and capacity)
 			Expect(normalNode.Requirements.Get(v1alpha2.LabelSKUCPU).Values()).To(ConsistOf("2"))
 			Expect(normalNode.Capacity.Cpu().Value()).To(Equal(int64(2)))
@@ -962,6 +1481,72 @@ var _ = Describe("InstanceType Provider", func() {
 			Entry("ARM instance type with AzureLinux image family",
 				"Standard_D16plds_v5", v1alpha2.AzureLinuxImageFamily, imagefamily.AzureLinuxGen2ArmCommunityImage, imagefamily.AKSAzureLinuxPublicGalleryURL),
 		)
+		DescribeTable("should select the FIPS image for a given instance type when FIPS mode is enabled",
+			func(instanceType string, imageFamily string, expectedImageDefinition string, expectedGalleryURL string) {
+				nodeClass.Spec.ImageFamily = lo.ToPtr(imageFamily)
+				nodeClass.Spec.FIPSMode = lo.ToPtr(v1alpha2.FIPSModeEnabled)
+				coretest.ReplaceRequirements(nodePool, corev1beta1.NodeSelectorRequirementWithMinValues{
+					NodeSelectorRequirement: v1.NodeSelectorRequirement{
+						Key:      v1.LabelInstanceTypeStable,
+						Operator: v1.NodeSelectorOpIn,
+						Values:   []string{instanceType},
+					}})
+				nodePool.Spec.Template.Spec.NodeClassRef = &corev1beta1.NodeClassReference{Name: nodeClass.Name}
+				ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+				pod := coretest.UnschedulablePod(coretest.PodOptions{})
+				ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+
+				Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+				vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+				Expect(vm.Properties.StorageProfile.ImageReference).ToNot(BeNil())
+				Expect(vm.Properties.StorageProfile.ImageReference.CommunityGalleryImageID).ToNot(BeNil())
+				parts := strings.Split(*vm.Properties.StorageProfile.ImageReference.CommunityGalleryImageID, "/")
+				Expect(parts[2]).To(Equal(expectedGalleryURL))
+				Expect(parts[4]).To(Equal(expectedImageDefinition))
+
+				// Need to reset env since we are doing these nested tests
+				cluster.Reset()
+				azureEnv.Reset()
+			},
+			Entry("Gen2, Gen1 instance type with AKSUbuntu image family",
+				"Standard_D2_v5", v1alpha2.Ubuntu2204ImageFamily, imagefamily.Ubuntu2204Gen2FIPSCommunityImage, imagefamily.AKSUbuntuPublicGalleryURL),
+			Entry("Gen1 instance type with AKSUbuntu image family",
+				"Standard_D2_v3", v1alpha2.Ubuntu2204ImageFamily, imagefamily.Ubuntu2204Gen1FIPSCommunityImage, imagefamily.AKSUbuntuPublicGalleryURL),
+			Entry("Gen2 instance type with AzureLinux image family",
+				"Standard_D2_v5", v1alpha2.AzureLinuxImageFamily, imagefamily.AzureLinuxGen2FIPSCommunityImage, imagefamily.AKSAzureLinuxPublicGalleryURL),
+			Entry("Gen1 instance type with AzureLinux image family",
+				"Standard_D2_v3", v1alpha2.AzureLinuxImageFamily, imagefamily.AzureLinuxGen1FIPSCommunityImage, imagefamily.AKSAzureLinuxPublicGalleryURL),
+		)
+		It("should use the imageID and userData of the AKSNodeClass for the Custom image family", func() {
+			imageID := "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/flatcar/versions/1.0.0"
+			nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.CustomImageFamily)
+			nodeClass.Spec.ImageID = lo.ToPtr(imageID)
+			nodeClass.Spec.UserData = lo.ToPtr("#!/bin/bash\njoin --server {{ .ClusterEndpoint }} --token {{ .KubeletClientTLSBootstrapToken }}")
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			Expect(azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Len()).To(Equal(1))
+			vm := azureEnv.VirtualMachinesAPI.VirtualMachineCreateOrUpdateBehavior.CalledWithInput.Pop().VM
+			Expect(vm.Properties.StorageProfile.ImageReference).ToNot(BeNil())
+			Expect(vm.Properties.StorageProfile.ImageReference.CommunityGalleryImageID).To(BeNil())
+			Expect(lo.FromPtr(vm.Properties.StorageProfile.ImageReference.ID)).To(Equal(imageID))
+
+			decodedString, err := base64.StdEncoding.DecodeString(lo.FromPtr(vm.Properties.OSProfile.CustomData))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decodedString)).To(Equal(fmt.Sprintf("#!/bin/bash\njoin --server %s --token %s", "https://test-cluster", test.Options().KubeletClientTLSBootstrapToken)))
+		})
+		It("should not launch ARM instance types when FIPS mode is enabled", func() {
+			nodeClass.Spec.FIPSMode = lo.ToPtr(v1alpha2.FIPSModeEnabled)
+			ExpectApplied(ctx, env.Client, nodePool, nodeClass)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				NodeSelector: map[string]string{v1.LabelArchStable: corev1beta1.ArchitectureArm64},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, cloudProvider, coreProvisioner, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+		})
 	})
 	Context("Instance Types", func() {
 		It("should support provisioning with no labels", func() {
@@ -1158,7 +1743,7 @@ var _ = Describe("Tax Calculator", func() {
 			expectedCPU := "140m"
 			expectedMemory := "1638Mi"
 
-			resources := instancetype.KubeReservedResources(cpus, memory)
+			resources := instancetype.KubeReservedResources(ctx, cpus, memory, 110)
 			gotCPU := resources[v1.ResourceCPU]
 			gotMemory := resources[v1.ResourceMemory]
 
@@ -1172,7 +1757,7 @@ var _ = Describe("Tax Calculator", func() {
 			expectedCPU := "100m"
 			expectedMemory := "1843Mi"
 
-			resources := instancetype.KubeReservedResources(cpus, memory)
+			resources := instancetype.KubeReservedResources(ctx, cpus, memory, 110)
 			gotCPU := resources[v1.ResourceCPU]
 			gotMemory := resources[v1.ResourceMemory]
 
@@ -1186,7 +1771,7 @@ var _ = Describe("Tax Calculator", func() {
 			expectedCPU := "120m"
 			expectedMemory := "5611Mi"
 
-			resources := instancetype.KubeReservedResources(cpus, memory)
+			resources := instancetype.KubeReservedResources(ctx, cpus, memory, 110)
 			gotCPU := resources[v1.ResourceCPU]
 			gotMemory := resources[v1.ResourceMemory]
 
@@ -1196,6 +1781,16 @@ var _ = Describe("Tax Calculator", func() {
 	})
 })
 
+func lowPriorityCoresQuotaError() *azcore.ResponseError {
+	LowPriorityCoresQuotaErrorMessage := "Operation could not be completed as it results in exceeding approved Low Priority Cores quota. Additional details - Deployment Model: Resource Manager, Location: westus2, Current Limit: 0, Current Usage: 0, Additional Required: 32, (Minimum) New Limit Required: 32. Submit a request for Quota increase at https://aka.ms/ProdportalCRP/#blade/Microsoft_Azure_Capacity/UsageAndQuota.ReactView/Parameters/%7B%22subscriptionId%22:%(redacted)%22,%22command%22:%22openQuotaApprovalBlade%22,%22quotas%22:[%7B%22location%22:%22westus2%22,%22providerId%22:%22Microsoft.Compute%22,%22resourceName%22:%22LowPriorityCores%22,%22quotaRequest%22:%7B%22properties%22:%7B%22limit%22:32,%22unit%22:%22Count%22,%22name%22:%7B%22value%22:%22LowPriorityCores%22%7D%7D%7D%7D]%7D by specifying parameters listed in the ‘Details’ section for deployment to succeed. Please read more about quota limits at https://docs.microsoft.com/en-us/azure/azure-supportability/per-vm-quota-requests"
+	return &azcore.ResponseError{
+		ErrorCode: sdkerrors.OperationNotAllowed,
+		RawResponse: &http.Response{
+			Body: createSDKErrorBody(sdkerrors.OperationNotAllowed, LowPriorityCoresQuotaErrorMessage),
+		},
+	}
+}
+
 func createSDKErrorBody(code, message string) io.ReadCloser {
 	return io.NopCloser(bytes.NewReader([]byte(fmt.Sprintf(`{"error":{"code": "%s", "message": "%s"}}`, code, message))))
 }
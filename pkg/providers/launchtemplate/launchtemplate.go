@@ -148,6 +148,8 @@ func (p *Provider) getStaticParameters(ctx context.Context, instanceType *cloudp
 		NetworkPlugin:                  options.FromContext(ctx).NetworkPlugin,
 		NetworkPolicy:                  options.FromContext(ctx).NetworkPolicy,
 		SubnetID:                       options.FromContext(ctx).SubnetID,
+		EnableFIPS:                     nodeClass.Spec.IsFIPSEnabled(),
+		KubeletOnTemporaryDisk:         nodeClass.Spec.IsKubeletOnTemporaryDisk(),
 	}, nil
 }
 
@@ -158,16 +160,19 @@ func (p *Provider) createLaunchTemplate(_ context.Context, options *parameters.P
 		return nil, err
 	}
 
-	// merge and convert to ARM tags
-	azureTags := mergeTags(options.Tags, map[string]string{karpenterManagedTagKey: options.ClusterName})
 	template := &Template{
 		UserData: userData,
 		ImageID:  options.ImageID,
-		Tags:     azureTags,
+		Tags:     Tags(options.ClusterName, options.Tags),
 	}
 	return template, nil
 }
 
+// Tags returns the ARM tags of the resources of an instance, the AKSNodeClass tags along with the karpenter managed tag
+func Tags(clusterName string, nodeClassTags map[string]string) map[string]*string {
+	return mergeTags(nodeClassTags, map[string]string{karpenterManagedTagKey: clusterName})
+}
+
 // MergeTags takes a variadic list of maps and merges them together
 // with format acceptable to ARM (no / in keys, pointer to strings as values)
 func mergeTags(tags ...map[string]string) (result map[string]*string) {
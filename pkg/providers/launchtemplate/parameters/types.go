@@ -38,6 +38,8 @@ type StaticParameters struct {
 	NetworkPlugin                  string
 	NetworkPolicy                  string
 	KubernetesVersion              string
+	EnableFIPS                     bool
+	KubeletOnTemporaryDisk         bool
 
 	// VNET
 	SubnetID string
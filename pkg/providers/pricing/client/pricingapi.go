@@ -19,65 +19,236 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"golang.org/x/time/rate"
+	"knative.dev/pkg/logging"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 )
 
 const (
 	apiVersion = "2021-10-01-preview"
-	pricingURL = "https://prices.azure.com/api/retail/prices?api-version=" + apiVersion
+	// DefaultBaseURL is the retail prices API of the public cloud
+	DefaultBaseURL = "https://prices.azure.com/api/retail/prices"
+
+	defaultRequestTimeout    = time.Minute
+	defaultMaxRetries        = 5
+	defaultRetryDelay        = time.Second
+	maxRetryDelay            = 30 * time.Second
+	defaultRequestsPerSecond = 5
 )
 
 type PricingAPI interface {
 	GetProductsPricePages(context.Context, []*Filter, func(output *ProductsPricePage)) error
 }
 
-type pricingAPI struct{}
+// Options configure the pricing API client, the zero value uses the public retail prices API
+type Options struct {
+	// BaseURL of the retail prices API, e.g. for sovereign clouds or a local stand-in, defaults to DefaultBaseURL
+	BaseURL string
+	// CurrencyCode of the prices, e.g. EUR, defaults to USD
+	CurrencyCode string
+	// HTTPClient defaults to a client with a timeout of a minute per request
+	HTTPClient *http.Client
+	// MaxRetries of each page on transport errors, 429 and 5xx status codes, defaults to 5
+	MaxRetries int
+	// RetryDelay is the initial delay of the exponential backoff between retries, unless the response has a
+	// Retry-After header, which is followed up to 30 seconds, defaults to a second
+	RetryDelay time.Duration
+	// RequestsPerSecond limits the rate of requests, defaults to 5
+	RequestsPerSecond float64
+}
+
+type pricingAPI struct {
+	baseURL      string
+	currencyCode string
+	httpClient   *http.Client
+	maxRetries   int
+	retryDelay   time.Duration
+	limiter      *rate.Limiter
+
+	mu sync.Mutex
+	// resumptions are the calls which ran out of retries, by the URL of their first page
+	resumptions map[string]*resumption
+}
 
-func New() PricingAPI {
-	return &pricingAPI{}
+// resumption is where a call which ran out of retries stopped: the pages it handled, and the link of the page that failed
+type resumption struct {
+	pages   []*ProductsPricePage
+	nextURL string
 }
 
-func (papi *pricingAPI) GetProductsPricePages(_ context.Context, filters []*Filter, pageHandler func(output *ProductsPricePage)) error {
-	nextURL := pricingURL
+func New(opts Options) PricingAPI {
+	papi := &pricingAPI{
+		baseURL:      opts.BaseURL,
+		currencyCode: opts.CurrencyCode,
+		httpClient:   opts.HTTPClient,
+		maxRetries:   opts.MaxRetries,
+		retryDelay:   opts.RetryDelay,
+		limiter:      rate.NewLimiter(rate.Limit(opts.RequestsPerSecond), 1),
+		resumptions:  map[string]*resumption{},
+	}
+	if papi.baseURL == "" {
+		papi.baseURL = DefaultBaseURL
+	}
+	if papi.httpClient == nil {
+		papi.httpClient = &http.Client{Timeout: defaultRequestTimeout}
+	}
+	if papi.maxRetries == 0 {
+		papi.maxRetries = defaultMaxRetries
+	}
+	if papi.retryDelay == 0 {
+		papi.retryDelay = defaultRetryDelay
+	}
+	if opts.RequestsPerSecond == 0 {
+		papi.limiter.SetLimit(defaultRequestsPerSecond)
+	}
+	return papi
+}
 
+// GetProductsPricePages calls the page handler with each page of the prices matching the filters. Each page is
+// retried on its own, so that a transient failure is retried from the page that failed rather than from the first
+// page. A page that runs out of retries fails the whole call, and the next call with the same filters resumes from
+// that page: the pages handled before it are kept and handled again first, so that the handler still sees every page.
+func (papi *pricingAPI) GetProductsPricePages(ctx context.Context, filters []*Filter, pageHandler func(output *ProductsPricePage)) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.PricingFetchDuration.WithLabelValues(lo.Ternary(err == nil, "success", "error")).Observe(time.Since(start).Seconds())
+	}()
+
+	nextURL := fmt.Sprintf("%s?api-version=%s", papi.baseURL, apiVersion)
+	if papi.currencyCode != "" {
+		// the currency is a parameter rather than a filter, the prices are in USD otherwise
+		nextURL += fmt.Sprintf("&currencyCode=%s", url.QueryEscape(fmt.Sprintf("'%s'", papi.currencyCode)))
+	}
 	if len(filters) > 0 {
 		filterParams := []string{}
 		for _, filter := range filters {
 			filterParams = append(filterParams, filter.String())
 		}
-
 		filterParamsEscaped := url.QueryEscape(strings.Join(filterParams[:], " and "))
-
 		nextURL += fmt.Sprintf("&$filter=%s", filterParamsEscaped)
 	}
 
+	query := nextURL
+	var pages []*ProductsPricePage
+	papi.mu.Lock()
+	if resumed, ok := papi.resumptions[query]; ok {
+		delete(papi.resumptions, query)
+		pages, nextURL = resumed.pages, resumed.nextURL
+	}
+	papi.mu.Unlock()
+	for _, page := range pages {
+		pageHandler(page)
+	}
+
 	for nextURL != "" {
-		res, err := http.Get(nextURL)
+		page, err := papi.getPageWithRetries(ctx, nextURL)
 		if err != nil {
+			papi.mu.Lock()
+			papi.resumptions[query] = &resumption{pages: pages, nextURL: nextURL}
+			papi.mu.Unlock()
 			return err
 		}
+		pageHandler(page)
+		pages = append(pages, page)
+		nextURL = page.NextPageLink
+	}
+	return nil
+}
 
-		if res.StatusCode != 200 {
-			return fmt.Errorf("got a non-200 status code: %d", res.StatusCode)
+func (papi *pricingAPI) getPageWithRetries(ctx context.Context, pageURL string) (*ProductsPricePage, error) {
+	for attempt := 0; ; attempt++ {
+		if err := papi.limiter.Wait(ctx); err != nil {
+			return nil, err
 		}
-
-		resBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			return err
+		page, err := papi.getPage(ctx, pageURL)
+		if err == nil {
+			return page, nil
+		}
+		retryErr := &retryableError{}
+		if !errors.As(err, &retryErr) || attempt >= papi.maxRetries {
+			return nil, err
+		}
+		// an oversized Retry-After would hold the refresh of the prices for as long
+		delay := lo.Min([]time.Duration{retryErr.retryAfter, maxRetryDelay})
+		if delay == 0 {
+			delay = time.Duration(math.Min(float64(papi.retryDelay)*math.Pow(2, float64(attempt)), float64(maxRetryDelay)))
 		}
+		logging.FromContext(ctx).With("attempt", attempt+1, "delay", delay).Debugf("retrying pricing page, %s", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
 
-		page := ProductsPricePage{}
-		err = json.Unmarshal(resBody, &page)
-		if err != nil {
-			return err
+func (papi *pricingAPI) getPage(ctx context.Context, pageURL string) (*ProductsPricePage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request, %w", err)
+	}
+	res, err := papi.httpClient.Do(req)
+	if err != nil {
+		metrics.PricingRequestErrorCount.WithLabelValues("transport").Inc()
+		if ctx.Err() != nil {
+			return nil, err
 		}
+		return nil, &retryableError{error: err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		metrics.PricingRequestErrorCount.WithLabelValues(strconv.Itoa(res.StatusCode)).Inc()
+		err := fmt.Errorf("got a non-200 status code: %d", res.StatusCode)
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError {
+			return nil, &retryableError{error: err, retryAfter: retryAfter(res.Header.Get("Retry-After"))}
+		}
+		return nil, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		metrics.PricingRequestErrorCount.WithLabelValues("transport").Inc()
+		return nil, &retryableError{error: fmt.Errorf("reading response, %w", err)}
+	}
+	page := &ProductsPricePage{}
+	if err := json.Unmarshal(resBody, page); err != nil {
+		metrics.PricingRequestErrorCount.WithLabelValues("decode").Inc()
+		return nil, fmt.Errorf("decoding response, %w", err)
+	}
+	return page, nil
+}
 
-		pageHandler(&page)
-		nextURL = page.NextPageLink
+type retryableError struct {
+	error
+	retryAfter time.Duration // zero to back off
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.error
+}
+
+// retryAfter parses the Retry-After header, either a number of seconds or an HTTP date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
 	}
-	return nil
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(math.Max(float64(seconds), 0)) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Duration(math.Max(float64(time.Until(date)), 0))
+	}
+	return 0
 }
@@ -0,0 +1,197 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/samber/lo"
+	. "knative.dev/pkg/logging/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing/client"
+)
+
+var ctx context.Context
+
+func TestAzure(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Providers/Pricing/Client")
+}
+
+// pricingServer serves two pages of prices, failing the requests of each page with its status codes first
+type pricingServer struct {
+	*httptest.Server
+	failures   map[string][]int // by page
+	retryAfter string
+	requests   map[string]int // by page
+	mu         sync.Mutex
+}
+
+func newPricingServer(failures map[string][]int, retryAfter string) *pricingServer {
+	s := &pricingServer{failures: failures, retryAfter: retryAfter, requests: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		pageNumber := lo.Ternary(r.URL.Query().Get("page") == "", "1", r.URL.Query().Get("page"))
+		request := s.requests[pageNumber]
+		s.requests[pageNumber]++
+		if request < len(s.failures[pageNumber]) {
+			if s.retryAfter != "" {
+				w.Header().Set("Retry-After", s.retryAfter)
+			}
+			w.WriteHeader(s.failures[pageNumber][request])
+			return
+		}
+		page := client.ProductsPricePage{Items: []client.Item{{ArmSkuName: "Standard_D2s_v3", RetailPrice: 0.1}}}
+		if pageNumber == "1" {
+			page = client.ProductsPricePage{
+				Items:        []client.Item{{ArmSkuName: "Standard_D4s_v3", RetailPrice: 0.2}},
+				NextPageLink: fmt.Sprintf("%s/prices?page=2", s.URL),
+			}
+		}
+		Expect(json.NewEncoder(w).Encode(page)).To(Succeed())
+	}))
+	return s
+}
+
+func (s *pricingServer) Requests(page string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[page]
+}
+
+var _ = Describe("Client", func() {
+	newClient := func(baseURL string) client.PricingAPI {
+		return client.New(client.Options{
+			BaseURL:           baseURL,
+			RetryDelay:        time.Millisecond,
+			MaxRetries:        3,
+			RequestsPerSecond: 1000,
+		})
+	}
+	getPrices := func(pricingAPI client.PricingAPI) (map[string]float64, error) {
+		prices := map[string]float64{}
+		err := pricingAPI.GetProductsPricePages(ctx, []*client.Filter{{Field: "armRegionName", Operator: client.Equals, Value: "eastus"}}, func(page *client.ProductsPricePage) {
+			for _, item := range page.Items {
+				prices[item.ArmSkuName] = item.RetailPrice
+			}
+		})
+		return prices, err
+	}
+
+	It("should fetch all the pages from the base URL", func() {
+		server := newPricingServer(nil, "")
+		defer server.Close()
+		prices, err := getPrices(newClient(server.URL + "/prices"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(prices).To(Equal(map[string]float64{"Standard_D4s_v3": 0.2, "Standard_D2s_v3": 0.1}))
+		Expect(server.Requests("1")).To(Equal(1))
+		Expect(server.Requests("2")).To(Equal(1))
+	})
+	It("should request the prices in the currency", func() {
+		var currencyCode string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			currencyCode = r.URL.Query().Get("currencyCode")
+			Expect(json.NewEncoder(w).Encode(client.ProductsPricePage{})).To(Succeed())
+		}))
+		defer server.Close()
+		err := client.New(client.Options{BaseURL: server.URL, CurrencyCode: "EUR"}).GetProductsPricePages(ctx, nil, func(*client.ProductsPricePage) {})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(currencyCode).To(Equal("'EUR'"))
+	})
+	It("should retry 429 and 5xx status codes", func() {
+		server := newPricingServer(map[string][]int{"1": {http.StatusTooManyRequests, http.StatusServiceUnavailable}}, "")
+		defer server.Close()
+		errors := testutil.ToFloat64(metrics.PricingRequestErrorCount.WithLabelValues("429"))
+		prices, err := getPrices(newClient(server.URL + "/prices"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(prices).To(HaveLen(2))
+		Expect(server.Requests("1")).To(Equal(3))
+		Expect(testutil.ToFloat64(metrics.PricingRequestErrorCount.WithLabelValues("429"))).To(BeNumerically("==", errors+1))
+	})
+	It("should honour the Retry-After header", func() {
+		server := newPricingServer(map[string][]int{"1": {http.StatusTooManyRequests}}, "1")
+		defer server.Close()
+		start := time.Now()
+		_, err := getPrices(newClient(server.URL + "/prices"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+	})
+	It("should not retry other status codes", func() {
+		server := newPricingServer(map[string][]int{"1": {http.StatusBadRequest}}, "")
+		defer server.Close()
+		_, err := getPrices(newClient(server.URL + "/prices"))
+		Expect(err).To(HaveOccurred())
+		Expect(server.Requests("1")).To(Equal(1))
+	})
+	It("should fail once out of retries", func() {
+		server := newPricingServer(map[string][]int{"1": {500, 500, 500, 500, 500}}, "")
+		defer server.Close()
+		_, err := getPrices(newClient(server.URL + "/prices"))
+		Expect(err).To(HaveOccurred())
+		Expect(server.Requests("1")).To(Equal(4)) // the first attempt and 3 retries
+	})
+	It("should retry from the page that failed rather than from the first page", func() {
+		server := newPricingServer(map[string][]int{"2": {http.StatusBadGateway, http.StatusGatewayTimeout}}, "")
+		defer server.Close()
+		prices, err := getPrices(newClient(server.URL + "/prices"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(prices).To(HaveLen(2))
+		Expect(server.Requests("1")).To(Equal(1))
+		Expect(server.Requests("2")).To(Equal(3))
+	})
+	It("should resume from the page that ran out of retries on the next call", func() {
+		server := newPricingServer(map[string][]int{"2": {500, 500, 500, 500}}, "")
+		defer server.Close()
+		pricingAPI := newClient(server.URL + "/prices")
+		_, err := getPrices(pricingAPI)
+		Expect(err).To(HaveOccurred())
+		Expect(server.Requests("1")).To(Equal(1))
+		Expect(server.Requests("2")).To(Equal(4))
+
+		prices, err := getPrices(pricingAPI)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(prices).To(Equal(map[string]float64{"Standard_D4s_v3": 0.2, "Standard_D2s_v3": 0.1}))
+		Expect(server.Requests("1")).To(Equal(1))
+		Expect(server.Requests("2")).To(Equal(5))
+
+		// a complete call is not resumed
+		_, err = getPrices(pricingAPI)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Requests("1")).To(Equal(2))
+	})
+	It("should honour the cancellation of the context", func() {
+		server := newPricingServer(map[string][]int{"1": {http.StatusTooManyRequests}}, "3600")
+		defer server.Close()
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		err := newClient(server.URL+"/prices").GetProductsPricePages(ctx, nil, func(*client.ProductsPricePage) {})
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+})
@@ -0,0 +1,120 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+const (
+	// OnDemandDiscountsKey holds the discounts off the retail on-demand prices, e.g. negotiated ones
+	OnDemandDiscountsKey = "on-demand-discounts"
+	// SpotDiscountsKey holds the discounts off the retail spot prices
+	SpotDiscountsKey = "spot-discounts"
+	// ReservedInstancesKey holds the number of on-demand VMs covered by reserved instances or savings plans
+	ReservedInstancesKey = "reserved-instances"
+)
+
+// Overrides adjust the public retail prices to the prices actually paid. Discounts are fractions of the price
+// (0.2 for 20% off), by instance type (e.g. Standard_D4s_v3) or SKU family (as in the karpenter.azure.com/sku-family
+// label, e.g. D); the discount of an instance type takes precedence over the one of its family.
+// The VMs of an instance type covered by reserved instances or savings plans are already paid for, so on-demand
+// VMs of the instance type are free while fewer than its reserved count are running or launching.
+type Overrides struct {
+	OnDemandDiscounts map[string]float64
+	SpotDiscounts     map[string]float64
+	ReservedInstances map[string]int // by instance type
+}
+
+// ParseOverrides parses the data of the price overrides ConfigMap, where each key holds comma separated
+// name=value pairs, e.g. on-demand-discounts: D=0.15,Standard_D4s_v3=0.3 and reserved-instances: Standard_D4s_v3=10
+func ParseOverrides(data map[string]string) (*Overrides, error) {
+	overrides := &Overrides{
+		OnDemandDiscounts: map[string]float64{},
+		SpotDiscounts:     map[string]float64{},
+		ReservedInstances: map[string]int{},
+	}
+	for _, key := range lo.Keys(data) {
+		var err error
+		switch key {
+		case OnDemandDiscountsKey:
+			overrides.OnDemandDiscounts, err = parseDiscounts(data[key])
+		case SpotDiscountsKey:
+			overrides.SpotDiscounts, err = parseDiscounts(data[key])
+		case ReservedInstancesKey:
+			overrides.ReservedInstances, err = parseCounts(data[key])
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s, %w", key, err)
+		}
+	}
+	return overrides, nil
+}
+
+// discount returns the discount of the instance type, or else of its SKU family
+func discount(discounts map[string]float64, instanceType, skuFamily string) float64 {
+	if discount, ok := discounts[instanceType]; ok {
+		return discount
+	}
+	return discounts[skuFamily]
+}
+
+func parseDiscounts(val string) (map[string]float64, error) {
+	discounts := map[string]float64{}
+	for name, value := range parsePairs(val) {
+		discount, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing discount of %s, %w", name, err)
+		}
+		if discount < 0 || discount > 1 {
+			return nil, fmt.Errorf("discount of %s must be between 0 and 1, got %s", name, value)
+		}
+		discounts[name] = discount
+	}
+	return discounts, nil
+}
+
+func parseCounts(val string) (map[string]int, error) {
+	counts := map[string]int{}
+	for name, value := range parsePairs(val) {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing count of %s, %w", name, err)
+		}
+		if count < 0 {
+			return nil, fmt.Errorf("count of %s must not be negative, got %s", name, value)
+		}
+		counts[name] = count
+	}
+	return counts, nil
+}
+
+// parsePairs parses comma separated name=value pairs, a pair without = has an empty value
+func parsePairs(val string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range lo.Compact(strings.Split(val, ",")) {
+		name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return pairs
+}
@@ -24,33 +24,58 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing/client"
 	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/logging"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 )
 
 // pricingUpdatePeriod is how often we try to update our pricing information after the initial update on startup
 const pricingUpdatePeriod = 12 * time.Hour
 
-const defaultRegion = "eastus"
+// azureChinaCloud is the name of the Azure China cloud, whose regions the retail prices API does not cover
+const azureChinaCloud = "AzureChinaCloud"
+
+// defaultCurrencyCode is the currency of the retail prices when none is requested, and of the static pricing
+const defaultCurrencyCode = "USD"
 
 // Provider provides actual pricing data to the Azure cloud provider to allow it to make more informed decisions
 // regarding which instances to launch.  This is initialized at startup with a periodically updated static price list to
 // support running in locations where pricing data is unavailable.  In those cases the static pricing data provides a
 // relative ordering that is still more accurate than our previous pricing model.  In the event that a pricing update
 // fails, the previous pricing information is retained and used which may be the static initial pricing data if pricing
-// updates never succeed.
+// updates never succeed. The last pricing fetched is persisted to the snapshot store, when there is one, and takes
+// precedence over the static pricing on startup.
 type Provider struct {
-	pricing client.PricingAPI
-	region  string
-	cm      *pretty.ChangeMonitor
+	pricing   client.PricingAPI
+	snapshots SnapshotStore
+	region    string
+	// currencyCode of the fetched prices, as requested from the pricing API
+	currencyCode string
+	cm           *pretty.ChangeMonitor
 
 	mu                 sync.RWMutex
 	onDemandUpdateTime time.Time
 	onDemandPrices     map[string]float64
 	spotUpdateTime     time.Time
 	spotPrices         map[string]float64
+
+	overrides        *Overrides
+	onDemandRunning  map[string]int
+	overridesSetTime time.Time
+	launches         map[*launch]struct{}
+	reservedCovered  sets.Set[string] // instance types with fewer on-demand VMs running or launching than reserved
+	seqNum           uint64
+}
+
+// launch is an on-demand launch which may use up a reserved instance
+type launch struct {
+	instanceType string
+	completed    time.Time
 }
 
 type Err struct {
@@ -59,30 +84,48 @@ type Err struct {
 	lastSpotUpdateTime     time.Time
 }
 
-// NewPricingAPI returns a pricing API
-func NewAPI() client.PricingAPI {
-	return client.New()
+// NewAPI returns the retail prices API of the cloud (as in ARM_CLOUD, the public one when empty), in the currency
+// (USD when empty). The public retail prices API also covers the Azure Government regions, but none covers the
+// Azure China ones, so there is no API for Azure China, unless a base URL is given, e.g. of a local stand-in.
+func NewAPI(cloud, baseURL, currencyCode string) client.PricingAPI {
+	if strings.EqualFold(cloud, azureChinaCloud) && baseURL == "" {
+		return nil
+	}
+	return client.New(client.Options{BaseURL: baseURL, CurrencyCode: currencyCode})
 }
 
-func NewProvider(ctx context.Context, pricing client.PricingAPI, region string, startAsync <-chan struct{}) *Provider {
-	// see if we've got region specific pricing data
-	staticPricing, ok := initialOnDemandPrices[region]
-	if !ok {
-		// and if not, fall back to the always available eastus
-		staticPricing = initialOnDemandPrices[defaultRegion]
-	}
+// NewProvider takes a nil pricing API when there is none for the region, in which case it keeps the static pricing.
+// The currency code is the one the pricing API was created with (USD when empty).
+func NewProvider(ctx context.Context, pricing client.PricingAPI, snapshots SnapshotStore, region string, currencyCode string, startAsync <-chan struct{}) *Provider {
+	// use the region specific static pricing, or else the one of the nearest region
+	staticRegion := staticPricingRegion(region)
+	staticPricing := initialOnDemandPrices[staticRegion]
 
 	p := &Provider{
 		region:             region,
+		currencyCode:       strings.ToUpper(lo.Ternary(currencyCode == "", defaultCurrencyCode, currencyCode)),
 		onDemandUpdateTime: initialPriceUpdate,
 		onDemandPrices:     staticPricing,
 		spotUpdateTime:     initialPriceUpdate,
 		// default our spot pricing to the same as the on-demand pricing until a price update
-		spotPrices: staticPricing,
-		pricing:    pricing,
-		cm:         pretty.NewChangeMonitor(),
+		spotPrices:      staticPricing,
+		pricing:         pricing,
+		snapshots:       snapshots,
+		cm:              pretty.NewChangeMonitor(),
+		launches:        map[*launch]struct{}{},
+		reservedCovered: sets.New[string](),
 	}
 	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).Named("pricing"))
+	p.loadSnapshot(ctx)
+	if p.OnDemandLastUpdated().Equal(initialPriceUpdate) {
+		logging.FromContext(ctx).Infof("using the static pricing of region %s for region %s until pricing is fetched", staticRegion, region)
+		metrics.PricingStaticFallback.WithLabelValues(region, staticRegion).Set(1)
+	}
+	if pricing == nil {
+		logging.FromContext(ctx).Infof("there is no retail prices API for region %s, using the static pricing of region %s", region, staticRegion)
+	}
+	metrics.PricingLastUpdated.WithLabelValues(corev1beta1.CapacityTypeOnDemand).Set(float64(p.onDemandUpdateTime.Unix()))
+	metrics.PricingLastUpdated.WithLabelValues(corev1beta1.CapacityTypeSpot).Set(float64(p.spotUpdateTime.Unix()))
 
 	go func() {
 		// perform an initial price update at startup
@@ -158,7 +201,119 @@ func (p *Provider) SpotPrice(instanceType string) (float64, bool) {
 	return price, true
 }
 
+// EffectiveOnDemandPrice returns the on-demand price of an instance type of the SKU family (as in the
+// karpenter.azure.com/sku-family label) actually paid, after the price overrides, returning false if there is
+// no known on-demand pricing for the instance type.
+func (p *Provider) EffectiveOnDemandPrice(instanceType, skuFamily string) (float64, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	price, ok := p.onDemandPrices[instanceType]
+	if !ok {
+		return 0.0, false
+	}
+	if p.overrides == nil {
+		return price, true
+	}
+	if p.reservedCovered.Has(instanceType) {
+		return 0.0, true
+	}
+	return price * (1 - discount(p.overrides.OnDemandDiscounts, instanceType, skuFamily)), true
+}
+
+// EffectiveSpotPrice returns the spot price of an instance type of the SKU family actually paid, after the
+// price overrides, returning false if there is no known spot pricing for the instance type.
+func (p *Provider) EffectiveSpotPrice(instanceType, skuFamily string) (float64, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	price, ok := p.spotPrices[instanceType]
+	if !ok {
+		return 0.0, false
+	}
+	if p.overrides == nil {
+		return price, true
+	}
+	return price * (1 - discount(p.overrides.SpotDiscounts, instanceType, skuFamily)), true
+}
+
+// SetOverrides sets the price overrides, nil for none, along with the number of on-demand VMs running by instance
+// type to account for the reserved instances. It returns whether the effective prices changed.
+func (p *Provider) SetOverrides(overrides *Overrides, onDemandRunning map[string]int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for launch := range p.launches {
+		// the VMs running, counted after the previous overrides were set, account for the launches completed before
+		if !launch.completed.IsZero() && launch.completed.Before(p.overridesSetTime) {
+			delete(p.launches, launch)
+		}
+	}
+	p.overridesSetTime = time.Now()
+	overridesChanged := !equality.Semantic.DeepEqual(p.overrides, overrides)
+	p.overrides = overrides
+	p.onDemandRunning = onDemandRunning
+	if !p.updateReservedCovered() && !overridesChanged {
+		return false
+	}
+	p.seqNum++
+	return true
+}
+
+// Launch holds an on-demand launch of the instance type against its reserved instances, so that the instance type
+// is not priced as covered by reserved instances the launches in flight use up. The returned func must be called once
+// the launch completed, with whether the VM was created: created VMs remain held until they are counted as running.
+func (p *Provider) Launch(instanceType string) func(created bool) {
+	l := &launch{instanceType: instanceType}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.launches[l] = struct{}{}
+	if p.updateReservedCovered() {
+		p.seqNum++
+	}
+	return func(created bool) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if created {
+			l.completed = time.Now()
+			return
+		}
+		delete(p.launches, l)
+		if p.updateReservedCovered() {
+			p.seqNum++
+		}
+	}
+}
+
+// updateReservedCovered updates the instance types covered by reserved instances, returning whether they changed
+func (p *Provider) updateReservedCovered() bool {
+	reservedCovered := sets.New[string]()
+	if p.overrides != nil {
+		launching := map[string]int{}
+		for launch := range p.launches {
+			launching[launch.instanceType]++
+		}
+		for instanceType, reserved := range p.overrides.ReservedInstances {
+			if p.onDemandRunning[instanceType]+launching[instanceType] < reserved {
+				reservedCovered.Insert(instanceType)
+			}
+		}
+	}
+	if p.reservedCovered.Equal(reservedCovered) {
+		return false
+	}
+	p.reservedCovered = reservedCovered
+	return true
+}
+
+// SeqNum changes whenever the price overrides change the effective prices
+func (p *Provider) SeqNum() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.seqNum
+}
+
 func (p *Provider) updatePricing(ctx context.Context) {
+	if p.pricing == nil {
+		return
+	}
 	prices := map[client.Item]bool{}
 	err := p.fetchPricing(ctx, processPage(prices))
 	if err != nil {
@@ -186,6 +341,57 @@ func (p *Provider) updatePricing(ctx context.Context) {
 	}()
 
 	wg.Wait()
+	p.saveSnapshot(ctx)
+}
+
+// loadSnapshot replaces the static pricing with the persisted one, when it is of the same region and currency and more recent
+func (p *Provider) loadSnapshot(ctx context.Context) {
+	if p.snapshots == nil {
+		return
+	}
+	snapshot, err := p.snapshots.Load(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("loading pricing snapshot for region %s, using the static pricing, %s", p.region, err)
+		return
+	}
+	if snapshot == nil || snapshot.Region != p.region {
+		return
+	}
+	if snapshot.CurrencyCode != p.currencyCode {
+		logging.FromContext(ctx).Infof("ignoring pricing snapshot in currency %q, prices are in %s", snapshot.CurrencyCode, p.currencyCode)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(snapshot.OnDemandPrices) > 0 && snapshot.OnDemandUpdateTime.After(p.onDemandUpdateTime) {
+		p.onDemandPrices = snapshot.OnDemandPrices
+		p.onDemandUpdateTime = snapshot.OnDemandUpdateTime
+	}
+	if len(snapshot.SpotPrices) > 0 && snapshot.SpotUpdateTime.After(p.spotUpdateTime) {
+		p.spotPrices = snapshot.SpotPrices
+		p.spotUpdateTime = snapshot.SpotUpdateTime
+	}
+	logging.FromContext(ctx).With("on-demand", p.onDemandUpdateTime.Format(time.RFC3339), "spot", p.spotUpdateTime.Format(time.RFC3339)).Infof("loaded pricing snapshot for region %s", p.region)
+}
+
+// saveSnapshot persists the pricing, once it was fetched rather than loaded
+func (p *Provider) saveSnapshot(ctx context.Context) {
+	if p.snapshots == nil {
+		return
+	}
+	p.mu.RLock()
+	snapshot := &Snapshot{
+		Region:             p.region,
+		CurrencyCode:       p.currencyCode,
+		OnDemandUpdateTime: p.onDemandUpdateTime,
+		OnDemandPrices:     p.onDemandPrices,
+		SpotUpdateTime:     p.spotUpdateTime,
+		SpotPrices:         p.spotPrices,
+	}
+	p.mu.RUnlock()
+	if err := p.snapshots.Save(ctx, snapshot); err != nil {
+		logging.FromContext(ctx).Errorf("saving pricing snapshot for region %s, %s", p.region, err)
+	}
 }
 
 func (p *Provider) UpdateOnDemandPricing(ctx context.Context, onDemandPrices map[string]float64) *Err {
@@ -197,26 +403,22 @@ func (p *Provider) UpdateOnDemandPricing(ctx context.Context, onDemandPrices map
 
 	p.onDemandPrices = lo.Assign(onDemandPrices)
 	p.onDemandUpdateTime = time.Now()
+	metrics.PricingStaticFallback.Reset()
+	metrics.PricingLastUpdated.WithLabelValues(corev1beta1.CapacityTypeOnDemand).Set(float64(p.onDemandUpdateTime.Unix()))
 	if p.cm.HasChanged("on-demand-prices", p.onDemandPrices) {
 		logging.FromContext(ctx).With("instance-type-count", len(p.onDemandPrices)).Infof("updated on-demand pricing for region %s", p.region)
 	}
 	return nil
 }
 
+// fetchPricing does not hold the lock while fetching, as retries can make it take minutes
 func (p *Provider) fetchPricing(ctx context.Context, pageHandler func(output *client.ProductsPricePage)) *Err {
-	p.mu.Lock()
-	defer p.mu.Unlock()
 	filters := []*client.Filter{
 		{
 			Field:    "priceType",
 			Operator: client.Equals,
 			Value:    "Consumption",
 		},
-		{
-			Field:    "currencyCode",
-			Operator: client.Equals,
-			Value:    "USD",
-		},
 		{
 			Field:    "serviceFamily",
 			Operator: client.Equals,
@@ -234,6 +436,8 @@ func (p *Provider) fetchPricing(ctx context.Context, pageHandler func(output *cl
 		}}
 	err := p.pricing.GetProductsPricePages(ctx, filters, pageHandler)
 	if err != nil {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
 		return &Err{error: err, lastOnDemandUpdateTime: p.onDemandUpdateTime, lastSpotUpdateTime: p.spotUpdateTime}
 	}
 	return nil
@@ -263,6 +467,7 @@ func (p *Provider) UpdateSpotPricing(ctx context.Context, spotPrices map[string]
 
 	p.spotPrices = lo.Assign(spotPrices)
 	p.spotUpdateTime = time.Now()
+	metrics.PricingLastUpdated.WithLabelValues(corev1beta1.CapacityTypeSpot).Set(float64(p.spotUpdateTime.Unix()))
 	if p.cm.HasChanged("spot-prices", p.spotPrices) {
 		logging.FromContext(ctx).With("instance-type-count", len(p.spotPrices)).Infof("updated spot pricing for region %s", p.region)
 	}
@@ -290,15 +495,16 @@ func (p *Provider) LivenessProbe(_ *http.Request) error {
 }
 
 func (p *Provider) Reset() {
-	// see if we've got region specific pricing data
-	staticPricing, ok := initialOnDemandPrices[p.region]
-	if !ok {
-		// and if not, fall back to the always available eastus
-		staticPricing = initialOnDemandPrices[defaultRegion]
-	}
+	staticPricing := initialOnDemandPrices[staticPricingRegion(p.region)]
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.onDemandPrices = staticPricing
 	p.onDemandUpdateTime = initialPriceUpdate
+	p.overrides = nil
+	p.onDemandRunning = nil
+	p.overridesSetTime = time.Time{}
+	p.launches = map[*launch]struct{}{}
+	p.reservedCovered = sets.New[string]()
+	p.seqNum++
 }
@@ -0,0 +1,83 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"strings"
+)
+
+const defaultRegion = "eastus"
+
+// regionFallbacks are the nearest regions with static pricing of the regions without, by geography
+var regionFallbacks = map[string]string{
+	"austriaeast":      "germanywestcentral",
+	"belgiumcentral":   "westeurope",
+	"chilecentral":     "brazilsouth",
+	"denmarkeast":      "swedencentral",
+	"indonesiacentral": "southeastasia",
+	"israelcentral":    "uaenorth",
+	"italynorth":       "switzerlandnorth",
+	"malaysiawest":     "southeastasia",
+	"mexicocentral":    "southcentralus",
+	"newzealandnorth":  "australiaeast",
+	"spaincentral":     "francecentral",
+	"usdodcentral":     "centralus",
+	"usdodeast":        "eastus",
+	"usgovarizona":     "westus3",
+	"usgoviowa":        "centralus",
+	"usgovtexas":       "southcentralus",
+	"usgovvirginia":    "eastus",
+}
+
+// geographyFallbacks are the regions with static pricing of the geographies, by prefix of their region names,
+// for regions not in regionFallbacks, e.g. ones more recent than the static pricing
+var geographyFallbacks = []struct{ prefix, region string }{
+	{"australia", "australiaeast"},
+	{"brazil", "brazilsouth"},
+	{"canada", "canadacentral"},
+	{"china", "eastasia"},
+	{"france", "francecentral"},
+	{"germany", "germanywestcentral"},
+	{"japan", "japaneast"},
+	{"jioindia", "jioindiawest"},
+	{"korea", "koreacentral"},
+	{"norway", "norwayeast"},
+	{"southafrica", "southafricanorth"},
+	{"sweden", "swedencentral"},
+	{"switzerland", "switzerlandnorth"},
+	{"uae", "uaenorth"},
+	{"uk", "uksouth"},
+	{"usdod", "eastus"},
+	{"usgov", "eastus"},
+}
+
+// staticPricingRegion returns the region whose static pricing to use for the region: the region itself, else the
+// nearest one by geography, else eastus
+func staticPricingRegion(region string) string {
+	if _, ok := initialOnDemandPrices[region]; ok {
+		return region
+	}
+	if fallback, ok := regionFallbacks[region]; ok {
+		return fallback
+	}
+	for _, geography := range geographyFallbacks {
+		if strings.HasPrefix(region, geography.prefix) {
+			return geography.region
+		}
+	}
+	return defaultRegion
+}
@@ -0,0 +1,113 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// SnapshotConfigMapName is the name of the ConfigMap, in the namespace of Karpenter, holding the last pricing
+	// successfully fetched, so that a restart does not fall back to the possibly months old static pricing
+	SnapshotConfigMapName = "karpenter-pricing-snapshot"
+	snapshotKey           = "snapshot.json"
+)
+
+// Snapshot is the pricing of a region, along with its currency and when it was fetched
+type Snapshot struct {
+	Region             string             `json:"region"`
+	CurrencyCode       string             `json:"currencyCode"`
+	OnDemandUpdateTime time.Time          `json:"onDemandUpdateTime"`
+	OnDemandPrices     map[string]float64 `json:"onDemandPrices"`
+	SpotUpdateTime     time.Time          `json:"spotUpdateTime"`
+	SpotPrices         map[string]float64 `json:"spotPrices"`
+}
+
+// SnapshotStore persists the pricing snapshot across restarts
+type SnapshotStore interface {
+	// Load returns the last saved snapshot, nil if there is none
+	Load(ctx context.Context) (*Snapshot, error)
+	Save(ctx context.Context, snapshot *Snapshot) error
+}
+
+// ConfigMapSnapshotStore stores the pricing snapshot in a ConfigMap. It uses the clientset rather than the
+// controller-runtime client, as the pricing is loaded before the caches of the manager are started.
+type ConfigMapSnapshotStore struct {
+	kubernetesInterface kubernetes.Interface
+	namespace           string
+}
+
+func NewConfigMapSnapshotStore(kubernetesInterface kubernetes.Interface, namespace string) *ConfigMapSnapshotStore {
+	return &ConfigMapSnapshotStore{
+		kubernetesInterface: kubernetesInterface,
+		namespace:           namespace,
+	}
+}
+
+func (s *ConfigMapSnapshotStore) Load(ctx context.Context) (*Snapshot, error) {
+	configMap, err := s.kubernetesInterface.CoreV1().ConfigMaps(s.namespace).Get(ctx, SnapshotConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getting pricing snapshot configmap, %w", err)
+	}
+	data, ok := configMap.Data[snapshotKey]
+	if !ok {
+		return nil, nil
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal([]byte(data), snapshot); err != nil {
+		return nil, fmt.Errorf("unmarshaling pricing snapshot, %w", err)
+	}
+	return snapshot, nil
+}
+
+func (s *ConfigMapSnapshotStore) Save(ctx context.Context, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshaling pricing snapshot, %w", err)
+	}
+	configMaps := s.kubernetesInterface.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := configMaps.Get(ctx, SnapshotConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: SnapshotConfigMapName, Namespace: s.namespace},
+			Data:       map[string]string{snapshotKey: string(data)},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("creating pricing snapshot configmap, %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting pricing snapshot configmap, %w", err)
+	}
+	configMap.Data = map[string]string{snapshotKey: string(data)}
+	if _, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("updating pricing snapshot configmap, %w", err)
+	}
+	return nil
+}
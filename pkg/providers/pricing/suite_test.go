@@ -24,9 +24,13 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kubefake "k8s.io/client-go/kubernetes/fake"
 	. "knative.dev/pkg/logging/testing"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing/client"
 )
@@ -47,7 +51,7 @@ var _ = BeforeSuite(func() {
 	ctx, stop = context.WithCancel(ctx)
 
 	fakePricingAPI = &fake.PricingAPI{}
-	pricingProvider = pricing.NewProvider(ctx, fakePricingAPI, "", make(chan struct{}))
+	pricingProvider = pricing.NewProvider(ctx, fakePricingAPI, nil, "", "", make(chan struct{}))
 })
 
 var _ = AfterSuite(func() {
@@ -64,7 +68,7 @@ var _ = Describe("Pricing", func() {
 	})
 	It("should return static on-demand data if pricing API fails", func() {
 		fakePricingAPI.NextError.Set(fmt.Errorf("failed"))
-		p := pricing.NewProvider(ctx, fakePricingAPI, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, fakePricingAPI, nil, "", "", make(chan struct{}))
 		price, ok := p.OnDemandPrice("Standard_D1")
 		Expect(ok).To(BeTrue())
 		Expect(price).To(BeNumerically(">", 0))
@@ -78,7 +82,7 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, fakePricingAPI, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, fakePricingAPI, nil, "", "", make(chan struct{}))
 		Eventually(func() bool { return p.OnDemandLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		price, ok := p.OnDemandPrice("Standard_D1")
@@ -99,7 +103,7 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, fakePricingAPI, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, fakePricingAPI, nil, "", "", make(chan struct{}))
 		Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		price, ok := p.SpotPrice("Standard_D1")
@@ -110,4 +114,263 @@ var _ = Describe("Pricing", func() {
 		Expect(ok).To(BeTrue())
 		Expect(price).To(BeNumerically("==", 1.13))
 	})
+	Context("Overrides", func() {
+		BeforeEach(func() {
+			fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
+				Items: []client.Item{
+					fake.NewProductPrice("Standard_D2s_v3", 1.00),
+					fake.NewProductPrice("Standard_D4s_v3", 2.00),
+					fake.NewSpotProductPrice("Standard_D2s_v3", 0.50),
+				},
+			})
+		})
+		newProvider := func() *pricing.Provider {
+			GinkgoHelper()
+			updateStart := time.Now()
+			p := pricing.NewProvider(ctx, fakePricingAPI, nil, "", "", make(chan struct{}))
+			Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
+			return p
+		}
+
+		It("should parse the overrides", func() {
+			overrides, err := pricing.ParseOverrides(map[string]string{
+				pricing.OnDemandDiscountsKey: "D=0.15, Standard_D4s_v3=0.3",
+				pricing.SpotDiscountsKey:     "D=0.1",
+				pricing.ReservedInstancesKey: "Standard_D4s_v3=10",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(overrides.OnDemandDiscounts).To(Equal(map[string]float64{"D": 0.15, "Standard_D4s_v3": 0.3}))
+			Expect(overrides.SpotDiscounts).To(Equal(map[string]float64{"D": 0.1}))
+			Expect(overrides.ReservedInstances).To(Equal(map[string]int{"Standard_D4s_v3": 10}))
+		})
+		DescribeTable("should fail to parse invalid overrides", func(data map[string]string) {
+			_, err := pricing.ParseOverrides(data)
+			Expect(err).To(HaveOccurred())
+		},
+			Entry("unknown key", map[string]string{"discounts": "D=0.1"}),
+			Entry("discount that is not a number", map[string]string{pricing.OnDemandDiscountsKey: "D=ten"}),
+			Entry("discount above 1", map[string]string{pricing.OnDemandDiscountsKey: "D=15"}),
+			Entry("negative discount", map[string]string{pricing.SpotDiscountsKey: "D=-0.1"}),
+			Entry("missing count", map[string]string{pricing.ReservedInstancesKey: "Standard_D4s_v3"}),
+			Entry("negative count", map[string]string{pricing.ReservedInstancesKey: "Standard_D4s_v3=-1"}),
+		)
+		It("should return the retail prices without overrides", func() {
+			p := newProvider()
+			price, ok := p.EffectiveOnDemandPrice("Standard_D2s_v3", "D")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.00))
+			price, ok = p.EffectiveSpotPrice("Standard_D2s_v3", "D")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 0.50))
+			_, ok = p.EffectiveSpotPrice("Standard_D4s_v3", "D")
+			Expect(ok).To(BeFalse())
+		})
+		It("should apply the discount of the instance type over the one of its family", func() {
+			p := newProvider()
+			Expect(p.SetOverrides(&pricing.Overrides{
+				OnDemandDiscounts: map[string]float64{"D": 0.2, "Standard_D4s_v3": 0.5},
+				SpotDiscounts:     map[string]float64{"D": 0.1},
+			}, nil)).To(BeTrue())
+			price, _ := p.EffectiveOnDemandPrice("Standard_D2s_v3", "D")
+			Expect(price).To(BeNumerically("~", 0.80))
+			price, _ = p.EffectiveOnDemandPrice("Standard_D4s_v3", "D")
+			Expect(price).To(BeNumerically("~", 1.00))
+			price, _ = p.EffectiveSpotPrice("Standard_D2s_v3", "D")
+			Expect(price).To(BeNumerically("~", 0.45))
+			// the retail prices are unchanged
+			price, _ = p.OnDemandPrice("Standard_D2s_v3")
+			Expect(price).To(BeNumerically("==", 1.00))
+		})
+		It("should make reserved instances free until they are all running", func() {
+			p := newProvider()
+			overrides := &pricing.Overrides{
+				OnDemandDiscounts: map[string]float64{"D": 0.2},
+				ReservedInstances: map[string]int{"Standard_D4s_v3": 2},
+			}
+			Expect(p.SetOverrides(overrides, map[string]int{"Standard_D4s_v3": 1})).To(BeTrue())
+			price, _ := p.EffectiveOnDemandPrice("Standard_D4s_v3", "D")
+			Expect(price).To(BeNumerically("==", 0))
+
+			Expect(p.SetOverrides(overrides, map[string]int{"Standard_D4s_v3": 2})).To(BeTrue())
+			price, _ = p.EffectiveOnDemandPrice("Standard_D4s_v3", "D")
+			Expect(price).To(BeNumerically("~", 1.60))
+		})
+		It("should not make reserved instances free once launches in flight use them up", func() {
+			p := newProvider()
+			overrides := &pricing.Overrides{ReservedInstances: map[string]int{"Standard_D4s_v3": 2}}
+			Expect(p.SetOverrides(overrides, map[string]int{"Standard_D4s_v3": 1})).To(BeTrue())
+
+			seqNum := p.SeqNum()
+			release := p.Launch("Standard_D4s_v3")
+			Expect(p.SeqNum()).ToNot(Equal(seqNum))
+			price, _ := p.EffectiveOnDemandPrice("Standard_D4s_v3", "D")
+			Expect(price).To(BeNumerically("~", 2.00))
+			// launches which fail no longer use up the reserved instances
+			release(false)
+			price, _ = p.EffectiveOnDemandPrice("Standard_D4s_v3", "D")
+			Expect(price).To(BeNumerically("==", 0))
+
+			// launched VMs use them up until they are counted as running
+			p.Launch("Standard_D4s_v3")(true)
+			Expect(p.SetOverrides(overrides, map[string]int{"Standard_D4s_v3": 1})).To(BeFalse())
+			price, _ = p.EffectiveOnDemandPrice("Standard_D4s_v3", "D")
+			Expect(price).To(BeNumerically("~", 2.00))
+			Expect(p.SetOverrides(overrides, map[string]int{"Standard_D4s_v3": 2})).To(BeFalse())
+			Expect(p.SetOverrides(overrides, map[string]int{"Standard_D4s_v3": 1})).To(BeTrue())
+			price, _ = p.EffectiveOnDemandPrice("Standard_D4s_v3", "D")
+			Expect(price).To(BeNumerically("==", 0))
+		})
+		It("should not change the sequence number for launches of instance types without reserved instances", func() {
+			p := newProvider()
+			Expect(p.SetOverrides(&pricing.Overrides{ReservedInstances: map[string]int{"Standard_D4s_v3": 2}}, nil)).To(BeTrue())
+			seqNum := p.SeqNum()
+			p.Launch("Standard_D2s_v3")(false)
+			p.Launch("Standard_D4s_v3")(false)
+			Expect(p.SeqNum()).To(Equal(seqNum))
+		})
+		It("should only change the sequence number when the effective prices change", func() {
+			p := newProvider()
+			overrides := &pricing.Overrides{ReservedInstances: map[string]int{"Standard_D4s_v3": 2}}
+			seqNum := p.SeqNum()
+			Expect(p.SetOverrides(overrides, nil)).To(BeTrue())
+			Expect(p.SeqNum()).ToNot(Equal(seqNum))
+
+			seqNum = p.SeqNum()
+			Expect(p.SetOverrides(overrides, map[string]int{"Standard_D4s_v3": 1})).To(BeFalse())
+			Expect(p.SeqNum()).To(Equal(seqNum))
+
+			Expect(p.SetOverrides(nil, nil)).To(BeTrue())
+			Expect(p.SeqNum()).ToNot(Equal(seqNum))
+		})
+	})
+	Context("Snapshot", func() {
+		var snapshots *pricing.ConfigMapSnapshotStore
+
+		BeforeEach(func() {
+			snapshots = pricing.NewConfigMapSnapshotStore(kubefake.NewSimpleClientset(), "karpenter")
+		})
+
+		It("should load the snapshot on startup when the pricing API fails", func() {
+			updateTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+			Expect(snapshots.Save(ctx, &pricing.Snapshot{
+				Region:             "",
+				CurrencyCode:       "USD",
+				OnDemandUpdateTime: updateTime,
+				OnDemandPrices:     map[string]float64{"Standard_D1": 1.20},
+				SpotUpdateTime:     updateTime,
+				SpotPrices:         map[string]float64{"Standard_D1": 0.20},
+			})).To(Succeed())
+			fakePricingAPI.NextError.Set(fmt.Errorf("failed"))
+			p := pricing.NewProvider(ctx, fakePricingAPI, snapshots, "", "", make(chan struct{}))
+
+			price, ok := p.OnDemandPrice("Standard_D1")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.20))
+			price, ok = p.SpotPrice("Standard_D1")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 0.20))
+			Expect(p.OnDemandLastUpdated()).To(BeTemporally("==", updateTime))
+			Expect(p.SpotLastUpdated()).To(BeTemporally("==", updateTime))
+			Expect(testutil.ToFloat64(metrics.PricingLastUpdated.WithLabelValues(corev1beta1.CapacityTypeSpot))).To(BeNumerically("==", updateTime.Unix()))
+		})
+		It("should ignore the snapshot of another region", func() {
+			Expect(snapshots.Save(ctx, &pricing.Snapshot{
+				Region:             "westus",
+				OnDemandUpdateTime: time.Now(),
+				OnDemandPrices:     map[string]float64{"Standard_D1": 1.20},
+			})).To(Succeed())
+			fakePricingAPI.NextError.Set(fmt.Errorf("failed"))
+			p := pricing.NewProvider(ctx, fakePricingAPI, snapshots, "", "", make(chan struct{}))
+
+			price, ok := p.OnDemandPrice("Standard_D1")
+			Expect(ok).To(BeTrue())
+			Expect(price).ToNot(BeNumerically("==", 1.20))
+		})
+		It("should ignore the snapshot of another currency", func() {
+			Expect(snapshots.Save(ctx, &pricing.Snapshot{
+				Region:             "",
+				CurrencyCode:       "EUR",
+				OnDemandUpdateTime: time.Now(),
+				OnDemandPrices:     map[string]float64{"Standard_D1": 1.20},
+			})).To(Succeed())
+			fakePricingAPI.NextError.Set(fmt.Errorf("failed"))
+			p := pricing.NewProvider(ctx, fakePricingAPI, snapshots, "", "USD", make(chan struct{}))
+
+			price, ok := p.OnDemandPrice("Standard_D1")
+			Expect(ok).To(BeTrue())
+			Expect(price).ToNot(BeNumerically("==", 1.20))
+		})
+		It("should load the snapshot of the same currency, whatever its case", func() {
+			Expect(snapshots.Save(ctx, &pricing.Snapshot{
+				Region:             "",
+				CurrencyCode:       "EUR",
+				OnDemandUpdateTime: time.Now(),
+				OnDemandPrices:     map[string]float64{"Standard_D1": 1.20},
+			})).To(Succeed())
+			fakePricingAPI.NextError.Set(fmt.Errorf("failed"))
+			p := pricing.NewProvider(ctx, fakePricingAPI, snapshots, "", "eur", make(chan struct{}))
+
+			price, ok := p.OnDemandPrice("Standard_D1")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.20))
+		})
+		It("should save the fetched pricing", func() {
+			fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
+				Items: []client.Item{
+					fake.NewProductPrice("Standard_D1", 1.20),
+					fake.NewSpotProductPrice("Standard_D1", 0.20),
+				},
+			})
+			pricing.NewProvider(ctx, fakePricingAPI, snapshots, "", "", make(chan struct{}))
+
+			Eventually(func(g Gomega) {
+				snapshot, err := snapshots.Load(ctx)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(snapshot).ToNot(BeNil())
+				g.Expect(snapshot.CurrencyCode).To(Equal("USD"))
+				g.Expect(snapshot.OnDemandPrices).To(Equal(map[string]float64{"Standard_D1": 1.20}))
+				g.Expect(snapshot.SpotPrices).To(Equal(map[string]float64{"Standard_D1": 0.20}))
+			}).Should(Succeed())
+		})
+	})
+	Context("Static Fallback", func() {
+		onDemandPrice := func(region string) float64 {
+			GinkgoHelper()
+			p := pricing.NewProvider(ctx, nil, nil, region, "", make(chan struct{}))
+			price, ok := p.OnDemandPrice("Standard_D2s_v3")
+			Expect(ok).To(BeTrue())
+			return price
+		}
+
+		DescribeTable("should use the static pricing of the nearest region", func(region, staticRegion string) {
+			Expect(onDemandPrice(region)).To(Equal(onDemandPrice(staticRegion)))
+			Expect(testutil.ToFloat64(metrics.PricingStaticFallback.WithLabelValues(region, staticRegion))).To(BeNumerically("==", 1))
+		},
+			Entry("region with static pricing", "westeurope", "westeurope"),
+			Entry("region without static pricing", "italynorth", "switzerlandnorth"),
+			Entry("Azure Government region", "usgovarizona", "westus3"),
+			Entry("Azure China region", "chinanorth3", "eastasia"),
+			Entry("unknown region", "marsnorth", "eastus"),
+		)
+		It("should keep the static pricing without a pricing API", func() {
+			p := pricing.NewProvider(ctx, nil, nil, "westeurope", "", make(chan struct{}))
+			Consistently(p.OnDemandLastUpdated).Should(Equal(p.OnDemandLastUpdated()))
+			_, ok := p.SpotPrice("Standard_D2s_v3")
+			Expect(ok).To(BeTrue())
+		})
+		It("should not have a pricing API for Azure China, unless it has a base URL", func() {
+			Expect(pricing.NewAPI("AzureChinaCloud", "", "")).To(BeNil())
+			Expect(pricing.NewAPI("AzureChinaCloud", "http://localhost:8080/api/retail/prices", "")).ToNot(BeNil())
+			Expect(pricing.NewAPI("AzureUSGovernmentCloud", "", "")).ToNot(BeNil())
+		})
+		It("should stop reporting the static fallback once pricing is fetched", func() {
+			fakePricingAPI.ProductsPricePage.Set(&client.ProductsPricePage{
+				Items: []client.Item{fake.NewProductPrice("Standard_D1", 1.20)},
+			})
+			updateStart := time.Now()
+			p := pricing.NewProvider(ctx, fakePricingAPI, nil, "italynorth", "", make(chan struct{}))
+			Eventually(func() bool { return p.OnDemandLastUpdated().After(updateStart) }).Should(BeTrue())
+			Expect(testutil.CollectAndCount(metrics.PricingStaticFallback)).To(Equal(0))
+		})
+	})
 })
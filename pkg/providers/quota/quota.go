@@ -0,0 +1,239 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/samber/lo"
+	"knative.dev/pkg/logging"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+// quotaUpdatePeriod is how often the vCPU usage of the subscription is read after the initial update
+const quotaUpdatePeriod = 5 * time.Minute
+
+const (
+	// RegionalVCPUsUsageName is the usage name of the regional vCPU quota of regular (on-demand) VMs,
+	// which are also held against the quota of their SKU family, e.g. standardDSv3Family
+	RegionalVCPUsUsageName = "cores"
+	// LowPriorityVCPUsUsageName is the usage name of the regional vCPU quota of spot VMs
+	LowPriorityVCPUsUsageName = "lowPriorityCores"
+)
+
+type UsageAPI interface {
+	NewListPager(location string, options *armcompute.UsageClientListOptions) *runtime.Pager[armcompute.UsageClientListResponse]
+}
+
+// Provider tracks the vCPU quota of the subscription in the region, so that offerings without enough quota left
+// are unavailable before launches fail on it. Launches in flight are held against the quota until the usage
+// read after they completed reflects them. Until the first successful update, or for usages it does not know,
+// the provider assumes there is enough quota.
+type Provider struct {
+	usage  UsageAPI
+	region string
+	cm     *pretty.ChangeMonitor
+
+	mu        sync.RWMutex
+	remaining map[string]int64 // vCPUs, by usage name
+	launches  map[*launch]struct{}
+	// answers are the results of the HasQuota queries. seqNum only changes when the quota changes one of them,
+	// that is when offerings run out of quota or have enough of it again.
+	answers map[query]bool
+	seqNum  uint64
+}
+
+type query struct {
+	skuFamily    string
+	capacityType string
+	vcpus        int64
+}
+
+type launch struct {
+	usageNames []string
+	vcpus      int64
+	completed  time.Time // zero while in flight
+}
+
+func NewProvider(ctx context.Context, usage UsageAPI, region string, startAsync <-chan struct{}) *Provider {
+	p := &Provider{
+		usage:     usage,
+		region:    region,
+		cm:        pretty.NewChangeMonitor(),
+		remaining: map[string]int64{},
+		launches:  map[*launch]struct{}{},
+		answers:   map[query]bool{},
+	}
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).Named("quota"))
+
+	go func() {
+		// only the leader launches instances, wait for leader election or to be signaled to exit
+		select {
+		case <-startAsync:
+		case <-ctx.Done():
+			return
+		}
+		for {
+			if err := p.Update(ctx); err != nil {
+				logging.FromContext(ctx).Errorf("updating vCPU quota for region %s, using the existing quota data, %s", p.region, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(quotaUpdatePeriod):
+			}
+		}
+	}()
+	return p
+}
+
+// Update reads the vCPU usages and limits of the subscription in the region
+func (p *Provider) Update(ctx context.Context) error {
+	started := time.Now()
+	remaining := map[string]int64{}
+	pager := p.usage.NewListPager(p.region, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("listing usages, %w", err)
+		}
+		for _, usage := range page.Value {
+			if usage == nil || usage.Name == nil || !isVCPUsUsage(lo.FromPtr(usage.Name.Value)) {
+				continue
+			}
+			remaining[lo.FromPtr(usage.Name.Value)] = lo.FromPtr(usage.Limit) - int64(lo.FromPtr(usage.CurrentValue))
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remaining = remaining
+	for launch := range p.launches {
+		// the usage read after a launch completed accounts for it
+		if !launch.completed.IsZero() && launch.completed.Before(started) {
+			delete(p.launches, launch)
+		}
+	}
+	p.updateSeqNum()
+	metrics.VCPUQuotaRemaining.Reset()
+	for usageName, vcpus := range remaining {
+		metrics.VCPUQuotaRemaining.WithLabelValues(usageName).Set(float64(vcpus))
+	}
+	if p.cm.HasChanged("remaining", remaining) {
+		logging.FromContext(ctx).With("regional", remaining[RegionalVCPUsUsageName], "low-priority", remaining[LowPriorityVCPUsUsageName]).Debugf("updated remaining vCPU quota")
+	}
+	return nil
+}
+
+// HasQuota returns whether there is enough vCPU quota left, less the launches in flight, for a VM of the SKU family
+// (e.g. standardDSv3Family) and capacity type
+func (p *Provider) HasQuota(skuFamily, capacityType string, vcpus int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q := query{skuFamily: skuFamily, capacityType: capacityType, vcpus: vcpus}
+	hasQuota := p.hasQuota(q)
+	p.answers[q] = hasQuota
+	return hasQuota
+}
+
+// Reserve holds the vCPUs of a launch against the quota. The returned func must be called once the launch completed,
+// with whether the VM was created: the vCPUs of created VMs remain held until the next update, the others are released.
+func (p *Provider) Reserve(skuFamily, capacityType string, vcpus int64) func(created bool) {
+	l := &launch{usageNames: usageNames(skuFamily, capacityType), vcpus: vcpus}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.launches[l] = struct{}{}
+	p.updateSeqNum()
+	return func(created bool) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if created {
+			l.completed = time.Now()
+			return
+		}
+		delete(p.launches, l)
+		p.updateSeqNum()
+	}
+}
+
+// SeqNum changes whenever the quota changed whether there is enough of it for one of the HasQuota queries
+func (p *Provider) SeqNum() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.seqNum
+}
+
+// Reset forgets the quota data and launches, for tests
+func (p *Provider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remaining = map[string]int64{}
+	p.launches = map[*launch]struct{}{}
+	p.answers = map[query]bool{}
+	p.seqNum++
+}
+
+func (p *Provider) hasQuota(q query) bool {
+	for _, usageName := range usageNames(q.skuFamily, q.capacityType) {
+		remaining, ok := p.remaining[usageName]
+		if ok && remaining-p.inFlight(usageName) < q.vcpus {
+			return false
+		}
+	}
+	return true
+}
+
+// updateSeqNum changes the sequence number if the quota changed the answer to any of the HasQuota queries
+func (p *Provider) updateSeqNum() {
+	changed := false
+	for q, hasQuota := range p.answers {
+		if current := p.hasQuota(q); current != hasQuota {
+			p.answers[q] = current
+			changed = true
+		}
+	}
+	if changed {
+		p.seqNum++
+	}
+}
+
+func (p *Provider) inFlight(usageName string) int64 {
+	return lo.SumBy(lo.Keys(p.launches), func(launch *launch) int64 {
+		return lo.Ternary(lo.Contains(launch.usageNames, usageName), launch.vcpus, 0)
+	})
+}
+
+func usageNames(skuFamily, capacityType string) []string {
+	if capacityType == corev1beta1.CapacityTypeSpot {
+		return []string{LowPriorityVCPUsUsageName}
+	}
+	return []string{RegionalVCPUsUsageName, skuFamily}
+}
+
+// isVCPUsUsage returns whether the usage is a vCPU one, rather than e.g. availabilitySets or PremiumDiskCount
+func isVCPUsUsage(usageName string) bool {
+	return usageName == RegionalVCPUsUsageName || usageName == LowPriorityVCPUsUsageName || strings.HasSuffix(usageName, "Family")
+}
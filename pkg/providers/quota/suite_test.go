@@ -0,0 +1,161 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "knative.dev/pkg/logging/testing"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/quota"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+
+var fakeUsageAPI *fake.UsageAPI
+var quotaProvider *quota.Provider
+
+func TestAzure(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Providers/Quota/Azure")
+}
+
+var _ = BeforeSuite(func() {
+	ctx, stop = context.WithCancel(ctx)
+
+	fakeUsageAPI = &fake.UsageAPI{}
+	quotaProvider = quota.NewProvider(ctx, fakeUsageAPI, fake.Region, make(chan struct{}))
+})
+
+var _ = AfterSuite(func() {
+	stop()
+})
+
+var _ = BeforeEach(func() {
+	fakeUsageAPI.Reset()
+	quotaProvider.Reset()
+})
+
+var _ = Describe("Quota", func() {
+	BeforeEach(func() {
+		fakeUsageAPI.Usages.Append(
+			fake.NewUsage(quota.RegionalVCPUsUsageName, 90, 100),
+			fake.NewUsage(quota.LowPriorityVCPUsUsageName, 0, 8),
+			fake.NewUsage("standardDSv3Family", 10, 20),
+			fake.NewUsage("standardFSv2Family", 0, 0),
+			fake.NewUsage("availabilitySets", 0, 2500),
+		)
+	})
+	It("should assume there is quota before the first update", func() {
+		Expect(quotaProvider.HasQuota("standardFSv2Family", corev1beta1.CapacityTypeOnDemand, 2)).To(BeTrue())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeSpot, 64)).To(BeTrue())
+	})
+	It("should assume there is quota when the usages can't be read", func() {
+		fakeUsageAPI.NextError.Set(fmt.Errorf("failed"))
+		Expect(quotaProvider.Update(ctx)).ToNot(Succeed())
+		Expect(quotaProvider.HasQuota("standardFSv2Family", corev1beta1.CapacityTypeOnDemand, 2)).To(BeTrue())
+	})
+	It("should check on-demand VMs against the regional and the family quota", func() {
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 8)).To(BeTrue())
+		// 10 vCPUs left in both
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 10)).To(BeTrue())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 16)).To(BeFalse())
+		// no family quota at all
+		Expect(quotaProvider.HasQuota("standardFSv2Family", corev1beta1.CapacityTypeOnDemand, 2)).To(BeFalse())
+		// family without a usage is only held against the regional quota
+		Expect(quotaProvider.HasQuota("standardEASv4Family", corev1beta1.CapacityTypeOnDemand, 8)).To(BeTrue())
+		Expect(quotaProvider.HasQuota("standardEASv4Family", corev1beta1.CapacityTypeOnDemand, 16)).To(BeFalse())
+	})
+	It("should check spot VMs against the low priority quota only", func() {
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		Expect(quotaProvider.HasQuota("standardFSv2Family", corev1beta1.CapacityTypeSpot, 8)).To(BeTrue())
+		Expect(quotaProvider.HasQuota("standardFSv2Family", corev1beta1.CapacityTypeSpot, 16)).To(BeFalse())
+	})
+	It("should hold launches in flight against the quota", func() {
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		release := quotaProvider.Reserve("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 8)
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 4)).To(BeFalse())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 2)).To(BeTrue())
+		// spot launches are held against a different quota
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeSpot, 8)).To(BeTrue())
+		release(false)
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 10)).To(BeTrue())
+	})
+	It("should hold created VMs against the quota until the next update", func() {
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		release := quotaProvider.Reserve("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 8)
+		release(true)
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 4)).To(BeFalse())
+
+		// the usages now account for the created VM
+		fakeUsageAPI.Usages.Reset()
+		fakeUsageAPI.Usages.Append(
+			fake.NewUsage(quota.RegionalVCPUsUsageName, 98, 100),
+			fake.NewUsage("standardDSv3Family", 18, 20),
+		)
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 2)).To(BeTrue())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 4)).To(BeFalse())
+	})
+	It("should change the sequence number when offerings run out of quota or have enough again", func() {
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 8)).To(BeTrue())
+		seqNum := quotaProvider.SeqNum()
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		// 10 vCPUs left
+		Expect(quotaProvider.SeqNum()).To(Equal(seqNum))
+
+		release := quotaProvider.Reserve("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 4)
+		Expect(quotaProvider.SeqNum()).ToNot(Equal(seqNum))
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 8)).To(BeFalse())
+
+		seqNum = quotaProvider.SeqNum()
+		release(false)
+		Expect(quotaProvider.SeqNum()).ToNot(Equal(seqNum))
+	})
+	It("should not change the sequence number for launches which do not change whether there is enough quota", func() {
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 2)).To(BeTrue())
+		Expect(quotaProvider.HasQuota("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 16)).To(BeFalse())
+		seqNum := quotaProvider.SeqNum()
+
+		release := quotaProvider.Reserve("standardDSv3Family", corev1beta1.CapacityTypeOnDemand, 2)
+		Expect(quotaProvider.SeqNum()).To(Equal(seqNum))
+		release(true)
+		Expect(quotaProvider.SeqNum()).To(Equal(seqNum))
+		// spot launches are held against a different quota
+		quotaProvider.Reserve("standardDSv3Family", corev1beta1.CapacityTypeSpot, 8)(false)
+		Expect(quotaProvider.SeqNum()).To(Equal(seqNum))
+	})
+	It("should expose the remaining vCPU quota", func() {
+		Expect(quotaProvider.Update(ctx)).To(Succeed())
+		Expect(testutil.ToFloat64(metrics.VCPUQuotaRemaining.WithLabelValues(quota.RegionalVCPUsUsageName))).To(BeNumerically("==", 10))
+		Expect(testutil.ToFloat64(metrics.VCPUQuotaRemaining.WithLabelValues(quota.LowPriorityVCPUsUsageName))).To(BeNumerically("==", 8))
+		Expect(testutil.ToFloat64(metrics.VCPUQuotaRemaining.WithLabelValues("standardDSv3Family"))).To(BeNumerically("==", 10))
+		Expect(testutil.CollectAndCount(metrics.VCPUQuotaRemaining)).To(Equal(4)) // availabilitySets is not a vCPU quota
+	})
+})
@@ -0,0 +1,212 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spotadvisor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+	"github.com/samber/lo"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+)
+
+// evictionRatesUpdatePeriod is how often the spot eviction rates are read after the initial update.
+// Azure Resource Graph refreshes them a few times a day.
+const evictionRatesUpdatePeriod = time.Hour
+
+// unknownPriceWeight is the spot price weight of instance types without a published eviction rate
+const unknownPriceWeight = 1.1
+
+// priceWeights are what the spot price of an instance type is multiplied with under the PriceCapacityOptimized strategy,
+// by the lower bound of its eviction rate bucket: an instance type evicted less than 5% of the time is preferred over one
+// evicted 20% or more of the time, unless the latter is at least 20% cheaper.
+var priceWeights = map[int]float64{
+	0:  1.0,
+	5:  1.05,
+	10: 1.1,
+	15: 1.15,
+	20: 1.25,
+}
+
+// ResourceGraphAPI is the subset of the Azure Resource Graph client used to query the SpotResources table
+type ResourceGraphAPI interface {
+	Resources(ctx context.Context, query armresourcegraph.QueryRequest, options *armresourcegraph.ClientResourcesOptions) (armresourcegraph.ClientResourcesResponse, error)
+}
+
+// Provider tracks the spot eviction rates of the instance types in the region, which Azure Resource Graph publishes
+// as buckets, e.g. 0-5, 5-10 and 20+ percent. Rates are identified by the lower bound of their bucket.
+// Until the first successful update, or for instance types without a published rate, the rate is unknown.
+type Provider struct {
+	arg            ResourceGraphAPI
+	subscriptionID string
+	region         string
+	cm             *pretty.ChangeMonitor
+
+	mu            sync.RWMutex
+	evictionRates map[string]int // lower bound of the bucket in percent, by lowercase instance type
+	seqNum        uint64
+}
+
+func NewProvider(ctx context.Context, arg ResourceGraphAPI, subscriptionID, region string, startAsync <-chan struct{}) *Provider {
+	p := &Provider{
+		arg:            arg,
+		subscriptionID: subscriptionID,
+		region:         region,
+		cm:             pretty.NewChangeMonitor(),
+		evictionRates:  map[string]int{},
+	}
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).Named("spotadvisor"))
+
+	go func() {
+		// only the leader launches instances, wait for leader election or to be signaled to exit
+		select {
+		case <-startAsync:
+		case <-ctx.Done():
+			return
+		}
+		for {
+			if err := p.Update(ctx); err != nil {
+				logging.FromContext(ctx).Errorf("updating spot eviction rates for region %s, using the existing eviction rates, %s", p.region, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(evictionRatesUpdatePeriod):
+			}
+		}
+	}()
+	return p
+}
+
+// EvictionRatesQuery is the Azure Resource Graph query of the spot eviction rates of the instance types in a region
+func EvictionRatesQuery(region string) string {
+	return fmt.Sprintf(`SpotResources
+| where type =~ 'microsoft.compute/skuspotevictionrate/location'
+| where location =~ '%s'
+| project skuName = tostring(sku.name), evictionRate = tostring(properties.evictionRate)`, region)
+}
+
+// Update reads the spot eviction rates of the instance types in the region
+func (p *Provider) Update(ctx context.Context) error {
+	query := EvictionRatesQuery(p.region)
+	req := armresourcegraph.QueryRequest{
+		Query:         &query,
+		Options:       &armresourcegraph.QueryRequestOptions{ResultFormat: lo.ToPtr(armresourcegraph.ResultFormatObjectArray)},
+		Subscriptions: []*string{&p.subscriptionID},
+	}
+	evictionRates := map[string]int{}
+	for {
+		resp, err := p.arg.Resources(ctx, req, nil)
+		if err != nil {
+			return fmt.Errorf("querying spot eviction rates, %w", err)
+		}
+		rows, ok := resp.Data.([]interface{})
+		if !ok {
+			return fmt.Errorf("type casting query response as interface array failed")
+		}
+		for _, row := range rows {
+			resource, ok := row.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			skuName, _ := resource["skuName"].(string)
+			bucket, _ := resource["evictionRate"].(string)
+			rate, err := ParseEvictionRate(bucket)
+			if skuName == "" || err != nil {
+				logging.FromContext(ctx).Debugf("ignoring spot eviction rate %q of instance type %q, %s", bucket, skuName, err)
+				continue
+			}
+			evictionRates[strings.ToLower(skuName)] = rate
+		}
+		if resp.SkipToken == nil {
+			break
+		}
+		req.Options.SkipToken = resp.SkipToken
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !maps.Equal(p.evictionRates, evictionRates) {
+		p.seqNum++
+	}
+	p.evictionRates = evictionRates
+	metrics.SpotEvictionRate.Reset()
+	for instanceType, rate := range evictionRates {
+		metrics.SpotEvictionRate.WithLabelValues(instanceType).Set(float64(rate))
+	}
+	if p.cm.HasChanged("evictionRates", evictionRates) {
+		logging.FromContext(ctx).With("instance-types", len(evictionRates)).Debugf("updated spot eviction rates")
+	}
+	return nil
+}
+
+// ParseEvictionRate returns the lower bound, in percent, of an eviction rate bucket, e.g. 5 for 5-10 and 20 for 20+
+func ParseEvictionRate(bucket string) (int, error) {
+	lower, _, _ := strings.Cut(strings.TrimSuffix(bucket, "+"), "-")
+	rate, err := strconv.Atoi(strings.TrimSpace(lower))
+	if err != nil || rate < 0 || rate > 100 {
+		return 0, fmt.Errorf("invalid eviction rate bucket %q", bucket)
+	}
+	return rate, nil
+}
+
+// EvictionRate returns the lower bound, in percent, of the spot eviction rate bucket of the instance type,
+// and whether it is known
+func (p *Provider) EvictionRate(instanceType string) (int, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	rate, ok := p.evictionRates[strings.ToLower(instanceType)]
+	return rate, ok
+}
+
+// PriceWeight returns what the spot price of the instance type is multiplied with when choosing among instance types
+// with the PriceCapacityOptimized strategy, so that instance types with lower eviction rates are preferred
+// unless they are notably more expensive
+func (p *Provider) PriceWeight(instanceType string) float64 {
+	rate, ok := p.EvictionRate(instanceType)
+	if !ok {
+		return unknownPriceWeight
+	}
+	if weight, ok := priceWeights[rate]; ok {
+		return weight
+	}
+	return unknownPriceWeight
+}
+
+// SeqNum changes whenever the eviction rates change
+func (p *Provider) SeqNum() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.seqNum
+}
+
+// Reset forgets the eviction rates, for tests
+func (p *Provider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictionRates = map[string]int{}
+	p.seqNum++
+}
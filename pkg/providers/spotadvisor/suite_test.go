@@ -0,0 +1,145 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spotadvisor_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "knative.dev/pkg/logging/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotadvisor"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+
+var fakeAzureResourceGraphAPI *fake.AzureResourceGraphAPI
+var spotAdvisor *spotadvisor.Provider
+
+func TestAzure(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Providers/SpotAdvisor/Azure")
+}
+
+var _ = BeforeSuite(func() {
+	ctx, stop = context.WithCancel(ctx)
+
+	fakeAzureResourceGraphAPI = &fake.AzureResourceGraphAPI{}
+	spotAdvisor = spotadvisor.NewProvider(ctx, fakeAzureResourceGraphAPI, "test-subscription", fake.Region, make(chan struct{}))
+})
+
+var _ = AfterSuite(func() {
+	stop()
+})
+
+var _ = BeforeEach(func() {
+	fakeAzureResourceGraphAPI.Reset()
+	spotAdvisor.Reset()
+})
+
+var _ = Describe("SpotAdvisor", func() {
+	BeforeEach(func() {
+		fakeAzureResourceGraphAPI.SpotEvictionRates.Store("Standard_D2s_v3", "0-5")
+		fakeAzureResourceGraphAPI.SpotEvictionRates.Store("Standard_D4s_v3", "10-15")
+		fakeAzureResourceGraphAPI.SpotEvictionRates.Store("Standard_F16s_v2", "20+")
+		fakeAzureResourceGraphAPI.SpotEvictionRates.Store("Standard_NC6s_v3", "unknown")
+	})
+	It("should not know any eviction rate before the first update", func() {
+		_, ok := spotAdvisor.EvictionRate("Standard_D2s_v3")
+		Expect(ok).To(BeFalse())
+	})
+	It("should query the eviction rates of the region", func() {
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		input := fakeAzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.CalledWithInput.Pop()
+		Expect(*input.Query.Query).To(Equal(spotadvisor.EvictionRatesQuery(fake.Region)))
+		Expect(input.Query.Subscriptions).To(HaveLen(1))
+		Expect(*input.Query.Subscriptions[0]).To(Equal("test-subscription"))
+	})
+	It("should identify eviction rates by the lower bound of their bucket", func() {
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		for instanceType, expected := range map[string]int{"Standard_D2s_v3": 0, "Standard_D4s_v3": 10, "Standard_F16s_v2": 20} {
+			rate, ok := spotAdvisor.EvictionRate(instanceType)
+			Expect(ok).To(BeTrue(), instanceType)
+			Expect(rate).To(Equal(expected), instanceType)
+		}
+		// invalid buckets are ignored
+		_, ok := spotAdvisor.EvictionRate("Standard_NC6s_v3")
+		Expect(ok).To(BeFalse())
+	})
+	It("should keep the existing eviction rates when the query fails", func() {
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		fakeAzureResourceGraphAPI.AzureResourceGraphResourcesBehavior.Error.Set(fmt.Errorf("failed"))
+		Expect(spotAdvisor.Update(ctx)).ToNot(Succeed())
+		rate, ok := spotAdvisor.EvictionRate("Standard_D4s_v3")
+		Expect(ok).To(BeTrue())
+		Expect(rate).To(Equal(10))
+	})
+	It("should weigh spot prices more the higher the eviction rate", func() {
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		Expect(spotAdvisor.PriceWeight("Standard_D2s_v3")).To(Equal(1.0))
+		Expect(spotAdvisor.PriceWeight("Standard_D4s_v3")).To(BeNumerically(">", spotAdvisor.PriceWeight("Standard_D2s_v3")))
+		Expect(spotAdvisor.PriceWeight("Standard_F16s_v2")).To(BeNumerically(">", spotAdvisor.PriceWeight("Standard_D4s_v3")))
+		// unknown eviction rates are weighed in between
+		Expect(spotAdvisor.PriceWeight("Standard_NC6s_v3")).To(BeNumerically(">", spotAdvisor.PriceWeight("Standard_D2s_v3")))
+		Expect(spotAdvisor.PriceWeight("Standard_NC6s_v3")).To(BeNumerically("<", spotAdvisor.PriceWeight("Standard_F16s_v2")))
+	})
+	It("should change the sequence number when the eviction rates change", func() {
+		seqNum := spotAdvisor.SeqNum()
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		Expect(spotAdvisor.SeqNum()).ToNot(Equal(seqNum))
+
+		seqNum = spotAdvisor.SeqNum()
+		fakeAzureResourceGraphAPI.SpotEvictionRates.Store("Standard_D2s_v3", "5-10")
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		Expect(spotAdvisor.SeqNum()).ToNot(Equal(seqNum))
+	})
+	It("should not change the sequence number when the eviction rates are unchanged", func() {
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		seqNum := spotAdvisor.SeqNum()
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		Expect(spotAdvisor.SeqNum()).To(Equal(seqNum))
+	})
+	It("should expose the eviction rates", func() {
+		Expect(spotAdvisor.Update(ctx)).To(Succeed())
+		Expect(testutil.ToFloat64(metrics.SpotEvictionRate.WithLabelValues("standard_f16s_v2"))).To(Equal(20.0))
+		Expect(testutil.ToFloat64(metrics.SpotEvictionRate.WithLabelValues("standard_d4s_v3"))).To(Equal(10.0))
+	})
+	DescribeTable("should parse eviction rate buckets",
+		func(bucket string, expected int, valid bool) {
+			rate, err := spotadvisor.ParseEvictionRate(bucket)
+			if !valid {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rate).To(Equal(expected))
+		},
+		Entry("0-5", "0-5", 0, true),
+		Entry("15-20", "15-20", 15, true),
+		Entry("20+", "20+", 20, true),
+		Entry("empty", "", 0, false),
+		Entry("not a bucket", "low", 0, false),
+	)
+})
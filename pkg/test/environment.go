@@ -30,6 +30,8 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/pricing"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/quota"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/spotadvisor"
 	"github.com/patrickmn/go-cache"
 	corev1 "k8s.io/api/core/v1"
 	"knative.dev/pkg/ptr"
@@ -58,7 +60,10 @@ type Environment struct {
 	CommunityImageVersionsAPI   *fake.CommunityGalleryImageVersionsAPI
 	MockSkuClientSignalton      *fake.MockSkuClientSingleton
 	PricingAPI                  *fake.PricingAPI
+	UsageAPI                    *fake.UsageAPI
 	LoadBalancersAPI            *fake.LoadBalancersAPI
+	SubnetsAPI                  *fake.SubnetsAPI
+	DisksAPI                    *fake.DisksAPI
 
 	// Cache
 	KubernetesVersionCache    *cache.Cache
@@ -70,6 +75,8 @@ type Environment struct {
 	InstanceTypesProvider  *instancetype.Provider
 	InstanceProvider       *instance.Provider
 	PricingProvider        *pricing.Provider
+	QuotaProvider          *quota.Provider
+	SpotAdvisor            *spotadvisor.Provider
 	ImageProvider          *imagefamily.Provider
 	ImageResolver          *imagefamily.Resolver
 	LaunchTemplateProvider *launchtemplate.Provider
@@ -99,6 +106,9 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 	skuClientSingleton := &fake.MockSkuClientSingleton{SKUClient: &fake.ResourceSKUsAPI{Location: region}}
 	communityImageVersionsAPI := &fake.CommunityGalleryImageVersionsAPI{}
 	loadBalancersAPI := &fake.LoadBalancersAPI{}
+	subnetsAPI := &fake.SubnetsAPI{}
+	disksAPI := &fake.DisksAPI{}
+	usageAPI := &fake.UsageAPI{}
 
 	// Cache
 	kubernetesVersionCache := cache.New(azurecache.KubernetesVersionTTL, azurecache.DefaultCleanupInterval)
@@ -107,10 +117,12 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 	unavailableOfferingsCache := azurecache.NewUnavailableOfferings()
 
 	// Providers
-	pricingProvider := pricing.NewProvider(ctx, pricingAPI, region, make(chan struct{}))
+	pricingProvider := pricing.NewProvider(ctx, pricingAPI, nil, region, "", make(chan struct{}))
+	quotaProvider := quota.NewProvider(ctx, usageAPI, region, make(chan struct{}))
+	spotAdvisor := spotadvisor.NewProvider(ctx, azureResourceGraphAPI, "test-subscription", region, make(chan struct{}))
 	imageFamilyProvider := imagefamily.NewProvider(env.KubernetesInterface, kubernetesVersionCache, communityImageVersionsAPI, region)
 	imageFamilyResolver := imagefamily.New(env.Client, imageFamilyProvider)
-	instanceTypesProvider := instancetype.NewProvider(region, instanceTypeCache, skuClientSingleton, pricingProvider, unavailableOfferingsCache)
+	instanceTypesProvider := instancetype.NewProvider(region, instanceTypeCache, skuClientSingleton, pricingProvider, quotaProvider, spotAdvisor, unavailableOfferingsCache)
 	launchTemplateProvider := launchtemplate.NewProvider(
 		ctx,
 		imageFamilyResolver,
@@ -137,12 +149,18 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		loadBalancersAPI,
 		communityImageVersionsAPI,
 		skuClientSingleton,
+		subnetsAPI,
+		disksAPI,
+		usageAPI,
 	)
 	instanceProvider := instance.NewProvider(
 		azClient,
 		instanceTypesProvider,
 		launchTemplateProvider,
 		loadBalancerProvider,
+		quotaProvider,
+		pricingProvider,
+		spotAdvisor,
 		unavailableOfferingsCache,
 		region,
 		resourceGroup,
@@ -156,8 +174,11 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		VirtualMachineExtensionsAPI: virtualMachinesExtensionsAPI,
 		NetworkInterfacesAPI:        networkInterfacesAPI,
 		LoadBalancersAPI:            loadBalancersAPI,
+		SubnetsAPI:                  subnetsAPI,
+		DisksAPI:                    disksAPI,
 		MockSkuClientSignalton:      skuClientSingleton,
 		PricingAPI:                  pricingAPI,
+		UsageAPI:                    usageAPI,
 
 		KubernetesVersionCache:    kubernetesVersionCache,
 		InstanceTypeCache:         instanceTypeCache,
@@ -167,6 +188,8 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		InstanceTypesProvider:  instanceTypesProvider,
 		InstanceProvider:       instanceProvider,
 		PricingProvider:        pricingProvider,
+		QuotaProvider:          quotaProvider,
+		SpotAdvisor:            spotAdvisor,
 		ImageProvider:          imageFamilyProvider,
 		ImageResolver:          imageFamilyResolver,
 		LaunchTemplateProvider: launchTemplateProvider,
@@ -182,10 +205,17 @@ func (env *Environment) Reset() {
 	env.VirtualMachineExtensionsAPI.Reset()
 	env.NetworkInterfacesAPI.Reset()
 	env.LoadBalancersAPI.Reset()
+	env.SubnetsAPI.Reset()
+	env.DisksAPI.Reset()
 	env.CommunityImageVersionsAPI.Reset()
 	env.MockSkuClientSignalton.Reset()
 	env.PricingAPI.Reset()
+	env.UsageAPI.Reset()
 	env.PricingProvider.Reset()
+	env.QuotaProvider.Reset()
+	env.SpotAdvisor.Reset()
+	env.InstanceProvider.Reset()
+	env.InstanceTypesProvider.SetOverheadSettings(nil)
 
 	env.KubernetesVersionCache.Flush()
 	env.InstanceTypeCache.Flush()
@@ -26,16 +26,33 @@ import (
 )
 
 type OptionsFields struct {
-	ClusterName                    *string
-	ClusterEndpoint                *string
-	ClusterID                      *string
-	KubeletClientTLSBootstrapToken *string
-	SSHPublicKey                   *string
-	NetworkPlugin                  *string
-	NetworkPolicy                  *string
-	VMMemoryOverheadPercent        *float64
-	NodeIdentities                 []string
-	SubnetID                       *string
+	ClusterName                      *string
+	ClusterEndpoint                  *string
+	ClusterID                        *string
+	KubeletClientTLSBootstrapToken   *string
+	SSHPublicKey                     *string
+	NetworkPlugin                    *string
+	NetworkPluginMode                *string
+	NetworkPolicy                    *string
+	VMMemoryOverheadPercent          *float64
+	NodeIdentities                   []string
+	SubnetID                         *string
+	PodSubnetID                      *string
+	KubeReservedPolicy               *string
+	KubeReservedMemoryBrackets       []azoptions.TaxBracket
+	KubeReservedCPUBrackets          []azoptions.TaxBracket
+	VMMemoryOverheadPercentOverrides map[string]float64
+	InstanceTypesInclude             []string
+	InstanceTypesExclude             []string
+	SKUFamiliesInclude               []string
+	SKUFamiliesExclude               []string
+	AllowBurstableInstanceTypes      *bool
+	AllowConstrainedCPUInstanceTypes *bool
+	PricingAPIURL                    *string
+	PricingCurrency                  *string
+	MaxLaunchAttempts                *int
+	VMCreationMode                   *string
+	AsyncVMCreation                  *bool
 }
 
 func Options(overrides ...OptionsFields) *azoptions.Options {
@@ -46,15 +63,32 @@ func Options(overrides ...OptionsFields) *azoptions.Options {
 		}
 	}
 	return &azoptions.Options{
-		ClusterName:                    lo.FromPtrOr(options.ClusterName, "test-cluster"),
-		ClusterEndpoint:                lo.FromPtrOr(options.ClusterEndpoint, "https://test-cluster"),
-		ClusterID:                      lo.FromPtrOr(options.ClusterID, "00000000"),
-		KubeletClientTLSBootstrapToken: lo.FromPtrOr(options.KubeletClientTLSBootstrapToken, "test-token"),
-		SSHPublicKey:                   lo.FromPtrOr(options.SSHPublicKey, "test-ssh-public-key"),
-		NetworkPlugin:                  lo.FromPtrOr(options.NetworkPlugin, "azure"),
-		NetworkPolicy:                  lo.FromPtrOr(options.NetworkPolicy, "cilium"),
-		VMMemoryOverheadPercent:        lo.FromPtrOr(options.VMMemoryOverheadPercent, 0.075),
-		NodeIdentities:                 options.NodeIdentities,
-		SubnetID:                       lo.FromPtrOr(options.SubnetID, "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
+		ClusterName:                      lo.FromPtrOr(options.ClusterName, "test-cluster"),
+		ClusterEndpoint:                  lo.FromPtrOr(options.ClusterEndpoint, "https://test-cluster"),
+		ClusterID:                        lo.FromPtrOr(options.ClusterID, "00000000"),
+		KubeletClientTLSBootstrapToken:   lo.FromPtrOr(options.KubeletClientTLSBootstrapToken, "test-token"),
+		SSHPublicKey:                     lo.FromPtrOr(options.SSHPublicKey, "test-ssh-public-key"),
+		NetworkPlugin:                    lo.FromPtrOr(options.NetworkPlugin, "azure"),
+		NetworkPluginMode:                lo.FromPtrOr(options.NetworkPluginMode, azoptions.NetworkPluginModeOverlay),
+		NetworkPolicy:                    lo.FromPtrOr(options.NetworkPolicy, "cilium"),
+		VMMemoryOverheadPercent:          lo.FromPtrOr(options.VMMemoryOverheadPercent, 0.075),
+		NodeIdentities:                   options.NodeIdentities,
+		SubnetID:                         lo.FromPtrOr(options.SubnetID, "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
+		PodSubnetID:                      lo.FromPtrOr(options.PodSubnetID, ""),
+		KubeReservedPolicy:               lo.FromPtrOr(options.KubeReservedPolicy, azoptions.KubeReservedPolicyAKSLegacy),
+		KubeReservedMemoryBrackets:       options.KubeReservedMemoryBrackets,
+		KubeReservedCPUBrackets:          options.KubeReservedCPUBrackets,
+		VMMemoryOverheadPercentOverrides: options.VMMemoryOverheadPercentOverrides,
+		InstanceTypesInclude:             options.InstanceTypesInclude,
+		InstanceTypesExclude:             options.InstanceTypesExclude,
+		SKUFamiliesInclude:               options.SKUFamiliesInclude,
+		SKUFamiliesExclude:               options.SKUFamiliesExclude,
+		AllowBurstableInstanceTypes:      lo.FromPtrOr(options.AllowBurstableInstanceTypes, true),
+		AllowConstrainedCPUInstanceTypes: lo.FromPtrOr(options.AllowConstrainedCPUInstanceTypes, false),
+		PricingAPIURL:                    lo.FromPtrOr(options.PricingAPIURL, ""),
+		PricingCurrency:                  lo.FromPtrOr(options.PricingCurrency, "USD"),
+		MaxLaunchAttempts:                lo.FromPtrOr(options.MaxLaunchAttempts, 3),
+		VMCreationMode:                   lo.FromPtrOr(options.VMCreationMode, azoptions.VMCreationModeLegacy),
+		AsyncVMCreation:                  lo.FromPtrOr(options.AsyncVMCreation, false),
 	}
 }
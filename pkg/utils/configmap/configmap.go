@@ -0,0 +1,53 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configmap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"knative.dev/pkg/system"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// PollPeriod is how often the ConfigMaps are read again, so how long a change takes to be applied
+const PollPeriod = time.Minute
+
+// Poll reads the ConfigMap of the name in the namespace of Karpenter and calls apply with it, or with nil when there is
+// none, then requeues after PollPeriod. An error of apply is returned, so that it is retried with backoff.
+//
+// The reader must be uncached, e.g. the API reader of the manager: the cache of the manager is not restricted to a
+// namespace, so reading a ConfigMap through it would list and watch the ConfigMaps of all namespaces, while Karpenter
+// may only list and watch those of its own namespace. Reading the ConfigMap periodically avoids setting up an informer
+// of its own for a ConfigMap that rarely changes.
+func Poll(ctx context.Context, kubeReader client.Reader, name string, apply func(configMap *v1.ConfigMap) error) (reconcile.Result, error) {
+	configMap := &v1.ConfigMap{}
+	if err := kubeReader.Get(ctx, client.ObjectKey{Namespace: system.Namespace(), Name: name}, configMap); err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("getting configmap %s, %w", name, err)
+		}
+		configMap = nil
+	}
+	if err := apply(configMap); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: PollPeriod}, nil
+}
@@ -0,0 +1,82 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configmap_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/system"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/utils/configmap"
+)
+
+var ctx context.Context
+
+func TestConfigMap(t *testing.T) {
+	ctx = context.Background()
+	t.Setenv(system.NamespaceEnvKey, "karpenter")
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Utils/ConfigMap")
+}
+
+var _ = Describe("Poll", func() {
+	var kubeReader client.Client
+	var applied []*v1.ConfigMap
+	apply := func(configMap *v1.ConfigMap) error {
+		applied = append(applied, configMap)
+		return nil
+	}
+
+	BeforeEach(func() {
+		kubeReader = fake.NewClientBuilder().Build()
+		applied = nil
+	})
+
+	It("should apply the ConfigMap of the namespace of Karpenter and requeue", func() {
+		Expect(kubeReader.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "karpenter", Name: "settings"},
+			Data:       map[string]string{"key": "value"},
+		})).To(Succeed())
+		result, err := configmap.Poll(ctx, kubeReader, "settings", apply)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(configmap.PollPeriod))
+		Expect(applied).To(HaveLen(1))
+		Expect(applied[0].Data).To(Equal(map[string]string{"key": "value"}))
+	})
+	It("should apply nil when there is no ConfigMap in the namespace of Karpenter", func() {
+		Expect(kubeReader.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "settings"},
+		})).To(Succeed())
+		result, err := configmap.Poll(ctx, kubeReader, "settings", apply)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(configmap.PollPeriod))
+		Expect(applied).To(ConsistOf(BeNil()))
+	})
+	It("should return the error of apply, without requeueing after the poll period", func() {
+		result, err := configmap.Poll(ctx, kubeReader, "settings", func(*v1.ConfigMap) error { return fmt.Errorf("invalid") })
+		Expect(err).To(MatchError("invalid"))
+		Expect(result.RequeueAfter).To(BeZero())
+	})
+})
@@ -0,0 +1,121 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ccp_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/samber/lo"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "knative.dev/pkg/logging/testing"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+	"github.com/Azure/karpenter-provider-azure/pkg/webhooks/ccp"
+)
+
+var ctx context.Context
+var validationWebhook *webhook.Admission
+
+func TestCCP(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Webhooks/CCP")
+}
+
+var _ = BeforeSuite(func() {
+	lo.Must0(apis.AddToScheme(scheme.Scheme))
+	validationWebhook = ccp.NewValidationWebhook()
+})
+
+func request(operation admissionv1.Operation, obj runtime.Object) admission.Request {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		Object:    runtime.RawExtension{Raw: lo.Must(json.Marshal(obj))},
+	}}
+}
+
+func v1alpha2NodeClass(imageFamily string, imageVersion string) *v1alpha2.AKSNodeClass {
+	return &v1alpha2.AKSNodeClass{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: "AKSNodeClass"},
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: v1alpha2.AKSNodeClassSpec{
+			ImageFamily:  lo.ToPtr(imageFamily),
+			ImageVersion: lo.EmptyableToPtr(imageVersion),
+		},
+	}
+}
+
+var _ = Describe("Validation", func() {
+	It("should allow a valid AKSNodeClass", func() {
+		resp := validationWebhook.Handle(ctx, request(admissionv1.Create, v1alpha2NodeClass(v1alpha2.Ubuntu2204ImageFamily, "")))
+		Expect(resp.Allowed).To(BeTrue())
+	})
+	It("should deny an AKSNodeClass breaking a rule of Validate", func() {
+		nodeClass := v1alpha2NodeClass(v1alpha2.Ubuntu2204ImageFamily, "")
+		nodeClass.Spec.Tags = map[string]string{"team<": "a"}
+		resp := validationWebhook.Handle(ctx, request(admissionv1.Create, nodeClass))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("tags"))
+	})
+	It("should deny an update of an AKSNodeClass breaking a rule of Validate", func() {
+		nodeClass := v1alpha2NodeClass(v1alpha2.Ubuntu2204ImageFamily, "")
+		nodeClass.Spec.Tags = map[string]string{"team<": "a"}
+		resp := validationWebhook.Handle(ctx, request(admissionv1.Update, nodeClass))
+		Expect(resp.Allowed).To(BeFalse())
+	})
+	It("should allow the deletion of an AKSNodeClass", func() {
+		resp := validationWebhook.Handle(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Delete,
+			Kind:      metav1.GroupVersionKind{Group: v1alpha2.SchemeGroupVersion.Group, Version: "v1alpha2", Kind: "AKSNodeClass"},
+		}})
+		Expect(resp.Allowed).To(BeTrue())
+	})
+	It("should validate v1beta1 AKSNodeClasses", func() {
+		nodeClass := &v1beta1.AKSNodeClass{
+			TypeMeta:   metav1.TypeMeta{APIVersion: v1beta1.SchemeGroupVersion.String(), Kind: "AKSNodeClass"},
+			ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Spec: v1beta1.AKSNodeClassSpec{
+				ImageFamily: lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily),
+				Tags:        map[string]string{"team<": "a"},
+			},
+		}
+		resp := validationWebhook.Handle(ctx, request(admissionv1.Create, nodeClass))
+		Expect(resp.Allowed).To(BeFalse())
+	})
+	It("should reject an unknown kind", func() {
+		resp := validationWebhook.Handle(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Kind:      metav1.GroupVersionKind{Group: v1alpha2.SchemeGroupVersion.Group, Version: "v1alpha2", Kind: "Unknown"},
+		}})
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Code).To(BeEquivalentTo(400))
+	})
+})
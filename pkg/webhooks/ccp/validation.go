@@ -0,0 +1,82 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ccp serves the validating webhook of AKSNodeClasses in AKS managed mode (ccp), from the webhook server of
+// the controller-runtime manager. The webhooks of pkg/webhooks are built on knative, which registers informers in
+// init() for cluster-scoped resources (webhook configurations, CRDs) that are not granted in AKS managed mode, and
+// manages its own certificates and webhook configurations. This webhook does neither: its serving certificate is
+// mounted in the certificate directory of the webhook server, and its ValidatingWebhookConfiguration is deployed
+// with Karpenter.
+package ccp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"knative.dev/pkg/apis"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// ValidationPath is the path the webhook is served at, the same as the validating webhook of pkg/webhooks
+const ValidationPath = "/validate/karpenter.azure.com"
+
+type validatable interface {
+	runtime.Object
+	Validate(context.Context) *apis.FieldError
+}
+
+// resources are the kinds the webhook validates, with the rules of AKSNodeClass.Validate
+var resources = map[schema.GroupVersionKind]func() validatable{
+	v1alpha2.SchemeGroupVersion.WithKind("AKSNodeClass"): func() validatable { return &v1alpha2.AKSNodeClass{} },
+	v1beta1.SchemeGroupVersion.WithKind("AKSNodeClass"):  func() validatable { return &v1beta1.AKSNodeClass{} },
+}
+
+// NewValidationWebhook returns the validating webhook of AKSNodeClasses, to be registered at ValidationPath
+func NewValidationWebhook() *webhook.Admission {
+	return &webhook.Admission{Handler: &validator{decoder: admission.NewDecoder(scheme.Scheme)}}
+}
+
+type validator struct {
+	decoder *admission.Decoder
+}
+
+func (v *validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	// the same verbs as AKSNodeClass.SupportedVerbs
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	newResource, ok := resources[schema.GroupVersionKind(req.Kind)]
+	if !ok {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("unhandled kind %v", req.Kind))
+	}
+	resource := newResource()
+	if err := v.decoder.Decode(req, resource); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := resource.Validate(ctx); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
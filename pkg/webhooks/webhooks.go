@@ -0,0 +1,77 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	knativeinjection "knative.dev/pkg/injection"
+	"knative.dev/pkg/webhook/resourcesemantics"
+	"knative.dev/pkg/webhook/resourcesemantics/conversion"
+	"knative.dev/pkg/webhook/resourcesemantics/validation"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1beta1"
+)
+
+// Resources are validated by the webhook in addition to the CEL rules of their CRDs.
+// In AKS managed mode (ccp), where the informers of knative need cluster-scoped roles that are not granted,
+// the same resources are validated by the webhook of pkg/webhooks/ccp instead.
+var Resources = map[schema.GroupVersionKind]resourcesemantics.GenericCRD{
+	v1alpha2.SchemeGroupVersion.WithKind("AKSNodeClass"): &v1alpha2.AKSNodeClass{},
+	v1beta1.SchemeGroupVersion.WithKind("AKSNodeClass"):  &v1beta1.AKSNodeClass{},
+}
+
+// ConversionResources are converted between their served versions through their hub version.
+var ConversionResources = map[schema.GroupKind]conversion.GroupKindConversion{
+	v1beta1.SchemeGroupVersion.WithKind("AKSNodeClass").GroupKind(): {
+		DefinitionName: "aksnodeclasses.karpenter.azure.com",
+		HubVersion:     v1beta1.SchemeGroupVersion.Version,
+		Zygotes: map[string]conversion.ConvertibleObject{
+			v1alpha2.SchemeGroupVersion.Version: &v1alpha2.AKSNodeClass{},
+			v1beta1.SchemeGroupVersion.Version:  &v1beta1.AKSNodeClass{},
+		},
+	},
+}
+
+func NewWebhooks() []knativeinjection.ControllerConstructor {
+	return []knativeinjection.ControllerConstructor{
+		NewCRDValidationWebhook,
+		NewCRDConversionWebhook,
+	}
+}
+
+func NewCRDValidationWebhook(ctx context.Context, _ configmap.Watcher) *controller.Impl {
+	return validation.NewAdmissionController(ctx,
+		"validation.webhook.karpenter.azure.com",
+		"/validate/karpenter.azure.com",
+		Resources,
+		func(ctx context.Context) context.Context { return ctx },
+		true,
+	)
+}
+
+func NewCRDConversionWebhook(ctx context.Context, _ configmap.Watcher) *controller.Impl {
+	return conversion.NewConversionController(ctx,
+		"/conversion/karpenter.azure.com",
+		ConversionResources,
+		func(ctx context.Context) context.Context { return ctx },
+	)
+}